@@ -0,0 +1,330 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/somnro/Go-Download-Static-Files/fileserver"
+)
+
+// 子命令：不需要启动服务的工具（打包目录、计算校验和、生成分享链接）不用再带一长串服务参数。
+// 不写子命令、或者第一个参数是选项时等同于 serve，以前的用法不受影响
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+// commands 在 init 中赋值，completion 子命令本身也要读取这个列表
+var commands []command
+
+func init() {
+	commands = []command{
+		{"serve", "Serve files over HTTP (default when no command is given)", func(args []string) error { serve(args); return nil }},
+		{"sync", "Download new and changed files from another instance into a local directory", runSync},
+		{"zip", "Pack a directory into a zip file", runZip},
+		{"hash", "Print checksums of files, like sha256sum", runHash},
+		{"dedupe", "Hard-link files with identical content in a directory served with -dedupe", runDedupe},
+		{"share", "Print a share link for a file, without starting the server", runShare},
+		{"users", "Add, change, remove or list users in the -users user store", runUsers},
+		{"completion", "Print a shell completion script for bash, zsh, fish or powershell", runCompletion},
+		{"version", "Print version information", runVersion},
+	}
+}
+
+// printCommands 打印子命令列表
+func printCommands(w io.Writer) {
+	fmt.Fprintf(w, "Commands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-11s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nRun '%s <command> -h' for the flags of a command.\n", progName())
+}
+
+func runCommand(name string, args []string) {
+	if name == "help" {
+		serve([]string{"-h"})
+		return
+	}
+	i := slices.IndexFunc(commands, func(c command) bool { return c.name == name })
+	if i < 0 {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		printCommands(os.Stderr)
+		os.Exit(2)
+	}
+	if err := commands[i].run(args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func progName() string {
+	return filepath.Base(os.Args[0])
+}
+
+// serveUsage 是 serve 的帮助信息，附带子命令列表
+func serveUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [serve] [flags]\n       %s <command> [flags] [args]\n\n", progName(), progName())
+	printCommands(out)
+	fmt.Fprintf(out, "\nFlags of serve:\n")
+	flag.PrintDefaults()
+}
+
+// newFlagSet 创建子命令的参数解析，usage 是参数之后的说明，如 "<dir>"
+func newFlagSet(name, usage string) *flag.FlagSet {
+	if describing {
+		return flag.CommandLine
+	}
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [flags] %s\n", progName(), name, usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// skipFile 判断打包、计算校验和时是否跳过，目录密码文件、未完成的上传、回收站等内部文件不应该被带出去
+func skipFile(name string) bool {
+	return name == ".password" || name == ".uploads" || name == ".objects" || name == ".trash" || name == ".versions" || name == ".quarantine"
+}
+
+// runZip 把目录打包成 zip，默认输出为当前目录下的 <目录名>.zip
+func runZip(args []string) error {
+	flags := newFlagSet("zip", "<dir>")
+	out := flags.String("o", "", "Output file (default: <dir>.zip in the current directory)")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	dir, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = filepath.Base(dir) + ".zip"
+	}
+	outAbs, err := filepath.Abs(*out)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(outAbs), ".zip-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	n, err := writeZip(f, dir, outAbs)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), outAbs); err != nil {
+		return err
+	}
+	log.Printf("Wrote %s (%d files)", *out, n)
+	return nil
+}
+
+// writeZip 把 dir 下的文件写入 w，跳过 skip 本身（输出文件在目录里面时）和临时文件，返回文件个数
+func writeZip(w io.Writer, dir, skip string) (int, error) {
+	zw := zip.NewWriter(w)
+	n := 0
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if skipFile(d.Name()) || strings.HasPrefix(d.Name(), ".zip-") || p == skip {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if p == dir || !d.Type().IsRegular() && !d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			hdr.Name += "/"
+			_, err := zw.CreateHeader(hdr)
+			return err
+		}
+		hdr.Method = zip.Deflate
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		if _, err := io.Copy(fw, src); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, zw.Close()
+}
+
+var hashAlgos = map[string]func() hash.Hash{
+	"md5": md5.New, "sha1": sha1.New, "sha256": sha256.New, "sha512": sha512.New,
+}
+
+// runHash 按 sha256sum 的格式打印文件的校验和，目录递归计算其中的文件
+func runHash(args []string) error {
+	flags := newFlagSet("hash", "<file or dir>...")
+	algo := flags.String("algo", "sha256", "Checksum algorithm: md5, sha1, sha256 or sha512")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	newHash := hashAlgos[strings.ToLower(*algo)]
+	if newHash == nil {
+		return fmt.Errorf("unsupported -algo %q, use md5, sha1, sha256 or sha512", *algo)
+	}
+	for _, arg := range flags.Args() {
+		err := filepath.WalkDir(arg, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if skipFile(d.Name()) && p != arg {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			sum, err := hashFile(p, newHash())
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s  %s\n", sum, filepath.ToSlash(p))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runDedupe 整理已有的目录，内容相同的文件换成同一个对象的硬链接，和服务的 -dedupe 使用同样的 .objects
+func runDedupe(args []string) error {
+	flags := newFlagSet("dedupe", "[dir]")
+	dryRun := flags.Bool("dry-run", false, "Only report how much space would be saved, don't change any files")
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flags.NArg() == 1 {
+		dir = flags.Arg(0)
+	}
+	res, err := fileserver.Dedupe(dir, *dryRun)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Printf("Would link %d of %d files, saving %d bytes, and remove %d unused objects\n", res.Linked, res.Files, res.Saved, res.Pruned)
+	} else {
+		fmt.Printf("Linked %d of %d files, saved %d bytes, removed %d unused objects\n", res.Linked, res.Files, res.Saved, res.Pruned)
+	}
+	return nil
+}
+
+func hashFile(name string, h hash.Hash) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// runShare 生成分享链接，和 serve -share 相同，需要与服务端使用相同的 -root 和 -share-secret
+func runShare(args []string) error {
+	flags := newFlagSet("share", "<path>")
+	root := flags.String("root", ".", "Root directory the server serves")
+	secret := flags.String("share-secret", "", "Secret the server signs share links with (its -share-secret)")
+	hours := flags.Float64("hours", 24, "Hours before the link expires, 0 for never")
+	downloads := flags.Int("downloads", 0, "Maximum downloads, 0 for unlimited")
+	basePath := flags.String("base-path", "", "URL path prefix the server runs under, e.g. /files")
+	port := flags.String("port", "8080", "Server port, used to print LAN addresses")
+	serverURL := flags.String("url", "", "Public server URL, e.g. https://files.example.com (default: LAN addresses)")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *secret == "" {
+		return errors.New("share requires -share-secret, the same one the server runs with")
+	}
+	h, err := fileserver.New(fileserver.Config{Root: *root, ShareSecret: *secret, BasePath: *basePath})
+	if err != nil {
+		return err
+	}
+	token, err := h.Share(flags.Arg(0), time.Duration(*hours*float64(time.Hour)), *downloads)
+	if err != nil {
+		return fmt.Errorf("failed to share %s: %w", flags.Arg(0), err)
+	}
+	if *serverURL != "" {
+		fmt.Printf("%s%s/s/%s\n", strings.TrimSuffix(*serverURL, "/"), h.BasePath(), token)
+		return nil
+	}
+	printShareURLs(token, *port, h.BasePath())
+	return nil
+}
+
+// printShareURLs 打印分享链接在每个局域网地址上的完整地址
+func printShareURLs(token, port, base string) {
+	for _, ip := range append(fileserver.LANIPs(), "127.0.0.1") {
+		fmt.Printf("http://%s%s/s/%s\n", net.JoinHostPort(ip, port), base, token)
+	}
+}
+
+// runVersion 打印版本信息，和 serve -version 相同
+func runVersion(args []string) error {
+	newFlagSet("version", "").Parse(args)
+	fmt.Printf("%s %s\n", progName(), buildVersion())
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/somnro/Go-Download-Static-Files/fileserver"
+)
+
+func TestWriteZip(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "sub", ".uploads"), 0755)
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644)
+	os.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("world"), 0644)
+	os.WriteFile(filepath.Join(dir, "sub", ".password"), []byte("pw"), 0644)
+	os.WriteFile(filepath.Join(dir, "sub", ".uploads", "part"), []byte("x"), 0644)
+	out := filepath.Join(dir, "out.zip")
+	os.WriteFile(out, nil, 0644)
+
+	var buf bytes.Buffer
+	n, err := writeZip(&buf, dir, out)
+	if err != nil || n != 2 {
+		t.Fatalf("writeZip = %d, %v", n, err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if !slices.Equal(names, []string{"a.txt", "sub/", "sub/b.txt"}) {
+		t.Errorf("zip entries = %q", names)
+	}
+	rc, _ := zr.File[2].Open()
+	if b, _ := io.ReadAll(rc); string(b) != "world" {
+		t.Errorf("sub/b.txt = %q", b)
+	}
+}
+
+// captureStdout 返回 fn 执行期间写到标准输出的内容
+func captureStdout(t *testing.T, fn func() error) string {
+	t.Helper()
+	r, w, _ := os.Pipe()
+	stdout := os.Stdout
+	os.Stdout = w
+	err := fn()
+	os.Stdout = stdout
+	w.Close()
+	b, _ := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRunShare(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("hello"), 0644)
+	out := captureStdout(t, func() error {
+		return runShare([]string{"-root", root, "-share-secret", "s3cret", "-url", "https://files.example.com/", "a.txt"})
+	})
+	token, ok := strings.CutPrefix(strings.TrimSpace(out), "https://files.example.com/s/")
+	if !ok {
+		t.Fatalf("share printed %q", out)
+	}
+
+	// 服务端用同样的密钥能识别这个链接
+	h, err := fileserver.New(fileserver.Config{Root: root, ShareSecret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/s/"+token, nil))
+	if w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("GET /s/<token> = %d %q", w.Code, w.Body)
+	}
+
+	if err := runShare([]string{"-root", root, "a.txt"}); err == nil {
+		t.Error("share without -share-secret succeeded")
+	}
+}
+
+func TestRunHash(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644)
+	os.WriteFile(filepath.Join(dir, ".password"), []byte("pw"), 0644)
+	out := captureStdout(t, func() error { return runHash([]string{"-algo", "md5", dir}) })
+	want := "5d41402abc4b2a76b9719d911017c592  " + filepath.ToSlash(filepath.Join(dir, "a.txt")) + "\n"
+	if out != want {
+		t.Errorf("hash printed %q, want %q", out, want)
+	}
+	if err := runHash([]string{"-algo", "crc", dir}); err == nil {
+		t.Error("unknown -algo was accepted")
+	}
+}
+
+func TestRunDedupe(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.bin"), []byte("same"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.bin"), []byte("same"), 0644)
+	out := captureStdout(t, func() error { return runDedupe([]string{dir}) })
+	if want := "Linked 1 of 2 files, saved 4 bytes, removed 0 unused objects\n"; out != want {
+		t.Errorf("dedupe printed %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// completion 子命令：生成 bash、zsh、fish、PowerShell 的补全脚本，包括所有子命令和它们的参数。
+// 参数列表直接取自各子命令的定义，新增参数后重新生成一次即可：
+//
+//	source <(Go-Download-Static-Files completion bash)
+//	Go-Download-Static-Files completion fish > ~/.config/fish/completions/Go-Download-Static-Files.fish
+
+// describing 为 true 时 newFlagSet 返回临时的 flag.CommandLine，见 commandFlags
+var describing bool
+
+// commandFlags 返回子命令定义的参数：用 -h 运行子命令，参数定义完、解析时以 panic 中止，
+// 不会执行子命令本身，这样各子命令的参数只需要在一个地方定义
+func commandFlags(c command) (flags *flag.FlagSet) {
+	saved, savedUsage := flag.CommandLine, flag.Usage
+	flags = flag.NewFlagSet(c.name, flag.PanicOnError)
+	flags.SetOutput(io.Discard)
+	flag.CommandLine, describing = flags, true
+	defer func() {
+		flag.CommandLine, flag.Usage, describing = saved, savedUsage, false
+		if r := recover(); r != nil && r != flag.ErrHelp {
+			panic(r)
+		}
+	}()
+	c.run([]string{"-h"})
+	return flags
+}
+
+// completionFlag 是补全脚本中的一个参数
+type completionFlag struct {
+	name   string
+	usage  string
+	isBool bool // 不带值的开关
+}
+
+type completionCommand struct {
+	command
+	flags []completionFlag
+}
+
+func completionCommands() []completionCommand {
+	var cmds []completionCommand
+	for _, c := range commands {
+		cc := completionCommand{command: c}
+		commandFlags(c).VisitAll(func(f *flag.Flag) {
+			b, ok := f.Value.(interface{ IsBoolFlag() bool })
+			cc.flags = append(cc.flags, completionFlag{name: f.Name, usage: f.Usage, isBool: ok && b.IsBoolFlag()})
+		})
+		cmds = append(cmds, cc)
+	}
+	return cmds
+}
+
+func runCompletion(args []string) error {
+	flags := newFlagSet("completion", "bash|zsh|fish|powershell")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	prog := strings.TrimSuffix(progName(), ".exe")
+	cmds := completionCommands()
+	switch flags.Arg(0) {
+	case "bash":
+		bashCompletion(os.Stdout, prog, cmds)
+	case "zsh":
+		zshCompletion(os.Stdout, prog, cmds)
+	case "fish":
+		fishCompletion(os.Stdout, prog, cmds)
+	case "powershell", "pwsh":
+		powershellCompletion(os.Stdout, prog, cmds)
+	default:
+		return fmt.Errorf("unsupported shell %q, use bash, zsh, fish or powershell", flags.Arg(0))
+	}
+	return nil
+}
+
+// shellFuncName 把程序名转换成可以用作 shell 函数名的形式
+func shellFuncName(prog string) string {
+	return "_" + regexp.MustCompile(`[^A-Za-z0-9_]`).ReplaceAllString(prog, "_")
+}
+
+func commandNames(cmds []completionCommand) string {
+	var names []string
+	for _, c := range cmds {
+		names = append(names, c.name)
+	}
+	return strings.Join(names, " ")
+}
+
+func flagNames(c completionCommand) string {
+	var names []string
+	for _, f := range c.flags {
+		names = append(names, "-"+f.name)
+	}
+	return strings.Join(names, " ")
+}
+
+// firstLine 返回参数说明的第一句，补全菜单中放不下太长的说明
+func firstLine(s string) string {
+	s, _, _ = strings.Cut(s, "\n")
+	return s
+}
+
+func bashCompletion(w io.Writer, prog string, cmds []completionCommand) {
+	fn := shellFuncName(prog)
+	fmt.Fprintf(w, "# bash completion for %s\n%s() {\n", prog, fn)
+	fmt.Fprintf(w, "    local cur=${COMP_WORDS[COMP_CWORD]} cmd=serve words\n")
+	fmt.Fprintf(w, "    if (( COMP_CWORD > 1 )) && [[ ${COMP_WORDS[1]} != -* ]]; then cmd=${COMP_WORDS[1]}; fi\n")
+	fmt.Fprintf(w, "    if (( COMP_CWORD == 1 )) && [[ $cur != -* ]]; then\n")
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n        return\n    fi\n", commandNames(cmds))
+	fmt.Fprintf(w, "    case $cmd in\n")
+	for _, c := range cmds {
+		fmt.Fprintf(w, "    %s) words=%q ;;\n", c.name, flagNames(c))
+	}
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "    if [[ $cur == -* ]]; then\n        COMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n    fi\n}\n")
+	fmt.Fprintf(w, "complete -o default -F %s %s\n", fn, prog)
+}
+
+// zshEscape 转义 _arguments 参数说明中的特殊字符，结果放在单引号中
+func zshEscape(s string) string {
+	return strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`, `\`, `\\`).Replace(firstLine(s))
+}
+
+func zshCompletion(w io.Writer, prog string, cmds []completionCommand) {
+	fn := shellFuncName(prog)
+	fmt.Fprintf(w, "#compdef %s\n\n%s() {\n    local -a commands\n    commands=(\n", prog, fn)
+	for _, c := range cmds {
+		fmt.Fprintf(w, "        '%s:%s'\n", c.name, zshEscape(c.summary))
+	}
+	fmt.Fprintf(w, "    )\n    local cmd=serve\n")
+	fmt.Fprintf(w, "    if (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then\n        _describe command commands\n        return\n    fi\n")
+	fmt.Fprintf(w, "    if [[ $words[2] != -* ]]; then\n        cmd=$words[2]\n        shift words\n        (( CURRENT-- ))\n    fi\n")
+	fmt.Fprintf(w, "    case $cmd in\n")
+	for _, c := range cmds {
+		fmt.Fprintf(w, "    %s)\n        _arguments \\\n", c.name)
+		for _, f := range c.flags {
+			if f.isBool {
+				fmt.Fprintf(w, "            '-%s[%s]' \\\n", f.name, zshEscape(f.usage))
+			} else {
+				fmt.Fprintf(w, "            '-%s[%s]:value:_default' \\\n", f.name, zshEscape(f.usage))
+			}
+		}
+		fmt.Fprintf(w, "            '*:file:_files'\n        ;;\n")
+	}
+	fmt.Fprintf(w, "    esac\n}\n\ncompdef %s %s\n", fn, prog)
+}
+
+// fishEscape 转义放在单引号中的字符串
+func fishEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(firstLine(s))
+}
+
+func fishCompletion(w io.Writer, prog string, cmds []completionCommand) {
+	fmt.Fprintf(w, "# fish completion for %s\n", prog)
+	var others []string
+	for _, c := range cmds {
+		fmt.Fprintf(w, "complete -c %s -f -n '__fish_use_subcommand' -a %s -d '%s'\n", prog, c.name, fishEscape(c.summary))
+		if c.name != "serve" {
+			others = append(others, c.name)
+		}
+	}
+	for _, c := range cmds {
+		cond := "__fish_seen_subcommand_from " + c.name
+		if c.name == "serve" {
+			// 不写子命令时也是 serve
+			cond = "not __fish_seen_subcommand_from " + strings.Join(others, " ")
+		}
+		for _, f := range c.flags {
+			arg := " -r"
+			if f.isBool {
+				arg = ""
+			}
+			fmt.Fprintf(w, "complete -c %s -n '%s' -o %s%s -d '%s'\n", prog, cond, f.name, arg, fishEscape(f.usage))
+		}
+	}
+}
+
+// psEscape 转义 PowerShell 单引号字符串
+func psEscape(s string) string {
+	return strings.ReplaceAll(firstLine(s), "'", "''")
+}
+
+func powershellCompletion(w io.Writer, prog string, cmds []completionCommand) {
+	fmt.Fprintf(w, "# PowerShell completion for %s\n", prog)
+	fmt.Fprintf(w, "Register-ArgumentCompleter -Native -CommandName '%s', '%s.exe' -ScriptBlock {\n", prog, prog)
+	fmt.Fprintf(w, "    param($wordToComplete, $commandAst, $cursorPosition)\n")
+	fmt.Fprintf(w, "    $commands = [ordered]@{\n")
+	for _, c := range cmds {
+		fmt.Fprintf(w, "        '%s' = '%s'\n", c.name, psEscape(c.summary))
+	}
+	fmt.Fprintf(w, "    }\n    $flags = @{\n")
+	for _, c := range cmds {
+		fmt.Fprintf(w, "        '%s' = [ordered]@{\n", c.name)
+		for _, f := range c.flags {
+			fmt.Fprintf(w, "            '-%s' = '%s'\n", f.name, psEscape(f.usage))
+		}
+		fmt.Fprintf(w, "        }\n")
+	}
+	fmt.Fprintf(w, "    }\n")
+	io.WriteString(w, `    $elements = $commandAst.CommandElements
+    $cmd = 'serve'
+    if ($elements.Count -gt 1 -and $commands.Contains($elements[1].ToString())) {
+        $cmd = $elements[1].ToString()
+    }
+    if ($wordToComplete.StartsWith('-')) {
+        $flags[$cmd].GetEnumerator() | Where-Object { $_.Key -like "$wordToComplete*" } | ForEach-Object {
+            [System.Management.Automation.CompletionResult]::new($_.Key, $_.Key, 'ParameterName', $_.Value)
+        }
+    } elseif ($elements.Count -eq 1 -or ($elements.Count -eq 2 -and $wordToComplete)) {
+        $commands.GetEnumerator() | Where-Object { $_.Key -like "$wordToComplete*" } | ForEach-Object {
+            [System.Management.Automation.CompletionResult]::new($_.Key, $_.Key, 'ParameterValue', $_.Value)
+        }
+    }
+}
+`)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCompletionCommands(t *testing.T) {
+	cmds := completionCommands()
+	flagsOf := func(name string) []completionFlag {
+		i := slices.IndexFunc(cmds, func(c completionCommand) bool { return c.name == name })
+		if i < 0 {
+			t.Fatalf("command %s missing", name)
+		}
+		return cmds[i].flags
+	}
+	has := func(name, flagName string, isBool bool) {
+		t.Helper()
+		if !slices.ContainsFunc(flagsOf(name), func(f completionFlag) bool { return f.name == flagName && f.isBool == isBool }) {
+			t.Errorf("%s: flag -%s (bool %v) missing", name, flagName, isBool)
+		}
+	}
+	has("serve", "port", false)
+	has("serve", "open", true)
+	has("sync", "delete", true)
+	has("zip", "o", false)
+	if len(flagsOf("version")) != 0 {
+		t.Errorf("version flags = %v", flagsOf("version"))
+	}
+	// 收集参数不能改动真正的命令行参数
+	if flag.Lookup("port") != nil {
+		t.Error("serve flags leaked into flag.CommandLine")
+	}
+}
+
+func TestCompletionScripts(t *testing.T) {
+	cmds := completionCommands()
+	for shell, gen := range map[string]func(*bytes.Buffer){
+		"bash": func(b *bytes.Buffer) { bashCompletion(b, "fileserver", cmds) },
+		"zsh":  func(b *bytes.Buffer) { zshCompletion(b, "fileserver", cmds) },
+		"fish": func(b *bytes.Buffer) { fishCompletion(b, "fileserver", cmds) },
+	} {
+		var buf bytes.Buffer
+		gen(&buf)
+		if !strings.Contains(buf.String(), "sftp-authorized-keys") || !strings.Contains(buf.String(), "dry-run") {
+			t.Errorf("%s script lacks flags", shell)
+		}
+		// 本机装了对应的 shell 时检查语法
+		if _, err := exec.LookPath(shell); err != nil {
+			continue
+		}
+		cmd := exec.Command(shell, "-n")
+		cmd.Stdin = &buf
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("%s -n: %v\n%s", shell, err, out)
+		}
+	}
+
+	var buf bytes.Buffer
+	powershellCompletion(&buf, "fileserver", cmds)
+	if !strings.Contains(buf.String(), "'-sftp-rw' = ") || !strings.Contains(buf.String(), "'completion' = ") {
+		t.Error("powershell script lacks flags or commands")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+func daemonize(logFile string) error {
+	return errors.New("-daemon is only supported on Unix, use -service on Windows")
+}
@@ -0,0 +1,37 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// daemonize 在后台重新启动自己（去掉 -daemon），新进程脱离当前终端，退出登录后继续运行。
+// 标准输出和错误输出写入 logFile，没有指定时丢弃
+func daemonize(logFile string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if logFile == "" {
+		logFile = os.DevNull
+	}
+	out, err := os.OpenFile(logFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	cmd := exec.Command(exe, withoutFlag(os.Args[1:], "daemon")...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	fmt.Printf("Started in background, PID %d\n", cmd.Process.Pid)
+	return nil
+}
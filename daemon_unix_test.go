@@ -0,0 +1,57 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestDaemonize(t *testing.T) {
+	// 后台进程把自己的 PID 和进程组 ID 写入文件
+	if out := os.Getenv("TEST_DAEMON_OUT"); out != "" {
+		pgid := syscall.Getpgrp()
+		os.WriteFile(out+".tmp", []byte(fmt.Sprintf("%d %d", os.Getpid(), pgid)), 0644)
+		os.Rename(out+".tmp", out)
+		return
+	}
+
+	dir := t.TempDir()
+	out, logFile := filepath.Join(dir, "out"), filepath.Join(dir, "log")
+	t.Setenv("TEST_DAEMON_OUT", out)
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^TestDaemonize$", "-test.v", "-daemon"}
+	defer func() { os.Args = args }()
+	if err := daemonize(logFile); err != nil {
+		t.Fatal(err)
+	}
+
+	var b []byte
+	for range 100 {
+		if b, _ = os.ReadFile(out); b != nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	var pid, pgid int
+	if _, err := fmt.Sscan(string(b), &pid, &pgid); err != nil {
+		t.Fatalf("background process did not start: %q", b)
+	}
+	if pid == os.Getpid() || pgid != pid {
+		t.Errorf("background process pid %d, process group %d: not detached", pid, pgid)
+	}
+	for range 100 {
+		if b, _ = os.ReadFile(logFile); strings.Contains(string(b), "PASS") {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if !strings.Contains(string(b), "TestDaemonize") || strings.Contains(string(b), "provided but not defined") {
+		t.Errorf("log file = %q", b)
+	}
+}
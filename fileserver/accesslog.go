@@ -0,0 +1,55 @@
+package fileserver
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// statusRecorder 记录响应状态码和字节数，Unwrap 让 http.ResponseController 仍能拿到原始的 Flusher 等接口
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// clientCN 返回客户端证书的 CN，没有使用 mTLS 时返回 -
+func clientCN(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return "-"
+	}
+	return r.TLS.PeerCertificates[0].Subject.CommonName
+}
+
+// accessLog 每个请求输出一行访问日志：客户端 IP、证书 CN、请求、状态码、字节数、耗时
+func (s *server) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		log.Printf("%s cn=%s %q %d %d %s", s.clientIP(r), clientCN(r), r.Method+" "+r.URL.RequestURI(), rec.status, rec.bytes, time.Since(start).Round(time.Millisecond))
+	})
+}
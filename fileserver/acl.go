@@ -0,0 +1,222 @@
+package fileserver
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// 访问控制：配置文件 acl 中的规则按顺序匹配，第一条同时匹配路径、用户和权限的规则决定结果，
+// 没有规则匹配时允许访问。例如：
+//
+//	"acl": [
+//	  {"path": "/public/**", "users": ["*"], "access": "read", "action": "allow"},
+//	  {"path": "/private/**", "users": ["alice", "@admin"], "action": "allow"},
+//	  {"path": "/private/**", "users": ["*"], "action": "deny"}
+//	]
+
+const (
+	permRead  = "read"
+	permWrite = "write"
+)
+
+// aclRule 是一条访问控制规则
+type aclRule struct {
+	Path   string   `json:"path"`   // 路径通配符，* 匹配一级，** 匹配任意多级
+	Users  []string `json:"users"`  // 用户名；"*" 所有人，"anonymous" 未登录用户，"@组名" 组成员
+	Access string   `json:"access"` // read、write，为空表示读写都适用
+	Action string   `json:"action"` // allow 或 deny
+}
+
+func (rule aclRule) validate() error {
+	if !strings.HasPrefix(rule.Path, "/") {
+		return fmt.Errorf("path %q must start with /", rule.Path)
+	}
+	if _, err := path.Match(strings.ReplaceAll(rule.Path, "**", "*"), "/"); err != nil {
+		return fmt.Errorf("path %q: %w", rule.Path, err)
+	}
+	switch rule.Access {
+	case "", permRead, permWrite:
+	default:
+		return fmt.Errorf("unknown access %q", rule.Access)
+	}
+	switch rule.Action {
+	case "allow", "deny":
+	default:
+		return fmt.Errorf("unknown action %q", rule.Action)
+	}
+	return nil
+}
+
+func (rule aclRule) matchUser(u *user) bool {
+	for _, name := range rule.Users {
+		switch {
+		case name == "*":
+			return true
+		case name == "anonymous":
+			if u == nil {
+				return true
+			}
+		case strings.HasPrefix(name, "@"):
+			if u.inGroup(name[1:]) {
+				return true
+			}
+		case u != nil && u.Name == name:
+			return true
+		}
+	}
+	return false
+}
+
+// allowed 判断用户 u 能否以 perm 权限访问 p
+func (s *server) allowed(u *user, p, perm string) bool {
+	if !u.scoped(p, perm) {
+		return false
+	}
+	for _, rule := range s.conf().acl {
+		if (rule.Access == "" || rule.Access == perm) && matchGlob(rule.Path, p) && rule.matchUser(u) {
+			return rule.Action == "allow"
+		}
+	}
+	return true
+}
+
+// noCookies 用于检查目录密码，FTP、SFTP 会话没有 cookie，所有受保护的目录都视为未解锁
+var noCookies = &http.Request{Header: http.Header{}}
+
+// sessionAccess 按隐藏文件、访问控制规则和目录密码检查 FTP、SFTP 会话中的用户 u 能否以 perm 权限访问 p
+func (s *server) sessionAccess(u *user, p, perm string) error {
+	if isHidden(p) {
+		return fs.ErrNotExist
+	}
+	if !s.allowed(u, p, perm) {
+		return fs.ErrPermission
+	}
+	if _, locked := s.lockedDir(noCookies, p); locked {
+		return fs.ErrPermission
+	}
+	return nil
+}
+
+// caseInsensitive 表示本机文件系统不区分大小写（Windows、macOS），/Secret/x 和 /secret/x 是同一个文件，
+// 规则和目录密码都要忽略大小写匹配，否则换个大小写就能绕过
+var caseInsensitive = runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+
+// foldPath 返回用于比较的路径，不区分大小写的系统上统一转成小写
+func foldPath(p string) string {
+	if caseInsensitive {
+		return strings.ToLower(p)
+	}
+	return p
+}
+
+// matchGlob 按路径分段匹配通配符，** 匹配零个或多个目录
+func matchGlob(pattern, p string) bool {
+	pattern, p = foldPath(pattern), foldPath(p)
+	return matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(strings.Trim(p, "/"), "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	if len(parts) == 1 && parts[0] == "" {
+		parts = nil
+	}
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return len(pattern) == 1 && pattern[0] == ""
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// scoped 按用户库中的角色和根目录检查权限：viewer 只能读；设置了根目录的用户只能访问根目录下面的内容，
+// 根目录的上级目录只能读，目录列表中只看得到通往根目录的那一个子目录
+func (u *user) scoped(p, perm string) bool {
+	if u == nil {
+		return true
+	}
+	if u.Role == RoleViewer && perm == permWrite {
+		return false
+	}
+	if u.Root == "" {
+		return true
+	}
+	return within(u.Root, p) || perm == permRead && within(p, u.Root)
+}
+
+// within 判断 p 是否是目录 dir 或者在 dir 下面
+func within(dir, p string) bool {
+	dir, p = foldPath(dir), foldPath(p)
+	return dir == "/" || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// isAdmin 判断用户 u 能否使用管理页面。管理员必须登录，没有配置 admins 时谁都不是管理员，用户库中角色为 admin 的用户除外
+func (s *server) isAdmin(u *user) bool {
+	return u != nil && (u.Role == RoleAdmin || aclRule{Users: s.conf().admins}.matchUser(u))
+}
+
+// requireAdmin 检查请求来自管理员，未登录时要求登录，不是管理员时返回 403
+func (s *server) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	u := currentUser(r)
+	if u == nil {
+		s.challenge(w, r)
+		return false
+	}
+	if !s.isAdmin(u) {
+		s.httpError(w, r, http.StatusForbidden, "Forbidden")
+		return false
+	}
+	return true
+}
+
+// requestPerm 返回请求需要的权限，不修改文件的请求（包括生成分享链接）只需要读权限，
+// 打开编辑页面需要写权限
+func requestPerm(r *http.Request) string {
+	if writeRequest(r) || strings.HasPrefix(r.URL.Path, "/edit/") {
+		return permWrite
+	}
+	return permRead
+}
+
+// authorize 在所有处理函数之前识别用户并检查访问控制规则
+func (s *server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := s.login(r)
+		if !ok {
+			s.challenge(w, r)
+			return
+		}
+		r = withUser(r, u)
+
+		// 静态资源、登录页面和分享链接不需要登录，分享链接本身就是访问凭据
+		public := strings.HasPrefix(r.URL.Path, "/static/") || strings.HasPrefix(r.URL.Path, "/s/") || strings.HasPrefix(r.URL.Path, "/auth/")
+		if u == nil && s.conf().requireAuth && !public {
+			s.challenge(w, r)
+			return
+		}
+
+		if p, ok := targetPath(r); ok && !s.allowed(u, p, requestPerm(r)) {
+			if u == nil {
+				s.challenge(w, r)
+				return
+			}
+			s.httpError(w, r, http.StatusForbidden, "Forbidden")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,51 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestACL(t *testing.T) {
+	config := writeConfig(t, `{
+		"users": [{"name": "alice", "password": "pw", "groups": ["staff"]}, {"name": "bob", "password": "pw"}],
+		"acl": [
+			{"path": "/sub/**", "users": ["@staff"], "action": "allow"},
+			{"path": "/sub/**", "users": ["*"], "action": "deny"}
+		]
+	}`)
+	h := newTestHandler(t, Config{Root: newTestRoot(t), ConfigFile: config})
+	for _, c := range []struct {
+		user string
+		path string
+		want int
+	}{
+		{"", "/download/a.txt", http.StatusOK},
+		{"", "/download/sub/b.txt", http.StatusUnauthorized},
+		{"bob", "/download/sub/b.txt", http.StatusForbidden},
+		{"alice", "/download/sub/b.txt", http.StatusOK},
+	} {
+		r := httptest.NewRequest("GET", c.path, nil)
+		if c.user != "" {
+			r.SetBasicAuth(c.user, "pw")
+		}
+		if res, _ := do(t, h, r); res.StatusCode != c.want {
+			t.Errorf("%s %s: status = %d, want %d", c.user, c.path, res.StatusCode, c.want)
+		}
+	}
+}
+
+func TestMatchGlobCase(t *testing.T) {
+	defer func(v bool) { caseInsensitive = v }(caseInsensitive)
+	caseInsensitive = false
+	if matchGlob("/secret/**", "/Secret/x") {
+		t.Error("case-sensitive match ignored case")
+	}
+	caseInsensitive = true
+	if !matchGlob("/secret/**", "/Secret/x") || !matchGlob("/Docs/*.PDF", "/docs/a.pdf") {
+		t.Error("case-insensitive match did not fold case")
+	}
+	if !isHidden("/sub/.PASSWORD") {
+		t.Error(".PASSWORD is not hidden on a case-insensitive file system")
+	}
+}
@@ -0,0 +1,248 @@
+package fileserver
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 管理页面 /admin：切换只读模式、查看正在处理的请求、撤销分享链接、重新加载配置文件、管理用户库中的用户、
+// 查看最近的日志，日常维护不用再登录服务器。和 /stats 一样只有 admins 中的用户可以打开，修改操作都是 POST，
+// 由 checkMode 拒绝其他站点发起的请求
+
+// maxLogLines 是管理页面上显示的日志行数
+const maxLogLines = 500
+
+// LogBuffer 保存最近的日志，显示在管理页面上。它是一个 io.Writer，
+// 由调用者加到 log 包或自己的 log.Logger 的输出中，再通过 Config.Logs 传入
+type LogBuffer struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *LogBuffer) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// log 包每条日志调用一次 Write
+	l.lines = append(l.lines, strings.TrimRight(string(b), "\n"))
+	if len(l.lines) > maxLogLines {
+		l.lines = slices.Delete(l.lines, 0, len(l.lines)-maxLogLines)
+	}
+	return len(b), nil
+}
+
+func (l *LogBuffer) recent() []string {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.lines)
+}
+
+// activeRequest 是一个正在处理的请求
+type activeRequest struct {
+	Method string
+	URL    string
+	Client string
+	User   string
+	Start  time.Time
+}
+
+// requestTracker 记录正在处理的请求
+type requestTracker struct {
+	mu     sync.Mutex
+	active map[*activeRequest]struct{}
+}
+
+// trackRequests 在 requestTracker 中登记每个请求，处理完成后去掉
+func (s *server) trackRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a := &activeRequest{Method: r.Method, URL: s.base + r.URL.RequestURI(), Start: time.Now()}
+		if u := currentUser(r); u != nil {
+			a.User = u.Name
+		}
+		if ip := s.clientIP(r); ip != nil {
+			a.Client = ip.String()
+		}
+		t := &s.requests
+		t.mu.Lock()
+		t.active[a] = struct{}{}
+		t.mu.Unlock()
+		defer func() {
+			t.mu.Lock()
+			delete(t.active, a)
+			t.mu.Unlock()
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AdminData 是 /admin 页面的数据
+type AdminData struct {
+	Page
+	Writable   bool   // 当前是否为读写模式
+	CanWrite   bool   // 根目录是本地目录，可以切换到读写模式
+	ConfigFile string // 配置文件，为空时不能重新加载
+	UserStore  bool   // 启用了用户库，可以管理用户
+	Users      []User // 用户库中的用户，不含密码
+	Roles      []string
+	Done       string // 刚完成的操作的提示（翻译键）
+	Error      string
+	Requests   []AdminRequest
+	Shares     []AdminShare
+	Logs       []string
+}
+
+// AdminRequest 是一个正在处理的请求
+type AdminRequest struct {
+	Method  string
+	URL     string
+	Client  string
+	User    string
+	Elapsed string
+}
+
+// AdminShare 是一个本服务签发的分享链接
+type AdminShare struct {
+	ID      string
+	Path    string
+	URL     string
+	Expires string // 为空表示不过期
+	Uses    int
+	MaxUses int // 0 表示不限
+	Revoked bool
+}
+
+// adminActions 是完成后显示提示的操作
+var adminActions = []string{"mode", "reload", "revoke", "user", "deluser"}
+
+// adminHandler 处理 /admin 页面和其中的 POST /admin/mode、/admin/reload、/admin/revoke、/admin/user、/admin/deluser
+func (s *server) adminHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	// 请求方法已经由 allowMethods 检查过：/admin 只有 GET，/admin/ 下面只有 POST
+	action := strings.TrimPrefix(r.URL.Path, "/admin/")
+	if r.URL.Path == "/admin" {
+		var done string
+		if d := r.FormValue("done"); slices.Contains(adminActions, d) {
+			done = "admin.done." + d
+		}
+		s.renderAdmin(w, r, http.StatusOK, done, "")
+		return
+	}
+	if !slices.Contains(adminActions, action) {
+		s.httpError(w, r, http.StatusNotFound, "Not found")
+		return
+	}
+
+	who := currentUser(r).Name
+	switch action {
+	case "mode":
+		writable := r.FormValue("mode") == ModeReadWrite
+		if writable && s.root == "" {
+			s.renderAdmin(w, r, http.StatusBadRequest, "", "read-write mode requires a root directory, FS is read-only")
+			return
+		}
+		s.writable.Store(writable)
+		mode := "read-only"
+		if writable {
+			mode = "read-write"
+		}
+		log.Printf("Admin %s switched the server to %s mode", who, mode)
+		s.auditHTTP(r, auditEntry{Action: auditMode, Detail: mode})
+	case "reload":
+		if err := s.reload(); err != nil {
+			log.Printf("Admin %s failed to reload config: %v", who, err)
+			s.renderAdmin(w, r, http.StatusBadRequest, "", "Failed to reload config: "+err.Error())
+			return
+		}
+		s.auditHTTP(r, auditEntry{Action: auditReload, Path: s.configFile})
+	case "revoke":
+		id := r.FormValue("id")
+		if link := r.FormValue("link"); link != "" {
+			// 也可以粘贴完整的分享地址，用来撤销用 -share 在命令行生成的链接
+			token := link
+			if i := strings.Index(link, "/s/"); i >= 0 {
+				token = link[i+len("/s/"):]
+			}
+			token, _, _ = strings.Cut(token, "/")
+			l, err := s.shares.decode(token)
+			if err != nil {
+				s.renderAdmin(w, r, http.StatusBadRequest, "", "Not a valid share link for this server")
+				return
+			}
+			id = l.ID
+		}
+		if id == "" {
+			s.renderAdmin(w, r, http.StatusBadRequest, "", "Missing share link")
+			return
+		}
+		s.shares.revoke(id)
+		log.Printf("Admin %s revoked share link %s", who, id)
+		s.auditHTTP(r, auditEntry{Action: auditRevoke, Detail: id})
+	case "user", "deluser":
+		if s.users == nil {
+			s.renderAdmin(w, r, http.StatusBadRequest, "", "No user store, start the server with -users")
+			return
+		}
+		name := strings.TrimSpace(r.FormValue("name"))
+		if action == "deluser" {
+			if err := s.users.remove(name); err != nil {
+				s.renderAdmin(w, r, http.StatusBadRequest, "", err.Error())
+				return
+			}
+			log.Printf("Admin %s removed user %s", who, name)
+			s.auditHTTP(r, auditEntry{Action: auditDelUser, Detail: name})
+			break
+		}
+		u := User{Name: name, Role: r.FormValue("role"), Root: strings.TrimSpace(r.FormValue("root"))}
+		if err := s.users.put(u, r.FormValue("password")); err != nil {
+			s.renderAdmin(w, r, http.StatusBadRequest, "", err.Error())
+			return
+		}
+		log.Printf("Admin %s saved user %s (role %q, root %q)", who, name, u.Role, u.Root)
+		s.auditHTTP(r, auditEntry{Action: auditUser, Detail: fmt.Sprintf("%s role=%s root=%s", name, u.Role, u.Root)})
+	}
+	http.Redirect(w, r, s.base+"/admin?done="+action, http.StatusSeeOther)
+}
+
+// renderAdmin 渲染 /admin 页面，done 是操作完成的提示，errMsg 是出错时的说明
+func (s *server) renderAdmin(w http.ResponseWriter, r *http.Request, status int, done, errMsg string) {
+	data := AdminData{Page: s.page(w, r), Writable: !s.readOnly(), CanWrite: s.root != "", ConfigFile: s.configFile, Done: done, Error: errMsg, Logs: s.logs.recent()}
+	if s.users != nil {
+		data.UserStore, data.Roles = true, Roles
+		for _, u := range s.users.list() {
+			u.Password = ""
+			data.Users = append(data.Users, u)
+		}
+	}
+
+	s.requests.mu.Lock()
+	var reqs []*activeRequest
+	for a := range s.requests.active {
+		reqs = append(reqs, a)
+	}
+	s.requests.mu.Unlock()
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].Start.Before(reqs[j].Start) })
+	for _, a := range reqs {
+		data.Requests = append(data.Requests, AdminRequest{Method: a.Method, URL: a.URL, Client: a.Client, User: a.User,
+			Elapsed: time.Since(a.Start).Round(time.Millisecond).String()})
+	}
+
+	for _, l := range s.shares.list() {
+		sh := AdminShare{ID: l.ID, Path: l.Path, URL: s.base + "/s/" + s.shares.token(l.shareLink), Uses: l.Uses, MaxUses: l.MaxUses, Revoked: l.Revoked}
+		if l.Expires > 0 {
+			sh.Expires = time.Unix(l.Expires, 0).Format("2006-01-02 15:04:05")
+		}
+		data.Shares = append(data.Shares, sh)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	s.renderStatus(w, status, "admin.html", data)
+}
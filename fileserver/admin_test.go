@@ -0,0 +1,108 @@
+package fileserver
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminPage(t *testing.T) {
+	config := writeConfig(t, `{"users": [{"name": "alice", "password": "pw"}, {"name": "bob", "password": "pw"}], "admins": ["alice"]}`)
+	// 服务本身不改 log 包的输出，由调用者把日志写入 Config.Logs
+	logs := &LogBuffer{}
+	old := log.Writer()
+	out := io.MultiWriter(old, logs)
+	log.SetOutput(out)
+	defer log.SetOutput(old)
+	h := newTestHandler(t, Config{Root: newTestRoot(t), ConfigFile: config, Logs: logs}, WithShareSecret("test"))
+	if log.Writer() != out {
+		t.Error("New changed the output of the log package")
+	}
+	send := func(name, method, target string, form url.Values) (*http.Response, string) {
+		t.Helper()
+		r := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		if form != nil {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if name != "" {
+			r.SetBasicAuth(name, "pw")
+		}
+		return do(t, h, r)
+	}
+
+	if res, _ := send("", "GET", "/admin", nil); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("anonymous: status = %d, want 401", res.StatusCode)
+	}
+	if res, _ := send("bob", "GET", "/admin", nil); res.StatusCode != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d, want 403", res.StatusCode)
+	}
+	if res, _ := send("bob", "POST", "/admin/mode", url.Values{"mode": {"rw"}}); res.StatusCode != http.StatusForbidden || !h.s.readOnly() {
+		t.Errorf("non-admin switched mode: status = %d", res.StatusCode)
+	}
+	// 页面上列出当前这个请求，日志中有加载配置的记录
+	res, body := send("alice", "GET", "/admin", nil)
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, "GET /admin") || !strings.Contains(body, "Loaded config: "+config) {
+		t.Errorf("admin page: status = %d\n%s", res.StatusCode, body)
+	}
+
+	// 只读模式下管理页面的 POST 也能用，切换后可以上传
+	if res, _ := send("alice", "POST", "/admin/mode", url.Values{"mode": {"rw"}}); res.StatusCode != http.StatusSeeOther || h.s.readOnly() {
+		t.Fatalf("switch to rw: status = %d", res.StatusCode)
+	}
+	if res, _ := send("alice", "PUT", "/api/files/new.txt", nil); res.StatusCode != http.StatusCreated {
+		t.Errorf("upload after switching to rw: status = %d", res.StatusCode)
+	}
+	send("alice", "POST", "/admin/mode", url.Values{"mode": {"ro"}})
+	if !h.s.readOnly() {
+		t.Error("still read-write")
+	}
+	// 其他网站发起的请求被拒绝
+	r := httptest.NewRequest("POST", "/admin/mode", strings.NewReader("mode=rw"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Origin", "https://evil.example")
+	r.SetBasicAuth("alice", "pw")
+	if res, _ := do(t, h, r); res.StatusCode != http.StatusForbidden || !h.s.readOnly() {
+		t.Errorf("cross-site request: status = %d", res.StatusCode)
+	}
+
+	// 撤销分享链接
+	token, _ := h.Share("a.txt", time.Hour, 0)
+	link, _ := h.s.shares.parse(token)
+	if _, body := send("alice", "GET", "/admin", nil); !strings.Contains(body, "/s/"+token) {
+		t.Error("share link not listed")
+	}
+	send("alice", "POST", "/admin/revoke", url.Values{"id": {link.ID}})
+	if res, _ := send("", "GET", "/s/"+token, nil); res.StatusCode != http.StatusGone {
+		t.Errorf("revoked link: status = %d, want 410", res.StatusCode)
+	}
+	other := h.s.shares.mint("/sub", 0, 0, nil)
+	send("alice", "POST", "/admin/revoke", url.Values{"link": {"http://example.com/s/" + other + "/b.txt"}})
+	if res, _ := send("", "GET", "/s/"+other+"/b.txt", nil); res.StatusCode != http.StatusGone {
+		t.Errorf("link revoked by URL: status = %d, want 410", res.StatusCode)
+	}
+
+	// 重新加载配置：新用户生效，配置有误时保留原来的设置
+	if res, _ := send("carol", "GET", "/", nil); res.StatusCode == http.StatusOK {
+		t.Fatal("unknown user accepted")
+	}
+	os.WriteFile(config, []byte(`{"users": [{"name": "alice", "password": "pw"}, {"name": "carol", "password": "pw"}], "admins": ["alice"]}`), 0600)
+	if res, _ := send("alice", "POST", "/admin/reload", nil); res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("reload: status = %d", res.StatusCode)
+	}
+	if res, _ := send("carol", "GET", "/", nil); res.StatusCode != http.StatusOK {
+		t.Errorf("user added by reload: status = %d", res.StatusCode)
+	}
+	os.WriteFile(config, []byte(`{"users": [`), 0600)
+	if res, body := send("alice", "POST", "/admin/reload", nil); res.StatusCode != http.StatusBadRequest || !strings.Contains(body, "Failed to reload config") {
+		t.Errorf("broken config: status = %d", res.StatusCode)
+	}
+	if res, _ := send("carol", "GET", "/", nil); res.StatusCode != http.StatusOK {
+		t.Errorf("settings lost after a failed reload: status = %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,82 @@
+package fileserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// JSON 接口，供脚本和页面中的脚本调用
+
+// apiFile 是 /api/list 返回的文件信息
+type apiFile struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"` // 相对根目录的路径
+	Size    int64     `json:"size"`
+	IsDir   bool      `json:"is_dir"`
+	ModTime time.Time `json:"mod_time"`
+	URL     string    `json:"url"`            // 下载地址，目录为浏览地址
+	View    string    `json:"view,omitempty"` // 在线查看地址
+}
+
+// writeJSON 输出 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// apiError 以 JSON 形式返回错误
+func apiError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// apiListHandler 处理 GET /api/list/<目录>，返回目录内容
+func (s *server) apiListHandler(w http.ResponseWriter, r *http.Request) {
+	p := cleanPath(strings.TrimPrefix(r.URL.Path, "/api/list"))
+	info, err := s.stat(p)
+	if err != nil || !info.IsDir() {
+		apiError(w, http.StatusNotFound, "directory not found")
+		return
+	}
+
+	dir := strings.TrimSuffix(p, "/") + "/"
+	entries, err := s.readDir(p)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, "failed to read directory")
+		return
+	}
+
+	u := currentUser(r)
+	files := []apiFile{}
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil || hiddenFiles[e.Name()] || !s.allowed(u, dir+e.Name(), permRead) {
+			continue
+		}
+		f := apiFile{Name: e.Name(), Path: dir + e.Name(), Size: fi.Size(), IsDir: e.IsDir(), ModTime: fi.ModTime()}
+		// 文件名中的 #、? 等要转义，否则客户端会当作锚点或查询参数
+		escaped := (&url.URL{Path: f.Path}).EscapedPath()
+		if f.IsDir {
+			f.URL = s.base + escaped + "/"
+		} else {
+			f.URL = s.base + "/download" + escaped
+			f.View = s.base + "/view" + escaped
+		}
+		files = append(files, f)
+	}
+	slices.SortFunc(files, func(a, b apiFile) int {
+		if a.IsDir != b.IsDir {
+			if a.IsDir {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	writeJSON(w, http.StatusOK, map[string]any{"path": dir, "files": files})
+}
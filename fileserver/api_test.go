@@ -0,0 +1,71 @@
+package fileserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPIList(t *testing.T) {
+	root := newTestRoot(t)
+	if err := os.WriteFile(filepath.Join(root, "a #1%.txt"), []byte("odd"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestHandler(t, Config{Root: root})
+	res, body := do(t, h, httptest.NewRequest("GET", "/api/list/", nil))
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", res.StatusCode)
+	}
+	var list struct {
+		Path  string    `json:"path"`
+		Files []apiFile `json:"files"`
+	}
+	if err := json.Unmarshal([]byte(body), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Files) != 3 || !list.Files[0].IsDir || list.Files[0].URL != "/sub/" {
+		t.Fatalf("files = %+v", list.Files)
+	}
+	var odd apiFile
+	for _, f := range list.Files {
+		if f.Name == "a #1%.txt" {
+			odd = f
+		}
+	}
+	if odd.URL != "/download/a%20%231%25.txt" || odd.View != "/view/a%20%231%25.txt" {
+		t.Fatalf("escaped links: url = %q, view = %q", odd.URL, odd.View)
+	}
+	if res, body := do(t, h, httptest.NewRequest("GET", odd.URL, nil)); res.StatusCode != http.StatusOK || body != "odd" {
+		t.Errorf("following url: got %d %q", res.StatusCode, body)
+	}
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/api/list/missing/", nil)); res.StatusCode != http.StatusNotFound || !strings.Contains(res.Header.Get("Content-Type"), "json") {
+		t.Errorf("missing directory: status = %d", res.StatusCode)
+	}
+}
+
+func TestDirTree(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)})
+	get := func(cookie string) string {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/sub/", nil)
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "dir-tree", Value: cookie})
+		}
+		_, body := do(t, h, r)
+		return body
+	}
+	// 默认收起，cookie 为 open 时页面一打开就显示，不会先闪一下
+	if body := get(""); !strings.Contains(body, `id="dir-tree" data-dir="/sub/" aria-label="Folders" hidden>`) || strings.Contains(body, "dir-tree-open") {
+		t.Errorf("closed tree not rendered hidden: %s", body)
+	}
+	if body := get("open"); !strings.Contains(body, `<body class="dir-tree-open">`) || !strings.Contains(body, `aria-label="Folders">`) {
+		t.Errorf("open tree not rendered: %s", body)
+	}
+	if body := get("closed"); strings.Contains(body, "dir-tree-open") {
+		t.Error("closed cookie opened the tree")
+	}
+}
@@ -0,0 +1,328 @@
+package fileserver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 浏览压缩包：在线查看 .zip、.tar、.tar.gz、.tgz 文件时不下载，而是把其中的内容显示成只读的目录列表，
+// 下载几个 GB 的压缩包之前可以先确认里面有什么。压缩包中的目录地址是 /view/<压缩包>!/<目录>/，
+// 其中的单个文件从 /download/<压缩包>!/<路径> 下载，边读边发送，不会把整个压缩包解压到磁盘。
+// 访问控制、目录密码都按压缩包本身的路径检查；?raw=1 仍然是原来的查看方式。
+// zip 只读取末尾的中央目录；tar.gz 没有目录，要解压一遍才能列出，很大的 tar.gz 打开会比较慢
+
+// 浏览时最多读取的条目数，超过的部分不显示
+const maxArchiveEntries = maxExtractEntries
+
+// splitArchive 把 /a/b.zip!/c/d 分成压缩包的路径 /a/b.zip 和其中的路径 /c/d，不是这种形式时返回 false
+func splitArchive(p string) (archive, member string, ok bool) {
+	for i := 0; i < len(p); i++ {
+		if p[i] != '!' || !isArchive(p[:i]) || (i+1 < len(p) && p[i+1] != '/') {
+			continue
+		}
+		return p[:i], cleanPath(p[i+1:]), true
+	}
+	return "", "", false
+}
+
+// archiveTarget 返回访问控制使用的路径：压缩包中的路径按压缩包本身检查
+func archiveTarget(p string) string {
+	if archive, _, ok := splitArchive(p); ok {
+		return archive
+	}
+	return p
+}
+
+// archiveMember 是压缩包中的一项，name 是不以 / 开头、不含 .. 的路径
+type archiveMember struct {
+	name    string
+	dir     bool
+	size    int64
+	modTime time.Time
+}
+
+// memberName 把压缩包中的条目名规范成不以 / 开头的路径，跳出压缩包的（zip slip）返回空
+func memberName(name string) string {
+	if c := path.Clean(name); c == ".." || strings.HasPrefix(c, "../") || strings.Contains(name, "\\") {
+		return ""
+	}
+	return strings.TrimPrefix(cleanPath(name), "/")
+}
+
+// readArchive 读取压缩包 f 的条目，name 用来按扩展名判断格式。zip 需要随机访问，f 要实现 io.ReaderAt
+func readArchive(f fs.File, info fs.FileInfo, name string) ([]archiveMember, error) {
+	var list []archiveMember
+	add := func(m archiveMember) bool {
+		if m.name = memberName(m.name); m.name != "" {
+			list = append(list, m)
+		}
+		return len(list) < maxArchiveEntries
+	}
+
+	if strings.HasSuffix(strings.ToLower(name), ".zip") {
+		ra, ok := f.(io.ReaderAt)
+		if !ok {
+			return nil, errBadArchive
+		}
+		zr, err := zip.NewReader(ra, info.Size())
+		if err != nil {
+			return nil, errBadArchive
+		}
+		for _, zf := range zr.File {
+			mode := zf.Mode()
+			if !mode.IsRegular() && !mode.IsDir() {
+				continue
+			}
+			if !add(archiveMember{name: zf.Name, dir: mode.IsDir(), size: int64(zf.UncompressedSize64), modTime: zf.Modified}) {
+				break
+			}
+		}
+		return list, nil
+	}
+
+	var r io.Reader = f
+	if !strings.HasSuffix(strings.ToLower(name), ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, errBadArchive
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return list, nil
+		}
+		if err != nil {
+			return nil, errBadArchive
+		}
+		if h.Typeflag != tar.TypeReg && h.Typeflag != tar.TypeDir {
+			continue
+		}
+		if !add(archiveMember{name: h.Name, dir: h.Typeflag == tar.TypeDir, size: h.Size, modTime: h.ModTime}) {
+			return list, nil
+		}
+	}
+}
+
+// archiveFile 是压缩包中正在读取的一个文件，关闭时同时关闭压缩包
+type archiveFile struct {
+	io.Reader
+	info   fs.FileInfo
+	closer []io.Closer
+}
+
+func (f *archiveFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *archiveFile) Close() error {
+	for _, c := range f.closer {
+		c.Close()
+	}
+	return nil
+}
+
+// storedFile 是 zip 中没有压缩的文件，可以随机读取，下载时支持 Range 请求
+type storedFile struct {
+	*io.SectionReader
+	archiveFile
+}
+
+// openMember 打开压缩包 f 中的文件 member（不以 / 开头），找不到时返回 fs.ErrNotExist。
+// 返回的文件关闭时同时关闭 f，出错时 f 由调用者关闭
+func openMember(f fs.File, info fs.FileInfo, name, member string) (fs.File, error) {
+	if strings.HasSuffix(strings.ToLower(name), ".zip") {
+		ra, ok := f.(io.ReaderAt)
+		if !ok {
+			return nil, errBadArchive
+		}
+		zr, err := zip.NewReader(ra, info.Size())
+		if err != nil {
+			return nil, errBadArchive
+		}
+		for _, zf := range zr.File {
+			if !zf.Mode().IsRegular() || memberName(zf.Name) != member {
+				continue
+			}
+			if off, err := zf.DataOffset(); err == nil && zf.Method == zip.Store {
+				sr := io.NewSectionReader(ra, off, int64(zf.UncompressedSize64))
+				return &storedFile{sr, archiveFile{info: zf.FileInfo(), closer: []io.Closer{f}}}, nil
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return nil, errBadArchive
+			}
+			return &archiveFile{Reader: rc, info: zf.FileInfo(), closer: []io.Closer{rc, f}}, nil
+		}
+		return nil, fs.ErrNotExist
+	}
+
+	var r io.Reader = f
+	closer := []io.Closer{f}
+	if !strings.HasSuffix(strings.ToLower(name), ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, errBadArchive
+		}
+		r = gz
+		closer = append(closer, gz)
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil, fs.ErrNotExist
+		}
+		if err != nil {
+			return nil, errBadArchive
+		}
+		if h.Typeflag == tar.TypeReg && memberName(h.Name) == member {
+			return &archiveFile{Reader: tr, info: h.FileInfo(), closer: closer}, nil
+		}
+	}
+}
+
+// archiveDir 返回压缩包中目录 dir（/ 开头）下的直接子项。很多压缩包不为目录单独存一项，
+// 只在文件路径中出现的目录也要列出；目录不存在时返回 false
+func archiveDir(members []archiveMember, dir string) ([]archiveMember, bool) {
+	prefix := strings.TrimPrefix(dir, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	found := prefix == ""
+	children := map[string]archiveMember{}
+	for _, m := range members {
+		if m.dir && m.name+"/" == prefix {
+			found = true
+		}
+		rest, ok := strings.CutPrefix(m.name, prefix)
+		if !ok || rest == "" {
+			continue
+		}
+		found = true
+		name, sub, nested := strings.Cut(rest, "/")
+		if nested && sub != "" || m.dir {
+			// 目录可能出现多次，有自己的条目时使用它的修改时间
+			c := children[name]
+			c.name, c.dir = name, true
+			if m.dir && (!nested || sub == "") {
+				c.modTime = m.modTime
+			}
+			children[name] = c
+			continue
+		}
+		children[name] = archiveMember{name: name, size: m.size, modTime: m.modTime}
+	}
+	list := make([]archiveMember, 0, len(children))
+	for _, c := range children {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].dir != list[j].dir {
+			return list[i].dir
+		}
+		return list[i].name < list[j].name
+	})
+	return list, found
+}
+
+// ArchiveData 是压缩包内容页面的数据
+type ArchiveData struct {
+	Page
+	Name     string     // 压缩包的文件名
+	Dir      string     // 当前显示的压缩包中的目录，/ 开头
+	Parent   string     // 上一级的地址，压缩包的根目录时是所在目录的浏览地址
+	Download string     // 压缩包的下载地址
+	Files    []FileInfo // 目录中的文件和子目录，目录排在前面
+}
+
+// archiveHandler 渲染压缩包 p 中目录 dir 的内容
+func (s *server) archiveHandler(w http.ResponseWriter, r *http.Request, p, dir string) {
+	info, err := s.stat(p)
+	if err != nil || !info.Mode().IsRegular() {
+		s.httpError(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+	f, err := s.open(p)
+	if err != nil {
+		s.pathError(w, r, err)
+		return
+	}
+	members, err := readArchive(f, info, p)
+	f.Close()
+	if err != nil {
+		s.httpError(w, r, http.StatusUnprocessableEntity, "Failed to read archive")
+		return
+	}
+	children, ok := archiveDir(members, dir)
+	if !ok {
+		s.httpError(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+
+	escaped := (&url.URL{Path: p}).EscapedPath()
+	browse := s.base + "/view" + escaped + "!"
+	data := ArchiveData{Page: s.page(w, r), Name: info.Name(), Dir: dir, Download: s.base + "/download" + escaped}
+	if dir == "/" {
+		data.Parent = s.base + parentDir(p)
+	} else {
+		data.Parent = browse + (&url.URL{Path: parentDir(dir)}).EscapedPath()
+	}
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	for _, c := range children {
+		fi := FileInfo{Name: c.name, Size: c.size, IsDir: c.dir, Path: prefix + c.name}
+		if !c.modTime.IsZero() {
+			fi.ModTime = c.modTime.Format("2006-01-02 15:04:05")
+		}
+		if c.dir {
+			fi.URL = browse + (&url.URL{Path: fi.Path + "/"}).EscapedPath()
+		} else {
+			fi.URL = data.Download + "!" + (&url.URL{Path: fi.Path}).EscapedPath()
+		}
+		data.Files = append(data.Files, fi)
+	}
+	s.render(w, "archive.html", data)
+}
+
+// archiveDownload 发送压缩包 p 中的文件 member（/ 开头）
+func (s *server) archiveDownload(w http.ResponseWriter, r *http.Request, p, member string) {
+	info, err := s.stat(p)
+	if err != nil || !info.Mode().IsRegular() {
+		s.httpError(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+	f, err := s.open(p)
+	if err != nil {
+		s.pathError(w, r, err)
+		return
+	}
+	mf, err := openMember(f, info, p, strings.TrimPrefix(member, "/"))
+	if err != nil {
+		f.Close()
+		if errors.Is(err, fs.ErrNotExist) {
+			s.httpError(w, r, http.StatusNotFound, "File not found")
+		} else {
+			s.httpError(w, r, http.StatusUnprocessableEntity, "Failed to read archive")
+		}
+		return
+	}
+	defer mf.Close()
+	minfo, _ := mf.Stat()
+	if !s.allowDownload(w, r, p+"!"+member, minfo) {
+		return
+	}
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", minfo.Name()))
+	s.setContentType(w, minfo.Name())
+	s.serveDownload(w, r, p+"!"+member, minfo, mf)
+}
@@ -0,0 +1,114 @@
+package fileserver
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBrowseArchive(t *testing.T) {
+	root := newTestRoot(t)
+	os.WriteFile(filepath.Join(root, "dist.zip"), zipArchive(t, map[string]string{
+		"README.txt": "read me", "docs/guide.md": "# Guide", "docs/img/logo.png": "png", "../evil.txt": "x",
+	}), 0644)
+	os.WriteFile(filepath.Join(root, "sub", "src.tar.gz"), tgzArchive(t, map[string]string{"src/main.go": "package main"}), 0644)
+	h := newTestHandler(t, Config{Root: root})
+
+	res, body := do(t, h, httptest.NewRequest("GET", "/view/dist.zip", nil))
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, "README.txt") || !strings.Contains(body, `href="/view/dist.zip!/docs/"`) {
+		t.Fatalf("zip root: got %d %s", res.StatusCode, body)
+	}
+	if strings.Contains(body, "evil") || strings.Contains(body, "guide.md") {
+		t.Errorf("zip root lists nested or unsafe entries: %s", body)
+	}
+
+	res, body = do(t, h, httptest.NewRequest("GET", "/view/dist.zip!/docs/", nil))
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, "guide.md") || !strings.Contains(body, `href="/view/dist.zip!/docs/img/"`) || !strings.Contains(body, `href="/view/dist.zip!/"`) {
+		t.Fatalf("zip dir: got %d %s", res.StatusCode, body)
+	}
+
+	res, body = do(t, h, httptest.NewRequest("GET", "/view/sub/src.tar.gz!/src", nil))
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, "main.go") {
+		t.Fatalf("tar.gz dir: got %d %s", res.StatusCode, body)
+	}
+
+	for _, p := range []string{"/view/dist.zip!/missing/", "/view/a.txt!/", "/view/nothing.zip!/"} {
+		if res, _ := do(t, h, httptest.NewRequest("GET", p, nil)); res.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", p, res.StatusCode)
+		}
+	}
+
+	locked := newTestHandler(t, Config{Root: root, Protect: map[string]string{"/sub": "pw"}})
+	if res, _ := do(t, locked, httptest.NewRequest("GET", "/view/sub/src.tar.gz!/src", nil)); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("protected archive: got %d, want 401", res.StatusCode)
+	}
+
+	// ?raw=1 仍然返回压缩包本身
+	res, body = do(t, h, httptest.NewRequest("GET", "/view/dist.zip?raw=1", nil))
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(body, "PK") {
+		t.Errorf("raw: got %d %q", res.StatusCode, body[:min(len(body), 20)])
+	}
+}
+
+func TestSplitArchive(t *testing.T) {
+	for p, want := range map[string][2]string{
+		"/a/b.zip!/c/d": {"/a/b.zip", "/c/d"},
+		"/b.tar.gz!":    {"/b.tar.gz", "/"},
+		"/x!/b.zip!/c":  {"/x!/b.zip", "/c"},
+	} {
+		archive, member, ok := splitArchive(p)
+		if !ok || archive != want[0] || member != want[1] {
+			t.Errorf("splitArchive(%q) = %q, %q, %v", p, archive, member, ok)
+		}
+	}
+	for _, p := range []string{"/a.txt!/b", "/b.zip", "/b.zip!x"} {
+		if _, _, ok := splitArchive(p); ok {
+			t.Errorf("splitArchive(%q) matched", p)
+		}
+	}
+}
+
+func TestArchiveDownload(t *testing.T) {
+	root := newTestRoot(t)
+	os.WriteFile(filepath.Join(root, "dist.zip"), zipArchive(t, map[string]string{"docs/guide.md": "# Guide"}), 0644)
+	os.WriteFile(filepath.Join(root, "src.tgz"), tgzArchive(t, map[string]string{"src/main.go": "package main"}), 0644)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.CreateHeader(&zip.FileHeader{Name: "data.bin", Method: zip.Store})
+	w.Write([]byte("0123456789"))
+	zw.Close()
+	os.WriteFile(filepath.Join(root, "stored.zip"), buf.Bytes(), 0644)
+	h := newTestHandler(t, Config{Root: root})
+
+	res, body := do(t, h, httptest.NewRequest("GET", "/download/dist.zip!/docs/guide.md", nil))
+	if res.StatusCode != http.StatusOK || body != "# Guide" || !strings.Contains(res.Header.Get("Content-Disposition"), `filename="guide.md"`) {
+		t.Fatalf("zip member: got %d %q %v", res.StatusCode, body, res.Header)
+	}
+	res, body = do(t, h, httptest.NewRequest("GET", "/download/src.tgz!/src/main.go", nil))
+	if res.StatusCode != http.StatusOK || body != "package main" || res.Header.Get("Content-Length") != "12" {
+		t.Fatalf("tar.gz member: got %d %q %v", res.StatusCode, body, res.Header)
+	}
+
+	// 没有压缩的文件可以断点续传
+	r := httptest.NewRequest("GET", "/download/stored.zip!/data.bin", nil)
+	r.Header.Set("Range", "bytes=2-4")
+	if res, body := do(t, h, r); res.StatusCode != http.StatusPartialContent || body != "234" {
+		t.Errorf("stored range: got %d %q", res.StatusCode, body)
+	}
+
+	for _, p := range []string{"/download/dist.zip!/docs", "/download/dist.zip!/missing.txt", "/download/src.tgz!/nothing", "/download/a.txt!/x"} {
+		if res, _ := do(t, h, httptest.NewRequest("GET", p, nil)); res.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", p, res.StatusCode)
+		}
+	}
+
+	// 内容页面中的文件链接到下载地址
+	if _, body := do(t, h, httptest.NewRequest("GET", "/view/dist.zip!/docs/", nil)); !strings.Contains(body, `href="/download/dist.zip!/docs/guide.md"`) {
+		t.Errorf("listing has no download link: %s", body)
+	}
+}
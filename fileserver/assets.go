@@ -0,0 +1,94 @@
+package fileserver
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 页面模板和静态资源都编译进程序，单个可执行文件即可运行
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+//go:embed static
+var staticFiles embed.FS
+
+// staticAssets 是去掉 static/ 前缀后的静态资源，挂载在 /static/ 下
+var staticAssets, _ = fs.Sub(staticFiles, "static")
+
+// Page 是所有页面模板共用的数据
+type Page struct {
+	Lang          // 当前语言，模板中用 {{.T "key"}} 取翻译
+	Theme  string // 当前主题名
+	User   string // 已登录的用户名，未登录为空
+	Logout bool   // 是否显示退出登录链接（单点登录时）
+	Base   string // -base-path 指定的地址前缀，站内链接都要加上
+}
+
+// Themes 返回内置的主题名，即 static/themes 下的 css 文件
+func Themes() []string {
+	entries, _ := fs.ReadDir(staticAssets, "themes")
+	var names []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".css"); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseTemplates 解析内置模板，custom 不为空时用该文件替换目录列表模板，
+// errorDir 不为空时加入其中的自定义错误页面
+func parseTemplates(custom, errorDir string) (*template.Template, error) {
+	t, err := template.ParseFS(templateFiles, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	if custom != "" {
+		b, err := os.ReadFile(custom)
+		if err != nil {
+			return nil, err
+		}
+		// 自定义模板同样可以使用 {{template "head" .}} 引入主题样式
+		if _, err := t.New("listing.html").Parse(string(b)); err != nil {
+			return nil, err
+		}
+	}
+	if errorDir != "" {
+		if err := parseErrorPages(t, errorDir); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// parseErrorPages 读取 dir 下的错误页面：error.html 替换内置的错误页面，404.html 等只用于对应的状态码
+func parseErrorPages(t *template.Template, dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		name := filepath.Base(file)
+		if code, ok := strings.CutSuffix(name, ".html"); ok && name != "error.html" {
+			if _, err := strconv.Atoi(code); err != nil {
+				continue
+			}
+			name = "error-" + name
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if _, err := t.New(name).Parse(string(b)); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCustomTemplate(t *testing.T) {
+	tpl := filepath.Join(t.TempDir(), "listing.html")
+	src := `<html>{{template "head" .}}<ul>{{range .Files}}<li data-size="{{.Size}}">{{.Name}}</li>{{end}}</ul></html>`
+	if err := os.WriteFile(tpl, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestHandler(t, Config{Root: newTestRoot(t), Template: tpl})
+	res, body := do(t, h, httptest.NewRequest("GET", "/", nil))
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, `<li data-size="5">a.txt</li>`) || !strings.Contains(body, "/static/themes/") {
+		t.Errorf("custom listing: status = %d, body = %s", res.StatusCode, body)
+	}
+
+	if err := os.WriteFile(tpl, []byte("{{.Broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Config{Root: newTestRoot(t), Template: tpl}); err == nil {
+		t.Error("invalid template was accepted")
+	}
+}
+
+func TestThemes(t *testing.T) {
+	for _, want := range []string{"auto", "dark", "light"} {
+		if !strings.Contains(strings.Join(Themes(), " "), want) {
+			t.Errorf("Themes() = %v, missing %s", Themes(), want)
+		}
+	}
+	h := newTestHandler(t, Config{Root: newTestRoot(t)}, WithTheme("dark"))
+	if _, body := do(t, h, httptest.NewRequest("GET", "/", nil)); !strings.Contains(body, `/static/themes/dark.css`) {
+		t.Error("configured theme is not used")
+	}
+	// cookie 中保存的选择优先，无效的值忽略
+	for cookie, want := range map[string]string{"light": "light.css", "../../etc": "dark.css"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: "theme", Value: cookie})
+		if _, body := do(t, h, r); !strings.Contains(body, "/static/themes/"+want) {
+			t.Errorf("theme cookie %q: page does not use %s", cookie, want)
+		}
+	}
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/static/themes/light.css", nil)); res.StatusCode != http.StatusOK {
+		t.Errorf("theme stylesheet: status = %d", res.StatusCode)
+	}
+}
+
+func TestResponsiveLayout(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)})
+	_, body := do(t, h, httptest.NewRequest("GET", "/", nil))
+	for _, want := range []string{`name="viewport"`, `id="theme-toggle"`, "/static/themes/auto.css"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("listing does not contain %s", want)
+		}
+	}
+	_, css := do(t, h, httptest.NewRequest("GET", "/static/themes/auto.css", nil))
+	if !strings.Contains(css, "prefers-color-scheme: dark") {
+		t.Error("auto theme does not follow the system dark mode")
+	}
+	_, css = do(t, h, httptest.NewRequest("GET", "/static/style.css", nil))
+	if !strings.Contains(css, "@media") {
+		t.Error("style.css has no media queries for small screens")
+	}
+}
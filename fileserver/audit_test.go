@@ -0,0 +1,96 @@
+package fileserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readAudit 读取审计日志中的所有记录
+func readAudit(t *testing.T, file string) []auditEntry {
+	t.Helper()
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []auditEntry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e auditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("bad audit line %q: %v", sc.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestAuditLog(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+	config := writeConfig(t, `{"users": [{"name": "alice", "password": "pw"}], "admins": ["alice"]}`)
+	h := newTestHandler(t, Config{Root: newTestRoot(t), ConfigFile: config, AuditLog: file}, WithReadWrite())
+	send := func(method, target string, form url.Values) {
+		t.Helper()
+		r := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("alice", "pw")
+		r.RemoteAddr = "192.0.2.7:5555"
+		if res, body := do(t, h, r); res.StatusCode >= 400 {
+			t.Fatalf("%s %s: status = %d, body %s", method, target, res.StatusCode, body)
+		}
+	}
+	send("PUT", "/api/files/new.txt", nil)
+	send("POST", "/api/mkdir", url.Values{"path": {"/docs"}})
+	send("POST", "/api/move", url.Values{"from": {"/new.txt"}, "to": {"/docs/new.txt"}})
+	send("DELETE", "/api/files/docs?recursive=1", nil)
+	send("POST", "/admin/mode", url.Values{"mode": {"ro"}})
+	// 读取不记录，失败的操作也不记录
+	send("GET", "/download/a.txt", nil)
+	r := httptest.NewRequest("DELETE", "/api/files/a.txt", nil)
+	r.SetBasicAuth("alice", "pw")
+	if res, _ := do(t, h, r); res.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("delete in read-only mode: status = %d", res.StatusCode)
+	}
+
+	root := h.Root()
+	h.s.writable.Store(true)
+	c := dialFTP(t, startFTP(t, h, FTPConfig{Writable: true}), "ftp", "")
+	if err := c.Stor("ftp.txt", strings.NewReader("ftp")); err != nil {
+		t.Fatal(err)
+	}
+	c.Quit()
+	if _, err := os.Stat(filepath.Join(root, "ftp.txt")); err != nil {
+		t.Fatal(err)
+	}
+	h.Close()
+
+	entries := readAudit(t, file)
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Via+" "+e.Action+" "+e.Path+" "+e.To+" "+e.Detail)
+	}
+	want := []string{
+		"http upload /new.txt  ",
+		"http mkdir /docs  ",
+		"http rename /new.txt /docs/new.txt ",
+		"http delete /docs  directory",
+		"http mode   read-only",
+		"ftp upload /ftp.txt  ",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("audit log:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if e := entries[0]; e.User != "alice" || e.Client != "192.0.2.7" || e.Time.IsZero() {
+		t.Errorf("first entry = %+v", e)
+	}
+	if e := entries[5]; e.User != "" || e.Client != "127.0.0.1" || e.Size != 3 {
+		t.Errorf("ftp entry = %+v", e)
+	}
+}
@@ -0,0 +1,116 @@
+package fileserver
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// user 是通过认证的用户
+type user struct {
+	Name   string
+	Groups []string
+	Role   string // 用户库中的角色，为空时不限制
+	Root   string // 只能访问的目录，为空时不限制
+}
+
+// User 是使用 Basic Auth 登录的本地用户，来自配置文件的 users、Config.Users 或用户库
+type User struct {
+	Name     string   `json:"name"`
+	Password string   `json:"password"` // 明文、sha256:<十六进制摘要>，或 bcrypt 摘要（$2a$ 开头）
+	Groups   []string `json:"groups,omitempty"`
+	Role     string   `json:"role,omitempty"` // admin、uploader 或 viewer，为空时不限制
+	Root     string   `json:"root,omitempty"` // 只能访问这个目录，比如 /alice，为空时不限制
+}
+
+// session 返回登录后的用户信息
+func (u User) session() *user {
+	return &user{Name: u.Name, Groups: u.Groups, Role: u.Role, Root: u.Root}
+}
+
+// authenticator 校验用户名和密码，成功时返回用户信息，失败时返回 nil
+type authenticator interface {
+	authenticate(name, password string) (*user, error)
+}
+
+// localUsers 是配置文件 users 中定义的用户
+type localUsers []User
+
+func (l localUsers) authenticate(name, password string) (*user, error) {
+	for _, u := range l {
+		if u.Name == name && checkPassword(u.Password, password) {
+			return u.session(), nil
+		}
+	}
+	return nil, nil
+}
+
+type userKey struct{}
+
+// currentUser 返回当前请求的用户，未登录时返回 nil
+func currentUser(r *http.Request) *user {
+	u, _ := r.Context().Value(userKey{}).(*user)
+	return u
+}
+
+func withUser(r *http.Request, u *user) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, u))
+}
+
+// inGroup 判断用户是否属于某个组
+func (u *user) inGroup(g string) bool {
+	return u != nil && slices.Contains(u.Groups, g)
+}
+
+// login 根据 Authorization 头识别用户，支持 Bearer 令牌和 Basic Auth，都没有时看单点登录的 session cookie。
+// 没有提供凭据时返回 nil, true；凭据错误时返回 false
+func (s *server) login(r *http.Request) (*user, bool) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if s.tokens == nil {
+			return nil, false
+		}
+		u, err := s.tokens.authenticate(strings.TrimSpace(token))
+		if err != nil {
+			log.Printf("Rejected bearer token: %v", err)
+			return nil, false
+		}
+		return u, true
+	}
+
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		if s.oidc != nil {
+			return s.oidc.user(r), true
+		}
+		return nil, true
+	}
+	for _, a := range s.conf().auth {
+		u, err := a.authenticate(name, password)
+		if err != nil {
+			log.Printf("Auth backend error: %v", err)
+			continue
+		}
+		if u != nil {
+			return u, true
+		}
+	}
+	return nil, false
+}
+
+// challenge 要求用户登录：启用单点登录时浏览器跳转到登录页面，否则弹出 Basic Auth 登录框，
+// 带 Bearer 令牌的脚本请求不弹框
+func (s *server) challenge(w http.ResponseWriter, r *http.Request) {
+	if s.oidc != nil && r.Header.Get("Authorization") == "" && r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") {
+		http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+		return
+	}
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="Go-Download-Static-Files", error="invalid_token"`)
+	} else {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Go-Download-Static-Files", charset="UTF-8"`)
+	}
+	s.httpError(w, r, http.StatusUnauthorized, "Unauthorized")
+}
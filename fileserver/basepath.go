@@ -0,0 +1,74 @@
+package fileserver
+
+import (
+	"net/http"
+	"strings"
+)
+
+// 部署在反向代理的子路径下（-base-path /files）：请求进来时去掉前缀，其余代码仍然按根路径处理；
+// 页面中的链接由各处加上 s.base，程序内部的跳转地址和 cookie 路径在这里统一加上前缀
+
+// normalizeBase 把 -base-path 规范成以 / 开头、不以 / 结尾的形式，根路径返回空字符串
+func normalizeBase(p string) string {
+	p = cleanPath(p)
+	if p == "/" {
+		return ""
+	}
+	return p
+}
+
+// basePath 去掉请求路径中的前缀，不在前缀下的请求返回 404
+func (s *server) basePath(next http.Handler) http.Handler {
+	if s.base == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == s.base {
+			http.Redirect(w, r, s.base+"/", http.StatusMovedPermanently)
+			return
+		}
+		rest, ok := strings.CutPrefix(r.URL.Path, s.base+"/")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/" + rest
+		if r.URL.RawPath != "" {
+			r2.URL.RawPath = "/" + strings.TrimPrefix(r.URL.RawPath, s.base+"/")
+		}
+		next.ServeHTTP(&baseWriter{ResponseWriter: w, base: s.base}, r2)
+	})
+}
+
+// baseWriter 在发送响应头之前给站内跳转地址和 cookie 路径加上前缀
+type baseWriter struct {
+	http.ResponseWriter
+	base        string
+	wroteHeader bool
+}
+
+func (w *baseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		h := w.Header()
+		if loc := h.Get("Location"); strings.HasPrefix(loc, "/") && !strings.HasPrefix(loc, "//") {
+			h.Set("Location", w.base+loc)
+		}
+		for i, c := range h["Set-Cookie"] {
+			h["Set-Cookie"][i] = strings.Replace(c, "; Path=/", "; Path="+w.base+"/", 1)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *baseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *baseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
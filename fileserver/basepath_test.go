@@ -0,0 +1,54 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeBase(t *testing.T) {
+	for in, want := range map[string]string{"": "", "/": "", "files": "/files", "/files/": "/files", "/a//b/": "/a/b"} {
+		if got := normalizeBase(in); got != want {
+			t.Errorf("normalizeBase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBasePathLinks(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)}, WithBasePath("/files"))
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/files", nil)); res.StatusCode != http.StatusMovedPermanently || res.Header.Get("Location") != "/files/" {
+		t.Errorf("/files: got %d, Location %q", res.StatusCode, res.Header.Get("Location"))
+	}
+
+	_, body := do(t, h, httptest.NewRequest("GET", "/files/sub/", nil))
+	for _, want := range []string{
+		`href="/files/download/sub/b.txt"`,
+		`href="/files/static/style.css"`,
+		`src="/files/static/app.js"`,
+		`class="back-link"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("listing does not contain %s", want)
+		}
+	}
+	if strings.Contains(body, `href="/download/`) || strings.Contains(body, `href="/static/`) {
+		t.Error("listing has links without the base path")
+	}
+
+	_, body = do(t, h, httptest.NewRequest("GET", "/files/api/list/sub/", nil))
+	if !strings.Contains(body, `"url":"/files/download/sub/b.txt"`) || !strings.Contains(body, `"view":"/files/view/sub/b.txt"`) {
+		t.Errorf("/api/list: %s", body)
+	}
+
+	// 程序内部的跳转地址和 cookie 路径也加上前缀
+	h = newTestHandler(t, Config{Root: newTestRoot(t), Protect: map[string]string{"/sub": "pw"}}, WithBasePath("/files"))
+	form := url.Values{"dir": {"/sub"}, "password": {"pw"}, "next": {"/sub/"}}
+	r := httptest.NewRequest("POST", "/files/api/unlock", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, _ := do(t, h, r)
+	if res.Header.Get("Location") != "/files/sub/" || !strings.Contains(res.Header.Get("Set-Cookie"), "Path=/files/") {
+		t.Errorf("unlock: Location %q, Set-Cookie %q", res.Header.Get("Location"), res.Header.Get("Set-Cookie"))
+	}
+}
@@ -0,0 +1,238 @@
+package fileserver
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// 批量下载：目录列表中勾选几个文件或目录后点“打包下载”，POST /api/zip 把它们打包成一个 zip 边压缩边发送，
+// 不在磁盘上生成临时文件。表单中每个 path 是一个要下载的路径，目录连同其中的内容一起打包，压缩包中的路径从勾选的那一项开始。
+// 每个文件都按访问控制规则和目录密码检查，没有权限的跳过；OnDownloadStart 拒绝的文件也跳过。
+//
+// 读写模式下勾选的项还可以批量删除、移动，只读模式下被 checkMode 拦截：
+//
+//	POST /api/batch/delete   参数 path（可以有多个），recursive 不为空时非空目录一并删除
+//	POST /api/batch/move     参数 path（可以有多个）和目标目录 to，移动后名字不变
+//
+// 每一项单独检查权限、单独执行，一项失败不影响其他项，结果按项返回成功与否和失败的原因
+
+// 一次最多勾选的项数
+const maxBatchPaths = 1000
+
+// 已经压缩过的格式，打包时直接存储，再压缩一遍只是浪费 CPU
+var compressedExts = map[string]bool{
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true, ".7z": true, ".rar": true,
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true,
+	".mp3": true, ".m4a": true, ".aac": true, ".ogg": true, ".opus": true, ".flac": true,
+	".mp4": true, ".m4v": true, ".mkv": true, ".mov": true, ".webm": true,
+	".apk": true, ".jar": true, ".docx": true, ".xlsx": true, ".pptx": true, ".odt": true,
+}
+
+// batchPaths 读取表单中的 path，去掉重复的和已经包含在其他勾选的目录中的
+func batchPaths(r *http.Request) []string {
+	var paths []string
+	seen := map[string]bool{}
+	for _, p := range r.PostForm["path"] {
+		p = cleanPath(p)
+		if p != "/" && !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	kept := paths[:0]
+	for _, p := range paths {
+		nested := false
+		for dir := parentDir(p); dir != "/"; dir = parentDir(strings.TrimSuffix(dir, "/")) {
+			if seen[strings.TrimSuffix(dir, "/")] {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// batchZipHandler 处理 POST /api/zip
+func (s *server) batchZipHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.httpError(w, r, http.StatusBadRequest, "Invalid form")
+		return
+	}
+	paths := batchPaths(r)
+	if len(paths) == 0 || len(paths) > maxBatchPaths {
+		s.httpError(w, r, http.StatusBadRequest, "Select between 1 and 1000 files")
+		return
+	}
+	u := currentUser(r)
+	readable := func(p string) bool {
+		if isHidden(p) || !s.allowed(u, p, permRead) {
+			return false
+		}
+		_, locked := s.lockedDir(r, p)
+		return !locked
+	}
+	for _, p := range paths {
+		if !readable(p) {
+			if u == nil && !isHidden(p) && !s.allowed(u, p, permRead) {
+				s.challenge(w, r)
+				return
+			}
+			s.httpError(w, r, http.StatusForbidden, "Permission denied")
+			return
+		}
+		if _, err := s.stat(p); err != nil {
+			s.pathError(w, r, err)
+			return
+		}
+	}
+
+	// 只选了一个目录时用目录名，否则用所在目录的名字
+	name := path.Base(paths[0])
+	if len(paths) > 1 || !s.isDir(paths[0]) {
+		name = path.Base(parentDir(paths[0]))
+		if name == "/" {
+			name = "download"
+		}
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", name+".zip"))
+
+	zw := zip.NewWriter(w)
+	for _, p := range paths {
+		prefix := parentDir(p)
+		err := fs.WalkDir(s.fsys, fsName(p), func(name string, e fs.DirEntry, err error) error {
+			if err != nil {
+				// 读不了的子目录跳过
+				if e != nil && e.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			rel := cleanPath(name)
+			if !readable(rel) {
+				if e.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if e.IsDir() {
+				// 空目录也要出现在压缩包中
+				_, err := zw.Create(strings.TrimPrefix(rel, prefix) + "/")
+				return err
+			}
+			if !e.Type().IsRegular() {
+				return nil
+			}
+			return s.zipFile(zw, r, rel, strings.TrimPrefix(rel, prefix))
+		})
+		if err != nil {
+			// 响应已经开始发送，只能中断
+			log.Printf("Failed to zip %s: %v", p, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("Failed to zip %v: %v", paths, err)
+	}
+}
+
+// batchResult 是批量删除、移动中一项的结果，Status 是单独请求这一项时的状态码
+type batchResult struct {
+	Path   string `json:"path"`
+	To     string `json:"to,omitempty"`
+	OK     bool   `json:"ok"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// batchHandler 处理 POST /api/batch/delete 和 /api/batch/move
+func (s *server) batchHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		apiError(w, http.StatusBadRequest, "invalid form")
+		return
+	}
+	paths := batchPaths(r)
+	if len(paths) == 0 || len(paths) > maxBatchPaths {
+		apiError(w, http.StatusBadRequest, "select between 1 and 1000 files")
+		return
+	}
+	move := r.URL.Path == "/api/batch/move"
+	to := cleanPath(r.PostForm.Get("to"))
+	if move && r.PostForm.Get("to") == "" {
+		apiError(w, http.StatusBadRequest, "missing target directory")
+		return
+	}
+	recursive := r.PostForm.Get("recursive") != ""
+
+	u := currentUser(r)
+	results := make([]batchResult, 0, len(paths))
+	for _, p := range paths {
+		res := batchResult{Path: p}
+		var err error
+		switch _, locked := s.lockedDir(r, p); {
+		case !s.allowed(u, p, permWrite):
+			err = errForbidden
+		case locked:
+			err = errLocked
+		case move:
+			res.To = path.Join(to, path.Base(p))
+			err = s.movePath(r, p, res.To)
+		default:
+			err = s.removePath(r, p, recursive)
+		}
+		if err != nil {
+			res.Status, res.Error = fileErrorStatus(err)
+		} else {
+			res.OK, res.Status = true, http.StatusOK
+		}
+		results = append(results, res)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"results": results})
+}
+
+// isDir 判断 p 是否为目录
+func (s *server) isDir(p string) bool {
+	info, err := s.stat(p)
+	return err == nil && info.IsDir()
+}
+
+// zipFile 把文件 p 以 name 写入压缩包，去掉元数据的规则和下载时一样
+func (s *server) zipFile(zw *zip.Writer, r *http.Request, p, name string) error {
+	f, err := s.open(p)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	if s.hooks.OnDownloadStart != nil && s.hooks.OnDownloadStart(r, p, info) != nil {
+		return nil
+	}
+	if info, f, err = s.stripMetadata(info, f); err != nil {
+		return nil
+	}
+	h, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	h.Name, h.Method = name, zip.Deflate
+	if compressedExts[strings.ToLower(path.Ext(name))] {
+		h.Method = zip.Store
+	}
+	dst, err := zw.CreateHeader(h)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, f)
+	return err
+}
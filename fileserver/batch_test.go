@@ -0,0 +1,175 @@
+package fileserver
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBatchZip(t *testing.T) {
+	root := newTestRoot(t)
+	os.MkdirAll(filepath.Join(root, "sub", "deep", "empty"), 0755)
+	os.WriteFile(filepath.Join(root, "sub", "deep", "c.txt"), []byte("deep"), 0644)
+	os.MkdirAll(filepath.Join(root, "private"), 0755)
+	os.WriteFile(filepath.Join(root, "private", "secret.txt"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(root, "sub", passwordFile), []byte("pw"), 0644)
+	config := writeConfig(t, `{"acl": [{"path": "/sub/deep/c.txt", "users": ["*"], "action": "deny"}, {"path": "/private/**", "users": ["*"], "action": "deny"}]}`)
+	h := newTestHandler(t, Config{Root: root, ConfigFile: config})
+
+	post := func(paths ...string) (*http.Response, string) {
+		t.Helper()
+		form := url.Values{"path": paths}
+		r := httptest.NewRequest("POST", "/api/zip", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return do(t, h, r)
+	}
+	entries := func(body string) map[string]string {
+		t.Helper()
+		zr, err := zip.NewReader(bytes.NewReader([]byte(body)), int64(len(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := map[string]string{}
+		for _, f := range zr.File {
+			rc, _ := f.Open()
+			b, _ := io.ReadAll(rc)
+			rc.Close()
+			m[f.Name] = string(b)
+		}
+		return m
+	}
+
+	// 只读模式下也可以打包下载；重复的和已经包含在勾选的目录中的只打包一次
+	res, body := post("/a.txt", "/a.txt")
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/zip" || !strings.Contains(res.Header.Get("Content-Disposition"), "download.zip") {
+		t.Fatalf("zip: got %d %v", res.StatusCode, res.Header)
+	}
+	if got := entries(body); len(got) != 1 || got["a.txt"] != "hello" {
+		t.Errorf("zip = %v", got)
+	}
+
+	// 目录中没有权限的文件跳过，密码文件不打包；受密码保护的目录要先解锁
+	if res, _ := post("/sub"); res.StatusCode != http.StatusForbidden {
+		t.Errorf("locked directory: got %d", res.StatusCode)
+	}
+	os.Remove(filepath.Join(root, "sub", passwordFile))
+	res, body = post("/sub", "/sub/b.txt")
+	if res.StatusCode != http.StatusOK || !strings.Contains(res.Header.Get("Content-Disposition"), "sub.zip") {
+		t.Fatalf("directory: got %d %v", res.StatusCode, res.Header)
+	}
+	got := entries(body)
+	var names []string
+	for name := range got {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, " ") != "sub/ sub/b.txt sub/deep/ sub/deep/empty/" || got["sub/b.txt"] != "world" {
+		t.Errorf("directory zip = %v", names)
+	}
+
+	if res, _ := post("/private/secret.txt"); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("denied file: got %d", res.StatusCode)
+	}
+	if res, _ := post("/missing.txt"); res.StatusCode != http.StatusNotFound {
+		t.Errorf("missing file: got %d", res.StatusCode)
+	}
+	if res, _ := post(); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("nothing selected: got %d", res.StatusCode)
+	}
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/api/zip?path=/a.txt", nil)); res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got %d", res.StatusCode)
+	}
+
+	if _, body := do(t, h, httptest.NewRequest("GET", "/", nil)); !strings.Contains(body, `name="path" value="/a.txt" form="batch-form"`) {
+		t.Errorf("listing has no checkboxes: %s", body)
+	}
+}
+
+func TestBatchDeleteMove(t *testing.T) {
+	root := newTestRoot(t)
+	os.WriteFile(filepath.Join(root, "c.txt"), []byte("c"), 0644)
+	os.MkdirAll(filepath.Join(root, "dst"), 0755)
+	os.WriteFile(filepath.Join(root, "dst", "c.txt"), []byte("old"), 0644)
+	os.MkdirAll(filepath.Join(root, "keep"), 0755)
+	os.WriteFile(filepath.Join(root, "keep", "k.txt"), []byte("k"), 0644)
+	config := writeConfig(t, `{"acl": [{"path": "/keep/**", "users": ["*"], "action": "deny"}]}`)
+	h := newTestHandler(t, Config{Root: root, ConfigFile: config}, WithReadWrite())
+
+	post := func(target string, form url.Values) (int, map[string]batchResult) {
+		t.Helper()
+		r := httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		res, body := do(t, h, r)
+		var data struct{ Results []batchResult }
+		json.Unmarshal([]byte(body), &data)
+		m := map[string]batchResult{}
+		for _, r := range data.Results {
+			m[r.Path] = r
+		}
+		return res.StatusCode, m
+	}
+
+	// 一项失败不影响其他项：同名文件已存在、没有权限的各自报错
+	status, got := post("/api/batch/move", url.Values{"path": {"/a.txt", "/c.txt", "/keep/k.txt", "/missing"}, "to": {"/dst"}})
+	if status != http.StatusOK || len(got) != 4 {
+		t.Fatalf("move: got %d %v", status, got)
+	}
+	if r := got["/a.txt"]; !r.OK || r.To != "/dst/a.txt" {
+		t.Errorf("move /a.txt = %+v", r)
+	}
+	for p, want := range map[string]int{"/c.txt": http.StatusConflict, "/keep/k.txt": http.StatusForbidden, "/missing": http.StatusNotFound} {
+		if r := got[p]; r.OK || r.Status != want || r.Error == "" {
+			t.Errorf("move %s = %+v, want status %d", p, r, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "dst", "a.txt")); err != nil {
+		t.Error("/a.txt was not moved")
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "dst", "c.txt")); string(b) != "old" {
+		t.Error("existing file was overwritten")
+	}
+
+	// 没有 recursive 时非空目录不删除
+	_, got = post("/api/batch/delete", url.Values{"path": {"/c.txt", "/sub", "/keep"}})
+	if !got["/c.txt"].OK || got["/sub"].Status != http.StatusConflict || got["/keep"].Status != http.StatusForbidden {
+		t.Errorf("delete = %v", got)
+	}
+	_, got = post("/api/batch/delete", url.Values{"path": {"/sub", "/sub/b.txt"}, "recursive": {"1"}})
+	if len(got) != 1 || !got["/sub"].OK {
+		t.Errorf("recursive delete = %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "sub")); err == nil {
+		t.Error("/sub was not deleted")
+	}
+
+	if status, _ := post("/api/batch/move", url.Values{"path": {"/dst"}}); status != http.StatusBadRequest {
+		t.Errorf("move without to: status = %d, want 400", status)
+	}
+	if status, _ := post("/api/batch/delete", nil); status != http.StatusBadRequest {
+		t.Errorf("delete nothing: status = %d, want 400", status)
+	}
+
+	if _, body := do(t, h, httptest.NewRequest("GET", "/", nil)); !strings.Contains(body, `id="batch-delete"`) {
+		t.Error("listing has no batch delete button")
+	}
+
+	// 只读模式下不能批量删除，也不显示按钮
+	ro := newTestHandler(t, Config{Root: root})
+	if _, body := do(t, ro, httptest.NewRequest("GET", "/", nil)); strings.Contains(body, `id="batch-delete"`) {
+		t.Error("read-only listing has a batch delete button")
+	}
+	r := httptest.NewRequest("POST", "/api/batch/delete", strings.NewReader("path=/dst"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if res, _ := do(t, ro, r); res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("read-only: status = %d, want 405", res.StatusCode)
+	}
+}
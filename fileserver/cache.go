@@ -0,0 +1,114 @@
+package fileserver
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// Cache-Control 策略：-cache-control 参数或配置文件 cache 中的规则按顺序匹配，第一条匹配的生效。
+// match 的写法：
+//
+//	/releases/**   以 / 开头时按路径通配符匹配，写法与访问控制规则相同
+//	*.zip          否则按文件名匹配
+//	listing        目录列表页面和 /api/list
+//
+// 没有规则匹配时不设置 Cache-Control，由浏览器自行决定
+
+// cacheRule 是一条缓存规则
+type cacheRule struct {
+	Match        string `json:"match"`
+	CacheControl string `json:"cache_control"`
+}
+
+// parseCacheRule 解析 -cache-control 参数，格式为 match=value
+func parseCacheRule(s string) (cacheRule, error) {
+	match, value, ok := strings.Cut(s, "=")
+	if !ok || match == "" || value == "" {
+		return cacheRule{}, fmt.Errorf("invalid cache rule %q, expected match=cache-control", s)
+	}
+	return cacheRule{Match: strings.TrimSpace(match), CacheControl: strings.TrimSpace(value)}, nil
+}
+
+func (rule cacheRule) matches(p string, listing bool) bool {
+	switch {
+	case rule.Match == "listing":
+		return listing
+	case strings.HasPrefix(rule.Match, "/"):
+		return matchGlob(rule.Match, p)
+	default:
+		ok, _ := path.Match(rule.Match, path.Base(p))
+		return ok && !listing
+	}
+}
+
+// cacheControl 按规则给成功的响应加上 Cache-Control，错误响应不加，避免 404 之类被长时间缓存
+func (s *server) cacheControl(next http.Handler) http.Handler {
+	// 配置文件中的规则可以重新加载，有配置文件时总是检查
+	if len(s.conf().cacheRules) == 0 && s.configFile == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if value, ok := s.cacheRuleFor(r); ok {
+			w = &cacheWriter{ResponseWriter: w, value: value}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cacheRuleFor 返回第一条匹配请求的规则中的 Cache-Control
+func (s *server) cacheRuleFor(r *http.Request) (string, bool) {
+	rules := s.conf().cacheRules
+	p, ok := targetPath(r)
+	if !ok || len(rules) == 0 {
+		return "", false
+	}
+	listing := strings.HasPrefix(r.URL.Path, "/api/list/")
+	if !strings.HasPrefix(r.URL.Path, "/download/") && !strings.HasPrefix(r.URL.Path, "/view/") {
+		if info, err := s.stat(p); err == nil && info.IsDir() {
+			listing = true
+		}
+	}
+	for _, rule := range rules {
+		if rule.matches(p, listing) {
+			return rule.CacheControl, true
+		}
+	}
+	return "", false
+}
+
+// cacheWriter 在写响应头时根据状态码决定是否加上 Cache-Control
+type cacheWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if code < 400 && w.Header().Get("Cache-Control") == "" {
+			w.Header().Set("Cache-Control", w.value)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *cacheWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// fileETag 根据修改时间和大小生成 ETag，不需要读取文件内容。
+// 配合 http.ServeContent 使用，它会处理 If-None-Match、If-Modified-Since 并返回 304
+func fileETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
@@ -0,0 +1,48 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConditionalView(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)})
+	res, body := do(t, h, httptest.NewRequest("GET", "/view/a.txt", nil))
+	etag, modified := res.Header.Get("ETag"), res.Header.Get("Last-Modified")
+	if res.StatusCode != http.StatusOK || body != "hello" || etag == "" || modified == "" {
+		t.Fatalf("got %d %q, ETag %q, Last-Modified %q", res.StatusCode, body, etag, modified)
+	}
+
+	r := httptest.NewRequest("GET", "/view/a.txt", nil)
+	r.Header.Set("If-None-Match", etag)
+	if res, body = do(t, h, r); res.StatusCode != http.StatusNotModified || body != "" {
+		t.Errorf("If-None-Match: got %d %q, want 304", res.StatusCode, body)
+	}
+	r = httptest.NewRequest("GET", "/view/a.txt", nil)
+	r.Header.Set("If-Modified-Since", modified)
+	if res, _ = do(t, h, r); res.StatusCode != http.StatusNotModified {
+		t.Errorf("If-Modified-Since: status = %d, want 304", res.StatusCode)
+	}
+	r = httptest.NewRequest("GET", "/view/a.txt", nil)
+	r.Header.Set("If-None-Match", `"other"`)
+	if res, _ = do(t, h, r); res.StatusCode != http.StatusOK {
+		t.Errorf("stale ETag: status = %d, want 200", res.StatusCode)
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t), CacheControl: []string{"/sub/**=no-store", "*.txt=max-age=3600", "listing=no-cache"}})
+	for p, want := range map[string]string{
+		"/download/a.txt":       "max-age=3600",
+		"/download/sub/b.txt":   "no-store",
+		"/":                     "no-cache",
+		"/api/list/":            "no-cache",
+		"/download/missing.txt": "",
+	} {
+		res, _ := do(t, h, httptest.NewRequest("GET", p, nil))
+		if cc := res.Header.Get("Cache-Control"); cc != want {
+			t.Errorf("%s: Cache-Control = %q, want %q", p, cc, want)
+		}
+	}
+}
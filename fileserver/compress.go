@@ -0,0 +1,185 @@
+package fileserver
+
+import (
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// 动态压缩：目录列表、JSON 接口和文本类文件的在线查看按 Accept-Encoding 使用 brotli 或 gzip 压缩。
+// /download/ 下载保持原样，断点续传的 Range 请求和已经压缩过的内容（图片、视频、压缩包）也不压缩
+
+// 小于这个大小的响应压缩收益很小
+const minCompressSize = 1024
+
+// compressible 判断 Content-Type 是否值得压缩
+func compressible(contentType string) bool {
+	t, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(t, "text/"), strings.HasSuffix(t, "+json"), strings.HasSuffix(t, "+xml"):
+		return true
+	}
+	switch t {
+	case "application/json", "application/javascript", "application/xml", "application/x-ndjson",
+		"image/svg+xml", "application/wasm":
+		return true
+	}
+	return false
+}
+
+// acceptsEncoding 判断 Accept-Encoding 中是否包含 encoding，q=0 表示明确拒绝
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// acceptEncoding 从 Accept-Encoding 中选出支持的编码，brotli 优先
+func acceptEncoding(r *http.Request) string {
+	switch {
+	case acceptsEncoding(r, "br"):
+		return "br"
+	case acceptsEncoding(r, "gzip"):
+		return "gzip"
+	}
+	return ""
+}
+
+// varyEncoding 告诉缓存响应内容随 Accept-Encoding 变化，已经有了就不重复添加
+func varyEncoding(h http.Header) {
+	for _, v := range h.Values("Vary") {
+		if strings.Contains(strings.ToLower(v), "accept-encoding") {
+			return
+		}
+	}
+	h.Add("Vary", "Accept-Encoding")
+}
+
+// compress 是压缩中间件
+func (s *server) compress(next http.Handler) http.Handler {
+	if !s.compression {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := acceptEncoding(r)
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" ||
+			strings.HasPrefix(r.URL.Path, "/download/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter 在写响应头时决定是否压缩
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	enc         io.WriteCloser // 不压缩时为 nil
+	wroteHeader bool
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	varyEncoding(h)
+	size, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+	if code == http.StatusOK && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) &&
+		(err != nil || size >= minCompressSize) {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		// 压缩后的内容和原文件字节不同，ETag 改为弱校验，条件请求仍然可以返回 304
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		if w.encoding == "br" {
+			w.enc = brotli.NewWriterLevel(w.ResponseWriter, 4)
+		} else {
+			w.enc = gzip.NewWriter(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.enc != nil {
+		return w.enc.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush 先把压缩器中的数据写出，实时推送的接口才能及时收到
+func (w *compressWriter) Flush() {
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressWriter) close() {
+	if w.enc != nil {
+		w.enc.Close()
+	}
+}
+
+// 预压缩文件：file.js 旁边有 file.js.br 或 file.js.gz 时直接发送压缩好的版本，类似 nginx 的 gzip_static。
+// 压缩文件比原文件旧时认为已经过期，不使用
+var sidecars = []struct{ encoding, ext string }{{"br", ".br"}, {"gzip", ".gz"}}
+
+// servePrecompressed 发送 p 的预压缩版本，没有合适的版本时返回 false。
+// Content-Type 等响应头由调用方按原文件设置好
+func (s *server) servePrecompressed(w http.ResponseWriter, r *http.Request, p string, info fs.FileInfo) bool {
+	for _, sc := range sidecars {
+		if !acceptsEncoding(r, sc.encoding) {
+			continue
+		}
+		f, err := s.open(p + sc.ext)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		cinfo, err := f.Stat()
+		if err != nil || cinfo.IsDir() || cinfo.ModTime().Before(info.ModTime()) {
+			continue
+		}
+		w.Header().Set("Content-Encoding", sc.encoding)
+		varyEncoding(w.Header())
+		w.Header().Set("ETag", fileETag(cinfo))
+		serveContent(w, r, cinfo, f)
+		return true
+	}
+	return false
+}
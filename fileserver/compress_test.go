@@ -0,0 +1,95 @@
+package fileserver
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestCompression(t *testing.T) {
+	root := newTestRoot(t)
+	text := strings.Repeat("log line\n", 500)
+	os.WriteFile(filepath.Join(root, "app.log"), []byte(text), 0644)
+	os.WriteFile(filepath.Join(root, "photo.png"), append([]byte("\x89PNG\r\n\x1a\n"), text...), 0644)
+	h := newTestHandler(t, Config{Root: root})
+	get := func(p, accept string) *http.Response {
+		r := httptest.NewRequest("GET", p, nil)
+		r.Header.Set("Accept-Encoding", accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	res := get("/view/app.log", "gzip")
+	if res.Header.Get("Content-Encoding") != "gzip" || !strings.Contains(res.Header.Get("Vary"), "Accept-Encoding") {
+		t.Fatalf("gzip: Content-Encoding %q, Vary %q", res.Header.Get("Content-Encoding"), res.Header.Get("Vary"))
+	}
+	zr, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(zr); string(b) != text {
+		t.Error("gzip body does not match the file")
+	}
+
+	res = get("/view/app.log", "gzip, br")
+	if res.Header.Get("Content-Encoding") != "br" {
+		t.Fatalf("br: Content-Encoding = %q", res.Header.Get("Content-Encoding"))
+	}
+	if b, _ := io.ReadAll(brotli.NewReader(res.Body)); string(b) != text {
+		t.Error("brotli body does not match the file")
+	}
+
+	for p, accept := range map[string]string{
+		"/view/app.log":     "gzip;q=0",
+		"/download/app.log": "gzip",
+		"/view/photo.png":   "gzip",
+		"/view/a.txt":       "gzip",
+	} {
+		if enc := get(p, accept).Header.Get("Content-Encoding"); enc != "" {
+			t.Errorf("%s (%s): Content-Encoding = %q, want none", p, accept, enc)
+		}
+	}
+
+	h = newTestHandler(t, Config{Root: root, DisableCompression: true})
+	if enc := get("/view/app.log", "gzip").Header.Get("Content-Encoding"); enc != "" {
+		t.Errorf("compression disabled: Content-Encoding = %q", enc)
+	}
+}
+
+func TestPrecompressed(t *testing.T) {
+	root := newTestRoot(t)
+	os.WriteFile(filepath.Join(root, "app.js"), []byte("console.log(1)"), 0644)
+	os.WriteFile(filepath.Join(root, "app.js.gz"), []byte("gzip bytes"), 0644)
+	os.WriteFile(filepath.Join(root, "app.js.br"), []byte("br bytes"), 0644)
+	h := newTestHandler(t, Config{Root: root})
+	for accept, want := range map[string]string{"gzip, br": "br bytes", "gzip": "gzip bytes", "": "console.log(1)"} {
+		r := httptest.NewRequest("GET", "/view/app.js?raw=1", nil)
+		r.Header.Set("Accept-Encoding", accept)
+		res, body := do(t, h, r)
+		if body != want {
+			t.Errorf("Accept-Encoding %q: body = %q, want %q", accept, body, want)
+		}
+		if accept != "" && !strings.HasPrefix(res.Header.Get("Content-Type"), "text/") {
+			t.Errorf("Accept-Encoding %q: Content-Type = %q, want the original file's type", accept, res.Header.Get("Content-Type"))
+		}
+	}
+
+	// 压缩文件比原文件旧时不再使用
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(root, "app.js.br"), old, old)
+	os.Chtimes(filepath.Join(root, "app.js.gz"), old, old)
+	r := httptest.NewRequest("GET", "/view/app.js?raw=1", nil)
+	r.Header.Set("Accept-Encoding", "gzip, br")
+	if res, body := do(t, h, r); body != "console.log(1)" || res.Header.Get("Content-Encoding") != "" {
+		t.Errorf("stale sidecar: got %q, Content-Encoding %q", body, res.Header.Get("Content-Encoding"))
+	}
+}
@@ -0,0 +1,68 @@
+package fileserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// fileConfig 是 -config 指定的 JSON 配置文件，命令行参数不方便表达的设置都放在这里
+type fileConfig struct {
+	Users       []User      `json:"users"`        // 本地用户，用于 Basic Auth 登录
+	RequireAuth bool        `json:"require_auth"` // 为 true 时所有请求都必须登录
+	ACL         []aclRule   `json:"acl"`          // 访问控制规则，按顺序匹配
+	JWT         *jwtConfig  `json:"jwt"`          // Bearer 令牌使用 JWT 时的校验设置
+	LDAP        *ldapConfig `json:"ldap"`         // 使用 LDAP / AD 校验 Basic Auth 用户名密码
+	OIDC        *oidcConfig `json:"oidc"`         // 通过 OIDC / GitHub 单点登录
+	Cache       []cacheRule `json:"cache"`        // Cache-Control 规则，排在 -cache-control 参数之后
+	Admins      []string    `json:"admins"`       // 能打开 /stats 等管理页面的用户，写法同 acl 的 users
+
+	MimeTypes map[string]string `json:"mime_types"` // 扩展名对应的 Content-Type，如 {".apk": "application/vnd.android.package-archive"}
+
+	Webhooks []webhookConfig `json:"webhooks"` // 下载、上传、删除时通知的地址
+}
+
+// loadConfig 读取配置文件，未知字段视为错误，避免拼写错误的设置被悄悄忽略
+func loadConfig(file string) (*fileConfig, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var cfg fileConfig
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	for i := range cfg.Users {
+		if err := cfg.Users[i].validate(); err != nil {
+			return nil, fmt.Errorf("%s: users[%d]: %w", file, i, err)
+		}
+	}
+	for i, rule := range cfg.ACL {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("%s: acl[%d]: %w", file, i, err)
+		}
+	}
+	if cfg.JWT != nil && cfg.JWT.Secret == "" && cfg.JWT.JWKSURL == "" {
+		// 没有密钥时任何签名都无法校验，不能当作“不检查签名”
+		return nil, fmt.Errorf("%s: jwt: secret or jwks_url is required", file)
+	}
+	for i, rule := range cfg.Cache {
+		if rule.Match == "" || rule.CacheControl == "" {
+			return nil, fmt.Errorf("%s: cache[%d]: match and cache_control are required", file, i)
+		}
+	}
+	for ext, typ := range cfg.MimeTypes {
+		if _, _, err := parseMimeType(ext + "=" + typ); err != nil {
+			return nil, fmt.Errorf("%s: mime_types: %w", file, err)
+		}
+	}
+	for i := range cfg.Webhooks {
+		if err := cfg.Webhooks[i].validate(); err != nil {
+			return nil, fmt.Errorf("%s: webhooks[%d]: %w", file, i, err)
+		}
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,66 @@
+package fileserver
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// CORS：-cors-origins 指定允许跨域访问的来源后，其他站点上的网页可以用 fetch 调用 JSON 接口和读取文件，
+// 预检请求（OPTIONS）在认证之前直接应答
+
+// corsConfig 是跨域设置
+type corsConfig struct {
+	origins []string // 允许的来源，* 表示任意来源
+	methods string
+	headers string
+}
+
+// 浏览器中的脚本默认只能读取少数几个响应头，下载、断点续传需要的这些要明确暴露
+const corsExposeHeaders = "Content-Length, Content-Range, Content-Disposition, ETag, Upload-Offset, Upload-Length"
+
+func (c *corsConfig) allowOrigin(origin string) string {
+	if slices.Contains(c.origins, "*") {
+		return "*"
+	}
+	for _, o := range c.origins {
+		if strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// cors 是跨域中间件，没有配置 -cors-origins 时不做任何事
+func (s *server) cors(next http.Handler) http.Handler {
+	if s.corsConf == nil {
+		return next
+	}
+	c := s.corsConf
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		allowed := c.allowOrigin(origin)
+		if allowed == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+
+		// 预检请求
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method, Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", c.methods)
+			w.Header().Set("Access-Control-Allow-Headers", c.headers)
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,42 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t), CORSOrigins: []string{"https://app.example.com/"}})
+	get := func(origin string) *http.Response {
+		r := httptest.NewRequest("GET", "/api/list/", nil)
+		r.Header.Set("Origin", origin)
+		res, _ := do(t, h, r)
+		return res
+	}
+
+	res := get("https://app.example.com")
+	if res.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		!strings.Contains(res.Header.Get("Access-Control-Expose-Headers"), "Content-Disposition") {
+		t.Errorf("allowed origin: headers %v", res.Header)
+	}
+	if res := get("https://evil.example.com"); res.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Error("other origin was allowed")
+	}
+
+	r := httptest.NewRequest("OPTIONS", "/api/files/a.txt", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", "PUT")
+	res, _ = do(t, h, r)
+	if res.StatusCode != http.StatusNoContent || res.Header.Get("Access-Control-Allow-Methods") != "GET, HEAD, OPTIONS" {
+		t.Errorf("preflight: got %d, methods %q", res.StatusCode, res.Header.Get("Access-Control-Allow-Methods"))
+	}
+
+	// 读写模式下允许修改文件的方法
+	h = newTestHandler(t, Config{Root: newTestRoot(t), CORSOrigins: []string{"*"}}, WithReadWrite())
+	res, _ = do(t, h, r)
+	if res.Header.Get("Access-Control-Allow-Origin") != "*" || !strings.Contains(res.Header.Get("Access-Control-Allow-Methods"), "PUT") {
+		t.Errorf("read-write preflight: headers %v", res.Header)
+	}
+}
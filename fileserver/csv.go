@@ -0,0 +1,103 @@
+package fileserver
+
+import (
+	"encoding/csv"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// CSV、TSV 表格预览：在线查看时渲染成 HTML 表格，第一行作为表头，只读取前 maxCSVRows 行，
+// 几个 GB 的导出文件也能很快打开，页面上有下载完整文件的链接；?raw=1 仍然是原文。
+// Config.Previews 或 RegisterPreview 为 .csv 注册了渲染器时使用注册的
+
+// 预览读取的行数和字节数上限，超过时只显示已经读到的部分
+const (
+	maxCSVRows  = 1000
+	maxCSVBytes = 8 << 20
+)
+
+// isCSV 判断 name 是否为可以预览成表格的文件，返回分隔符
+func isCSV(name string) (rune, bool) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".csv":
+		return ',', true
+	case ".tsv", ".tab":
+		return '\t', true
+	}
+	return 0, false
+}
+
+// CSVData 是表格预览页面的数据
+type CSVData struct {
+	Page
+	Name      string
+	Download  string
+	Parent    string
+	Header    []string
+	Rows      [][]string
+	Truncated bool // 文件没有读完，只显示了前面的部分
+}
+
+// readCSV 读取 src 的前 maxRows 行（不含表头），各行的列数可以不同。第一行就解析失败时返回错误
+func readCSV(src io.Reader, comma rune, maxRows int) (header []string, rows [][]string, truncated bool, err error) {
+	lr := &io.LimitedReader{R: src, N: maxCSVBytes}
+	cr := csv.NewReader(lr)
+	cr.Comma = comma
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			// 读到字节上限时最后一行可能不完整，去掉
+			if lr.N <= 0 && len(rows) > 0 {
+				rows, truncated = rows[:len(rows)-1], true
+			}
+			return header, rows, truncated, nil
+		}
+		if err != nil {
+			if header == nil {
+				return nil, nil, false, err
+			}
+			return header, rows, true, nil
+		}
+		for i, v := range rec {
+			rec[i] = strings.ToValidUTF8(v, "\uFFFD")
+		}
+		if header == nil {
+			// Excel 导出的 UTF-8 文件开头有 BOM
+			rec[0] = strings.TrimPrefix(rec[0], "\ufeff")
+			header = rec
+			continue
+		}
+		if len(rows) == maxRows {
+			return header, rows, true, nil
+		}
+		rows = append(rows, rec)
+	}
+}
+
+// csvHandler 渲染表格预览页面，文件读取或解析失败时返回 false，由调用方按原文输出
+func (s *server) csvHandler(w http.ResponseWriter, r *http.Request, decodedPath string, comma rune) bool {
+	f, err := s.open(decodedPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	header, rows, truncated, err := readCSV(f, comma, maxCSVRows)
+	if err != nil || header == nil {
+		return false
+	}
+	escaped := r.URL.EscapedPath()
+	s.render(w, "csv.html", CSVData{
+		Page:      s.page(w, r),
+		Name:      path.Base(decodedPath),
+		Download:  s.base + "/download" + strings.TrimPrefix(escaped, "/view"),
+		Parent:    s.base + parentDir(decodedPath),
+		Header:    header,
+		Rows:      rows,
+		Truncated: truncated,
+	})
+	return true
+}
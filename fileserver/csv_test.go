@@ -0,0 +1,45 @@
+package fileserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCSVPreview(t *testing.T) {
+	root := newTestRoot(t)
+	os.WriteFile(filepath.Join(root, "data.csv"), []byte("\ufeffname,note\nalice,\"a, b\"\nbob,<script>\ncarol\n"), 0644)
+	os.WriteFile(filepath.Join(root, "data.tsv"), []byte("id\tvalue\n1\tx,y\n"), 0644)
+	var big strings.Builder
+	big.WriteString("n\n")
+	for i := 0; i < maxCSVRows+10; i++ {
+		fmt.Fprintf(&big, "%d\n", i)
+	}
+	os.WriteFile(filepath.Join(root, "big.csv"), []byte(big.String()), 0644)
+	h := newTestHandler(t, Config{Root: root})
+
+	res, body := do(t, h, httptest.NewRequest("GET", "/view/data.csv", nil))
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, "<th>name</th>") || !strings.Contains(body, "<td>a, b</td>") || !strings.Contains(body, "<td>carol</td>") {
+		t.Fatalf("csv: got %d %s", res.StatusCode, body)
+	}
+	if strings.Contains(body, "<script>") || strings.Contains(body, "csv-more") {
+		t.Errorf("csv: unescaped cell or truncation note: %s", body)
+	}
+
+	if _, body := do(t, h, httptest.NewRequest("GET", "/view/data.tsv", nil)); !strings.Contains(body, "<td>x,y</td>") {
+		t.Errorf("tsv: %s", body)
+	}
+
+	_, body = do(t, h, httptest.NewRequest("GET", "/view/big.csv", nil))
+	if !strings.Contains(body, fmt.Sprintf("<td>%d</td>", maxCSVRows-1)) || strings.Contains(body, fmt.Sprintf("<td>%d</td>", maxCSVRows)) || !strings.Contains(body, `<a href="/download/big.csv">`) {
+		t.Errorf("big csv was not truncated to %d rows", maxCSVRows)
+	}
+
+	if _, body := do(t, h, httptest.NewRequest("GET", "/view/data.csv?raw=1", nil)); !strings.HasPrefix(body, "\ufeffname,note") {
+		t.Errorf("raw: %q", body)
+	}
+}
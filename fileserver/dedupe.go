@@ -0,0 +1,168 @@
+package fileserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 去重（-dedupe）：写入的每个文件按内容的 SHA-256 在根目录下隐藏的 .objects 中保存一个硬链接，
+// 再上传相同内容的文件时直接链接到已有的对象，同一个构建产物上传多次不会多占空间。
+// 所有写入都是写临时文件再改名，不会原地修改已经链接的文件。硬链接的副本共用修改时间和权限。
+// 已有的目录用 dedupe 子命令（Dedupe）整理，它同时删除树中已经没有文件使用的对象
+
+const objectsDir = ".objects"
+
+// objectFile 返回根目录 root 下内容摘要为 sum 的对象（本地路径），按前两位分子目录，避免一个目录中文件太多
+func objectFile(root, sum string) string {
+	return filepath.Join(root, objectsDir, sum[:2], sum)
+}
+
+// fileSHA256 计算本地文件的 SHA-256
+func fileSHA256(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// linkOver 用指向 obj 的硬链接替换文件 dst：先在同目录下建立链接再改名，失败时 dst 不变
+func linkOver(obj, dst string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".dedupe-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+	if err := os.Link(obj, tmp.Name()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// dedupeFile 在写好的临时文件 tmp 改名到目标位置之前调用：已经有相同内容的对象时把 tmp 换成它的硬链接，
+// 否则把 tmp 保存为新的对象。出错时只记录日志，文件照常按普通文件保存
+func (s *server) dedupeFile(tmp string) {
+	sum, err := fileSHA256(tmp)
+	if err != nil {
+		log.Printf("Failed to deduplicate %s: %v", tmp, err)
+		return
+	}
+	obj := objectFile(s.root, sum)
+	if _, err := os.Stat(obj); err == nil {
+		if err := linkOver(obj, tmp); err != nil {
+			log.Printf("Failed to deduplicate %s: %v", tmp, err)
+			return
+		}
+		// 链接后的文件带着对象原来的修改时间，改成现在，目录列表中刚上传的文件不会显示成旧的时间
+		now := time.Now()
+		os.Chtimes(tmp, now, now)
+		return
+	}
+	err = os.MkdirAll(filepath.Dir(obj), 0700)
+	if err == nil {
+		err = os.Link(tmp, obj)
+	}
+	if err != nil {
+		log.Printf("Failed to deduplicate %s: %v", tmp, err)
+	}
+}
+
+// DedupeResult 是 Dedupe 整理的结果
+type DedupeResult struct {
+	Files  int   // 检查的文件数
+	Linked int   // 换成硬链接的重复文件数
+	Saved  int64 // 节省的空间，单位字节
+	Pruned int   // 删除的不再使用的对象数
+}
+
+// Dedupe 整理 root 下已有的文件：内容相同的文件换成同一个对象的硬链接，并删除已经没有文件使用的对象。
+// 回收站和历史版本中的文件一起整理。dryRun 为 true 时只统计，不修改任何文件。
+// 和服务的 -dedupe 使用同一个 .objects 目录，服务运行时也可以执行
+func Dedupe(root string, dryRun bool) (DedupeResult, error) {
+	var res DedupeResult
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return res, err
+	}
+	used := map[string]bool{}
+	err = filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if filepath.Dir(name) == root && (foldPath(d.Name()) == objectsDir || foldPath(d.Name()) == uploadsDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		res.Files++
+		sum, err := fileSHA256(name)
+		if err != nil {
+			return err
+		}
+		obj := objectFile(root, sum)
+		oinfo, err := os.Stat(obj)
+		switch {
+		case err == nil && os.SameFile(info, oinfo):
+			// 已经是对象的链接
+		case err == nil || used[sum]:
+			res.Linked++
+			res.Saved += info.Size()
+			if !dryRun {
+				if err := linkOver(obj, name); err != nil {
+					return err
+				}
+			}
+		case !dryRun:
+			if err := os.MkdirAll(filepath.Dir(obj), 0700); err != nil {
+				return err
+			}
+			if err := os.Link(name, obj); err != nil {
+				return err
+			}
+		}
+		used[sum] = true
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+
+	// 对象只剩自己一个链接时文件已经被删除或覆盖，树中找不到使用它的文件
+	objects, _ := filepath.Glob(filepath.Join(root, objectsDir, "*", "*"))
+	for _, obj := range objects {
+		if used[filepath.Base(obj)] {
+			continue
+		}
+		res.Pruned++
+		if !dryRun {
+			if err := os.Remove(obj); err != nil {
+				return res, err
+			}
+		}
+	}
+	return res, nil
+}
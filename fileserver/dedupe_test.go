@@ -0,0 +1,83 @@
+package fileserver
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func sameFile(t *testing.T, a, b string) bool {
+	t.Helper()
+	ia, err := os.Stat(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ib, err := os.Stat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return os.SameFile(ia, ib)
+}
+
+func TestDedupeUploads(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root, Dedupe: true}, WithReadWrite())
+	for _, name := range []string{"x/build.bin", "y/build.bin"} {
+		if res, body := do(t, h, httptest.NewRequest("PUT", "/api/files/"+name, strings.NewReader("artifact"))); res.StatusCode >= 300 {
+			t.Fatalf("PUT %s: status = %d, body %s", name, res.StatusCode, body)
+		}
+	}
+	do(t, h, httptest.NewRequest("PUT", "/api/files/z.bin", strings.NewReader("other")))
+	if !sameFile(t, filepath.Join(root, "x", "build.bin"), filepath.Join(root, "y", "build.bin")) {
+		t.Error("identical uploads are not linked")
+	}
+	if sameFile(t, filepath.Join(root, "x", "build.bin"), filepath.Join(root, "z.bin")) {
+		t.Error("different uploads are linked")
+	}
+	// 覆盖其中一个不影响另一个
+	do(t, h, httptest.NewRequest("PUT", "/api/files/y/build.bin?overwrite=1", strings.NewReader("changed")))
+	if b, _ := os.ReadFile(filepath.Join(root, "x", "build.bin")); string(b) != "artifact" {
+		t.Errorf("linked copy changed to %q", b)
+	}
+	if _, body := do(t, h, httptest.NewRequest("GET", "/", nil)); strings.Contains(body, objectsDir) {
+		t.Error(".objects is listed")
+	}
+	// 对象不重复计入已用空间
+	if got := h.s.diskUsage(); got != int64(len("hello")+len("world")+len("artifact")+len("changed")+len("other")) {
+		t.Errorf("disk usage = %d", got)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "a"), 0755)
+	os.WriteFile(filepath.Join(root, "a", "1.bin"), []byte("same"), 0644)
+	os.WriteFile(filepath.Join(root, "2.bin"), []byte("same"), 0644)
+	os.WriteFile(filepath.Join(root, "3.bin"), []byte("unique"), 0644)
+
+	res, err := Dedupe(root, true)
+	if err != nil || res != (DedupeResult{Files: 3, Linked: 1, Saved: 4}) {
+		t.Fatalf("dry run = %+v, %v", res, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, objectsDir)); err == nil {
+		t.Error("dry run created .objects")
+	}
+	res, err = Dedupe(root, false)
+	if err != nil || res != (DedupeResult{Files: 3, Linked: 1, Saved: 4}) {
+		t.Fatalf("dedupe = %+v, %v", res, err)
+	}
+	if !sameFile(t, filepath.Join(root, "a", "1.bin"), filepath.Join(root, "2.bin")) {
+		t.Error("duplicates are not linked")
+	}
+	// 再次执行没有可以整理的，删除文件后它的对象被清理
+	os.Remove(filepath.Join(root, "3.bin"))
+	res, err = Dedupe(root, false)
+	if err != nil || res != (DedupeResult{Files: 2, Pruned: 1}) {
+		t.Fatalf("second run = %+v, %v", res, err)
+	}
+	if objects, _ := filepath.Glob(filepath.Join(root, objectsDir, "*", "*")); len(objects) != 1 {
+		t.Errorf("objects = %v", objects)
+	}
+}
@@ -0,0 +1,135 @@
+package fileserver
+
+import (
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 目录总大小：目录列表中每个子目录旁边显示它包含的所有文件的总大小，页面打开后由脚本逐个向
+// GET /api/size/<目录> 查询，结果出来之前显示占位符。开启了 -index 时直接从索引读取；
+// 否则在后台遍历目录，结果缓存一段时间，同时最多遍历两个目录。-dir-sizes=false 关闭
+
+const (
+	dirSizeTTL      = time.Minute      // 遍历结果的缓存时间
+	dirSizeWait     = 10 * time.Second // 请求最多等待的时间，超过时返回 202，遍历在后台继续
+	dirSizeParallel = 2
+)
+
+// dirSizes 缓存遍历目录得到的总大小
+type dirSizes struct {
+	mu   sync.Mutex
+	jobs map[string]*dirSizeJob
+	sem  chan struct{}
+}
+
+// dirSizeJob 是一次遍历，done 关闭后结果可用
+type dirSizeJob struct {
+	done  chan struct{}
+	size  int64
+	files int64
+	err   error
+	at    time.Time // 完成时间
+}
+
+func newDirSizes() *dirSizes {
+	return &dirSizes{jobs: map[string]*dirSizeJob{}, sem: make(chan struct{}, dirSizeParallel)}
+}
+
+// get 返回目录 p 的遍历，缓存中没有或已经过期时开始新的遍历
+func (d *dirSizes) get(fsys fs.FS, p string) *dirSizeJob {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if j := d.jobs[p]; j != nil {
+		select {
+		case <-j.done:
+			if time.Since(j.at) < dirSizeTTL {
+				return j
+			}
+		default:
+			return j
+		}
+	}
+	// 顺便清理过期的结果
+	for k, j := range d.jobs {
+		select {
+		case <-j.done:
+			if time.Since(j.at) >= dirSizeTTL {
+				delete(d.jobs, k)
+			}
+		default:
+		}
+	}
+	j := &dirSizeJob{done: make(chan struct{})}
+	d.jobs[p] = j
+	go func() {
+		d.sem <- struct{}{}
+		defer func() { <-d.sem }()
+		j.size, j.files, j.err = walkSize(fsys, p)
+		j.at = time.Now()
+		close(j.done)
+	}()
+	return j
+}
+
+// walkSize 遍历目录 p，返回其中所有普通文件的总大小和个数，程序自己使用的文件不计算
+func walkSize(fsys fs.FS, p string) (size, files int64, err error) {
+	err = fs.WalkDir(fsys, fsName(p), func(name string, e fs.DirEntry, err error) error {
+		if err != nil {
+			// 没有权限读取的子目录跳过，不影响其他部分
+			if e != nil && e.IsDir() && name != fsName(p) {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if hiddenFiles[foldPath(e.Name())] {
+			if e.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if e.Type().IsRegular() {
+			if info, err := e.Info(); err == nil {
+				size += info.Size()
+				files++
+			}
+		}
+		return nil
+	})
+	return size, files, err
+}
+
+// dirSizeHandler 处理 GET /api/size/<目录>，返回 {"path", "size", "files"}；还没有算完时返回 202 和 {"pending": true}，稍后再查询
+func (s *server) dirSizeHandler(w http.ResponseWriter, r *http.Request) {
+	if s.sizes == nil {
+		apiError(w, http.StatusNotFound, "directory sizes are disabled")
+		return
+	}
+	p := cleanPath(strings.TrimPrefix(r.URL.Path, "/api/size"))
+	if info, err := s.stat(p); err != nil || !info.IsDir() || isHidden(p) {
+		apiError(w, http.StatusNotFound, "directory not found")
+		return
+	}
+	if s.index != nil {
+		if size, files, ok := s.index.dirSize(p); ok && s.index.isReady() {
+			writeJSON(w, http.StatusOK, map[string]any{"path": p, "size": size, "files": files})
+			return
+		}
+	}
+	j := s.sizes.get(s.fsys, p)
+	select {
+	case <-j.done:
+	case <-time.After(dirSizeWait):
+		writeJSON(w, http.StatusAccepted, map[string]any{"path": p, "pending": true})
+		return
+	case <-r.Context().Done():
+		return
+	}
+	if j.err != nil {
+		apiError(w, http.StatusInternalServerError, "failed to read directory")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"path": p, "size": j.size, "files": j.files})
+}
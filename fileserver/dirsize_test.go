@@ -0,0 +1,53 @@
+package fileserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDirSizeAPI(t *testing.T) {
+	root := newTestRoot(t)
+	os.MkdirAll(filepath.Join(root, "sub", "deep"), 0755)
+	os.WriteFile(filepath.Join(root, "sub", "deep", "c.txt"), []byte("12345678"), 0644)
+	size := func(h *Handler, p string) (status int, total, files int64) {
+		t.Helper()
+		res, body := do(t, h, httptest.NewRequest("GET", "/api/size"+p, nil))
+		var data struct{ Size, Files int64 }
+		json.Unmarshal([]byte(body), &data)
+		return res.StatusCode, data.Size, data.Files
+	}
+
+	h := newTestHandler(t, Config{Root: root})
+	if status, total, files := size(h, "/sub"); status != http.StatusOK || total != 13 || files != 2 {
+		t.Errorf("/sub = %d, %d bytes in %d files, want 200, 13 in 2", status, total, files)
+	}
+	for _, p := range []string{"/a.txt", "/missing"} {
+		if status, _, _ := size(h, p); status != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", p, status)
+		}
+	}
+	_, body := do(t, h, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(body, `class="size dir-size loading" data-path="/sub"`) {
+		t.Error("listing has no placeholder for the directory size")
+	}
+
+	// 开启索引后直接使用索引中的结果
+	indexed := newTestHandler(t, Config{Root: root, Index: true})
+	waitIndex(t, "first scan", indexed.s.index.isReady)
+	if status, total, files := size(indexed, "/"); status != http.StatusOK || total != 18 || files != 3 {
+		t.Errorf("/ = %d, %d bytes in %d files, want 200, 18 in 3", status, total, files)
+	}
+
+	off := newTestHandler(t, Config{Root: root, DisableDirSizes: true})
+	if status, _, _ := size(off, "/sub"); status != http.StatusNotFound {
+		t.Errorf("disabled: status = %d, want 404", status)
+	}
+	if _, body := do(t, off, httptest.NewRequest("GET", "/", nil)); strings.Contains(body, "dir-size") {
+		t.Error("listing shows directory sizes while disabled")
+	}
+}
@@ -0,0 +1,113 @@
+package fileserver
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 在线编辑：/edit/<路径> 显示文本框，POST 同一地址保存，只在读写模式下可用
+
+// 超过这个大小的文件不提供在线编辑
+const maxEditSize = 1 << 20
+
+// 除源码和 Markdown 之外可以编辑的纯文本扩展名
+var textExts = map[string]bool{
+	".txt": true, ".log": true, ".csv": true, ".tsv": true, ".cfg": true, ".env": true,
+	".gitignore": true, ".htaccess": true, ".service": true, ".nginx": true,
+}
+
+// isEditable 根据文件名判断是否显示编辑链接，内容是否为文本在打开时再检查
+func isEditable(name string) bool {
+	return isCode(name) || isMarkdown(name) || textExts[strings.ToLower(filepath.Ext(name))]
+}
+
+// EditData 是编辑页面的数据
+type EditData struct {
+	Page
+	Name    string
+	Parent  string
+	View    string // 查看地址
+	Content string
+	ModTime int64 // 打开时文件的修改时间，保存时用来发现别人同时做的修改
+	Saved   bool
+	Error   string
+}
+
+// editHandler 处理 /edit/<路径>
+func (s *server) editHandler(w http.ResponseWriter, r *http.Request) {
+	if s.readOnly() {
+		s.httpError(w, r, http.StatusMethodNotAllowed, "Server is read-only")
+		return
+	}
+	p := cleanPath(strings.TrimPrefix(r.URL.Path, "/edit"))
+	filePath := s.root + p
+	// 直接读写本地文件，先按符号链接策略检查路径，不能经过链接编辑根目录外面的文件
+	if err := s.checkSymlinks(p); err != nil {
+		s.httpError(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+	info, err := os.Stat(filePath)
+	if err != nil || info.IsDir() || isHidden(p) {
+		s.httpError(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+	if info.Size() > maxEditSize {
+		s.httpError(w, r, http.StatusRequestEntityTooLarge, "File too large to edit")
+		return
+	}
+	src, err := os.ReadFile(filePath)
+	if err != nil || !isText(src) {
+		s.httpError(w, r, http.StatusUnsupportedMediaType, "Not a text file")
+		return
+	}
+
+	data := EditData{
+		Page:    s.page(w, r),
+		Name:    info.Name(),
+		Parent:  s.base + parentDir(p),
+		View:    s.base + "/view" + strings.TrimPrefix(r.URL.EscapedPath(), "/edit"),
+		Content: string(src),
+		ModTime: info.ModTime().UnixNano(),
+		Saved:   r.URL.Query().Get("saved") != "",
+	}
+
+	status := http.StatusOK
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPost:
+		content := r.FormValue("content")
+		// 浏览器提交的文本框内容总是 CRLF 换行，原文件不是 CRLF 时换回 LF
+		if !bytes.Contains(src, []byte("\r\n")) {
+			content = strings.ReplaceAll(content, "\r\n", "\n")
+		}
+		data.Content = content
+		if len(content) > maxEditSize {
+			data.Error = "edit.tooLarge"
+		} else if mt, _ := strconv.ParseInt(r.FormValue("mtime"), 10, 64); mt != info.ModTime().UnixNano() {
+			data.Error = "edit.conflict"
+		} else if err := s.saveFile(p, strings.NewReader(content), true); err != nil {
+			data.Error = "edit.failed"
+		} else {
+			os.Chmod(filePath, info.Mode().Perm())
+			s.auditHTTP(r, auditEntry{Action: auditEdit, Path: p, Size: int64(len(content))})
+			http.Redirect(w, r, r.URL.Path+"?saved=1", http.StatusSeeOther)
+			return
+		}
+		status = http.StatusConflict
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		s.httpError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	s.renderStatus(w, status, "edit.html", data)
+}
+
+// isText 判断内容是否为 UTF-8 文本
+func isText(b []byte) bool {
+	return utf8.Valid(b) && bytes.IndexByte(b, 0) < 0
+}
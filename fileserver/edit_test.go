@@ -0,0 +1,53 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEditor(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root}, WithReadWrite(), WithBasePath("/files"))
+	res, body := do(t, h, httptest.NewRequest("GET", "/files/edit/a.txt", nil))
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, "\nhello</textarea>") {
+		t.Fatalf("editor page: status = %d", res.StatusCode)
+	}
+	info, _ := os.Stat(filepath.Join(root, "a.txt"))
+	mtime := strconv.FormatInt(info.ModTime().UnixNano(), 10)
+
+	save := func(content, mtime string) *http.Response {
+		form := url.Values{"content": {content}, "mtime": {mtime}}
+		r := httptest.NewRequest("POST", "/files/edit/a.txt", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		res, _ := do(t, h, r)
+		return res
+	}
+	// 打开之后文件被别人改过
+	if res := save("stale", "1"); res.StatusCode != http.StatusConflict {
+		t.Errorf("stale mtime: status = %d, want 409", res.StatusCode)
+	}
+	res = save("line 1\r\nline 2", mtime)
+	if res.StatusCode != http.StatusSeeOther || res.Header.Get("Location") != "/files/edit/a.txt?saved=1" {
+		t.Fatalf("save: status = %d, Location = %q", res.StatusCode, res.Header.Get("Location"))
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "a.txt")); string(b) != "line 1\nline 2" {
+		t.Errorf("saved file = %q", b)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "bin.txt"), []byte{0, 1, 2}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/files/edit/bin.txt", nil)); res.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("binary file: status = %d, want 415", res.StatusCode)
+	}
+	ro := newTestHandler(t, Config{Root: root})
+	if res, _ := do(t, ro, httptest.NewRequest("GET", "/edit/a.txt", nil)); res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("read-only mode: status = %d, want 405", res.StatusCode)
+	}
+}
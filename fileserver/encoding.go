@@ -0,0 +1,116 @@
+package fileserver
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// 旧文件名编码（-filename-encoding）：老的 Windows 工具、zip 解压出来的文件名常常是 GBK、Big5 或 Shift_JIS 字节，
+// 在 UTF-8 的页面上显示成乱码，链接也打不开。encodedFS 把目录项中不是合法 UTF-8 的名字按指定编码转成 UTF-8，
+// 显示和生成链接都用转换后的名字；请求中的 UTF-8 路径在磁盘上找不到时再按这个编码转回去查找。
+// 本来就是 UTF-8 的文件名不受影响。只转换读取，上传的文件仍然用 UTF-8 命名
+
+// encodedFS 在 fsys 之上转换文件名的编码
+type encodedFS struct {
+	fs.FS
+	enc encoding.Encoding
+}
+
+// newEncodedFS 返回按编码 name（gbk、big5、shift_jis 等 WHATWG 编码名）转换文件名的 fsys
+func newEncodedFS(fsys fs.FS, name string) (*encodedFS, error) {
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown filename encoding %q", name)
+	}
+	return &encodedFS{FS: fsys, enc: enc}, nil
+}
+
+// decode 把磁盘上的名字转换成 UTF-8，已经是 UTF-8 的原样返回
+func (f *encodedFS) decode(name string) string {
+	if utf8.ValidString(name) {
+		return name
+	}
+	if s, err := f.enc.NewDecoder().String(name); err == nil {
+		return s
+	}
+	return name
+}
+
+// resolve 返回 UTF-8 路径 name 在磁盘上的名字：逐级查找，原样存在的部分不转换，否则换成按编码转换后的名字
+func (f *encodedFS) resolve(name string) string {
+	if isASCII(name) {
+		return name
+	}
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		if isASCII(part) {
+			continue
+		}
+		enc, err := f.enc.NewEncoder().String(part)
+		if err != nil || enc == part {
+			continue
+		}
+		if _, err := fs.Stat(f.FS, path.Join(parts[:i+1]...)); err == nil {
+			continue
+		}
+		parts[i] = enc
+	}
+	return strings.Join(parts, "/")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *encodedFS) Open(name string) (fs.File, error) {
+	return f.FS.Open(f.resolve(name))
+}
+
+func (f *encodedFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := fs.Stat(f.FS, f.resolve(name))
+	if err != nil {
+		return nil, err
+	}
+	return renamed{info, f.decode(info.Name())}, nil
+}
+
+// ReadDir 列出目录，目录项的名字转换成 UTF-8
+func (f *encodedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(f.FS, f.resolve(name))
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range entries {
+		if n := f.decode(e.Name()); n != e.Name() {
+			entries[i] = renamedEntry{e, n}
+		}
+	}
+	return entries, nil
+}
+
+// renamedEntry 是换了名字的目录项
+type renamedEntry struct {
+	fs.DirEntry
+	name string
+}
+
+func (e renamedEntry) Name() string { return e.name }
+
+func (e renamedEntry) Info() (fs.FileInfo, error) {
+	info, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return renamed{info, e.name}, nil
+}
@@ -0,0 +1,49 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestFilenameEncoding(t *testing.T) {
+	root := newTestRoot(t)
+	dir, _ := simplifiedchinese.GBK.NewEncoder().String("资料")
+	name, _ := simplifiedchinese.GBK.NewEncoder().String("报告.txt")
+	if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+		t.Skipf("file system does not accept GBK names: %v", err)
+	}
+	os.WriteFile(filepath.Join(root, dir, name), []byte("gbk"), 0644)
+	os.WriteFile(filepath.Join(root, "中文.txt"), []byte("utf-8"), 0644)
+	h := newTestHandler(t, Config{Root: root, FilenameEncoding: "gbk"})
+
+	res, body := do(t, h, httptest.NewRequest("GET", "/", nil))
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, "资料") || !strings.Contains(body, "中文.txt") {
+		t.Errorf("listing /: status = %d\n%s", res.StatusCode, body)
+	}
+	_, body = do(t, h, httptest.NewRequest("GET", "/"+url.PathEscape("资料")+"/", nil))
+	link := "/download/" + url.PathEscape("资料") + "/" + url.PathEscape("报告.txt")
+	if !strings.Contains(body, ">报告.txt<") || !strings.Contains(body, "/"+url.PathEscape("报告.txt")) {
+		t.Errorf("listing the GBK directory:\n%s", body)
+	}
+	if res, body := do(t, h, httptest.NewRequest("GET", link, nil)); res.StatusCode != http.StatusOK || body != "gbk" {
+		t.Errorf("GET %s: status = %d, body %q", link, res.StatusCode, body)
+	}
+	if res, body := do(t, h, httptest.NewRequest("GET", "/download/"+url.PathEscape("中文.txt"), nil)); body != "utf-8" {
+		t.Errorf("UTF-8 name: status = %d, body %q", res.StatusCode, body)
+	}
+	_, body = do(t, h, httptest.NewRequest("GET", "/api/list/"+url.PathEscape("资料"), nil))
+	if !strings.Contains(body, `"name":"报告.txt"`) {
+		t.Errorf("/api/list: %s", body)
+	}
+
+	if _, err := New(Config{Root: root, FilenameEncoding: "klingon"}); err == nil {
+		t.Error("unknown encoding accepted")
+	}
+}
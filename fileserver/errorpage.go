@@ -0,0 +1,56 @@
+package fileserver
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// 错误页面：浏览器访问时显示和目录列表同样风格的页面，脚本和 curl 仍然得到纯文本。
+// -error-pages 指定的目录中可以放 404.html、403.html、500.html 等按状态码命名的模板，
+// 以及作为其余状态码默认页面的 error.html
+
+// ErrorData 是错误页面模板使用的数据
+type ErrorData struct {
+	Page
+	Status  int    // HTTP 状态码
+	Title   string // 状态码对应的标题，已翻译
+	Message string // 错误说明，不包含系统错误信息
+}
+
+// httpError 返回错误响应，代替 http.Error。msg 会直接显示给用户，不要传入 err.Error()
+func (s *server) httpError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Error(w, msg, status)
+		return
+	}
+	page := s.page(w, r)
+	key := "error." + strconv.Itoa(status)
+	title := page.T(key)
+	if title == key {
+		title = http.StatusText(status)
+	}
+	name := fmt.Sprintf("error-%d.html", status)
+	if s.tpl.Lookup(name) == nil {
+		name = "error.html"
+	}
+	s.renderStatus(w, status, name, ErrorData{Page: page, Status: status, Title: title, Message: msg})
+}
+
+// pathError 把读取文件或目录时的错误转换成对应的错误页面，系统错误信息只写入日志
+func (s *server) pathError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, os.ErrNotExist), errors.Is(err, syscall.ENOTDIR):
+		s.httpError(w, r, http.StatusNotFound, "File not found")
+	case errors.Is(err, os.ErrPermission):
+		s.httpError(w, r, http.StatusForbidden, "Permission denied")
+	default:
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+		s.httpError(w, r, http.StatusInternalServerError, "Internal server error")
+	}
+}
@@ -0,0 +1,43 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestErrorPages(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)})
+	res, body := do(t, h, httptest.NewRequest("GET", "/download/missing.txt", nil))
+	if res.StatusCode != http.StatusNotFound || body != "File not found\n" {
+		t.Errorf("plain: got %d %q", res.StatusCode, body)
+	}
+	r := httptest.NewRequest("GET", "/download/missing.txt", nil)
+	r.Header.Set("Accept", "text/html,application/xhtml+xml")
+	res, body = do(t, h, r)
+	if res.StatusCode != http.StatusNotFound || !strings.Contains(res.Header.Get("Content-Type"), "text/html") ||
+		!strings.Contains(body, "<h1>404 ") || !strings.Contains(body, "File not found") {
+		t.Errorf("browser: got %d %q", res.StatusCode, body)
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "404.html"), []byte(`custom 404: {{.Message}}`), 0644)
+	os.WriteFile(filepath.Join(dir, "error.html"), []byte(`custom {{.Status}}`), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.html"), []byte(`{{broken`), 0644)
+	h = newTestHandler(t, Config{Root: newTestRoot(t), ErrorPages: dir})
+	for p, want := range map[string]string{"/download/missing.txt": "custom 404: File not found", "/api/mkdir": "custom 405"} {
+		r := httptest.NewRequest("GET", p, nil)
+		r.Header.Set("Accept", "text/html")
+		if _, body := do(t, h, r); body != want {
+			t.Errorf("%s: body = %q, want %q", p, body, want)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, "500.html"), []byte(`{{broken`), 0644)
+	if _, err := New(Config{Root: t.TempDir(), ErrorPages: dir}); err == nil {
+		t.Error("invalid error page template accepted")
+	}
+}
@@ -0,0 +1,342 @@
+package fileserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 照片的拍摄信息：在线查看 JPEG 时读取其中的 EXIF，在图片旁边显示相机、镜头、拍摄时间、曝光参数和 GPS 位置，
+// 整理手机、相机导出的大量照片时不用下载下来再看。只读取文件开头的 APP1 段，不解码图片。
+// -exif-gps=false 时不显示 GPS 位置
+
+var errNoEXIF = errors.New("no EXIF data")
+
+// EXIF 是照片中的拍摄信息，没有的项为空
+type EXIF struct {
+	Camera   string // 相机厂商和型号
+	Lens     string
+	Taken    string // 拍摄时间，格式 2006-01-02 15:04:05，照片本身不带时区
+	Exposure string // 曝光时间，如 1/250 s
+	Aperture string // 光圈，如 f/2.8
+	ISO      int
+	Focal    string // 焦距，如 35 mm
+	Width    int    // 图片宽度，单位像素
+	Height   int
+	GPS      bool // 是否有 GPS 位置
+	Lat      float64
+	Lon      float64
+	Altitude string // 海拔，如 12.5 m
+}
+
+// Location 返回 GPS 位置的文字形式
+func (e *EXIF) Location() string {
+	return strconv.FormatFloat(e.Lat, 'f', 6, 64) + ", " + strconv.FormatFloat(e.Lon, 'f', 6, 64)
+}
+
+// MapURL 返回在 OpenStreetMap 上显示 GPS 位置的地址
+func (e *EXIF) MapURL() string {
+	lat, lon := strconv.FormatFloat(e.Lat, 'f', 6, 64), strconv.FormatFloat(e.Lon, 'f', 6, 64)
+	return "https://www.openstreetmap.org/?mlat=" + lat + "&mlon=" + lon + "#map=15/" + lat + "/" + lon
+}
+
+// 最多读取的 APP1 段大小，EXIF 不会超过一个 JPEG 段的上限 64 KB
+const maxEXIFSize = 64 * 1024
+
+// exifSegment 在 JPEG 的开头找到 EXIF 所在的 APP1 段，返回其中的 TIFF 数据。遇到图像数据（SOS）时停止
+func exifSegment(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return nil, errNoEXIF
+	}
+	for {
+		b, err := br.ReadByte()
+		if err != nil || b != 0xFF {
+			return nil, errNoEXIF
+		}
+		// 标记前可以有多个填充的 0xFF
+		m := byte(0xFF)
+		for m == 0xFF {
+			if m, err = br.ReadByte(); err != nil {
+				return nil, errNoEXIF
+			}
+		}
+		switch {
+		case m == 0xD9 || m == 0xDA:
+			return nil, errNoEXIF
+		case m >= 0xD0 && m <= 0xD7 || m == 0x01:
+			// 没有长度的标记
+			continue
+		}
+		var l [2]byte
+		if _, err := io.ReadFull(br, l[:]); err != nil {
+			return nil, errNoEXIF
+		}
+		n := int(binary.BigEndian.Uint16(l[:])) - 2
+		if n < 0 {
+			return nil, errNoEXIF
+		}
+		if m != 0xE1 || n > maxEXIFSize {
+			if _, err := br.Discard(n); err != nil {
+				return nil, errNoEXIF
+			}
+			continue
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, errNoEXIF
+		}
+		// APP1 也可能是 XMP，只取以 Exif\0\0 开头的
+		if tiff, ok := bytes.CutPrefix(data, []byte("Exif\x00\x00")); ok {
+			return tiff, nil
+		}
+	}
+}
+
+// tiffData 是 EXIF 中的 TIFF 结构，所有偏移量都相对它的开头
+type tiffData struct {
+	b  []byte
+	bo binary.ByteOrder
+}
+
+// tiffEntry 是 IFD 中的一项，data 是值的原始字节
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+// 各个 TIFF 类型一个值的字节数
+var tiffTypeSize = map[uint16]uint64{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+// EXIF 标签
+const (
+	tagMake        = 0x010F
+	tagModel       = 0x0110
+	tagOrientation = 0x0112
+	tagDateTime    = 0x0132
+	tagExifIFD     = 0x8769
+	tagGPSIFD      = 0x8825
+	tagExposure    = 0x829A
+	tagFNumber     = 0x829D
+	tagISO         = 0x8827
+	tagOriginal    = 0x9003
+	tagFocalLength = 0x920A
+	tagWidth       = 0xA002
+	tagHeight      = 0xA003
+	tagLensModel   = 0xA434
+	tagGPSLatRef   = 1
+	tagGPSLat      = 2
+	tagGPSLonRef   = 3
+	tagGPSLon      = 4
+	tagGPSAltRef   = 5
+	tagGPSAlt      = 6
+)
+
+// ifd 读取偏移量 off 处的 IFD，超出范围的项跳过
+func (t tiffData) ifd(off uint32) map[uint16]tiffEntry {
+	if uint64(off)+2 > uint64(len(t.b)) {
+		return nil
+	}
+	n := int(t.bo.Uint16(t.b[off:]))
+	entries := make(map[uint16]tiffEntry, n)
+	for i := 0; i < n; i++ {
+		p := int(off) + 2 + i*12
+		if p+12 > len(t.b) {
+			break
+		}
+		e := tiffEntry{typ: t.bo.Uint16(t.b[p+2:]), count: t.bo.Uint32(t.b[p+4:])}
+		size := tiffTypeSize[e.typ] * uint64(e.count)
+		if size == 0 {
+			continue
+		}
+		// 不超过 4 字节的值直接放在项中，否则这里是值的偏移量
+		if size <= 4 {
+			e.data = t.b[p+8 : p+8+int(size)]
+		} else {
+			o := uint64(t.bo.Uint32(t.b[p+8:]))
+			if o+size > uint64(len(t.b)) {
+				continue
+			}
+			e.data = t.b[o : o+size]
+		}
+		entries[t.bo.Uint16(t.b[p:])] = e
+	}
+	return entries
+}
+
+func (t tiffData) str(e tiffEntry) string {
+	if e.typ != 2 {
+		return ""
+	}
+	s, _, _ := strings.Cut(string(e.data), "\x00")
+	return strings.TrimSpace(strings.ToValidUTF8(s, ""))
+}
+
+// uint 返回 BYTE、SHORT 或 LONG 类型的第一个值
+func (t tiffData) uint(e tiffEntry) (uint32, bool) {
+	switch e.typ {
+	case 1:
+		return uint32(e.data[0]), true
+	case 3:
+		return uint32(t.bo.Uint16(e.data)), true
+	case 4:
+		return t.bo.Uint32(e.data), true
+	}
+	return 0, false
+}
+
+// rational 返回 RATIONAL 或 SRATIONAL 类型的第 i 个值的分子和分母
+func (t tiffData) rational(e tiffEntry, i int) (num, den int64, ok bool) {
+	if (e.typ != 5 && e.typ != 10) || uint32(i) >= e.count {
+		return 0, 0, false
+	}
+	n, d := t.bo.Uint32(e.data[i*8:]), t.bo.Uint32(e.data[i*8+4:])
+	if d == 0 {
+		return 0, 0, false
+	}
+	if e.typ == 10 {
+		return int64(int32(n)), int64(int32(d)), true
+	}
+	return int64(n), int64(d), true
+}
+
+func (t tiffData) float(e tiffEntry, i int) (float64, bool) {
+	n, d, ok := t.rational(e, i)
+	return float64(n) / float64(d), ok
+}
+
+// formatNumber 去掉小数末尾的 0，如 2.80 显示为 2.8
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(math.Round(f*10)/10, 'f', -1, 64)
+}
+
+// readTIFF 读取 JPEG 中的 TIFF 结构和它的第一个 IFD
+func readTIFF(r io.Reader) (tiffData, map[uint16]tiffEntry, error) {
+	b, err := exifSegment(r)
+	if err != nil {
+		return tiffData{}, nil, err
+	}
+	if len(b) < 8 {
+		return tiffData{}, nil, errNoEXIF
+	}
+	t := tiffData{b: b}
+	switch string(b[:2]) {
+	case "II":
+		t.bo = binary.LittleEndian
+	case "MM":
+		t.bo = binary.BigEndian
+	default:
+		return tiffData{}, nil, errNoEXIF
+	}
+	if t.bo.Uint16(b[2:]) != 42 {
+		return tiffData{}, nil, errNoEXIF
+	}
+	return t, t.ifd(t.bo.Uint32(b[4:])), nil
+}
+
+// jpegOrientation 返回 JPEG 的 EXIF 中记录的方向（1 到 8），没有时返回 1
+func jpegOrientation(r io.Reader) int {
+	t, ifd0, err := readTIFF(r)
+	if err != nil {
+		return 1
+	}
+	if v, ok := t.uint(ifd0[tagOrientation]); ok && v >= 1 && v <= 8 {
+		return int(v)
+	}
+	return 1
+}
+
+// readEXIF 从 JPEG 中读取拍摄信息，没有 EXIF 时返回 errNoEXIF
+func readEXIF(r io.Reader) (*EXIF, error) {
+	t, ifd0, err := readTIFF(r)
+	if err != nil {
+		return nil, err
+	}
+	var exif, gps map[uint16]tiffEntry
+	if off, ok := t.uint(ifd0[tagExifIFD]); ok {
+		exif = t.ifd(off)
+	}
+	if off, ok := t.uint(ifd0[tagGPSIFD]); ok {
+		gps = t.ifd(off)
+	}
+
+	e := &EXIF{}
+	maker, model := t.str(ifd0[tagMake]), t.str(ifd0[tagModel])
+	// 很多相机的型号已经带着厂商名，如 Canon EOS R5
+	if maker != "" && !strings.HasPrefix(strings.ToLower(model), strings.ToLower(maker)) {
+		model = strings.TrimSpace(maker + " " + model)
+	}
+	e.Camera = model
+	e.Lens = t.str(exif[tagLensModel])
+
+	taken := t.str(exif[tagOriginal])
+	if taken == "" {
+		taken = t.str(ifd0[tagDateTime])
+	}
+	if tm, err := time.Parse("2006:01:02 15:04:05", taken); err == nil {
+		e.Taken = tm.Format("2006-01-02 15:04:05")
+	}
+
+	if n, d, ok := t.rational(exif[tagExposure], 0); ok && n > 0 {
+		if n < d {
+			e.Exposure = fmt.Sprintf("1/%s s", formatNumber(float64(d)/float64(n)))
+		} else {
+			e.Exposure = formatNumber(float64(n)/float64(d)) + " s"
+		}
+	}
+	if f, ok := t.float(exif[tagFNumber], 0); ok && f > 0 {
+		e.Aperture = "f/" + formatNumber(f)
+	}
+	if v, ok := t.uint(exif[tagISO]); ok {
+		e.ISO = int(v)
+	}
+	if f, ok := t.float(exif[tagFocalLength], 0); ok && f > 0 {
+		e.Focal = formatNumber(f) + " mm"
+	}
+	if v, ok := t.uint(exif[tagWidth]); ok {
+		e.Width = int(v)
+	}
+	if v, ok := t.uint(exif[tagHeight]); ok {
+		e.Height = int(v)
+	}
+
+	lat, latOK := t.degrees(gps[tagGPSLat])
+	lon, lonOK := t.degrees(gps[tagGPSLon])
+	if latOK && lonOK && (lat != 0 || lon != 0) {
+		if t.str(gps[tagGPSLatRef]) == "S" {
+			lat = -lat
+		}
+		if t.str(gps[tagGPSLonRef]) == "W" {
+			lon = -lon
+		}
+		e.GPS, e.Lat, e.Lon = true, lat, lon
+		if alt, ok := t.float(gps[tagGPSAlt], 0); ok {
+			// 参考值为 1 时在海平面以下
+			if ref := gps[tagGPSAltRef]; ref.data != nil && ref.data[0] == 1 {
+				alt = -alt
+			}
+			e.Altitude = formatNumber(alt) + " m"
+		}
+	}
+	return e, nil
+}
+
+// degrees 把 GPS 中的度、分、秒换算成度
+func (t tiffData) degrees(e tiffEntry) (float64, bool) {
+	d, ok1 := t.float(e, 0)
+	m, ok2 := t.float(e, 1)
+	s, ok3 := t.float(e, 2)
+	if !ok1 || !ok2 || !ok3 {
+		return 0, false
+	}
+	return d + m/60 + s/3600, true
+}
@@ -0,0 +1,141 @@
+package fileserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tiffTag 是测试中写入 EXIF 的一项
+type tiffTag struct {
+	tag, typ uint16
+	count    uint32
+	value    []byte
+}
+
+func asciiTag(tag uint16, s string) tiffTag {
+	return tiffTag{tag, 2, uint32(len(s) + 1), append([]byte(s), 0)}
+}
+
+func shortTag(tag uint16, v uint16) tiffTag {
+	return tiffTag{tag, 3, 1, binary.LittleEndian.AppendUint16(nil, v)}
+}
+
+func rationalTag(tag uint16, v ...uint32) tiffTag {
+	var b []byte
+	for _, x := range v {
+		b = binary.LittleEndian.AppendUint32(b, x)
+	}
+	return tiffTag{tag, 5, uint32(len(v) / 2), b}
+}
+
+// exifJPEG 把 img 编码成带 EXIF 的 JPEG，ifd0、exif、gps 是三个 IFD 中的项，指向后两个的项自动加上
+func exifJPEG(t *testing.T, img image.Image, ifd0, exif, gps []tiffTag) []byte {
+	t.Helper()
+	le := binary.LittleEndian
+	ifdSize := func(tags []tiffTag) int { return 2 + 12*len(tags) + 4 }
+	ifd0 = append(ifd0, tiffTag{tagExifIFD, 4, 1, nil}, tiffTag{tagGPSIFD, 4, 1, nil})
+	exifOff := 8 + ifdSize(ifd0)
+	gpsOff := exifOff + ifdSize(exif)
+	dataOff := gpsOff + ifdSize(gps)
+	ifd0[len(ifd0)-2].value = le.AppendUint32(nil, uint32(exifOff))
+	ifd0[len(ifd0)-1].value = le.AppendUint32(nil, uint32(gpsOff))
+
+	var head, data []byte
+	head = append(head, "II"...)
+	head = le.AppendUint16(head, 42)
+	head = le.AppendUint32(head, 8)
+	for _, tags := range [][]tiffTag{ifd0, exif, gps} {
+		head = le.AppendUint16(head, uint16(len(tags)))
+		for _, tag := range tags {
+			head = le.AppendUint16(head, tag.tag)
+			head = le.AppendUint16(head, tag.typ)
+			head = le.AppendUint32(head, tag.count)
+			if len(tag.value) <= 4 {
+				head = append(head, append(tag.value, make([]byte, 4-len(tag.value))...)...)
+			} else {
+				head = le.AppendUint32(head, uint32(dataOff+len(data)))
+				data = append(data, tag.value...)
+			}
+		}
+		head = le.AppendUint32(head, 0)
+	}
+	app1 := append([]byte("Exif\x00\x00"), append(head, data...)...)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(app1)+2))
+	out = append(out, app1...)
+	return append(out, buf.Bytes()[2:]...)
+}
+
+func testPhoto(t *testing.T) []byte {
+	return exifJPEG(t, image.NewGray(image.Rect(0, 0, 4, 4)),
+		[]tiffTag{asciiTag(tagMake, "Canon"), asciiTag(tagModel, "Canon EOS R5")},
+		[]tiffTag{rationalTag(tagExposure, 1, 250), rationalTag(tagFNumber, 28, 10), shortTag(tagISO, 400),
+			asciiTag(tagOriginal, "2024:05:01 09:30:00"), rationalTag(tagFocalLength, 35, 1), asciiTag(tagLensModel, "RF 35mm F1.8")},
+		[]tiffTag{asciiTag(tagGPSLatRef, "N"), rationalTag(tagGPSLat, 31, 1, 14, 1, 2400, 100),
+			asciiTag(tagGPSLonRef, "E"), rationalTag(tagGPSLon, 121, 1, 28, 1, 1200, 100)},
+	)
+}
+
+func TestReadEXIF(t *testing.T) {
+	e, err := readEXIF(bytes.NewReader(testPhoto(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := EXIF{Camera: "Canon EOS R5", Lens: "RF 35mm F1.8", Taken: "2024-05-01 09:30:00", Exposure: "1/250 s",
+		Aperture: "f/2.8", ISO: 400, Focal: "35 mm", GPS: true, Lat: e.Lat, Lon: e.Lon}
+	if *e != want || e.Location() != "31.240000, 121.470000" {
+		t.Errorf("got %+v\nwant %+v", *e, want)
+	}
+
+	var plain bytes.Buffer
+	jpeg.Encode(&plain, image.NewGray(image.Rect(0, 0, 4, 4)), nil)
+	for name, data := range map[string][]byte{"no exif": plain.Bytes(), "not jpeg": []byte("GIF89a"), "truncated": testPhoto(t)[:40]} {
+		if _, err := readEXIF(bytes.NewReader(data)); err != errNoEXIF {
+			t.Errorf("%s: err = %v, want errNoEXIF", name, err)
+		}
+	}
+}
+
+func TestImagePage(t *testing.T) {
+	root := newTestRoot(t)
+	os.WriteFile(filepath.Join(root, "photo.jpg"), testPhoto(t), 0644)
+	page := func(h http.Handler) string {
+		r := httptest.NewRequest("GET", "/view/photo.jpg", nil)
+		r.Header.Set("Accept", "text/html,*/*")
+		res, body := do(t, h, r)
+		if res.StatusCode != http.StatusOK || !strings.Contains(body, `src="/view/photo.jpg?raw=1"`) {
+			t.Fatalf("image page: got %d %s", res.StatusCode, body)
+		}
+		return body
+	}
+
+	body := page(newTestHandler(t, Config{Root: root}))
+	for _, s := range []string{"Canon EOS R5", "1/250 s", "f/2.8", "2024-05-01 09:30:00", "31.240000, 121.470000", "openstreetmap.org"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("image page is missing %q", s)
+		}
+	}
+	if body := page(newTestHandler(t, Config{Root: root, HideGPS: true})); strings.Contains(body, "31.24") || !strings.Contains(body, "Canon EOS R5") {
+		t.Errorf("HideGPS: %s", body)
+	}
+
+	// <img> 引用的照常返回图片
+	r := httptest.NewRequest("GET", "/view/photo.jpg", nil)
+	r.Header.Set("Accept", "image/avif,image/webp,*/*")
+	if res, _ := do(t, newTestHandler(t, Config{Root: root}), r); res.Header.Get("Content-Type") != "image/jpeg" {
+		t.Errorf("embedded image: Content-Type = %q", res.Header.Get("Content-Type"))
+	}
+}
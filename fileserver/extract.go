@@ -0,0 +1,188 @@
+package fileserver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// 上传后解压：上传接口带上 ?extract=1 时，.zip、.tar、.tar.gz、.tgz 文件保存后解压到所在目录，然后删除压缩包。
+// 解压前先检查所有条目的路径，不允许跳出目标目录（zip slip），符号链接等特殊条目一律跳过；
+// 解压后的总大小受 -max-extract 限制，同时也受上传大小和配额限制
+
+var errBadArchive = errors.New("invalid or unsafe archive")
+
+// 一个压缩包最多解压出的条目数
+const maxExtractEntries = 100000
+
+func isArchive(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".zip") || strings.HasSuffix(name, ".tar") ||
+		strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+// archiveEntry 是压缩包中的一个文件或目录
+type archiveEntry struct {
+	name  string
+	dir   bool
+	size  int64
+	open  func() (io.Reader, error) // 只有在遍历回调中调用才有效
+	close func()
+}
+
+// walkArchive 依次把压缩包中的普通文件和目录交给 fn，其他类型的条目跳过
+func walkArchive(file string, fn func(e archiveEntry) error) error {
+	if strings.HasSuffix(strings.ToLower(file), ".zip") {
+		zr, err := zip.OpenReader(file)
+		if err != nil {
+			return errBadArchive
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			mode := f.Mode()
+			if !mode.IsRegular() && !mode.IsDir() {
+				continue
+			}
+			var rc io.ReadCloser
+			e := archiveEntry{name: f.Name, dir: mode.IsDir(), size: int64(f.UncompressedSize64)}
+			e.open = func() (io.Reader, error) {
+				var err error
+				rc, err = f.Open()
+				return rc, err
+			}
+			err := fn(e)
+			if rc != nil {
+				rc.Close()
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if !strings.HasSuffix(strings.ToLower(file), ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return errBadArchive
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errBadArchive
+		}
+		if h.Typeflag != tar.TypeReg && h.Typeflag != tar.TypeDir {
+			continue
+		}
+		e := archiveEntry{name: h.Name, dir: h.Typeflag == tar.TypeDir, size: h.Size}
+		e.open = func() (io.Reader, error) { return tr, nil }
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+// extractArchive 把根目录下的压缩包 p 解压到所在目录，返回解压出的文件
+func (s *server) extractArchive(r *http.Request, p string, overwrite bool) ([]string, error) {
+	file := s.root + p
+	dir := path.Dir(p)
+	u := currentUser(r)
+
+	// 第一遍只检查路径和大小，有问题时什么都不写
+	var total int64
+	count := 0
+	err := walkArchive(file, func(e archiveEntry) error {
+		rel := cleanPath(e.name)
+		target := path.Join(dir, rel)
+		if rel == "/" || isHidden(rel) || path.IsAbs(e.name) || strings.HasPrefix(path.Clean(e.name), "..") || strings.Contains(e.name, "\\") {
+			return errBadArchive
+		}
+		if !s.allowed(u, target, permWrite) {
+			return os.ErrPermission
+		}
+		// 第二遍会先创建上级目录再保存，这里就要按符号链接策略检查
+		if err := s.checkSymlinks(target); err != nil {
+			return err
+		}
+		if !e.dir {
+			if info, err := os.Stat(s.root + target); err == nil && (info.IsDir() || !overwrite) {
+				return errFileExists
+			}
+		}
+		count++
+		total += e.size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if count > maxExtractEntries || (s.limits.maxExtract > 0 && total > s.limits.maxExtract) {
+		return nil, errTooLarge
+	}
+	if err := s.uploadAllowed(total); err != nil {
+		return nil, err
+	}
+
+	// 第二遍写入，实际解压出的大小以读取到的为准，声明的大小不可信
+	left := &limitedReader{n: total, err: errTooLarge}
+	var files []string
+	err = walkArchive(file, func(e archiveEntry) error {
+		target := path.Join(dir, cleanPath(e.name))
+		if e.dir {
+			return os.MkdirAll(s.root+target, 0755)
+		}
+		if err := os.MkdirAll(path.Dir(s.root+target), 0755); err != nil {
+			return err
+		}
+		src, err := e.open()
+		if err != nil {
+			return errBadArchive
+		}
+		left.r = src
+		if err := s.saveFile(target, left, overwrite); err != nil {
+			return err
+		}
+		files = append(files, target)
+		return nil
+	})
+	s.uploaded()
+	return files, err
+}
+
+// afterUpload 在上传完成后按 ?extract=1 解压，不论成功与否都删除压缩包，
+// 然后为保存下来的文件发送 upload 事件
+func (s *server) afterUpload(r *http.Request, p string) ([]string, error) {
+	if r.URL.Query().Get("extract") == "" || !isArchive(p) {
+		s.notifyUpload(r, p)
+		return nil, nil
+	}
+	defer os.Remove(s.root + p)
+	files, err := s.extractArchive(r, p, r.URL.Query().Get("overwrite") != "")
+	if err == nil {
+		s.auditHTTP(r, auditEntry{Action: auditExtract, Path: p, Detail: fmt.Sprintf("%d files", len(files))})
+		for _, f := range files {
+			s.notifyUpload(r, f)
+		}
+	}
+	return files, err
+}
@@ -0,0 +1,93 @@
+package fileserver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func tgzArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, data := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(data))
+	}
+	tw.Close()
+	gw.Close()
+	return buf.Bytes()
+}
+
+func TestExtractUpload(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root, MaxExtract: 100}, WithReadWrite())
+	put := func(p string, body []byte) (int, string) {
+		res, b := do(t, h, httptest.NewRequest("PUT", p, bytes.NewReader(body)))
+		return res.StatusCode, b
+	}
+
+	status, body := put("/api/files/site/dist.zip?extract=1", zipArchive(t, map[string]string{"index.html": "<html>", "js/app.js": "app()"}))
+	if status != http.StatusCreated || !strings.Contains(body, "/site/js/app.js") {
+		t.Fatalf("zip: got %d %s", status, body)
+	}
+	status, body = put("/api/files/docs.tar.gz?extract=1", tgzArchive(t, map[string]string{"docs/guide.md": "# Guide"}))
+	if status != http.StatusCreated {
+		t.Fatalf("tar.gz: got %d %s", status, body)
+	}
+	for _, p := range []string{"site/index.html", "site/js/app.js", "docs/guide.md"} {
+		if _, err := os.Stat(filepath.Join(root, p)); err != nil {
+			t.Errorf("%s: %v", p, err)
+		}
+	}
+	for _, p := range []string{"site/dist.zip", "docs.tar.gz"} {
+		if _, err := os.Stat(filepath.Join(root, p)); err == nil {
+			t.Errorf("archive %s was kept", p)
+		}
+	}
+
+	for name, c := range map[string]struct {
+		files map[string]string
+		want  int
+	}{
+		"zip slip":    {map[string]string{"ok.txt": "x", "../../evil.txt": "x"}, http.StatusBadRequest},
+		"hidden file": {map[string]string{".password": "x"}, http.StatusBadRequest},
+		"existing":    {map[string]string{"a.txt": "x"}, http.StatusConflict},
+		"too large":   {map[string]string{"big.bin": strings.Repeat("x", 101)}, http.StatusRequestEntityTooLarge},
+	} {
+		if status, _ := put("/api/files/bad.zip?extract=1", zipArchive(t, c.files)); status != c.want {
+			t.Errorf("%s: status = %d, want %d", name, status, c.want)
+		}
+	}
+	for _, p := range []string{"ok.txt", "../evil.txt", "big.bin", "bad.zip"} {
+		if _, err := os.Stat(filepath.Join(root, p)); err == nil {
+			t.Errorf("%s was written by a rejected archive", p)
+		}
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "a.txt")); string(b) != "hello" {
+		t.Errorf("existing file was overwritten: %q", b)
+	}
+}
@@ -0,0 +1,199 @@
+package fileserver
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 最近文件的订阅源：GET /feed.xml 返回整个根目录中最近新增或修改的文件（Atom 格式），
+// /feed.xml?path=/builds 只看某个目录，可以用 limit 调整条数。同事在阅读器中订阅后，出了新的构建就能看到。
+// 文件修改后作为新的一条出现；只列出请求者有权读取、所在目录没有被密码锁住的文件。
+// 有 -index 时从索引中取，否则每次遍历目录，目录很大时建议打开 -index
+
+// 订阅源默认和最多的条数
+const (
+	feedLimit    = 50
+	maxFeedLimit = 500
+)
+
+// newestFiles 把 files 按修改时间从新到旧排序，返回前 limit 个 keep 为 true 的文件，目录不算
+func newestFiles(files []indexHit, limit int, keep func(p string) bool) []indexHit {
+	files = slices.DeleteFunc(files, func(f indexHit) bool { return f.IsDir })
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].ModTime.Equal(files[j].ModTime) {
+			return files[i].ModTime.After(files[j].ModTime)
+		}
+		return files[i].Path < files[j].Path
+	})
+	kept := files[:0]
+	for _, f := range files {
+		if len(kept) == limit {
+			break
+		}
+		if keep(f.Path) {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// walkFiles 遍历目录 p 下的所有普通文件和子目录，程序自己使用的文件和 skipDir 返回 true 的目录跳过，
+// 没有 -index 时代替索引
+func walkFiles(fsys fs.FS, p string, skipDir func(p string) bool) []indexHit {
+	var files []indexHit
+	fs.WalkDir(fsys, fsName(p), func(name string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if e != nil && e.IsDir() && name != fsName(p) {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if hiddenFiles[foldPath(e.Name())] && name != fsName(p) {
+			if e.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		rel := cleanPath(name)
+		if name == fsName(p) || !e.IsDir() && !e.Type().IsRegular() {
+			return nil
+		}
+		if e.IsDir() && skipDir(rel) {
+			return fs.SkipDir
+		}
+		if info, err := e.Info(); err == nil {
+			files = append(files, indexHit{Path: rel, indexEntry: indexEntry{Name: e.Name(), Size: info.Size(), IsDir: e.IsDir(), ModTime: info.ModTime()}})
+		}
+		return nil
+	})
+	return files
+}
+
+// formatBytes 把字节数显示成易读的大小，和页面脚本中的 humanSize 一致
+func formatBytes(n int64) string {
+	const KB, MB, GB = 1 << 10, 1 << 20, 1 << 30
+	switch {
+	case n >= GB:
+		return fmt.Sprintf("%.2f GB", float64(n)/GB)
+	case n >= MB:
+		return fmt.Sprintf("%.2f MB", float64(n)/MB)
+	case n >= KB:
+		return fmt.Sprintf("%.2f KB", float64(n)/KB)
+	}
+	return fmt.Sprintf("%d Byte", n)
+}
+
+// atomFeed、atomEntry 是 Atom 订阅源的 XML 结构
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Links   []atomLink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Link    atomLink `xml:"link"`
+	Updated string   `xml:"updated"`
+	Summary string   `xml:"summary"`
+}
+
+// feedHandler 处理 GET /feed.xml
+func (s *server) feedHandler(w http.ResponseWriter, r *http.Request) {
+	dir := cleanPath(r.FormValue("path"))
+	info, err := s.stat(dir)
+	if err != nil || !info.IsDir() {
+		s.httpError(w, r, http.StatusNotFound, "Directory not found")
+		return
+	}
+	limit := feedLimit
+	if v := r.FormValue("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			s.httpError(w, r, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = min(n, maxFeedLimit)
+	}
+
+	u := currentUser(r)
+	keep := func(p string) bool {
+		if !s.allowed(u, p, permRead) {
+			return false
+		}
+		_, locked := s.lockedDir(r, p)
+		return !locked
+	}
+	var files []indexHit
+	if s.index != nil && s.index.isReady() {
+		files = s.index.all(dir)
+	} else {
+		files = walkFiles(s.fsys, dir, func(p string) bool {
+			_, locked := s.lockedDir(r, p)
+			return locked
+		})
+	}
+	files = newestFiles(files, limit, keep)
+
+	origin := s.origin(r) + s.base
+	escaped := (&url.URL{Path: dir}).EscapedPath()
+	self := origin + "/feed.xml"
+	if dir != "/" {
+		self += "?path=" + url.QueryEscape(dir)
+	}
+	feed := atomFeed{
+		Title: "Recent files in " + dir,
+		ID:    self,
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: self},
+			{Rel: "alternate", Type: "text/html", Href: origin + strings.TrimSuffix(escaped, "/") + "/"},
+		},
+	}
+	// 没有文件时用目录本身的修改时间
+	updated := info.ModTime()
+	if len(files) > 0 {
+		updated = files[0].ModTime
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+	for _, f := range files {
+		link := origin + "/download" + (&url.URL{Path: f.Path}).EscapedPath()
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title: f.Path,
+			// 修改时间加在 ID 中，文件更新后阅读器把它当作新的一条
+			ID:      fmt.Sprintf("%s#%d", link, f.ModTime.UnixNano()),
+			Link:    atomLink{Href: link},
+			Updated: f.ModTime.UTC().Format(time.RFC3339),
+			Summary: fmt.Sprintf("%s, %s", path.Base(f.Path), formatBytes(f.Size)),
+		})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		s.httpError(w, r, http.StatusInternalServerError, "Failed to build feed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	http.ServeContent(w, r, "", updated, bytes.NewReader(buf.Bytes()))
+}
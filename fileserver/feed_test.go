@@ -0,0 +1,67 @@
+package fileserver
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFeed(t *testing.T) {
+	root := newTestRoot(t)
+	os.Mkdir(filepath.Join(root, "builds"), 0755)
+	now := time.Now()
+	for i, name := range []string{"builds/app-1.apk", "builds/app-2.apk", "a.txt", "sub/b.txt"} {
+		p := filepath.Join(root, name)
+		os.WriteFile(p, []byte("x"), 0644)
+		mt := now.Add(time.Duration(i-10) * time.Hour)
+		os.Chtimes(p, mt, mt)
+	}
+	config := writeConfig(t, `{"acl": [{"path": "/sub/**", "users": ["*"], "action": "deny"}]}`)
+
+	feed := func(h *Handler, query string) (titles []string) {
+		t.Helper()
+		res, body := do(t, h, httptest.NewRequest("GET", "/feed.xml"+query, nil))
+		if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("Content-Type"), "application/atom+xml") {
+			t.Fatalf("feed%s: got %d %s", query, res.StatusCode, body)
+		}
+		var f atomFeed
+		if err := xml.Unmarshal([]byte(body), &f); err != nil {
+			t.Fatalf("feed%s: %v", query, err)
+		}
+		for _, e := range f.Entries {
+			titles = append(titles, e.Title)
+			if !strings.HasPrefix(e.Link.Href, "http://example.com/download/") {
+				t.Errorf("entry link = %q", e.Link.Href)
+			}
+		}
+		return titles
+	}
+
+	indexed := newTestHandler(t, Config{Root: root, Index: true, ConfigFile: config})
+	waitIndex(t, "first scan", func() bool { return indexed.s.index.isReady() })
+	for name, h := range map[string]*Handler{"walk": newTestHandler(t, Config{Root: root, ConfigFile: config}), "index": indexed} {
+		// 新的在前，没有权限的目录中的文件不出现
+		if got := strings.Join(feed(h, ""), " "); got != "/a.txt /builds/app-2.apk /builds/app-1.apk" {
+			t.Errorf("%s: feed = %s", name, got)
+		}
+		if got := strings.Join(feed(h, "?path=/builds&limit=1"), " "); got != "/builds/app-2.apk" {
+			t.Errorf("%s: feed of /builds = %s", name, got)
+		}
+		if res, _ := do(t, h, httptest.NewRequest("GET", "/feed.xml?path=/sub", nil)); res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: feed of denied directory: %d", name, res.StatusCode)
+		}
+	}
+
+	h := newTestHandler(t, Config{Root: root})
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/feed.xml?path=/missing", nil)); res.StatusCode != http.StatusNotFound {
+		t.Errorf("missing directory: %d", res.StatusCode)
+	}
+	if _, body := do(t, h, httptest.NewRequest("GET", "/builds/", nil)); !strings.Contains(body, `type="application/atom+xml" href="/feed.xml?path=%2Fbuilds"`) {
+		t.Errorf("listing does not link the feed: %s", body)
+	}
+}
@@ -0,0 +1,367 @@
+package fileserver
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 修改文件的接口，只在 -mode rw 时可用：
+//
+//	PUT  /api/files/<文件路径>   请求体就是文件内容，?overwrite=1 时覆盖已有文件
+//	POST /api/files/<目录路径>   multipart/form-data 表单，file 字段可以有多个，文件名可以带相对路径
+//	DELETE /api/files/<路径>     删除文件；非空目录需要加 ?recursive=1
+//	POST /api/move               参数 from、to，重命名或移动文件和目录
+//	POST /api/mkdir              参数 path，新建目录（上级目录不存在时一并创建）
+//
+// 大文件的断点续传见 resumable.go
+
+var (
+	errFileExists = errors.New("file already exists")
+	errBadName    = errors.New("invalid file name")
+	errNotEmpty   = errors.New("directory not empty")
+	errIntoSelf   = errors.New("cannot move a directory into itself")
+	errForbidden  = errors.New("forbidden")
+	errLocked     = errors.New("target directory is password protected")
+	errMkdir      = errors.New("failed to create directory")
+)
+
+// filesHandler 处理 /api/files/ 下的请求
+func (s *server) filesHandler(w http.ResponseWriter, r *http.Request) {
+	p := cleanPath(strings.TrimPrefix(r.URL.Path, "/api/files"))
+	s.limitBody(w, r)
+	switch r.Method {
+	case http.MethodPut:
+		s.putFile(w, r, p)
+	case http.MethodPost:
+		s.uploadFiles(w, r, p)
+	case http.MethodDelete:
+		s.deleteFile(w, r, p)
+	case http.MethodHead:
+		s.uploadStatus(w, p)
+	case http.MethodPatch:
+		s.uploadChunk(w, r, p)
+	default:
+		w.Header().Set("Allow", "PUT, POST, DELETE, HEAD, PATCH")
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// putFile 把请求体保存为文件 p，上级目录不存在时自动创建
+func (s *server) putFile(w http.ResponseWriter, r *http.Request, p string) {
+	if p == "/" || isHidden(p) {
+		apiError(w, http.StatusForbidden, errBadName.Error())
+		return
+	}
+	dst := s.root + p
+	if err := s.checkSymlinks(path.Dir(p)); err != nil {
+		fileError(w, err)
+		return
+	}
+	if err := os.MkdirAll(path.Dir(dst), 0755); err != nil {
+		apiError(w, http.StatusConflict, "failed to create directory")
+		return
+	}
+	if err := s.uploadAllowed(r.ContentLength); err != nil {
+		fileError(w, err)
+		return
+	}
+	err := s.saveFile(p, s.limitUpload(r.Body), r.URL.Query().Get("overwrite") != "")
+	s.uploaded()
+	if err != nil {
+		fileError(w, err)
+		return
+	}
+	extracted, err := s.afterUpload(r, p)
+	if err != nil {
+		fileError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"path": p, "extracted": extracted})
+}
+
+// deleteFile 删除文件或目录 p，根目录不能删除
+func (s *server) deleteFile(w http.ResponseWriter, r *http.Request, p string) {
+	if p == "/" || isHidden(p) {
+		apiError(w, http.StatusForbidden, errBadName.Error())
+		return
+	}
+	if err := s.removePath(r, p, r.URL.Query().Get("recursive") != ""); err != nil {
+		fileError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"deleted": p})
+}
+
+// removePath 删除文件或目录 p（开启回收站时移动到回收站），非空目录需要 recursive。批量删除也用它
+func (s *server) removePath(r *http.Request, p string, recursive bool) error {
+	if p == "/" || isHidden(p) {
+		return errBadName
+	}
+	// 链接本身可以删除，但不能经过链接删除根目录外面的文件
+	if err := s.checkSymlinks(path.Dir(p)); err != nil {
+		return err
+	}
+	info, err := os.Lstat(s.root + p)
+	if err != nil {
+		return err
+	}
+	switch {
+	case s.trashTTL > 0:
+		// 移动到回收站，非空目录同样需要 ?recursive=1
+		if info.IsDir() && !recursive {
+			if entries, _ := os.ReadDir(s.root + p); len(entries) > 0 {
+				return errNotEmpty
+			}
+		}
+		var who string
+		if u := currentUser(r); u != nil {
+			who = u.Name
+		}
+		err = s.moveToTrash(p, info, who)
+	case info.IsDir() && recursive:
+		err = os.RemoveAll(s.root + p)
+	default:
+		err = os.Remove(s.root + p)
+	}
+	if err != nil {
+		if info.IsDir() && !errors.Is(err, os.ErrPermission) {
+			return errNotEmpty
+		}
+		return err
+	}
+	s.notifyHTTP(r, eventDelete, p, 0)
+	e := auditEntry{Action: auditDelete, Path: p}
+	if info.IsDir() {
+		e.Detail = "directory"
+	}
+	s.auditHTTP(r, e)
+	return nil
+}
+
+// moveHandler 处理 POST /api/move。访问控制和目录密码中间件只检查了 from，这里再检查 to
+func (s *server) moveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	from := cleanPath(r.FormValue("from"))
+	to := cleanPath(r.FormValue("to"))
+	if err := s.movePath(r, from, to); err != nil {
+		fileError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"from": from, "to": to})
+}
+
+// movePath 把 from 移动到 to，检查 to 的访问控制和目录密码。批量移动也用它
+func (s *server) movePath(r *http.Request, from, to string) error {
+	if from == "/" || to == "/" || isHidden(from) || isHidden(to) {
+		return errBadName
+	}
+	if !s.allowed(currentUser(r), to, permWrite) {
+		return errForbidden
+	}
+	if _, locked := s.lockedDir(r, to); locked {
+		return errLocked
+	}
+	// 目录不能移动到自己里面
+	if strings.HasPrefix(to+"/", from+"/") {
+		return errIntoSelf
+	}
+	if err := s.checkSymlinks(path.Dir(from)); err != nil {
+		return err
+	}
+	if err := s.checkSymlinks(path.Dir(to)); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(s.root + from); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(s.root + to); err == nil {
+		return errFileExists
+	}
+	if err := os.MkdirAll(path.Dir(s.root+to), 0755); err != nil {
+		return errMkdir
+	}
+	if err := os.Rename(s.root+from, s.root+to); err != nil {
+		return err
+	}
+	s.auditHTTP(r, auditEntry{Action: auditRename, Path: from, To: to})
+	return nil
+}
+
+// mkdirHandler 处理 POST /api/mkdir
+func (s *server) mkdirHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	p := cleanPath(r.FormValue("path"))
+	if p == "/" || isHidden(p) {
+		apiError(w, http.StatusBadRequest, errBadName.Error())
+		return
+	}
+	if err := s.checkSymlinks(p); err != nil {
+		fileError(w, err)
+		return
+	}
+	if _, err := os.Lstat(s.root + p); err == nil {
+		fileError(w, errFileExists)
+		return
+	}
+	if err := os.MkdirAll(s.root+p, 0755); err != nil {
+		fileError(w, err)
+		return
+	}
+	s.auditHTTP(r, auditEntry{Action: auditMkdir, Path: p})
+	writeJSON(w, http.StatusCreated, map[string]string{"path": p})
+}
+
+// uploadFiles 把表单中的文件保存到目录 dir
+func (s *server) uploadFiles(w http.ResponseWriter, r *http.Request, dir string) {
+	info, err := os.Stat(s.root + dir)
+	if err != nil || !info.IsDir() {
+		apiError(w, http.StatusNotFound, "directory not found")
+		return
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "expected multipart/form-data")
+		return
+	}
+	overwrite := r.URL.Query().Get("overwrite") != ""
+	u := currentUser(r)
+
+	saved := []string{}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			apiError(w, http.StatusBadRequest, "malformed multipart body")
+			return
+		}
+		if part.FormName() != "file" || part.FileName() == "" {
+			continue
+		}
+		p, err := uploadPath(dir, part)
+		// 文件名带相对路径时会写到子目录中，中间件只检查了 dir，这里按实际位置再检查
+		if err == nil && !s.allowed(u, p, permWrite) {
+			err = errForbidden
+		}
+		if err == nil {
+			if _, locked := s.lockedDir(r, p); locked {
+				err = errLocked
+			}
+		}
+		if err == nil {
+			err = s.checkSymlinks(path.Dir(p))
+		}
+		if err == nil {
+			err = os.MkdirAll(path.Dir(s.root+p), 0755)
+		}
+		if err == nil {
+			err = s.saveFile(p, s.limitUpload(part), overwrite)
+			s.uploaded()
+		}
+		var extracted []string
+		if err == nil {
+			extracted, err = s.afterUpload(r, p)
+		}
+		if err != nil {
+			fileError(w, err)
+			return
+		}
+		if extracted != nil {
+			saved = append(saved, extracted...)
+		} else {
+			saved = append(saved, p)
+		}
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"files": saved})
+}
+
+// uploadPath 返回表单文件保存的位置。上传整个目录时文件名是 a/b/c.txt 这样的相对路径，
+// 清理后拼在 dir 下面，不会跳出 dir
+func uploadPath(dir string, part *multipart.Part) (string, error) {
+	// FileName 会去掉路径部分，这里需要原始的文件名
+	_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+	if err != nil {
+		return "", errBadName
+	}
+	rel := cleanPath(strings.ReplaceAll(params["filename"], "\\", "/"))
+	if rel == "/" || isHidden(rel) {
+		return "", errBadName
+	}
+	return path.Join(dir, rel), nil
+}
+
+// saveFile 把 src 保存为根目录下的 p：先写入同目录下的临时文件再改名，写到一半失败不会留下残缺的文件
+func (s *server) saveFile(p string, src io.Reader, overwrite bool) error {
+	if err := s.checkSymlinks(path.Dir(p)); err != nil {
+		return err
+	}
+	dst := s.root + p
+	if info, err := os.Stat(dst); err == nil {
+		if info.IsDir() || !overwrite {
+			return errFileExists
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	os.Chmod(tmp.Name(), 0644)
+	return s.replaceFile(tmp.Name(), p)
+}
+
+// fileError 把文件操作的错误转换成 JSON 错误响应，不把系统错误信息直接返回给客户端
+func fileError(w http.ResponseWriter, err error) {
+	status, msg := fileErrorStatus(err)
+	apiError(w, status, msg)
+}
+
+// fileErrorStatus 返回错误对应的状态码和提示
+func fileErrorStatus(err error) (int, string) {
+	var maxBytes *http.MaxBytesError
+	switch {
+	case errors.Is(err, errTooLarge), errors.As(err, &maxBytes):
+		return http.StatusRequestEntityTooLarge, errTooLarge.Error()
+	case errors.Is(err, errQuota):
+		return http.StatusInsufficientStorage, err.Error()
+	case errors.Is(err, errFileExists), errors.Is(err, errNotEmpty), errors.Is(err, errMkdir):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, errInfected):
+		return http.StatusUnprocessableEntity, err.Error()
+	case errors.Is(err, errScan):
+		return http.StatusServiceUnavailable, err.Error()
+	case errors.Is(err, errBadName), errors.Is(err, errBadArchive), errors.Is(err, errIntoSelf):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, errForbidden), errors.Is(err, errLocked):
+		return http.StatusForbidden, err.Error()
+	case errors.Is(err, os.ErrNotExist):
+		return http.StatusNotFound, "file not found"
+	case errors.Is(err, os.ErrPermission):
+		return http.StatusForbidden, "permission denied"
+	}
+	return http.StatusInternalServerError, "failed to write file"
+}
@@ -0,0 +1,237 @@
+package fileserver
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPutFile(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root}, WithReadWrite())
+	put := func(p, body string) int {
+		res, _ := do(t, h, httptest.NewRequest("PUT", p, strings.NewReader(body)))
+		return res.StatusCode
+	}
+	if got := put("/api/files/a.txt", "new"); got != http.StatusConflict {
+		t.Errorf("existing file: status = %d, want 409", got)
+	}
+	if got := put("/api/files/a.txt?overwrite=1", "new"); got != http.StatusCreated {
+		t.Errorf("overwrite: status = %d, want 201", got)
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "a.txt")); string(b) != "new" {
+		t.Errorf("overwritten file = %q", b)
+	}
+	// 程序自己使用的文件和根目录不能写入
+	if got := put("/api/files/sub/.password", "x"); got < 400 {
+		t.Errorf("PUT .password: status = %d", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "sub", ".password")); err == nil {
+		t.Error(".password was written")
+	}
+	if got := put("/api/files/", "x"); got != http.StatusForbidden {
+		t.Errorf("PUT /: status = %d, want 403", got)
+	}
+	// 临时文件改名后不会留下
+	if matches, _ := filepath.Glob(filepath.Join(root, ".upload-*")); len(matches) != 0 {
+		t.Errorf("temporary files left: %v", matches)
+	}
+}
+
+func TestDeleteFile(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root}, WithReadWrite())
+	del := func(p string) int {
+		res, _ := do(t, h, httptest.NewRequest("DELETE", p, nil))
+		return res.StatusCode
+	}
+	for _, c := range []struct {
+		path string
+		want int
+	}{
+		{"/api/files/missing.txt", http.StatusNotFound},
+		{"/api/files/", http.StatusForbidden},
+		{"/api/files/sub", http.StatusConflict},
+		{"/api/files/a.txt", http.StatusOK},
+		{"/api/files/sub?recursive=1", http.StatusOK},
+	} {
+		if got := del(c.path); got != c.want {
+			t.Errorf("DELETE %s: status = %d, want %d", c.path, got, c.want)
+		}
+	}
+	// 删除的内容在回收站中
+	if entries, _ := os.ReadDir(root); len(entries) != 1 || entries[0].Name() != trashDir {
+		t.Errorf("files left after delete: %v", entries)
+	}
+}
+
+// postForm 发送表单请求
+func postForm(t *testing.T, h http.Handler, target string, values url.Values) int {
+	t.Helper()
+	r := httptest.NewRequest("POST", target, strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, _ := do(t, h, r)
+	return res.StatusCode
+}
+
+func TestMoveFile(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root}, WithReadWrite())
+	for _, c := range []struct {
+		from, to string
+		want     int
+	}{
+		{"/a.txt", "/archive/2024/a.txt", http.StatusOK},
+		{"/missing.txt", "/b.txt", http.StatusNotFound},
+		{"/sub", "/sub/inner", http.StatusBadRequest},
+		{"/sub/b.txt", "/archive/2024/a.txt", http.StatusConflict},
+		{"/sub/b.txt", "/sub/.password", http.StatusBadRequest},
+		{"/sub", "/renamed", http.StatusOK},
+	} {
+		if got := postForm(t, h, "/api/move", url.Values{"from": {c.from}, "to": {c.to}}); got != c.want {
+			t.Errorf("move %s -> %s: status = %d, want %d", c.from, c.to, got, c.want)
+		}
+	}
+	for _, p := range []string{"archive/2024/a.txt", "renamed/b.txt"} {
+		if _, err := os.Stat(filepath.Join(root, p)); err != nil {
+			t.Errorf("%s: %v", p, err)
+		}
+	}
+}
+
+func TestMkdir(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root}, WithReadWrite())
+	for _, c := range []struct {
+		path string
+		want int
+	}{
+		{"/new/nested", http.StatusCreated},
+		{"/sub", http.StatusConflict},
+		{"/", http.StatusBadRequest},
+		{"/.uploads", http.StatusNotFound},
+		{"/../outside", http.StatusCreated},
+	} {
+		if got := postForm(t, h, "/api/mkdir", url.Values{"path": {c.path}}); got != c.want {
+			t.Errorf("mkdir %s: status = %d, want %d", c.path, got, c.want)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(root, "new", "nested")); err != nil || !info.IsDir() {
+		t.Errorf("nested directory: %v", err)
+	}
+	// ../ 被清理成根目录下的路径
+	if _, err := os.Stat(filepath.Join(root, "outside")); err != nil {
+		t.Errorf("cleaned path: %v", err)
+	}
+}
+
+// multipartBody 生成 file 字段的表单，files 为文件名到内容，文件名可以带相对路径
+func multipartBody(t *testing.T, files [][2]string) (string, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, f := range files {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, f[0]))
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(f[1]))
+	}
+	mw.Close()
+	return mw.FormDataContentType(), &buf
+}
+
+func TestMultipartUpload(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root}, WithReadWrite())
+	upload := func(dir string, files ...[2]string) (*http.Response, string) {
+		ct, body := multipartBody(t, files)
+		r := httptest.NewRequest("POST", "/api/files"+dir, body)
+		r.Header.Set("Content-Type", ct)
+		return do(t, h, r)
+	}
+	res, body := upload("/sub/", [2]string{"one.txt", "1"}, [2]string{"two.txt", "2"})
+	if res.StatusCode != http.StatusCreated || !strings.Contains(body, `"/sub/one.txt"`) || !strings.Contains(body, `"/sub/two.txt"`) {
+		t.Fatalf("upload: got %d %s", res.StatusCode, body)
+	}
+	if res, _ := upload("/sub/", [2]string{"one.txt", "again"}); res.StatusCode != http.StatusConflict {
+		t.Errorf("existing file: status = %d, want 409", res.StatusCode)
+	}
+	if res, _ := upload("/missing/", [2]string{"x.txt", "x"}); res.StatusCode != http.StatusNotFound {
+		t.Errorf("missing directory: status = %d, want 404", res.StatusCode)
+	}
+	if _, body := do(t, h, httptest.NewRequest("GET", "/sub/", nil)); !strings.Contains(body, `id="drop-zone"`) {
+		t.Error("listing has no drop zone in rw mode")
+	}
+	ro := newTestHandler(t, Config{Root: root})
+	if _, body := do(t, ro, httptest.NewRequest("GET", "/sub/", nil)); strings.Contains(body, `id="drop-zone"`) {
+		t.Error("listing has a drop zone in read-only mode")
+	}
+	r := httptest.NewRequest("POST", "/api/files/sub/", strings.NewReader("not multipart"))
+	if res, _ := do(t, h, r); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("plain body: status = %d, want 400", res.StatusCode)
+	}
+}
+
+func TestDirectoryUpload(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root}, WithReadWrite())
+	ct, body := multipartBody(t, [][2]string{
+		{"site/index.html", "<html>"},
+		{`site\css\style.css`, "body{}"},
+	})
+	r := httptest.NewRequest("POST", "/api/files/", body)
+	r.Header.Set("Content-Type", ct)
+	if res, body := do(t, h, r); res.StatusCode != http.StatusCreated {
+		t.Fatalf("upload: got %d %s", res.StatusCode, body)
+	}
+	for _, p := range []string{"site/index.html", "site/css/style.css"} {
+		if _, err := os.Stat(filepath.Join(root, p)); err != nil {
+			t.Errorf("%s: %v", p, err)
+		}
+	}
+
+	// 相对路径不能跳出目标目录，也不能写入程序自己使用的文件
+	for _, name := range []string{"../../escape.txt", "a/.password"} {
+		ct, body := multipartBody(t, [][2]string{{name, "x"}})
+		r := httptest.NewRequest("POST", "/api/files/sub/", body)
+		r.Header.Set("Content-Type", ct)
+		res, _ := do(t, h, r)
+		if res.StatusCode == http.StatusCreated && name == "a/.password" {
+			t.Errorf("%s: uploaded", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "escape.txt")); err == nil {
+		t.Error("upload escaped the root directory")
+	}
+	if _, err := os.Stat(filepath.Join(root, "sub", "escape.txt")); err != nil {
+		t.Errorf("cleaned path: %v", err)
+	}
+
+	// 文件名中的子目录按实际位置检查访问控制和目录密码，和直接 PUT 到那里一样
+	os.MkdirAll(filepath.Join(root, "locked"), 0755)
+	os.WriteFile(filepath.Join(root, "locked", passwordFile), []byte("pw"), 0644)
+	config := writeConfig(t, `{"acl": [{"path": "/sub/**", "users": ["*"], "action": "deny"}]}`)
+	h = newTestHandler(t, Config{Root: root, ConfigFile: config}, WithReadWrite())
+	for _, name := range []string{"sub/evil.txt", "locked/evil.txt"} {
+		ct, body := multipartBody(t, [][2]string{{name, "x"}})
+		r := httptest.NewRequest("POST", "/api/files/", body)
+		r.Header.Set("Content-Type", ct)
+		if res, body := do(t, h, r); res.StatusCode != http.StatusForbidden {
+			t.Errorf("%s: got %d %s, want 403", name, res.StatusCode, body)
+		}
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(name))); err == nil {
+			t.Errorf("%s was written", name)
+		}
+	}
+}
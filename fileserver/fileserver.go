@@ -0,0 +1,464 @@
+// Package fileserver 是目录浏览、下载和上传服务本身，返回一个 http.Handler，
+// 可以挂载到其他程序自己的 ServeMux 下。命令行程序只是把参数转换成 Config 后调用 New
+package fileserver
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config 是服务的配置，字段的零值就是命令行参数的默认行为（压缩、安全响应头除外，它们默认开启）
+type Config struct {
+	Root     string // 要浏览的根目录，和 FS 二选一
+	FS       fs.FS  // 代替 Root 提供文件，如 embed.FS（先用 fs.Sub 去掉目录前缀）、zip.Reader，只能只读
+	Mode     string // ModeReadOnly（默认）或 ModeReadWrite
+	Theme    string // 页面主题，默认 auto，见 Themes()
+	Lang     string // 默认界面语言，默认 en，见 Languages()
+	Checksum string // 目录列表中显示的校验和：md5、sha1、sha256、sha512，为空不显示
+	BasePath string // 挂载在子路径下时的地址前缀，如 /files。前缀由 Handler 自己去掉，外层不要再用 StripPrefix
+
+	SPA        bool   // 单页应用模式，未知地址返回根目录的 index.html
+	ServeIndex bool   // 目录下有 index.html 时直接返回它
+	LiveReload bool   // 开发模式：SPA、ServeIndex 返回的 HTML 页面在文件变化时自动刷新，只支持 Root
+	Template   string // 自定义目录列表模板文件
+	ErrorPages string // 自定义错误页面模板所在目录
+
+	DisableCompression     bool // 不压缩文本类响应
+	DisableSecurityHeaders bool // 不添加 nosniff、CSP、HSTS 等安全响应头
+	DisableListingCache    bool // 每次都重新读取目录，不使用目录列表缓存
+	DisableDirSizes        bool // 目录列表中不显示子目录的总大小
+	DisableTrash           bool // 删除时不放入回收站，直接删除
+	AccessLog              bool // 用 log 包记录每个请求
+
+	Index         bool          // 在后台建立文件索引，用于文件名搜索和目录总大小
+	IndexInterval time.Duration // 完整重建索引的间隔，默认 1 小时
+
+	ShareSecret string // 签名分享链接的密钥，为空时随机生成，重启后旧链接失效
+	ShareDB     string // 保存分享链接下载次数的文件
+
+	StatsDB        string        // 记录每次下载的统计数据库文件（bbolt），为空不记录
+	StatsRetention time.Duration // 下载记录的保留时间，默认 90 天
+	AuditLog       string        // 记录上传、删除、重命名和权限修改的审计日志文件，为空不记录
+	TrashRetention time.Duration // 回收站中的内容保留的时间，默认 30 天
+	Versions       int           // 覆盖文件时保留的旧版本个数，为 0 不保留
+	Dedupe         bool          // 按内容去重，相同内容的文件保存为同一个文件的硬链接
+	Clamd          string        // 扫描上传文件的 clamd 地址，host:port 或 unix socket 路径
+	ScanCommand    string        // 扫描上传文件的外部命令，文件路径作为最后一个参数，退出码 1 表示有病毒
+	Quarantine     bool          // 有病毒的上传移到 .quarantine 中，而不是直接删除
+	FollowSymlinks string        // 符号链接策略：never、within-root（默认）或 always
+
+	FilenameEncoding string // 不是 UTF-8 的文件名使用的编码，如 gbk、big5，显示时转换成 UTF-8
+
+	HideGPS    bool   // 图片页面的拍摄信息中不显示 GPS 位置
+	ImageCache string // 保存缩放后的图片（?w=、?h=）的目录，为空时每次重新生成
+	StripEXIF  bool   // 查看、下载的 JPEG、PNG 去掉 EXIF（包括 GPS 位置）、XMP 等元数据
+
+	Sitemap        bool     // 提供 /sitemap.xml，列出不登录就能访问的目录和文件
+	SitemapExclude []string // 不出现在站点地图中的路径，写法同访问控制规则的 path，如 /drafts/**、**/*.tmp
+	Robots         string   // /robots.txt 的内容：deny 禁止所有爬虫，allow 允许所有，其他值是文件路径；为空时按根目录中的文件处理
+	RobotsTag      string   // 所有响应都带上的 X-Robots-Tag，如 noindex, nofollow
+
+	Users       []User            // 使用 Basic Auth 登录的本地用户，排在配置文件中的用户之前
+	RequireAuth bool              // 所有请求都必须登录
+	ConfigFile  string            // JSON 配置文件，包含用户、访问控制、LDAP、OIDC、JWT 等设置
+	UsersFile   string            // 用户库文件，保存带角色和根目录的用户，可以在管理页面上修改
+	APIToken    string            // 脚本使用的固定 Bearer 令牌，认证为用户 api
+	Protect     map[string]string // 密码保护的目录，路径 => 密码
+	Admins      []string          // 能打开 /stats 等管理页面的用户，写法同访问控制规则的 users，如 alice、@admin
+	Logs        *LogBuffer        // 管理页面显示的最近日志，由调用者把日志写入其中，为空时不显示
+
+	AllowIPs        []string // 只允许这些 CIDR 访问
+	DenyIPs         []string // 禁止这些 CIDR 访问
+	TrustedProxies  []string // 采信这些代理的 X-Forwarded-For
+	TrustUnixSocket bool     // 通过 unix socket 连接时总是采信 X-Forwarded-For
+	PublicURL       string   // 对外的地址 scheme://host[:port]，分享链接、二维码、复制的链接使用；为空时从请求推断
+
+	CORSOrigins []string // 允许跨域访问的来源，* 表示任意来源
+	CORSMethods string   // 跨域请求允许的方法，为空时按运行模式决定
+	CORSHeaders string   // 跨域请求允许的请求头
+
+	CacheControl []string // Cache-Control 规则，格式 match=value
+	MimeTypes    []string // 按扩展名指定的 Content-Type，格式 .ext=type，优先于内容嗅探
+
+	MaxUpload  int64 // 单个上传文件的最大字节数，0 不限制
+	MaxBody    int64 // 单个请求体的最大字节数，0 不限制
+	Quota      int64 // 根目录下所有文件的总大小上限，0 不限制
+	MaxExtract int64 // 解压上传的压缩包时解压出的总大小上限，0 不限制
+
+	Hooks      Hooks                      // 各个处理阶段的回调
+	Previews   map[string]PreviewRenderer // 只对这个服务生效的预览渲染器，键的格式同 RegisterPreview，优先于全局注册的
+	Middleware []Middleware               // 插入到认证之后的中间件，第一个在最外层
+
+	Version VersionInfo // /api/version 返回的版本信息，为空的字段从构建信息中读取
+}
+
+// Option 在 New 中修改 Config，便于只调整少数几项设置
+type Option func(*Config)
+
+// WithFS 从 fsys 读取文件，代替 Root
+func WithFS(fsys fs.FS) Option {
+	return func(c *Config) { c.FS = fsys }
+}
+
+// WithReadWrite 允许上传、删除、重命名等修改
+func WithReadWrite() Option {
+	return func(c *Config) { c.Mode = ModeReadWrite }
+}
+
+// WithBasePath 设置挂载的子路径
+func WithBasePath(p string) Option {
+	return func(c *Config) { c.BasePath = p }
+}
+
+// WithTheme 设置页面主题
+func WithTheme(theme string) Option {
+	return func(c *Config) { c.Theme = theme }
+}
+
+// WithLang 设置默认界面语言
+func WithLang(lang string) Option {
+	return func(c *Config) { c.Lang = lang }
+}
+
+// WithUsers 添加本地用户
+func WithUsers(users ...User) Option {
+	return func(c *Config) { c.Users = append(c.Users, users...) }
+}
+
+// WithRequireAuth 要求所有请求都登录
+func WithRequireAuth() Option {
+	return func(c *Config) { c.RequireAuth = true }
+}
+
+// WithShareSecret 设置签名分享链接的密钥
+func WithShareSecret(secret string) Option {
+	return func(c *Config) { c.ShareSecret = secret }
+}
+
+// WithAccessLog 记录访问日志
+func WithAccessLog() Option {
+	return func(c *Config) { c.AccessLog = true }
+}
+
+// WithHooks 设置回调
+func WithHooks(hooks Hooks) Option {
+	return func(c *Config) { c.Hooks = hooks }
+}
+
+// WithMiddleware 添加中间件，先添加的在外层
+func WithMiddleware(mw ...Middleware) Option {
+	return func(c *Config) { c.Middleware = append(c.Middleware, mw...) }
+}
+
+// WithPreview 添加只对这个服务生效的预览渲染器
+func WithPreview(match string, r PreviewRenderer) Option {
+	return func(c *Config) {
+		if c.Previews == nil {
+			c.Previews = make(map[string]PreviewRenderer)
+		}
+		c.Previews[match] = r
+	}
+}
+
+// WithUploadLimits 设置上传大小和配额限制，0 表示不限制
+func WithUploadLimits(maxUpload, maxBody, quota int64) Option {
+	return func(c *Config) {
+		c.MaxUpload, c.MaxBody, c.Quota = maxUpload, maxBody, quota
+	}
+}
+
+// Handler 是整个文件服务，实现 http.Handler
+type Handler struct {
+	s *server
+	h http.Handler
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.h.ServeHTTP(w, r)
+}
+
+// Root 返回根目录的绝对路径，使用 / 分隔，使用 Config.FS 时为空
+func (h *Handler) Root() string {
+	return h.s.root
+}
+
+// BasePath 返回规范化后的子路径前缀，根路径时为空
+func (h *Handler) BasePath() string {
+	return h.s.base
+}
+
+// Close 写完还没有保存的下载记录并关闭统计数据库和审计日志，没有使用 StatsDB、AuditLog 时什么也不做
+func (h *Handler) Close() error {
+	var errs []error
+	if h.s.stats != nil {
+		errs = append(errs, h.s.stats.close())
+	}
+	if h.s.auditLog != nil {
+		errs = append(errs, h.s.auditLog.close())
+	}
+	return errors.Join(errs...)
+}
+
+// Share 为根目录下的 p 签发分享链接，返回 /s/ 后面的令牌。ttl 和 downloads 为 0 时不限制
+func (h *Handler) Share(p string, ttl time.Duration, downloads int) (string, error) {
+	p = cleanPath(filepath.ToSlash(p))
+	if _, err := h.s.stat(p); err != nil {
+		return "", err
+	}
+	return h.s.shares.mint(p, ttl, downloads, nil), nil
+}
+
+// New 检查配置并创建文件服务，配置有误时返回错误
+func New(cfg Config, opts ...Option) (*Handler, error) {
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if (cfg.Root == "") == (cfg.FS == nil) {
+		return nil, fmt.Errorf("exactly one of root directory and FS is required")
+	}
+	if cfg.Theme == "" {
+		cfg.Theme = "auto"
+	}
+	if cfg.Lang == "" {
+		cfg.Lang = "en"
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = ModeReadOnly
+	}
+
+	var absRoot string
+	fsys := cfg.FS
+	if fsys == nil {
+		abs, err := filepath.Abs(cfg.Root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		absRoot = filepath.ToSlash(abs)
+		policy, err := validSymlinkPolicy(cfg.FollowSymlinks)
+		if err != nil {
+			return nil, err
+		}
+		fsys = newSymlinkFS(abs, policy)
+	} else if cfg.Mode == ModeReadWrite {
+		return nil, fmt.Errorf("read-write mode requires a root directory, FS is read-only")
+	}
+	if cfg.FilenameEncoding != "" {
+		efs, err := newEncodedFS(fsys, cfg.FilenameEncoding)
+		if err != nil {
+			return nil, err
+		}
+		fsys = efs
+	}
+
+	if !slices.Contains(Themes(), cfg.Theme) {
+		return nil, fmt.Errorf("unknown theme %q, available: %s", cfg.Theme, strings.Join(Themes(), ", "))
+	}
+	if cfg.Checksum != "" && hashAlgos[cfg.Checksum] == nil {
+		return nil, fmt.Errorf("unknown checksum %q, expected md5, sha1, sha256 or sha512", cfg.Checksum)
+	}
+	if cfg.Mode != ModeReadOnly && cfg.Mode != ModeReadWrite {
+		return nil, fmt.Errorf("unknown mode %q, expected ro or rw", cfg.Mode)
+	}
+	if _, ok := bundles[cfg.Lang]; !ok {
+		return nil, fmt.Errorf("unknown language %q, available: %s", cfg.Lang, strings.Join(Languages(), ", "))
+	}
+
+	// 模板在启动时解析一次，自定义模板有错误时直接返回
+	t, err := parseTemplates(cfg.Template, cfg.ErrorPages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	secret := []byte(cfg.ShareSecret)
+	if len(secret) == 0 {
+		secret = randomSecret()
+	}
+	shares, err := newShareStore(secret, cfg.ShareDB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load share db: %w", err)
+	}
+
+	protected := make(map[string]string)
+	for dir, pw := range cfg.Protect {
+		if pw == "" {
+			return nil, fmt.Errorf("empty password for protected directory %q", dir)
+		}
+		protected[foldPath(cleanPath(filepath.ToSlash(dir)))] = pw
+	}
+
+	s := &server{root: absRoot, fsys: fsys, hashes: &hashCache{sums: make(map[hashKey]string)}, theme: cfg.Theme, lang: cfg.Lang, checksum: cfg.Checksum, compression: !cfg.DisableCompression, security: !cfg.DisableSecurityHeaders, spa: cfg.SPA, serveIndex: cfg.ServeIndex, base: normalizeBase(cfg.BasePath), tpl: t, secret: secret, shares: shares, protected: protected, unixSocket: cfg.TrustUnixSocket, hooks: cfg.Hooks, middleware: cfg.Middleware, previews: make(map[string]PreviewRenderer), version: cfg.Version.WithBuildInfo(), hideGPS: cfg.HideGPS, imageCache: cfg.ImageCache, stripEXIF: cfg.StripEXIF, sitemap: cfg.Sitemap, sitemapSkip: cfg.SitemapExclude, robotsTag: cfg.RobotsTag}
+	s.writable.Store(cfg.Mode == ModeReadWrite)
+	s.requests.active = map[*activeRequest]struct{}{}
+	for match, r := range cfg.Previews {
+		s.previews[previewKey(match)] = r
+	}
+	if absRoot != "" && !cfg.DisableListingCache {
+		s.listings = newListingCache()
+	}
+	if !cfg.DisableDirSizes {
+		s.sizes = newDirSizes()
+	}
+	if absRoot != "" && !cfg.DisableTrash {
+		s.trashTTL = cfg.TrashRetention
+		if s.trashTTL <= 0 {
+			s.trashTTL = defaultTrashRetention
+		}
+	}
+	if absRoot != "" {
+		s.versions = cfg.Versions
+		s.dedupe = cfg.Dedupe
+		s.quarantine = cfg.Quarantine
+		if s.scanner, err = newScanner(cfg.Clamd, cfg.ScanCommand); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.LiveReload && absRoot == "" {
+		return nil, fmt.Errorf("live reload requires a local root directory")
+	}
+	if s.publicURL, err = parsePublicURL(cfg.PublicURL); err != nil {
+		return nil, err
+	}
+	s.limits = &uploadLimits{maxFile: cfg.MaxUpload, maxBody: cfg.MaxBody, quota: cfg.Quota, maxExtract: cfg.MaxExtract}
+
+	for _, v := range []struct {
+		list  []string
+		nets  *[]*net.IPNet
+		label string
+	}{{cfg.AllowIPs, &s.allowIPs, "allow IPs"}, {cfg.DenyIPs, &s.denyIPs, "deny IPs"}, {cfg.TrustedProxies, &s.trustedProxies, "trusted proxies"}} {
+		nets, err := parseCIDRs(v.list)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", v.label, err)
+		}
+		*v.nets = nets
+	}
+
+	if len(cfg.CORSOrigins) > 0 {
+		s.corsConf = &corsConfig{methods: cfg.CORSMethods, headers: cfg.CORSHeaders}
+		for _, o := range cfg.CORSOrigins {
+			if o = strings.TrimSpace(o); o != "" {
+				s.corsConf.origins = append(s.corsConf.origins, o)
+			}
+		}
+		if s.corsConf.methods == "" {
+			s.corsConf.methods = "GET, HEAD, OPTIONS"
+			if !s.readOnly() {
+				s.corsConf.methods += ", PUT, POST, PATCH, DELETE"
+			}
+		}
+		if s.corsConf.headers == "" {
+			s.corsConf.headers = "Authorization, Content-Type, Range, Upload-Offset, Upload-Length"
+		}
+	}
+
+	if s.robotsTxt, err = loadRobots(cfg.Robots); err != nil {
+		return nil, err
+	}
+
+	for _, v := range cfg.CacheControl {
+		rule, err := parseCacheRule(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cache control: %w", err)
+		}
+		s.flags.cacheRules = append(s.flags.cacheRules, rule)
+	}
+	for _, v := range cfg.MimeTypes {
+		ext, typ, err := parseMimeType(v)
+		if err != nil {
+			return nil, err
+		}
+		if s.flags.mimeTypes == nil {
+			s.flags.mimeTypes = map[string]string{}
+		}
+		s.flags.mimeTypes[ext] = typ
+	}
+
+	if len(cfg.Users) > 0 {
+		// validate 会规范根目录，复制一份，不改动调用者的切片
+		users := slices.Clone(cfg.Users)
+		for i := range users {
+			if err := users[i].validate(); err != nil {
+				return nil, err
+			}
+		}
+		s.flags.auth = append(s.flags.auth, localUsers(users))
+	}
+	if cfg.UsersFile != "" {
+		if s.users, err = openUserStore(cfg.UsersFile); err != nil {
+			return nil, fmt.Errorf("failed to load users: %w", err)
+		}
+		s.flags.auth = append(s.flags.auth, s.users)
+	}
+	s.flags.requireAuth = cfg.RequireAuth
+	s.flags.admins = cfg.Admins
+	s.access.Store(&s.flags)
+	s.configFile = cfg.ConfigFile
+	s.logs = cfg.Logs
+	if cfg.ConfigFile != "" {
+		fc, err := loadConfig(cfg.ConfigFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
+		a, err := s.merge(fc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
+		s.access.Store(a)
+		if fc.OIDC != nil {
+			s.oidc, err = newOIDCAuth(fc.OIDC, secret)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load config: %w", err)
+			}
+		}
+		if fc.JWT != nil {
+			s.tokens = newTokenAuth(cfg.APIToken, fc.JWT)
+		}
+		s.webhooks = newWebhooks(fc.Webhooks)
+		log.Printf("Loaded config: %s (%d users, %d acl rules)\n", cfg.ConfigFile, len(fc.Users), len(fc.ACL))
+	}
+	if s.tokens == nil && cfg.APIToken != "" {
+		s.tokens = newTokenAuth(cfg.APIToken, nil)
+	}
+	// 数据库最后打开，前面的配置有误时不会留下打开的文件
+	if cfg.AuditLog != "" {
+		if s.auditLog, err = openAuditLog(cfg.AuditLog); err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+	}
+	if cfg.StatsDB != "" {
+		if s.stats, err = openDownloadStats(cfg.StatsDB, cfg.StatsRetention); err != nil {
+			if s.auditLog != nil {
+				s.auditLog.close()
+			}
+			return nil, fmt.Errorf("failed to open stats db: %w", err)
+		}
+	}
+	// 文件监视和后台索引在数据库之后启动，前面的配置有误时不会留下无人使用的 goroutine
+	if cfg.LiveReload {
+		if s.liveReload, err = newLiveReload(absRoot); err != nil {
+			(&Handler{s: s}).Close()
+			return nil, fmt.Errorf("failed to watch %s: %w", absRoot, err)
+		}
+	}
+	if cfg.Index {
+		interval := cfg.IndexInterval
+		if interval <= 0 {
+			interval = time.Hour
+		}
+		s.index = newFileIndex(fsys, absRoot, interval)
+	}
+
+	h := s.basePath(s.errorHooks(s.securityHeaders(s.filterIP(s.robots(s.cors(s.allowMethods(s.checkMode(s.authorize(s.trackRequests(s.protect(s.requestHooks(s.cacheControl(s.compress(s.routes()))))))))))))))
+	if cfg.AccessLog {
+		h = s.accessLog(h)
+	}
+
+	return &Handler{s: s, h: h}, nil
+}
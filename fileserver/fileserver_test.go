@@ -0,0 +1,243 @@
+package fileserver
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// newTestRoot 创建一个带有 a.txt 和 sub/b.txt 的临时根目录
+func newTestRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "sub", "b.txt"), []byte("world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// writeConfig 把 JSON 配置写入临时文件，返回文件路径
+func writeConfig(t *testing.T, config string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(file, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func newTestHandler(t *testing.T, cfg Config, opts ...Option) *Handler {
+	t.Helper()
+	h, err := New(cfg, opts...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return h
+}
+
+// do 发送请求并返回响应和响应体
+func do(t *testing.T, h http.Handler, r *http.Request) (*http.Response, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	res := w.Result()
+	b, _ := io.ReadAll(res.Body)
+	return res, string(b)
+}
+
+func TestListing(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)})
+	res, body := do(t, h, httptest.NewRequest("GET", "/", nil))
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", res.StatusCode)
+	}
+	for _, want := range []string{`href="/download/a.txt"`, `href="/sub/"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("listing does not contain %s", want)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)})
+	res, body := do(t, h, httptest.NewRequest("GET", "/download/sub/b.txt", nil))
+	if res.StatusCode != http.StatusOK || body != "world" {
+		t.Fatalf("got %d %q, want 200 \"world\"", res.StatusCode, body)
+	}
+	if cd := res.Header.Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	res, _ = do(t, h, httptest.NewRequest("GET", "/download/missing.txt", nil))
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("missing file: status = %d, want 404", res.StatusCode)
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"report.pdf", `attachment; filename="report.pdf"`},
+		{"my report.pdf", `attachment; filename="my report.pdf"`},
+		{"报告 2024.pdf", `attachment; filename="__ 2024.pdf"; filename*=UTF-8''%E6%8A%A5%E5%91%8A%202024.pdf`},
+		{`say "hi".txt`, `attachment; filename="say \"hi\".txt"; filename*=UTF-8''say%20%22hi%22.txt`},
+		{`a\b.txt`, `attachment; filename="a\\b.txt"; filename*=UTF-8''a%5Cb.txt`},
+		{"a;b%c'd.txt", `attachment; filename="a;b%c'd.txt"`},
+		{"line\nbreak.txt", `attachment; filename="line_break.txt"; filename*=UTF-8''line%0Abreak.txt`},
+	}
+	for _, tt := range tests {
+		if got := contentDisposition("attachment", tt.name); got != tt.want {
+			t.Errorf("contentDisposition(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	// 下载和查看都使用同样的编码，浏览器按 filename* 还原出中文名
+	root := newTestRoot(t)
+	os.WriteFile(filepath.Join(root, "中文 文件.txt"), []byte("x"), 0644)
+	h := newTestHandler(t, Config{Root: root})
+	for _, target := range []string{"/download/", "/view/"} {
+		res, _ := do(t, h, httptest.NewRequest("GET", target+url.PathEscape("中文 文件.txt"), nil))
+		_, params, err := mime.ParseMediaType(res.Header.Get("Content-Disposition"))
+		if err != nil || params["filename"] != "中文 文件.txt" {
+			t.Errorf("GET %s: Content-Disposition = %q, parsed %v, %v", target, res.Header.Get("Content-Disposition"), params, err)
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root})
+	res, _ := do(t, h, httptest.NewRequest("PUT", "/api/files/c.txt", strings.NewReader("x")))
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d, want 405", res.StatusCode)
+	}
+	if _, err := os.Stat(filepath.Join(root, "c.txt")); err == nil {
+		t.Error("file was written in read-only mode")
+	}
+}
+
+func TestWithReadWrite(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root}, WithReadWrite())
+	res, _ := do(t, h, httptest.NewRequest("PUT", "/api/files/new/c.txt", strings.NewReader("upload")))
+	if res.StatusCode >= 300 {
+		t.Fatalf("status = %d, want 2xx", res.StatusCode)
+	}
+	b, err := os.ReadFile(filepath.Join(root, "new", "c.txt"))
+	if err != nil || string(b) != "upload" {
+		t.Fatalf("uploaded file = %q, %v", b, err)
+	}
+}
+
+func TestWithBasePath(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)}, WithBasePath("/files/"))
+	if h.BasePath() != "/files" {
+		t.Errorf("BasePath() = %q, want /files", h.BasePath())
+	}
+	res, body := do(t, h, httptest.NewRequest("GET", "/files/", nil))
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, `href="/files/download/a.txt"`) {
+		t.Fatalf("status = %d, links are not prefixed", res.StatusCode)
+	}
+	res, _ = do(t, h, httptest.NewRequest("GET", "/download/a.txt", nil))
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("request outside base path: status = %d, want 404", res.StatusCode)
+	}
+}
+
+// TestMount 把 Handler 挂载到外部程序自己的 ServeMux 下
+func TestMount(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)}, WithBasePath("/files"))
+	mux := http.NewServeMux()
+	mux.Handle("/files/", h)
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "ok") })
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	for path, want := range map[string]string{"/files/download/a.txt": "hello", "/health": "ok"} {
+		res, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if string(b) != want {
+			t.Errorf("%s = %q, want %q", path, b, want)
+		}
+	}
+}
+
+func TestWithUsers(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)},
+		WithUsers(User{Name: "alice", Password: "secret"}), WithRequireAuth())
+
+	res, _ := do(t, h, httptest.NewRequest("GET", "/download/a.txt", nil))
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("anonymous: status = %d, want 401", res.StatusCode)
+	}
+
+	r := httptest.NewRequest("GET", "/download/a.txt", nil)
+	r.SetBasicAuth("alice", "wrong")
+	if res, _ = do(t, h, r); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong password: status = %d, want 401", res.StatusCode)
+	}
+
+	r = httptest.NewRequest("GET", "/download/a.txt", nil)
+	r.SetBasicAuth("alice", "secret")
+	if res, body := do(t, h, r); res.StatusCode != http.StatusOK || body != "hello" {
+		t.Errorf("alice: got %d %q", res.StatusCode, body)
+	}
+}
+
+func TestShare(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)}, WithShareSecret("test"))
+	token, err := h.Share("sub/b.txt", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, body := do(t, h, httptest.NewRequest("GET", "/s/"+token, nil)); res.StatusCode != http.StatusOK || body != "world" {
+		t.Errorf("share link: got %d %q", res.StatusCode, body)
+	}
+	if _, err := h.Share("missing.txt", 0, 0); err == nil {
+		t.Error("sharing a missing file succeeded")
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	root := t.TempDir()
+	for name, cfg := range map[string]Config{
+		"no root":  {},
+		"theme":    {Root: root, Theme: "nope"},
+		"mode":     {Root: root, Mode: "wo"},
+		"lang":     {Root: root, Lang: "xx"},
+		"checksum": {Root: root, Checksum: "crc"},
+		"cidr":     {Root: root, AllowIPs: []string{"10.0.0.0/99"}},
+		"cache":    {Root: root, CacheControl: []string{"no-equals"}},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("%s: New succeeded, want error", name)
+		}
+	}
+
+	// 配置有误时不会留下后台索引和文件监视的 goroutine
+	before := runtime.NumGoroutine()
+	for range 5 {
+		if _, err := New(Config{Root: root, Index: true, LiveReload: true, AllowIPs: []string{"bad"}}); err == nil {
+			t.Fatal("New succeeded, want error")
+		}
+	}
+	if n := runtime.NumGoroutine(); n > before+2 {
+		t.Errorf("goroutines: %d before, %d after failed New", before, n)
+	}
+}
@@ -0,0 +1,87 @@
+package fileserver
+
+import (
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 浏览、下载、预览都通过 io/fs 读取文件：默认是 os.DirFS(Root)，也可以用 Config.FS 换成 embed.FS、
+// zip.Reader 等，把要分发的内容直接编译进程序。上传、删除等修改仍然直接操作 Root 下的文件，所以 FS 只能只读
+
+// fsName 把 /a/b 形式的路径转换成 io/fs 使用的 a/b，根目录为 .
+func fsName(p string) string {
+	p = strings.TrimPrefix(cleanPath(p), "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+func (s *server) stat(p string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, fsName(p))
+}
+
+func (s *server) open(p string) (fs.File, error) {
+	return s.fsys.Open(fsName(p))
+}
+
+func (s *server) readFile(p string) ([]byte, error) {
+	return fs.ReadFile(s.fsys, fsName(p))
+}
+
+func (s *server) readDir(p string) ([]fs.DirEntry, error) {
+	if s.listings != nil {
+		return s.listings.readDir(s.fsys, fsName(p), s.root+cleanPath(p))
+	}
+	return fs.ReadDir(s.fsys, fsName(p))
+}
+
+// serveContent 发送打开的文件。能 Seek 时交给 http.ServeContent 处理 Range 和条件请求，
+// zip 中的文件等不能 Seek 的只能整个发送
+func serveContent(w http.ResponseWriter, r *http.Request, info fs.FileInfo, f fs.File) {
+	if rs, ok := f.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, info.Name(), info.ModTime(), rs)
+		return
+	}
+	h := w.Header()
+	if h.Get("Content-Type") == "" {
+		if t := mime.TypeByExtension(path.Ext(info.Name())); t != "" {
+			h.Set("Content-Type", t)
+		}
+	}
+	h.Del("Accept-Ranges")
+	if !info.ModTime().IsZero() {
+		if t, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !info.ModTime().Truncate(time.Second).After(t) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		h.Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	}
+	h.Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	if r.Method == http.MethodHead {
+		return
+	}
+	io.Copy(w, f)
+}
+
+// nextEntries 按 fs.ReadDirFile 的约定从 entries 中取出下一批目录项，n <= 0 时全部取出
+func nextEntries(entries *[]fs.DirEntry, n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		all := *entries
+		*entries = nil
+		return all, nil
+	}
+	if len(*entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(*entries))
+	next := (*entries)[:n]
+	*entries = (*entries)[n:]
+	return next, nil
+}
@@ -0,0 +1,79 @@
+package fileserver
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMapFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":           {Data: []byte("hello")},
+		"docs/README.md":  {Data: []byte("# Docs")},
+		"docs/main.go":    {Data: []byte("package main")},
+		"music/song.mp3":  {Data: []byte("ID3")},
+		"music/other.mp3": {Data: []byte("ID3")},
+	}
+	h := newTestHandler(t, Config{}, WithFS(fsys))
+	if h.Root() != "" {
+		t.Errorf("Root() = %q, want empty", h.Root())
+	}
+
+	res, body := do(t, h, httptest.NewRequest("GET", "/docs/", nil))
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, "<h1>Docs</h1>") {
+		t.Fatalf("listing: status = %d, README not rendered", res.StatusCode)
+	}
+
+	r := httptest.NewRequest("GET", "/download/a.txt", nil)
+	r.Header.Set("Range", "bytes=1-2")
+	if res, body = do(t, h, r); res.StatusCode != http.StatusPartialContent || body != "el" {
+		t.Errorf("range: got %d %q", res.StatusCode, body)
+	}
+
+	if res, _ = do(t, h, httptest.NewRequest("GET", "/view/music/other.mp3", nil)); res.StatusCode != http.StatusOK {
+		t.Errorf("player: status = %d", res.StatusCode)
+	}
+	if res, _ = do(t, h, httptest.NewRequest("PUT", "/api/files/b.txt", strings.NewReader("x"))); res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("upload: status = %d, want 405", res.StatusCode)
+	}
+}
+
+// zip 中的文件不能 Seek，下载时整个发送
+func TestZipFS(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("dir/data.txt")
+	w.Write([]byte("zipped content"))
+	zw.Close()
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newTestHandler(t, Config{FS: zr})
+
+	res, body := do(t, h, httptest.NewRequest("GET", "/dir/", nil))
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, "data.txt") {
+		t.Fatalf("listing: status = %d", res.StatusCode)
+	}
+	r := httptest.NewRequest("GET", "/download/dir/data.txt", nil)
+	r.Header.Set("Range", "bytes=0-3")
+	if res, body = do(t, h, r); res.StatusCode != http.StatusOK || body != "zipped content" {
+		t.Errorf("download: got %d %q", res.StatusCode, body)
+	}
+	if res, body = do(t, h, httptest.NewRequest("GET", "/view/dir/data.txt", nil)); res.StatusCode != http.StatusOK || body != "zipped content" {
+		t.Errorf("view: got %d %q", res.StatusCode, body)
+	}
+}
+
+func TestFSReadWrite(t *testing.T) {
+	if _, err := New(Config{FS: fstest.MapFS{}}, WithReadWrite()); err == nil {
+		t.Error("read-write mode with FS succeeded")
+	}
+	if _, err := New(Config{Root: t.TempDir(), FS: fstest.MapFS{}}); err == nil {
+		t.Error("both Root and FS succeeded")
+	}
+}
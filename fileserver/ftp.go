@@ -0,0 +1,904 @@
+package fileserver
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math/rand/v2"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 内置 FTP 服务（-ftp :2121）：和网页共用同一个根目录、同一套用户和访问控制规则，给只会用 FTP 拉取固件的老设备使用。
+// 默认只读，FTPConfig.Writable 并且服务本身是读写模式时才允许上传、删除和重命名。
+// 设置了 TLSConfig 时支持 AUTH TLS（显式 FTPS）。匿名用户用 anonymous 或 ftp 登录，密码任意。
+// FTP 客户端没有地方输入目录密码，受保护的目录在 FTP 中不可访问
+
+// FTPConfig 是 FTP 服务的设置
+type FTPConfig struct {
+	TLSConfig    *tls.Config // 不为 nil 时支持 AUTH TLS
+	RequireTLS   bool        // 登录和传输文件之前必须先升级为 TLS
+	PassivePorts string      // 被动模式数据连接使用的端口范围，如 50000-50100，为空时由系统分配
+	PublicIP     string      // 被动模式告诉客户端连接的 IP，在 NAT 后面时需要设置，为空时使用控制连接的本机地址
+	Writable     bool        // 允许上传、删除、重命名，服务本身还要是读写模式
+}
+
+const (
+	ftpIdleTimeout = 5 * time.Minute
+	ftpDataTimeout = 30 * time.Second
+)
+
+// ServeFTP 在 ln 上提供 FTP 服务，直到 ln 被关闭
+func (h *Handler) ServeFTP(ln net.Listener, conf FTPConfig) error {
+	ports, err := parsePortRange(conf.PassivePorts)
+	if err != nil {
+		return err
+	}
+	if conf.RequireTLS && conf.TLSConfig == nil {
+		return errors.New("ftp: RequireTLS needs a TLSConfig")
+	}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		c := &ftpConn{s: h.s, conf: &conf, ports: ports, ctrl: conn, cwd: "/"}
+		go c.serve()
+	}
+}
+
+// parsePortRange 解析 50000-50100 形式的端口范围，空字符串返回 0, 0
+func parsePortRange(v string) ([2]int, error) {
+	if v == "" {
+		return [2]int{}, nil
+	}
+	lo, hi, ok := strings.Cut(v, "-")
+	if !ok {
+		hi = lo
+	}
+	a, err1 := strconv.Atoi(strings.TrimSpace(lo))
+	b, err2 := strconv.Atoi(strings.TrimSpace(hi))
+	if err1 != nil || err2 != nil || a <= 0 || b > 65535 || a > b {
+		return [2]int{}, fmt.Errorf("invalid passive port range %q, expected e.g. 50000-50100", v)
+	}
+	return [2]int{a, b}, nil
+}
+
+// ftpConn 是一个 FTP 控制连接
+type ftpConn struct {
+	s     *server
+	conf  *FTPConfig
+	ports [2]int
+	ctrl  net.Conn
+	r     *bufio.Reader
+	w     *bufio.Writer
+
+	userName   string // USER 给出的用户名
+	loggedIn   bool
+	u          *user // 登录的用户，匿名时为 nil
+	cwd        string
+	secure     bool // 控制连接已经升级为 TLS
+	protect    bool // PROT P，数据连接也使用 TLS
+	pasv       net.Listener
+	active     string // PORT、EPRT 给出的客户端地址
+	rest       int64  // REST 给出的下载起始位置
+	renameFrom string
+}
+
+func (c *ftpConn) serve() {
+	defer c.ctrl.Close()
+	defer c.closePassive()
+	c.r, c.w = bufio.NewReader(c.ctrl), bufio.NewWriter(c.ctrl)
+
+	ip := addrIP(c.ctrl.RemoteAddr())
+	if !c.s.ipAllowed(ip) {
+		c.reply(421, "Forbidden")
+		return
+	}
+	c.reply(220, "Go-Download-Static-Files FTP server ready")
+	for {
+		c.ctrl.SetReadDeadline(time.Now().Add(ftpIdleTimeout))
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		cmd = strings.ToUpper(cmd)
+		if !c.loggedIn && !ftpPublic[cmd] {
+			c.reply(530, "Please login with USER and PASS")
+			continue
+		}
+		if cmd == "QUIT" {
+			c.reply(221, "Goodbye")
+			return
+		}
+		c.command(cmd, arg)
+	}
+}
+
+// ftpPublic 是登录之前可以使用的命令
+var ftpPublic = map[string]bool{
+	"USER": true, "PASS": true, "AUTH": true, "PBSZ": true, "PROT": true, "FEAT": true,
+	"SYST": true, "OPTS": true, "NOOP": true, "QUIT": true,
+}
+
+func (c *ftpConn) command(cmd, arg string) {
+	switch cmd {
+	case "USER":
+		c.cmdUser(arg)
+	case "PASS":
+		c.cmdPass(arg)
+	case "AUTH":
+		c.cmdAuth(arg)
+	case "PBSZ":
+		c.reply(200, "PBSZ=0")
+	case "PROT":
+		c.cmdProt(arg)
+	case "FEAT":
+		c.cmdFeat()
+	case "SYST":
+		c.reply(215, "UNIX Type: L8")
+	case "OPTS":
+		if strings.EqualFold(arg, "UTF8 ON") {
+			c.reply(200, "UTF8 mode enabled")
+		} else {
+			c.reply(501, "Option not understood")
+		}
+	case "NOOP", "ALLO":
+		c.reply(200, "OK")
+	case "TYPE":
+		c.reply(200, "Type set to "+arg)
+	case "MODE":
+		c.onlyParam(arg, "S")
+	case "STRU":
+		c.onlyParam(arg, "F")
+	case "PWD", "XPWD":
+		c.reply(257, `"`+strings.ReplaceAll(c.cwd, `"`, `""`)+`" is the current directory`)
+	case "CWD", "XCWD":
+		c.cmdCwd(arg)
+	case "CDUP", "XCUP":
+		c.cmdCwd("..")
+	case "PASV":
+		c.cmdPasv(false)
+	case "EPSV":
+		c.cmdPasv(true)
+	case "PORT":
+		c.cmdPort(arg, false)
+	case "EPRT":
+		c.cmdPort(arg, true)
+	case "LIST", "NLST", "MLSD":
+		c.cmdList(cmd, arg)
+	case "MLST":
+		c.cmdMlst(arg)
+	case "SIZE", "MDTM":
+		c.cmdStat(cmd, arg)
+	case "REST":
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || n < 0 {
+			c.reply(501, "Invalid offset")
+			return
+		}
+		c.rest = n
+		c.reply(350, "Restarting at "+arg)
+	case "RETR":
+		c.cmdRetr(arg)
+	case "STOR":
+		c.cmdStor(arg)
+	case "DELE", "RMD", "XRMD":
+		c.cmdDelete(cmd, arg)
+	case "MKD", "XMKD":
+		c.cmdMkdir(arg)
+	case "RNFR":
+		c.cmdRenameFrom(arg)
+	case "RNTO":
+		c.cmdRenameTo(arg)
+	default:
+		c.reply(502, "Command not implemented")
+	}
+}
+
+// reply 发送一行响应
+func (c *ftpConn) reply(code int, msg string) {
+	fmt.Fprintf(c.w, "%d %s\r\n", code, msg)
+	c.w.Flush()
+}
+
+func (c *ftpConn) onlyParam(arg, want string) {
+	if strings.EqualFold(arg, want) {
+		c.reply(200, "OK")
+	} else {
+		c.reply(504, "Only "+want+" is supported")
+	}
+}
+
+// replyError 把文件操作的错误转换成 FTP 响应，系统错误信息只写入日志
+func (c *ftpConn) replyError(err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		c.reply(550, "File not found")
+	case errors.Is(err, fs.ErrPermission):
+		c.reply(550, "Permission denied")
+	case errors.Is(err, errFileExists):
+		c.reply(550, "File already exists")
+	case errors.Is(err, errTooLarge), errors.Is(err, errQuota):
+		c.reply(552, err.Error())
+	case errors.Is(err, errInfected):
+		c.reply(550, err.Error())
+	case errors.Is(err, errScan):
+		c.reply(451, err.Error())
+	default:
+		log.Printf("ftp %s: %v", c.ctrl.RemoteAddr(), err)
+		c.reply(550, "Operation failed")
+	}
+}
+
+// tlsRequired 在要求 TLS 而连接还没有升级时回复错误
+func (c *ftpConn) tlsRequired() bool {
+	if c.conf.RequireTLS && !c.secure {
+		c.reply(530, "TLS required, use AUTH TLS first")
+		return true
+	}
+	return false
+}
+
+func (c *ftpConn) cmdUser(arg string) {
+	if c.tlsRequired() {
+		return
+	}
+	c.userName, c.loggedIn, c.u = arg, false, nil
+	c.reply(331, "Password required")
+}
+
+func (c *ftpConn) cmdPass(arg string) {
+	if c.userName == "" {
+		c.reply(503, "Send USER first")
+		return
+	}
+	if c.userName == "anonymous" || c.userName == "ftp" {
+		if c.s.conf().requireAuth {
+			c.reply(530, "Anonymous login is not allowed")
+			return
+		}
+		c.loggedIn = true
+		c.reply(230, "Anonymous user logged in")
+		return
+	}
+	for _, a := range c.s.conf().auth {
+		u, err := a.authenticate(c.userName, arg)
+		if err != nil {
+			log.Printf("Auth backend error: %v", err)
+			continue
+		}
+		if u != nil {
+			c.loggedIn, c.u = true, u
+			c.reply(230, "User logged in")
+			return
+		}
+	}
+	log.Printf("ftp %s: failed login for %q", c.ctrl.RemoteAddr(), c.userName)
+	// 放慢暴力猜测密码的速度
+	time.Sleep(time.Second)
+	c.reply(530, "Login incorrect")
+}
+
+func (c *ftpConn) cmdAuth(arg string) {
+	switch {
+	case c.conf.TLSConfig == nil:
+		c.reply(502, "TLS is not configured")
+	case !strings.EqualFold(arg, "TLS") && !strings.EqualFold(arg, "SSL"):
+		c.reply(504, "Only AUTH TLS is supported")
+	case c.secure:
+		c.reply(503, "Already using TLS")
+	default:
+		c.reply(234, "Proceed with TLS negotiation")
+		conn := tls.Server(c.ctrl, c.conf.TLSConfig)
+		c.ctrl.SetDeadline(time.Now().Add(ftpDataTimeout))
+		if err := conn.Handshake(); err != nil {
+			c.ctrl.Close()
+			return
+		}
+		c.ctrl.SetDeadline(time.Time{})
+		c.ctrl, c.secure = conn, true
+		c.r, c.w = bufio.NewReader(conn), bufio.NewWriter(conn)
+	}
+}
+
+func (c *ftpConn) cmdProt(arg string) {
+	switch strings.ToUpper(arg) {
+	case "P":
+		if !c.secure {
+			c.reply(503, "Use AUTH TLS first")
+			return
+		}
+		c.protect = true
+		c.reply(200, "Data connections will use TLS")
+	case "C":
+		if c.conf.RequireTLS {
+			c.reply(534, "Data connections must use TLS")
+			return
+		}
+		c.protect = false
+		c.reply(200, "Data connections will not use TLS")
+	default:
+		c.reply(504, "Only PROT P and PROT C are supported")
+	}
+}
+
+func (c *ftpConn) cmdFeat() {
+	feats := []string{"UTF8", "EPSV", "MLST type*;size*;modify*;", "SIZE", "MDTM", "REST STREAM"}
+	if c.conf.TLSConfig != nil {
+		feats = append(feats, "AUTH TLS", "PBSZ", "PROT")
+	}
+	fmt.Fprintf(c.w, "211-Features:\r\n")
+	for _, f := range feats {
+		fmt.Fprintf(c.w, " %s\r\n", f)
+	}
+	c.reply(211, "End")
+}
+
+// path 把命令参数转换成相对根目录的路径
+func (c *ftpConn) path(arg string) string {
+	if !strings.HasPrefix(arg, "/") {
+		arg = path.Join(c.cwd, arg)
+	}
+	return cleanPath(arg)
+}
+
+func (c *ftpConn) access(p, perm string) error {
+	return c.s.sessionAccess(c.u, p, perm)
+}
+
+// writable 检查能否修改 p，不能时回复错误并返回 false
+func (c *ftpConn) writable(p string) bool {
+	if !c.conf.Writable || c.s.readOnly() {
+		c.reply(550, "Server is read-only")
+		return false
+	}
+	if p == "/" {
+		c.reply(550, errBadName.Error())
+		return false
+	}
+	if err := c.access(p, permWrite); err != nil {
+		c.replyError(err)
+		return false
+	}
+	return true
+}
+
+func (c *ftpConn) cmdCwd(arg string) {
+	p := c.path(arg)
+	if err := c.access(p, permRead); err != nil {
+		c.replyError(err)
+		return
+	}
+	info, err := c.s.stat(p)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	if !info.IsDir() {
+		c.reply(550, "Not a directory")
+		return
+	}
+	c.cwd = p
+	c.reply(250, "Directory changed to "+p)
+}
+
+func (c *ftpConn) closePassive() {
+	if c.pasv != nil {
+		c.pasv.Close()
+		c.pasv = nil
+	}
+}
+
+// listenPassive 在控制连接的本机地址上监听一个被动模式端口
+func (c *ftpConn) listenPassive() (net.Listener, error) {
+	host := addrIP(c.ctrl.LocalAddr()).String()
+	if c.ports[0] == 0 {
+		return net.Listen("tcp", net.JoinHostPort(host, "0"))
+	}
+	// 从随机位置开始尝试，多个连接同时进入被动模式时不容易冲突
+	n := c.ports[1] - c.ports[0] + 1
+	start := rand.IntN(n)
+	var lastErr error
+	for i := range n {
+		port := c.ports[0] + (start+i)%n
+		ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err == nil {
+			return ln, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (c *ftpConn) cmdPasv(extended bool) {
+	if c.tlsRequired() {
+		return
+	}
+	c.closePassive()
+	c.active = ""
+	ln, err := c.listenPassive()
+	if err != nil {
+		log.Printf("ftp %s: passive listen: %v", c.ctrl.RemoteAddr(), err)
+		c.reply(425, "Cannot open passive connection")
+		return
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	if extended {
+		c.pasv = ln
+		c.reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", port))
+		return
+	}
+	ip := addrIP(c.ctrl.LocalAddr())
+	if c.conf.PublicIP != "" {
+		ip = net.ParseIP(c.conf.PublicIP)
+	}
+	ip4 := ip.To4()
+	if ip4 == nil {
+		ln.Close()
+		c.reply(425, "PASV needs IPv4, use EPSV")
+		return
+	}
+	c.pasv = ln
+	c.reply(227, fmt.Sprintf("Entering Passive Mode (%d,%d,%d,%d,%d,%d)", ip4[0], ip4[1], ip4[2], ip4[3], port>>8, port&0xff))
+}
+
+// cmdPort 处理主动模式。只允许连回控制连接的客户端，避免被用来向第三方发起连接（FTP bounce）
+func (c *ftpConn) cmdPort(arg string, extended bool) {
+	if c.tlsRequired() {
+		return
+	}
+	var ip net.IP
+	var port int
+	if extended {
+		// EPRT |协议|地址|端口|
+		if parts := strings.Split(arg, arg[:min(len(arg), 1)]); len(arg) > 0 && len(parts) == 5 {
+			ip = net.ParseIP(parts[2])
+			port, _ = strconv.Atoi(parts[3])
+		}
+	} else {
+		var h [6]int
+		if n, _ := fmt.Sscanf(arg, "%d,%d,%d,%d,%d,%d", &h[0], &h[1], &h[2], &h[3], &h[4], &h[5]); n == 6 {
+			ip = net.IPv4(byte(h[0]), byte(h[1]), byte(h[2]), byte(h[3]))
+			port = h[4]<<8 | h[5]
+		}
+	}
+	if ip == nil || port < 1024 || port > 65535 {
+		c.reply(501, "Invalid address")
+		return
+	}
+	if !ip.Equal(addrIP(c.ctrl.RemoteAddr())) {
+		c.reply(504, "Data connections to other hosts are not allowed")
+		return
+	}
+	c.closePassive()
+	c.active = net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	c.reply(200, "PORT command successful")
+}
+
+// dataConn 建立数据连接，被动模式只接受来自同一客户端的连接，防止别人抢先连上端口拿走文件
+func (c *ftpConn) dataConn() (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	switch {
+	case c.pasv != nil:
+		ln := c.pasv
+		c.pasv = nil
+		defer ln.Close()
+		if tl, ok := ln.(*net.TCPListener); ok {
+			tl.SetDeadline(time.Now().Add(ftpDataTimeout))
+		}
+		conn, err = ln.Accept()
+		if err == nil && !addrIP(conn.RemoteAddr()).Equal(addrIP(c.ctrl.RemoteAddr())) {
+			conn.Close()
+			return nil, errors.New("data connection from another host")
+		}
+	case c.active != "":
+		conn, err = net.DialTimeout("tcp", c.active, ftpDataTimeout)
+		c.active = ""
+	default:
+		return nil, errors.New("no PASV or PORT given")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.protect {
+		tc := tls.Server(conn, c.conf.TLSConfig)
+		tc.SetDeadline(time.Now().Add(ftpDataTimeout))
+		if err := tc.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tc.SetDeadline(time.Time{})
+		conn = tc
+	}
+	return conn, nil
+}
+
+// transfer 打开数据连接并执行 fn，结束后回复传输结果
+func (c *ftpConn) transfer(fn func(conn net.Conn) error) {
+	c.reply(150, "Opening data connection")
+	conn, err := c.dataConn()
+	if err != nil {
+		log.Printf("ftp %s: data connection: %v", c.ctrl.RemoteAddr(), err)
+		c.reply(425, "Cannot open data connection")
+		return
+	}
+	err = fn(conn)
+	if cerr := conn.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		if errors.Is(err, errTooLarge) || errors.Is(err, errQuota) {
+			c.reply(552, err.Error())
+			return
+		}
+		if errors.Is(err, errInfected) || errors.Is(err, errScan) {
+			c.replyError(err)
+			return
+		}
+		c.reply(426, "Transfer aborted")
+		return
+	}
+	c.reply(226, "Transfer complete")
+}
+
+// listArgs 去掉 LIST -la 之类的参数，返回要列出的路径
+func listArgs(arg string) string {
+	var rest []string
+	for _, f := range strings.Fields(arg) {
+		if !strings.HasPrefix(f, "-") {
+			rest = append(rest, f)
+		}
+	}
+	return strings.Join(rest, " ")
+}
+
+func (c *ftpConn) cmdList(cmd, arg string) {
+	if c.tlsRequired() {
+		return
+	}
+	p := c.path(listArgs(arg))
+	if err := c.access(p, permRead); err != nil {
+		c.replyError(err)
+		return
+	}
+	info, err := c.s.stat(p)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	var infos []fs.FileInfo
+	if info.IsDir() {
+		entries, err := c.s.readDir(p)
+		if err != nil {
+			c.replyError(err)
+			return
+		}
+		for _, e := range entries {
+			if isHidden(path.Join(p, e.Name())) {
+				continue
+			}
+			if fi, err := e.Info(); err == nil {
+				infos = append(infos, fi)
+			}
+		}
+	} else if cmd == "MLSD" {
+		c.reply(501, "Not a directory")
+		return
+	} else {
+		infos = []fs.FileInfo{info}
+	}
+
+	c.transfer(func(conn net.Conn) error {
+		w := bufio.NewWriter(conn)
+		for _, fi := range infos {
+			switch cmd {
+			case "NLST":
+				fmt.Fprintf(w, "%s\r\n", fi.Name())
+			case "MLSD":
+				fmt.Fprintf(w, "%s %s\r\n", mlstFacts(fi), fi.Name())
+			default:
+				fmt.Fprintf(w, "%s\r\n", lsLine(fi))
+			}
+		}
+		return w.Flush()
+	})
+}
+
+func (c *ftpConn) cmdMlst(arg string) {
+	p := c.path(arg)
+	if err := c.access(p, permRead); err != nil {
+		c.replyError(err)
+		return
+	}
+	info, err := c.s.stat(p)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	fmt.Fprintf(c.w, "250-Listing %s\r\n %s %s\r\n", p, mlstFacts(info), p)
+	c.reply(250, "End")
+}
+
+// lsLine 返回 ls -l 格式的一行，大多数 FTP 客户端都按这个格式解析 LIST 的结果
+func lsLine(fi fs.FileInfo) string {
+	mode := "-rw-r--r--"
+	if fi.IsDir() {
+		mode = "drwxr-xr-x"
+	}
+	t := fi.ModTime()
+	stamp := t.Format("Jan _2 15:04")
+	if time.Since(t) > 180*24*time.Hour || time.Until(t) > time.Hour {
+		stamp = t.Format("Jan _2  2006")
+	}
+	return fmt.Sprintf("%s 1 ftp ftp %12d %s %s", mode, fi.Size(), stamp, fi.Name())
+}
+
+// mlstFacts 返回 MLSD、MLST 使用的机器可读属性
+func mlstFacts(fi fs.FileInfo) string {
+	typ := "file"
+	if fi.IsDir() {
+		typ = "dir"
+	}
+	return fmt.Sprintf("type=%s;size=%d;modify=%s;", typ, fi.Size(), fi.ModTime().UTC().Format("20060102150405"))
+}
+
+func (c *ftpConn) cmdStat(cmd, arg string) {
+	p := c.path(arg)
+	if err := c.access(p, permRead); err != nil {
+		c.replyError(err)
+		return
+	}
+	info, err := c.s.stat(p)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	if info.IsDir() {
+		c.reply(550, "Not a regular file")
+		return
+	}
+	if cmd == "SIZE" {
+		c.reply(213, strconv.FormatInt(info.Size(), 10))
+	} else {
+		c.reply(213, info.ModTime().UTC().Format("20060102150405"))
+	}
+}
+
+func (c *ftpConn) cmdRetr(arg string) {
+	offset := c.rest
+	c.rest = 0
+	if c.tlsRequired() {
+		return
+	}
+	p := c.path(arg)
+	if err := c.access(p, permRead); err != nil {
+		c.replyError(err)
+		return
+	}
+	info, err := c.s.stat(p)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	if info.IsDir() {
+		c.reply(550, "Not a regular file")
+		return
+	}
+	f, err := c.s.open(p)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	defer f.Close()
+	if offset > 0 {
+		if rs, ok := f.(io.Seeker); ok {
+			_, err = rs.Seek(offset, io.SeekStart)
+		} else {
+			_, err = io.CopyN(io.Discard, f, offset)
+		}
+		if err != nil {
+			c.reply(554, "Invalid restart position")
+			return
+		}
+	}
+	c.transfer(func(conn net.Conn) error {
+		var w io.Writer = conn
+		var t *transfer
+		if c.s.stats != nil {
+			t = c.s.stats.start(c.downloadRecord(p), info.Size())
+			defer c.s.stats.finish(t)
+			w = io.MultiWriter(conn, t)
+		}
+		n, err := io.Copy(w, f)
+		if err == nil && offset == 0 {
+			c.notify(eventDownload, p, n)
+		}
+		if t != nil {
+			t.rec.Bytes, t.rec.Status = n, 226
+			if err != nil {
+				t.rec.Status = 426
+			}
+			c.s.stats.record(t.rec)
+		}
+		return err
+	})
+}
+
+func (c *ftpConn) cmdStor(arg string) {
+	if c.rest > 0 {
+		c.rest = 0
+		c.reply(504, "Resuming uploads is not supported")
+		return
+	}
+	if c.tlsRequired() {
+		return
+	}
+	p := c.path(arg)
+	if !c.writable(p) {
+		return
+	}
+	if info, err := os.Stat(c.s.root + path.Dir(p)); err != nil || !info.IsDir() {
+		c.reply(550, "Directory not found")
+		return
+	}
+	c.transfer(func(conn net.Conn) error {
+		// FTP 的 STOR 约定覆盖同名文件
+		err := c.s.saveFile(p, c.s.limitUpload(conn), true)
+		c.s.uploaded()
+		if err == nil {
+			if info, serr := os.Stat(c.s.root + p); serr == nil {
+				c.notify(eventUpload, p, info.Size())
+				c.audit(auditEntry{Action: auditUpload, Path: p, Size: info.Size()})
+			}
+		}
+		return err
+	})
+}
+
+func (c *ftpConn) cmdDelete(cmd, arg string) {
+	p := c.path(arg)
+	if !c.writable(p) {
+		return
+	}
+	info, err := os.Lstat(c.s.root + p)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	if info.IsDir() != (cmd != "DELE") {
+		if info.IsDir() {
+			c.reply(550, "Is a directory, use RMD")
+		} else {
+			c.reply(550, "Not a directory, use DELE")
+		}
+		return
+	}
+	if c.s.trashTTL > 0 && !info.IsDir() {
+		// 文件放入回收站，RMD 只能删除空目录，直接删除
+		var who string
+		if c.u != nil {
+			who = c.u.Name
+		}
+		err = c.s.moveToTrash(p, info, who)
+	} else {
+		err = os.Remove(c.s.root + p)
+	}
+	if err != nil {
+		if info.IsDir() && !errors.Is(err, os.ErrPermission) {
+			c.reply(550, "Directory not empty")
+			return
+		}
+		c.replyError(err)
+		return
+	}
+	c.notify(eventDelete, p, 0)
+	e := auditEntry{Action: auditDelete, Path: p}
+	if info.IsDir() {
+		e.Detail = "directory"
+	}
+	c.audit(e)
+	c.reply(250, "Deleted "+p)
+}
+
+// notify 发送 FTP 操作的 webhook 事件
+func (c *ftpConn) notify(event, p string, size int64) {
+	ev := webhookEvent{Event: event, Path: p, Size: size, Via: "ftp", Client: remoteIP(c.ctrl.RemoteAddr())}
+	if c.u != nil {
+		ev.User = c.u.Name
+	}
+	c.s.notify(ev)
+}
+
+// audit 记录 FTP 会话完成的操作
+func (c *ftpConn) audit(e auditEntry) {
+	e.Via, e.Client = "ftp", remoteIP(c.ctrl.RemoteAddr())
+	if c.u != nil {
+		e.User = c.u.Name
+	}
+	c.s.audit(e)
+}
+
+// downloadRecord 返回下载 p 的记录，字节数和状态码在下载结束后填写
+func (c *ftpConn) downloadRecord(p string) downloadRecord {
+	rec := downloadRecord{Path: p, Via: "ftp", Client: remoteIP(c.ctrl.RemoteAddr()), Time: time.Now()}
+	if c.u != nil {
+		rec.User = c.u.Name
+	}
+	return rec
+}
+
+func (c *ftpConn) cmdMkdir(arg string) {
+	p := c.path(arg)
+	if !c.writable(p) {
+		return
+	}
+	if err := os.Mkdir(c.s.root+p, 0755); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			err = errFileExists
+		}
+		c.replyError(err)
+		return
+	}
+	c.audit(auditEntry{Action: auditMkdir, Path: p})
+	c.reply(257, `"`+strings.ReplaceAll(p, `"`, `""`)+`" created`)
+}
+
+func (c *ftpConn) cmdRenameFrom(arg string) {
+	p := c.path(arg)
+	if !c.writable(p) {
+		return
+	}
+	if _, err := os.Lstat(c.s.root + p); err != nil {
+		c.replyError(err)
+		return
+	}
+	c.renameFrom = p
+	c.reply(350, "Ready for RNTO")
+}
+
+func (c *ftpConn) cmdRenameTo(arg string) {
+	from := c.renameFrom
+	c.renameFrom = ""
+	if from == "" {
+		c.reply(503, "Send RNFR first")
+		return
+	}
+	to := c.path(arg)
+	if !c.writable(to) {
+		return
+	}
+	if strings.HasPrefix(to+"/", from+"/") {
+		c.reply(553, "Cannot move a directory into itself")
+		return
+	}
+	if _, err := os.Lstat(c.s.root + to); err == nil {
+		c.replyError(errFileExists)
+		return
+	}
+	if err := os.Rename(c.s.root+from, c.s.root+to); err != nil {
+		c.replyError(err)
+		return
+	}
+	c.audit(auditEntry{Action: auditRename, Path: from, To: to})
+	c.reply(250, "Renamed to "+to)
+}
+
+// addrIP 返回 TCP 地址中的 IP
+func addrIP(a net.Addr) net.IP {
+	if ta, ok := a.(*net.TCPAddr); ok {
+		return ta.IP
+	}
+	host, _, _ := net.SplitHostPort(a.String())
+	return net.ParseIP(host)
+}
@@ -0,0 +1,270 @@
+package fileserver
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// startFTP 在本机随机端口上启动 FTP 服务，返回地址
+func startFTP(t *testing.T, h *Handler, conf FTPConfig) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go h.ServeFTP(ln, conf)
+	return ln.Addr().String()
+}
+
+func dialFTP(t *testing.T, addr, name, password string, opts ...ftp.DialOption) *ftp.ServerConn {
+	t.Helper()
+	c, err := ftp.Dial(addr, append(opts, ftp.DialWithTimeout(5*time.Second))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Quit() })
+	if err := c.Login(name, password); err != nil {
+		t.Fatalf("login as %s: %v", name, err)
+	}
+	return c
+}
+
+func retr(c *ftp.ServerConn, p string, offset uint64) (string, error) {
+	res, err := c.RetrFrom(p, offset)
+	if err != nil {
+		return "", err
+	}
+	defer res.Close()
+	b, err := io.ReadAll(res)
+	return string(b), err
+}
+
+func TestFTPReadOnly(t *testing.T) {
+	root := newTestRoot(t)
+	os.WriteFile(filepath.Join(root, "sub", ".password"), []byte("pw"), 0644)
+	os.Mkdir(filepath.Join(root, "open"), 0755)
+	h := newTestHandler(t, Config{Root: root}, WithReadWrite())
+	c := dialFTP(t, startFTP(t, h, FTPConfig{}), "anonymous", "guest@example.com")
+
+	entries, err := c.List("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	if !slices.Equal(names, []string{"a.txt", "open", "sub"}) {
+		t.Errorf("List = %q", names)
+	}
+	if got, err := retr(c, "a.txt", 0); err != nil || got != "hello" {
+		t.Errorf("RETR a.txt = %q, %v", got, err)
+	}
+	if got, err := retr(c, "/a.txt", 2); err != nil || got != "llo" {
+		t.Errorf("REST 2, RETR a.txt = %q, %v", got, err)
+	}
+	if size, err := c.FileSize("a.txt"); err != nil || size != 5 {
+		t.Errorf("SIZE = %d, %v", size, err)
+	}
+	if err := c.ChangeDir("open"); err != nil {
+		t.Fatal(err)
+	}
+	if dir, _ := c.CurrentDir(); dir != "/open" {
+		t.Errorf("PWD = %q", dir)
+	}
+	c.ChangeDirToParent()
+
+	// 受保护的目录在 FTP 中无法解锁，隐藏文件也不能下载
+	if err := c.ChangeDir("sub"); err == nil {
+		t.Error("CWD into a password protected directory succeeded")
+	}
+	if _, err := retr(c, "sub/b.txt", 0); err == nil {
+		t.Error("RETR in a password protected directory succeeded")
+	}
+	if _, err := retr(c, "/sub/.password", 0); err == nil {
+		t.Error("RETR of .password succeeded")
+	}
+
+	// 没有 Writable 时即使服务是读写模式也不能修改
+	if err := c.Stor("new.txt", strings.NewReader("x")); err == nil {
+		t.Error("STOR succeeded on a read-only FTP server")
+	}
+	if err := c.Delete("a.txt"); err == nil {
+		t.Error("DELE succeeded on a read-only FTP server")
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.txt")); err != nil {
+		t.Error("a.txt was deleted")
+	}
+}
+
+func TestFTPAuth(t *testing.T) {
+	config := writeConfig(t, `{
+		"users": [{"name": "alice", "password": "pw", "groups": ["staff"]}, {"name": "bob", "password": "pw"}],
+		"acl": [{"path": "/sub/**", "users": ["@staff"], "action": "allow"}, {"path": "/sub/**", "users": ["*"], "action": "deny"}]
+	}`)
+	h := newTestHandler(t, Config{Root: newTestRoot(t), ConfigFile: config, RequireAuth: true})
+	addr := startFTP(t, h, FTPConfig{})
+
+	for name, password := range map[string]string{"anonymous": "x", "alice": "wrong"} {
+		c, err := ftp.Dial(addr, ftp.DialWithTimeout(5*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Login(name, password); err == nil {
+			t.Errorf("login as %s/%s succeeded", name, password)
+		}
+		c.Quit()
+	}
+
+	alice := dialFTP(t, addr, "alice", "pw")
+	if got, err := retr(alice, "sub/b.txt", 0); err != nil || got != "world" {
+		t.Errorf("alice: RETR sub/b.txt = %q, %v", got, err)
+	}
+	bob := dialFTP(t, addr, "bob", "pw")
+	if _, err := retr(bob, "sub/b.txt", 0); err == nil {
+		t.Error("bob: RETR sub/b.txt succeeded despite the ACL")
+	}
+	if got, err := retr(bob, "a.txt", 0); err != nil || got != "hello" {
+		t.Errorf("bob: RETR a.txt = %q, %v", got, err)
+	}
+}
+
+func TestFTPWrite(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root}, WithReadWrite(), WithUploadLimits(10, 0, 0))
+	c := dialFTP(t, startFTP(t, h, FTPConfig{Writable: true}), "ftp", "")
+
+	if err := c.MakeDir("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stor("docs/readme.txt", strings.NewReader("read me")); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "docs", "readme.txt")); string(b) != "read me" {
+		t.Errorf("uploaded file = %q", b)
+	}
+	if err := c.Stor("big.bin", bytes.NewReader(make([]byte, 11))); err == nil {
+		t.Error("STOR over -max-upload succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(root, "big.bin")); err == nil {
+		t.Error("oversized upload was kept")
+	}
+	if err := c.Stor(".password", strings.NewReader("x")); err == nil {
+		t.Error("STOR .password succeeded")
+	}
+	if err := c.Rename("docs/readme.txt", "docs/README.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Rename("docs", "docs/inner"); err == nil {
+		t.Error("moving a directory into itself succeeded")
+	}
+	if err := c.RemoveDir("docs"); err == nil {
+		t.Error("RMD of a non-empty directory succeeded")
+	}
+	if err := c.Delete("docs/README.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveDir("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "docs")); err == nil {
+		t.Error("docs was not removed")
+	}
+}
+
+// newServerCert 生成 127.0.0.1 的自签名服务器证书
+func newServerCert(t *testing.T) (*x509.CertPool, tls.Certificate) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "localhost"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return pool, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestFTPTLS(t *testing.T) {
+	pool, cert := newServerCert(t)
+	h := newTestHandler(t, Config{Root: newTestRoot(t)})
+	addr := startFTP(t, h, FTPConfig{TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}}, RequireTLS: true})
+
+	plain, err := ftp.Dial(addr, ftp.DialWithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.Login("anonymous", "x"); err == nil {
+		t.Error("login without TLS succeeded")
+	}
+	plain.Quit()
+
+	c := dialFTP(t, addr, "anonymous", "x", ftp.DialWithExplicitTLS(&tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}))
+	if got, err := retr(c, "sub/b.txt", 0); err != nil || got != "world" {
+		t.Errorf("RETR over TLS = %q, %v", got, err)
+	}
+}
+
+// TestFTPPort 检查主动模式不能让服务器连接第三方（FTP bounce）
+func TestFTPPort(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)})
+	conn, err := textproto.Dial("tcp", startFTP(t, h, FTPConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	expect := func(code int, format string, args ...any) {
+		t.Helper()
+		if format != "" {
+			conn.PrintfLine(format, args...)
+		}
+		if _, msg, err := conn.ReadResponse(code); err != nil {
+			t.Fatalf("%q: %v %s", format, err, msg)
+		}
+	}
+	expect(220, "")
+	expect(530, "PORT 127,0,0,1,200,1")
+	expect(331, "USER anonymous")
+	expect(230, "PASS x")
+	expect(504, "PORT 10,1,2,3,200,1")
+	expect(504, "EPRT |1|10.1.2.3|51201|")
+	expect(501, "PORT 127,0,0,1,0,21")
+	expect(200, "EPRT |1|127.0.0.1|51201|")
+}
+
+func TestParsePortRange(t *testing.T) {
+	for v, want := range map[string][2]int{"": {0, 0}, "50000-50100": {50000, 50100}, "2121": {2121, 2121}} {
+		if got, err := parsePortRange(v); err != nil || got != want {
+			t.Errorf("parsePortRange(%q) = %v, %v", v, got, err)
+		}
+	}
+	for _, v := range []string{"a-b", "100-50", "0-10", "60000-70000"} {
+		if _, err := parsePortRange(v); err == nil {
+			t.Errorf("parsePortRange(%q) succeeded", v)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package fileserver
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 相册视图：目录中大部分是图片时，图片显示成缩略图网格，点击后在当前页面上放大（灯箱），←→ 切换上一张、下一张，Esc 关闭。
+// ?view=gallery、?view=list 切换两种显示方式，不带参数时图片超过一半就用相册。缩略图和放大的图片都通过 ?w=、?h= 缩放（见 resize.go），
+// 不能缩放的格式（WebP、SVG 等）直接用原图。子目录和其他文件照常显示在列表中
+
+// 缩略图和灯箱中图片的最大边长
+const (
+	thumbSize    = 240
+	lightboxSize = 1920
+)
+
+// galleryView 判断目录列表是否用相册显示，返回其中图片的个数
+func galleryView(r *http.Request, list []FileInfo) (bool, int) {
+	images := 0
+	for _, f := range list {
+		if !f.IsDir && isImage(f.Name) {
+			images++
+		}
+	}
+	switch r.URL.Query().Get("view") {
+	case "gallery":
+		return images > 0, images
+	case "list":
+		return false, images
+	}
+	return images*2 > len(list), images
+}
+
+// setThumbs 给列表中的图片填上缩略图和放大显示的地址
+func (s *server) setThumbs(list []FileInfo) {
+	for i, f := range list {
+		if f.IsDir || !isImage(f.Name) {
+			continue
+		}
+		view := s.base + "/view" + strings.TrimPrefix(f.URL, s.base+"/download")
+		if !isResizable(f.Name) {
+			list[i].Thumb, list[i].Full = view+"?raw=1", view+"?raw=1"
+			continue
+		}
+		list[i].Thumb = view + "?w=" + strconv.Itoa(thumbSize) + "&h=" + strconv.Itoa(thumbSize)
+		list[i].Full = view + "?w=" + strconv.Itoa(lightboxSize) + "&h=" + strconv.Itoa(lightboxSize)
+	}
+}
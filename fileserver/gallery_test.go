@@ -0,0 +1,72 @@
+package fileserver
+
+import (
+	"bytes"
+	"html"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGallery(t *testing.T) {
+	root := newTestRoot(t)
+	dir := filepath.Join(root, "photos")
+	os.Mkdir(dir, 0755)
+	var buf bytes.Buffer
+	png.Encode(&buf, halfImage(800, 400))
+	for _, name := range []string{"p1.png", "p2.png", "p3.png"} {
+		os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644)
+	}
+	os.WriteFile(filepath.Join(dir, "p4.webp"), []byte("RIFF"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0644)
+	h := newTestHandler(t, Config{Root: root})
+	get := func(p string) string {
+		t.Helper()
+		res, body := do(t, h, httptest.NewRequest("GET", p, nil))
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: got %d", p, res.StatusCode)
+		}
+		return html.UnescapeString(body)
+	}
+
+	// 图片超过一半时自动用相册，图片不再出现在列表中，其他文件照常显示
+	body := get("/photos/")
+	for _, want := range []string{`id="gallery"`, `src="/view/photos/p1.png?w=240&h=240"`, `data-full="/view/photos/p1.png?w=1920&h=1920"`,
+		`src="/view/photos/p4.webp?raw=1"`, `>notes.txt</a>`, `href="?view=list"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("gallery page has no %s", want)
+		}
+	}
+	if strings.Contains(body, `>p1.png</a>`) {
+		t.Error("image is also shown in the list")
+	}
+
+	// ?view=list 切回列表，?view=gallery 在图片不多的目录中也可以打开相册
+	body = get("/photos/?view=list")
+	if strings.Contains(body, `id="gallery"`) || !strings.Contains(body, `>p1.png</a>`) || !strings.Contains(body, `href="?view=gallery"`) {
+		t.Error("?view=list did not show the list")
+	}
+	os.WriteFile(filepath.Join(root, "cover.png"), buf.Bytes(), 0644)
+	if body := get("/"); strings.Contains(body, `id="gallery"`) || !strings.Contains(body, `href="?view=gallery"`) {
+		t.Error("root with few images should be a list with a gallery link")
+	}
+	if body := get("/?view=gallery"); !strings.Contains(body, `src="/view/cover.png?w=240&h=240"`) {
+		t.Error("?view=gallery did not show the gallery")
+	}
+	os.Remove(filepath.Join(root, "cover.png"))
+	if body := get("/"); strings.Contains(body, "view-switch") {
+		t.Error("directory without images has a gallery link")
+	}
+
+	// 缩略图由缩放接口生成
+	res, thumb := do(t, h, httptest.NewRequest("GET", "/view/photos/p1.png?w=240&h=240", nil))
+	cfg, _, err := image.DecodeConfig(strings.NewReader(thumb))
+	if res.StatusCode != http.StatusOK || err != nil || cfg.Width != 240 || cfg.Height != 120 {
+		t.Errorf("thumbnail: got %d %v %dx%d", res.StatusCode, err, cfg.Width, cfg.Height)
+	}
+}
@@ -0,0 +1,99 @@
+package fileserver
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 文件校验和：GET /api/hash/<路径>?algo=sha256，结果按文件的修改时间和大小缓存，文件没变时不重新计算
+
+var hashAlgos = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+type hashKey struct {
+	path    string
+	algo    string
+	size    int64
+	modTime time.Time
+}
+
+// hashCache 保存算过的校验和
+type hashCache struct {
+	mu   sync.Mutex
+	sums map[hashKey]string
+}
+
+// fileHash 计算文件 p 的校验和，文件没变时直接返回上次的结果
+func (s *server) fileHash(p, algo string) (string, fs.FileInfo, error) {
+	f, err := s.open(p)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", nil, err
+	}
+	key := hashKey{p, algo, info.Size(), info.ModTime()}
+	s.hashes.mu.Lock()
+	sum, ok := s.hashes.sums[key]
+	s.hashes.mu.Unlock()
+	if ok {
+		return sum, info, nil
+	}
+
+	h := hashAlgos[algo]()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", nil, err
+	}
+	sum = hex.EncodeToString(h.Sum(nil))
+
+	s.hashes.mu.Lock()
+	// 同一个文件的旧结果不再有用
+	for k := range s.hashes.sums {
+		if k.path == p && k.algo == algo {
+			delete(s.hashes.sums, k)
+		}
+	}
+	s.hashes.sums[key] = sum
+	s.hashes.mu.Unlock()
+	return sum, info, nil
+}
+
+// hashAPIHandler 处理 GET /api/hash/<路径>?algo=sha256
+func (s *server) hashAPIHandler(w http.ResponseWriter, r *http.Request) {
+	p := cleanPath(strings.TrimPrefix(r.URL.Path, "/api/hash"))
+	algo := strings.ToLower(r.URL.Query().Get("algo"))
+	if algo == "" {
+		algo = "sha256"
+	}
+	if hashAlgos[algo] == nil {
+		apiError(w, http.StatusBadRequest, "unsupported algo, use md5, sha1, sha256 or sha512")
+		return
+	}
+	info, err := s.stat(p)
+	if err != nil || info.IsDir() {
+		apiError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	sum, info, err := s.fileHash(p, algo)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, "failed to read file")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"path": p, "algo": algo, "hash": sum, "size": info.Size()})
+}
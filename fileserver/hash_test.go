@@ -0,0 +1,61 @@
+package fileserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHashAPI(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root})
+	hashOf := func(p string) (int, map[string]any) {
+		res, body := do(t, h, httptest.NewRequest("GET", p, nil))
+		var v map[string]any
+		json.Unmarshal([]byte(body), &v)
+		return res.StatusCode, v
+	}
+
+	for algo, want := range map[string]string{
+		"":     "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		"MD5":  "5d41402abc4b2a76b9719d911017c592",
+		"sha1": "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d",
+	} {
+		status, v := hashOf("/api/hash/a.txt?algo=" + algo)
+		if status != http.StatusOK || v["hash"] != want {
+			t.Errorf("algo %q: got %d %v, want %s", algo, status, v, want)
+		}
+	}
+	if status, _ := hashOf("/api/hash/a.txt?algo=crc32"); status != http.StatusBadRequest {
+		t.Errorf("unknown algo: status = %d, want 400", status)
+	}
+	for _, p := range []string{"/api/hash/missing.txt", "/api/hash/sub"} {
+		if status, _ := hashOf(p); status != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", p, status)
+		}
+	}
+
+	// 文件内容变了之后缓存的结果不能再用
+	file := filepath.Join(root, "a.txt")
+	os.WriteFile(file, []byte("changed"), 0644)
+	os.Chtimes(file, time.Now(), time.Now().Add(time.Minute))
+	if _, v := hashOf("/api/hash/a.txt?algo=md5"); v["hash"] == "5d41402abc4b2a76b9719d911017c592" {
+		t.Error("stale hash returned after the file changed")
+	}
+}
+
+func TestChecksumColumn(t *testing.T) {
+	_, body := do(t, newTestHandler(t, Config{Root: newTestRoot(t), Checksum: "sha256"}), httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(body, `class="checksum" data-path="/a.txt" data-algo="sha256"`) {
+		t.Error("listing has no checksum column")
+	}
+	_, body = do(t, newTestHandler(t, Config{Root: newTestRoot(t)}), httptest.NewRequest("GET", "/", nil))
+	if strings.Contains(body, `class="checksum"`) {
+		t.Error("checksum column shown without -checksum")
+	}
+}
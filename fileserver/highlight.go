@@ -0,0 +1,66 @@
+package fileserver
+
+import (
+	"bytes"
+	"html/template"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// 超过这个大小的源码不做高亮，直接按原文输出
+const maxHighlightSize = 1 << 20
+
+// 需要高亮显示的源码扩展名，.html 等仍然交给浏览器直接渲染
+var codeExts = map[string]bool{
+	".go": true, ".py": true, ".js": true, ".mjs": true, ".ts": true, ".jsx": true, ".tsx": true,
+	".json": true, ".yaml": true, ".yml": true, ".toml": true, ".ini": true, ".conf": true,
+	".properties": true, ".xml": true, ".sql": true, ".css": true, ".scss": true, ".less": true,
+	".c": true, ".h": true, ".cc": true, ".cpp": true, ".hpp": true, ".cs": true, ".java": true,
+	".kt": true, ".gradle": true, ".rs": true, ".rb": true, ".php": true, ".lua": true, ".swift": true,
+	".sh": true, ".bash": true, ".zsh": true, ".ps1": true, ".bat": true, ".cmd": true,
+	".vue": true, ".proto": true, ".diff": true, ".patch": true,
+}
+
+// 没有扩展名的常见源码文件
+var codeNames = map[string]bool{
+	"Makefile": true, "Dockerfile": true, "Jenkinsfile": true, "go.mod": true,
+}
+
+func isCode(name string) bool {
+	return codeExts[strings.ToLower(filepath.Ext(name))] || codeNames[name]
+}
+
+// 使用 class 输出高亮，配色在主题样式中（static/code-*.css），深色/浅色切换时无需重新渲染
+var codeFormatter = html.New(
+	html.WithClasses(true),
+	html.WithLineNumbers(true),
+	html.WithLinkableLineNumbers(true, "L"),
+	html.TabWidth(4),
+)
+
+// highlight 把源码转换成带行号的高亮 HTML
+func highlight(name string, src []byte) (template.HTML, error) {
+	lexer := lexers.Match(name)
+	if lexer == nil {
+		lexer = lexers.Analyse(string(src))
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	it, err := lexer.Tokenise(nil, string(src))
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := codeFormatter.Format(&buf, styles.Get("github"), it); err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
@@ -0,0 +1,33 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCodeView(t *testing.T) {
+	h := newTestHandler(t, Config{FS: fstest.MapFS{
+		"main.go":   {Data: []byte("package main\n\n// <b>not bold</b>\nfunc main() {}\n")},
+		"big.js":    {Data: []byte(strings.Repeat("x", maxHighlightSize+1))},
+		"page.html": {Data: []byte("<p>hi</p>")},
+	}})
+	res, body := do(t, h, httptest.NewRequest("GET", "/view/main.go", nil))
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", res.StatusCode)
+	}
+	for _, want := range []string{`class="chroma"`, `id="L4"`, "&lt;b&gt;not bold&lt;/b&gt;"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page does not contain %s", want)
+		}
+	}
+	// 过大的文件和 HTML 原样输出
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/view/big.js", nil)); strings.Contains(res.Header.Get("Content-Type"), "text/html") {
+		t.Error("oversized source was highlighted")
+	}
+	if _, body := do(t, h, httptest.NewRequest("GET", "/view/page.html", nil)); body != "<p>hi</p>" {
+		t.Errorf("html view = %q", body)
+	}
+}
@@ -0,0 +1,107 @@
+package fileserver
+
+import (
+	"io/fs"
+	"net/http"
+)
+
+// 钩子和中间件：把本服务嵌入其他程序时，可以在不修改处理函数的情况下加入自己的认证、日志、过滤等逻辑
+
+// Hooks 是各个处理阶段的回调，为 nil 的不调用。回调在处理请求的 goroutine 中同步执行，不要做耗时操作
+type Hooks struct {
+	// OnRequest 在认证之后、处理请求之前调用，返回 false 时不再继续处理，响应由 OnRequest 自己写
+	OnRequest func(w http.ResponseWriter, r *http.Request) bool
+	// OnListing 在渲染目录列表页面之前调用，dir 是相对根目录的路径，返回的列表用于显示，可以过滤或修改
+	OnListing func(r *http.Request, dir string, files []FileInfo) []FileInfo
+	// OnDownloadStart 在开始发送 /download/ 或分享链接的文件之前调用，返回错误时拒绝下载（403），错误信息会显示给用户
+	OnDownloadStart func(r *http.Request, p string, info fs.FileInfo) error
+	// OnDownloadComplete 在文件发送结束后调用，n 是实际发送的字节数，客户端中途断开时 err 不为 nil
+	OnDownloadComplete func(r *http.Request, p string, n int64, err error)
+	// OnError 在返回 4xx、5xx 响应之后调用，包括认证失败、IP 被拒绝等在中间件中返回的错误
+	OnError func(r *http.Request, status int)
+}
+
+// Middleware 是标准的 http 中间件，通过 Config.Middleware 插入到认证之后，可以用 CurrentUser 取得登录用户
+type Middleware func(http.Handler) http.Handler
+
+// CurrentUser 返回请求的登录用户名和所属组，未登录时 name 为空
+func CurrentUser(r *http.Request) (name string, groups []string) {
+	if u := currentUser(r); u != nil {
+		return u.Name, u.Groups
+	}
+	return "", nil
+}
+
+// errorHooks 在响应完成后把错误状态码交给 OnError
+func (s *server) errorHooks(next http.Handler) http.Handler {
+	if s.hooks.OnError == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status >= 400 {
+			s.hooks.OnError(r, rec.status)
+		}
+	})
+}
+
+// requestHooks 依次执行 Config.Middleware（第一个在最外层）和 OnRequest
+func (s *server) requestHooks(next http.Handler) http.Handler {
+	if s.hooks.OnRequest != nil {
+		inner := next
+		next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s.hooks.OnRequest(w, r) {
+				inner.ServeHTTP(w, r)
+			}
+		})
+	}
+	for i := len(s.middleware) - 1; i >= 0; i-- {
+		next = s.middleware[i](next)
+	}
+	return next
+}
+
+// allowDownload 询问 OnDownloadStart 是否允许下载 p，不允许时返回 403 和 false
+func (s *server) allowDownload(w http.ResponseWriter, r *http.Request, p string, info fs.FileInfo) bool {
+	if s.hooks.OnDownloadStart == nil {
+		return true
+	}
+	if err := s.hooks.OnDownloadStart(r, p, info); err != nil {
+		s.httpError(w, r, http.StatusForbidden, err.Error())
+		return false
+	}
+	return true
+}
+
+// serveDownload 发送要下载的文件，结束后调用 OnDownloadComplete、记录下载统计并发送 download 事件
+func (s *server) serveDownload(w http.ResponseWriter, r *http.Request, p string, info fs.FileInfo, f fs.File) {
+	if s.hooks.OnDownloadComplete == nil && !s.webhooks.active() && s.stats == nil {
+		serveContent(w, r, info, f)
+		return
+	}
+	rec := &statusRecorder{ResponseWriter: w}
+	var t *transfer
+	if s.stats != nil {
+		t = s.stats.start(s.downloadRecord(r, p), info.Size())
+		defer s.stats.finish(t)
+		rec.ResponseWriter = &transferWriter{ResponseWriter: w, t: t}
+	}
+	serveContent(rec, r, info, f)
+	err := r.Context().Err()
+	if s.hooks.OnDownloadComplete != nil {
+		s.hooks.OnDownloadComplete(r, p, rec.bytes, err)
+	}
+	// HEAD 没有发送内容，不算下载
+	if t != nil && r.Method == http.MethodGet {
+		t.rec.Bytes, t.rec.Status = rec.bytes, rec.status
+		if t.rec.Status == 0 {
+			t.rec.Status = http.StatusOK
+		}
+		s.stats.record(t.rec)
+	}
+	// 只通知完整下载了文件的请求，HEAD、断点续传的分段请求和 304 不算
+	if err == nil && r.Method == http.MethodGet && (rec.status == 0 || rec.status == http.StatusOK) {
+		s.notifyHTTP(r, eventDownload, p, rec.bytes)
+	}
+}
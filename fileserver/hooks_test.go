@@ -0,0 +1,82 @@
+package fileserver
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	var completed []string
+	var errs []int
+	h := newTestHandler(t, Config{Root: newTestRoot(t)}, WithHooks(Hooks{
+		OnRequest: func(w http.ResponseWriter, r *http.Request) bool {
+			if r.URL.Query().Get("blocked") != "" {
+				http.Error(w, "blocked", http.StatusTeapot)
+				return false
+			}
+			return true
+		},
+		OnListing: func(r *http.Request, dir string, files []FileInfo) []FileInfo {
+			return slices.DeleteFunc(files, func(f FileInfo) bool { return f.Name == "sub" })
+		},
+		OnDownloadStart: func(r *http.Request, p string, info fs.FileInfo) error {
+			if p == "/sub/b.txt" {
+				return errors.New("not today")
+			}
+			return nil
+		},
+		OnDownloadComplete: func(r *http.Request, p string, n int64, err error) {
+			if err == nil {
+				completed = append(completed, p)
+			}
+		},
+		OnError: func(r *http.Request, status int) { errs = append(errs, status) },
+	}))
+
+	if _, body := do(t, h, httptest.NewRequest("GET", "/", nil)); strings.Contains(body, `href="/sub/"`) {
+		t.Error("OnListing did not filter sub/")
+	}
+	if res, body := do(t, h, httptest.NewRequest("GET", "/download/a.txt", nil)); res.StatusCode != http.StatusOK || body != "hello" {
+		t.Errorf("download: got %d %q", res.StatusCode, body)
+	}
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/download/sub/b.txt", nil)); res.StatusCode != http.StatusForbidden {
+		t.Errorf("rejected download: status = %d, want 403", res.StatusCode)
+	}
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/?blocked=1", nil)); res.StatusCode != http.StatusTeapot {
+		t.Errorf("OnRequest: status = %d, want 418", res.StatusCode)
+	}
+
+	if !slices.Equal(completed, []string{"/a.txt"}) {
+		t.Errorf("completed downloads = %v", completed)
+	}
+	if !slices.Equal(errs, []int{http.StatusForbidden, http.StatusTeapot}) {
+		t.Errorf("errors = %v", errs)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user, _ := CurrentUser(r)
+				order = append(order, name+":"+user)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := newTestHandler(t, Config{Root: newTestRoot(t)},
+		WithUsers(User{Name: "alice", Password: "secret"}), WithMiddleware(mw("outer"), mw("inner")))
+
+	r := httptest.NewRequest("GET", "/download/a.txt", nil)
+	r.SetBasicAuth("alice", "secret")
+	do(t, h, r)
+	if !slices.Equal(order, []string{"outer:alice", "inner:alice"}) {
+		t.Errorf("middleware order = %v", order)
+	}
+}
@@ -0,0 +1,134 @@
+package fileserver
+
+import (
+	"embed"
+	"encoding/json"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 界面文字的语言包，每种语言一个 JSON 文件，键名在所有语言中保持一致
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// bundles 按语言代码保存翻译，例如 bundles["en"]["listing.title"]
+var bundles = loadBundles()
+
+func loadBundles() map[string]map[string]string {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		log.Fatalf("Failed to load locales: %v", err)
+	}
+
+	m := make(map[string]map[string]string)
+	for _, e := range entries {
+		b, err := localeFiles.ReadFile(path.Join("locales", e.Name()))
+		if err != nil {
+			log.Fatalf("Failed to load locale %s: %v", e.Name(), err)
+		}
+		var msgs map[string]string
+		if err := json.Unmarshal(b, &msgs); err != nil {
+			log.Fatalf("Failed to parse locale %s: %v", e.Name(), err)
+		}
+		m[strings.TrimSuffix(e.Name(), ".json")] = msgs
+	}
+	return m
+}
+
+// Languages 返回支持的语言代码
+func Languages() []string {
+	var langs []string
+	for l := range bundles {
+		langs = append(langs, l)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Lang 是页面使用的语言，提供模板中的 {{.T "key"}} 翻译
+type Lang struct {
+	Code string
+}
+
+// T 返回 key 对应的翻译，当前语言没有时依次使用英文和 key 本身
+func (l Lang) T(key string) string {
+	if s, ok := bundles[l.Code][key]; ok {
+		return s
+	}
+	if s, ok := bundles["en"][key]; ok {
+		return s
+	}
+	return key
+}
+
+// JS 返回页面脚本使用的翻译（键名以 js. 开头），模板中以 JSON 形式输出
+func (l Lang) JS() map[string]string {
+	m := make(map[string]string)
+	for key := range bundles["en"] {
+		if strings.HasPrefix(key, "js.") {
+			m[key] = l.T(key)
+		}
+	}
+	return m
+}
+
+// Languages 返回所有语言供页面显示切换链接
+func (l Lang) Languages() []Lang {
+	var list []Lang
+	for _, code := range Languages() {
+		list = append(list, Lang{Code: code})
+	}
+	return list
+}
+
+// negotiateLang 选择页面语言：?lang= 参数 > lang cookie > Accept-Language > 默认语言。
+// 通过 ?lang= 切换的语言会写入 cookie，之后的页面保持一致
+func negotiateLang(w http.ResponseWriter, r *http.Request, def string) string {
+	if l := r.URL.Query().Get("lang"); l != "" {
+		if _, ok := bundles[l]; ok {
+			http.SetCookie(w, &http.Cookie{Name: "lang", Value: l, Path: "/", MaxAge: 365 * 24 * 3600, SameSite: http.SameSiteLaxMode})
+			return l
+		}
+	}
+	if c, err := r.Cookie("lang"); err == nil {
+		if _, ok := bundles[c.Value]; ok {
+			return c.Value
+		}
+	}
+	if l := matchAcceptLanguage(r.Header.Get("Accept-Language")); l != "" {
+		return l
+	}
+	return def
+}
+
+// matchAcceptLanguage 按 q 值从高到低找到第一个支持的语言，只比较主标签（zh-CN 匹配 zh）
+func matchAcceptLanguage(header string) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var list []candidate
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if _, ok := bundles[primary]; ok && q > 0 {
+			list = append(list, candidate{primary, q})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].q > list[j].q })
+	if len(list) == 0 {
+		return ""
+	}
+	return list[0].lang
+}
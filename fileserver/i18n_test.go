@@ -0,0 +1,56 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLanguage(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)}, WithLang("en"))
+	for _, c := range []struct {
+		name   string
+		query  string
+		cookie string
+		accept string
+		want   string
+	}{
+		{"default", "", "", "", "⬅ Parent directory"},
+		{"accept-language", "", "", "fr;q=0.9, zh-CN;q=0.8", "⬅ 返回上级"},
+		{"cookie", "", "zh", "en", "⬅ 返回上级"},
+		{"query", "?lang=en", "zh", "zh", "⬅ Parent directory"},
+		{"unknown", "?lang=xx", "", "", "⬅ Parent directory"},
+	} {
+		r := httptest.NewRequest("GET", "/sub/"+c.query, nil)
+		if c.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "lang", Value: c.cookie})
+		}
+		if c.accept != "" {
+			r.Header.Set("Accept-Language", c.accept)
+		}
+		if _, body := do(t, h, r); !strings.Contains(body, c.want) {
+			t.Errorf("%s: page does not contain %q", c.name, c.want)
+		}
+	}
+	res, _ := do(t, h, httptest.NewRequest("GET", "/?lang=zh", nil))
+	if c := res.Cookies(); len(c) != 1 || c[0].Name != "lang" || c[0].Value != "zh" {
+		t.Errorf("?lang= did not set the lang cookie: %v", c)
+	}
+}
+
+// TestLocaleKeys 每种语言的翻译键必须一致
+func TestLocaleKeys(t *testing.T) {
+	for _, code := range Languages() {
+		for key := range bundles["zh"] {
+			if _, ok := bundles[code][key]; !ok {
+				t.Errorf("%s.json is missing %s", code, key)
+			}
+		}
+		for key := range bundles[code] {
+			if _, ok := bundles["zh"][key]; !ok {
+				t.Errorf("zh.json is missing %s", key)
+			}
+		}
+	}
+}
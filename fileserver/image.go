@@ -0,0 +1,63 @@
+package fileserver
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// 图片页面：在浏览器中打开 /view/ 下的图片时显示一个页面，图片旁边列出照片的拍摄信息（EXIF）。
+// 只有请求的 Accept 中有 text/html 时才这样，<img> 和脚本照常直接拿到图片，已有的外链不受影响；
+// ?raw=1 总是返回图片本身。-strip-exif 时不显示拍摄信息
+
+// isImage 判断 name 是否为浏览器可以直接显示的图片
+func isImage(name string) bool {
+	return strings.HasPrefix(mediaType(name, ""), "image/")
+}
+
+// isJPEG 判断 name 是否为 JPEG，只有 JPEG 读取 EXIF
+func isJPEG(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".jpg" || ext == ".jpeg"
+}
+
+// wantsPage 判断请求是否来自浏览器打开页面，而不是 <img> 等嵌入的资源
+func wantsPage(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// ImageData 是图片页面的数据
+type ImageData struct {
+	Page
+	Name     string
+	Src      string // 图片本身的地址
+	Download string
+	Parent   string
+	EXIF     *EXIF // 照片的拍摄信息，没有时为 nil
+}
+
+// imageHandler 渲染图片页面，JPEG 读取其中的 EXIF
+func (s *server) imageHandler(w http.ResponseWriter, r *http.Request, decodedPath string) {
+	escaped := r.URL.EscapedPath()
+	data := ImageData{
+		Page:     s.page(w, r),
+		Name:     path.Base(decodedPath),
+		Src:      s.base + escaped + "?raw=1",
+		Download: s.base + "/download" + strings.TrimPrefix(escaped, "/view"),
+		Parent:   s.base + parentDir(decodedPath),
+	}
+	if isJPEG(decodedPath) && !s.stripEXIF {
+		if f, err := s.open(decodedPath); err == nil {
+			e, err := readEXIF(f)
+			f.Close()
+			if err == nil && s.hideGPS {
+				e.GPS, e.Lat, e.Lon, e.Altitude = false, 0, 0, ""
+			}
+			if err == nil && *e != (EXIF{}) {
+				data.EXIF = e
+			}
+		}
+	}
+	w.Header().Set("Vary", "Accept")
+	s.render(w, "image.html", data)
+}
@@ -0,0 +1,343 @@
+package fileserver
+
+import (
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 文件索引（-index）：后台把整个根目录的文件名、大小、修改时间读进内存，用来即时搜索文件名和计算目录的总大小，
+// 根目录很大时不用每次都遍历磁盘。启动后先完整扫描一遍，之后本地根目录由 fsnotify 通知哪些目录有变化，
+// 只重新读取这些目录；另外每隔 -index-interval 完整重建一次，补上错过的变化（S3 等远程根目录只能靠定时重建）
+
+// indexDelay 是收到变化后等待的时间，一批变化合并处理
+var indexDelay = 200 * time.Millisecond
+
+// indexEntry 是索引中的一个文件或目录
+type indexEntry struct {
+	Name    string
+	Size    int64
+	IsDir   bool
+	ModTime time.Time
+}
+
+// indexDir 是索引中的一个目录
+type indexDir struct {
+	entries map[string]indexEntry
+	total   int64 // 目录下所有文件（包括子目录中的）的总大小
+	files   int64 // 目录下所有文件（包括子目录中的）的个数
+}
+
+// fileIndex 按目录保存索引，键是相对根目录的路径，如 /、/a/b
+type fileIndex struct {
+	fsys     fs.FS
+	root     string // 本地根目录，为空时不监视变化
+	interval time.Duration
+
+	mu      sync.RWMutex
+	dirs    map[string]*indexDir
+	ready   bool              // 第一次扫描是否完成
+	watches map[string]func() // 正在监视的目录及取消函数
+	warned  bool
+
+	pmu     sync.Mutex
+	pending map[string]bool // 等待重新读取的目录
+	wake    chan struct{}
+}
+
+func newFileIndex(fsys fs.FS, root string, interval time.Duration) *fileIndex {
+	x := &fileIndex{fsys: fsys, root: root, interval: interval, dirs: map[string]*indexDir{}, watches: map[string]func(){},
+		pending: map[string]bool{}, wake: make(chan struct{}, 1)}
+	go x.run()
+	return x
+}
+
+func (x *fileIndex) run() {
+	x.rebuild()
+	ticker := time.NewTicker(x.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			x.rebuild()
+		case <-x.wake:
+			time.Sleep(indexDelay)
+			x.pmu.Lock()
+			dirs := x.pending
+			x.pending = map[string]bool{}
+			x.pmu.Unlock()
+			for dir := range dirs {
+				x.rescan(dir)
+			}
+		}
+	}
+}
+
+// changed 在目录 dir 有变化时由文件监视调用
+func (x *fileIndex) changed(dir string) {
+	x.pmu.Lock()
+	x.pending[dir] = true
+	x.pmu.Unlock()
+	select {
+	case x.wake <- struct{}{}:
+	default:
+	}
+}
+
+// scan 读取目录 p 和其中的所有子目录，结果放入 into，返回 p 本身
+func (x *fileIndex) scan(p string, into map[string]*indexDir) *indexDir {
+	d := &indexDir{entries: map[string]indexEntry{}}
+	into[p] = d
+	entries, err := fs.ReadDir(x.fsys, fsName(p))
+	if err != nil {
+		return d
+	}
+	for _, e := range entries {
+		if hiddenFiles[foldPath(e.Name())] {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		ie := indexEntry{Name: e.Name(), Size: info.Size(), IsDir: e.IsDir(), ModTime: info.ModTime()}
+		if ie.IsDir {
+			sub := x.scan(path.Join(p, e.Name()), into)
+			d.total += sub.total
+			d.files += sub.files
+			ie.Size = 0
+		} else {
+			d.total += ie.Size
+			d.files++
+		}
+		d.entries[e.Name()] = ie
+	}
+	return d
+}
+
+// rebuild 完整扫描根目录，替换原来的索引
+func (x *fileIndex) rebuild() {
+	start := time.Now()
+	dirs := map[string]*indexDir{}
+	root := x.scan("/", dirs)
+	x.mu.Lock()
+	x.dirs, x.ready = dirs, true
+	x.syncWatches()
+	x.mu.Unlock()
+	log.Printf("Indexed %d files in %d directories (%d bytes) in %s", root.files, len(dirs), root.total, time.Since(start).Round(time.Millisecond))
+}
+
+// syncWatches 监视索引中的每个目录，取消已经不存在的目录的监视，调用时持有 x.mu
+func (x *fileIndex) syncWatches() {
+	if x.root == "" {
+		return
+	}
+	for dir, cancel := range x.watches {
+		if x.dirs[dir] == nil {
+			cancel()
+			delete(x.watches, dir)
+		}
+	}
+	for dir := range x.dirs {
+		x.watch(dir)
+	}
+}
+
+// watch 开始监视目录 dir，调用时持有 x.mu
+func (x *fileIndex) watch(dir string) {
+	if x.root == "" || x.watches[dir] != nil {
+		return
+	}
+	cancel, err := watcher.subscribe(x.root+dir, func() { x.changed(dir) })
+	if err != nil {
+		// inotify watch 用完时只能靠定时重建
+		if !x.warned {
+			x.warned = true
+			log.Printf("Failed to watch %s, index updates wait for the next rebuild: %v", dir, err)
+		}
+		return
+	}
+	x.watches[dir] = cancel
+}
+
+// rescan 重新读取有变化的目录 p，新出现的子目录整个扫描，消失的子目录从索引中去掉，总大小逐级向上更新
+func (x *fileIndex) rescan(p string) {
+	x.mu.RLock()
+	old := x.dirs[p]
+	x.mu.RUnlock()
+	if old == nil {
+		return
+	}
+	if info, err := fs.Stat(x.fsys, fsName(p)); err != nil || !info.IsDir() {
+		// 目录本身被删除或改名，由上级目录处理
+		if p != "/" {
+			x.rescan(path.Dir(p))
+		}
+		return
+	}
+	fresh := map[string]*indexDir{}
+	d := x.scanShallow(p, old, fresh)
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.dirs[p] != old {
+		// 期间被完整重建过
+		return
+	}
+	for name, e := range old.entries {
+		if e.IsDir {
+			if ne, ok := d.entries[name]; !ok || !ne.IsDir {
+				x.removeTree(path.Join(p, name))
+			}
+		}
+	}
+	for dir, sub := range fresh {
+		x.dirs[dir] = sub
+		x.watch(dir)
+	}
+	// 重新计算 p 的总大小，子目录的总大小已经是最新的
+	d.total, d.files = 0, 0
+	for name, e := range d.entries {
+		if e.IsDir {
+			if sub := x.dirs[path.Join(p, name)]; sub != nil {
+				d.total += sub.total
+				d.files += sub.files
+			}
+		} else {
+			d.total += e.Size
+			d.files++
+		}
+	}
+	dTotal, dFiles := d.total-old.total, d.files-old.files
+	x.dirs[p] = d
+	for dir := p; dir != "/"; {
+		dir = path.Dir(dir)
+		if parent := x.dirs[dir]; parent != nil {
+			parent.total += dTotal
+			parent.files += dFiles
+		}
+	}
+}
+
+// scanShallow 读取目录 p 本身，已经在索引中的子目录沿用原来的结果，新的子目录完整扫描后放入 fresh
+func (x *fileIndex) scanShallow(p string, old *indexDir, fresh map[string]*indexDir) *indexDir {
+	d := &indexDir{entries: map[string]indexEntry{}}
+	entries, err := fs.ReadDir(x.fsys, fsName(p))
+	if err != nil {
+		return d
+	}
+	for _, e := range entries {
+		if hiddenFiles[foldPath(e.Name())] {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		ie := indexEntry{Name: e.Name(), Size: info.Size(), IsDir: e.IsDir(), ModTime: info.ModTime()}
+		if ie.IsDir {
+			ie.Size = 0
+			if oe, ok := old.entries[e.Name()]; !ok || !oe.IsDir {
+				x.scan(path.Join(p, e.Name()), fresh)
+			}
+		}
+		d.entries[e.Name()] = ie
+	}
+	return d
+}
+
+// removeTree 从索引中去掉目录 p 和它的所有子目录并停止监视，调用时持有 x.mu
+func (x *fileIndex) removeTree(p string) {
+	for dir := range x.dirs {
+		if dir == p || strings.HasPrefix(dir, p+"/") {
+			delete(x.dirs, dir)
+			if cancel := x.watches[dir]; cancel != nil {
+				cancel()
+				delete(x.watches, dir)
+			}
+		}
+	}
+}
+
+// dirSize 返回目录 p 的总大小和文件数，索引还没有建好或不包括 p 时 ok 为 false
+func (x *fileIndex) dirSize(p string) (total, files int64, ok bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	d := x.dirs[cleanPath(p)]
+	if d == nil {
+		return 0, 0, false
+	}
+	return d.total, d.files, true
+}
+
+// indexHit 是搜索到的一个文件或目录
+type indexHit struct {
+	Path string
+	indexEntry
+}
+
+// search 在目录 under 下搜索文件名包含 query 中所有词（不区分大小写）的文件和目录，按路径排序，
+// 最多 limit 个，keep 决定是否保留某个结果（访问控制）。truncated 表示结果被截断
+func (x *fileIndex) search(under, query string, limit int, keep func(p string) bool) (hits []indexHit, truncated, ready bool) {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return nil, false, x.isReady()
+	}
+	under = cleanPath(under)
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	for dir, d := range x.dirs {
+		if under != "/" && dir != under && !strings.HasPrefix(dir, under+"/") {
+			continue
+		}
+	entries:
+		for name, e := range d.entries {
+			lower := strings.ToLower(name)
+			for _, t := range terms {
+				if !strings.Contains(lower, t) {
+					continue entries
+				}
+			}
+			hits = append(hits, indexHit{Path: path.Join(dir, name), indexEntry: e})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Path < hits[j].Path })
+	kept := hits[:0]
+	for _, h := range hits {
+		if !keep(h.Path) {
+			continue
+		}
+		if len(kept) == limit {
+			truncated = true
+			break
+		}
+		kept = append(kept, h)
+	}
+	return kept, truncated, x.ready
+}
+
+// all 返回目录 under 下的所有文件和子目录，没有顺序
+func (x *fileIndex) all(under string) (hits []indexHit) {
+	under = cleanPath(under)
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	for dir, d := range x.dirs {
+		if under != "/" && dir != under && !strings.HasPrefix(dir, under+"/") {
+			continue
+		}
+		for name, e := range d.entries {
+			hits = append(hits, indexHit{Path: path.Join(dir, name), indexEntry: e})
+		}
+	}
+	return hits
+}
+
+func (x *fileIndex) isReady() bool {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.ready
+}
@@ -0,0 +1,94 @@
+package fileserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitIndex 等待条件成立，索引在后台更新
+func waitIndex(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFileIndex(t *testing.T) {
+	root := newTestRoot(t)
+	os.MkdirAll(filepath.Join(root, "sub", "deep"), 0755)
+	os.WriteFile(filepath.Join(root, "sub", "deep", "Report-2024.pdf"), []byte("12345678"), 0644)
+	h := newTestHandler(t, Config{Root: root, Index: true})
+	x := h.s.index
+	waitIndex(t, "first scan", x.isReady)
+
+	if total, files, _ := x.dirSize("/"); total != 18 || files != 3 {
+		t.Errorf("root size = %d bytes in %d files, want 18 in 3", total, files)
+	}
+	if total, _, _ := x.dirSize("/sub"); total != 13 {
+		t.Errorf("/sub size = %d, want 13", total)
+	}
+
+	// 新增、删除的文件和目录由 fsnotify 通知，总大小逐级更新
+	os.MkdirAll(filepath.Join(root, "sub", "new"), 0755)
+	os.WriteFile(filepath.Join(root, "sub", "new", "c.txt"), []byte("abc"), 0644)
+	waitIndex(t, "new file", func() bool { total, _, _ := x.dirSize("/"); return total == 21 })
+	os.RemoveAll(filepath.Join(root, "sub", "deep"))
+	waitIndex(t, "removed directory", func() bool { total, _, _ := x.dirSize("/sub"); return total == 8 })
+	if _, _, ok := x.dirSize("/sub/deep"); ok {
+		t.Error("removed directory is still indexed")
+	}
+	if total, files, _ := x.dirSize("/"); total != 13 || files != 3 {
+		t.Errorf("root size = %d bytes in %d files, want 13 in 3", total, files)
+	}
+}
+
+func TestSearchAPI(t *testing.T) {
+	root := newTestRoot(t)
+	os.WriteFile(filepath.Join(root, "sub", "Big Report.PDF"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(root, "report.txt"), []byte("x"), 0644)
+	config := writeConfig(t, `{"acl": [{"path": "/sub/**", "users": ["*"], "action": "deny"}]}`)
+	h := newTestHandler(t, Config{Root: root, Index: true})
+	denied := newTestHandler(t, Config{Root: root, Index: true, ConfigFile: config})
+	waitIndex(t, "first scan", func() bool { return h.s.index.isReady() && denied.s.index.isReady() })
+
+	search := func(h *Handler, query string) (paths []string) {
+		t.Helper()
+		res, body := do(t, h, httptest.NewRequest("GET", "/api/search?"+query, nil))
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("search %s: status = %d, body %s", query, res.StatusCode, body)
+		}
+		var data struct{ Results []apiFile }
+		json.Unmarshal([]byte(body), &data)
+		for _, f := range data.Results {
+			paths = append(paths, f.Path)
+		}
+		return paths
+	}
+	if got := search(h, "q=REPORT"); len(got) != 2 || got[0] != "/report.txt" || got[1] != "/sub/Big Report.PDF" {
+		t.Errorf("search REPORT = %v", got)
+	}
+	if got := search(h, "q=big+pdf"); len(got) != 1 {
+		t.Errorf("search big pdf = %v", got)
+	}
+	if got := search(h, "q=report&path=/sub"); len(got) != 1 || got[0] != "/sub/Big Report.PDF" {
+		t.Errorf("search under /sub = %v", got)
+	}
+	// 无权访问的目录中的文件不出现在结果中
+	if got := search(denied, "q=report"); len(got) != 1 || got[0] != "/report.txt" {
+		t.Errorf("search with acl = %v", got)
+	}
+
+	off := newTestHandler(t, Config{Root: root})
+	if res, _ := do(t, off, httptest.NewRequest("GET", "/api/search?q=a", nil)); res.StatusCode != http.StatusNotImplemented {
+		t.Errorf("search without index: status = %d, want 501", res.StatusCode)
+	}
+}
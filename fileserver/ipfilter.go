@@ -0,0 +1,99 @@
+package fileserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseCIDRs 解析 CIDR 列表，单个 IP 视为 /32 或 /128，每项可以用逗号分隔多个
+func parseCIDRs(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range list {
+		for _, v := range strings.Split(item, ",") {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+			if !strings.Contains(v, "/") {
+				ip := net.ParseIP(v)
+				if ip == nil {
+					return nil, fmt.Errorf("invalid IP %q", v)
+				}
+				bits := 128
+				if ip.To4() != nil {
+					bits = 32
+				}
+				v = fmt.Sprintf("%s/%d", v, bits)
+			}
+			_, n, err := net.ParseCIDR(v)
+			if err != nil {
+				return nil, err
+			}
+			nets = append(nets, n)
+		}
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipAllowed 按 -allow-ip、-deny-ip 判断客户端 ip 能否访问，ip 为 nil 时拒绝
+func (s *server) ipAllowed(ip net.IP) bool {
+	return ip != nil && !containsIP(s.denyIPs, ip) && (len(s.allowIPs) == 0 || containsIP(s.allowIPs, ip))
+}
+
+// peer 返回直接连接的地址，以及它是否是受信任的代理
+func (s *server) peer(r *http.Request) (net.IP, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	// 通过 unix socket 连接的只能是本机上的反向代理
+	return ip, ip == nil && s.unixSocket || ip != nil && containsIP(s.trustedProxies, ip)
+}
+
+// clientIP 返回请求方的 IP。只有直接连接来自受信任代理时才读取 X-Forwarded-For，
+// 从右往左跳过受信任的代理，第一个不受信任的地址就是真实客户端
+func (s *server) clientIP(r *http.Request) net.IP {
+	ip, proxied := s.peer(r)
+	if !proxied {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !containsIP(s.trustedProxies, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// filterIP 按 -deny-ip、-allow-ip 限制访问来源，先检查黑名单
+func (s *server) filterIP(next http.Handler) http.Handler {
+	if len(s.allowIPs) == 0 && len(s.denyIPs) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.ipAllowed(s.clientIP(r)) {
+			s.httpError(w, r, http.StatusForbidden, "Forbidden")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,43 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPFilter(t *testing.T) {
+	h := newTestHandler(t, Config{
+		Root:           newTestRoot(t),
+		AllowIPs:       []string{"10.0.0.0/8", "::1/128"},
+		DenyIPs:        []string{"10.0.0.66/32"},
+		TrustedProxies: []string{"192.168.1.1/32"},
+	})
+	for _, c := range []struct {
+		remote, forwarded string
+		want              int
+	}{
+		{"10.1.2.3:1234", "", http.StatusOK},
+		{"[::1]:1234", "", http.StatusOK},
+		{"10.0.0.66:1234", "", http.StatusForbidden},
+		{"8.8.8.8:1234", "", http.StatusForbidden},
+		// 不受信任的来源伪造 X-Forwarded-For 无效
+		{"8.8.8.8:1234", "10.1.2.3", http.StatusForbidden},
+		// 受信任的代理转发时按真实客户端判断
+		{"192.168.1.1:1234", "10.1.2.3", http.StatusOK},
+		{"192.168.1.1:1234", "10.1.2.3, 10.0.0.66", http.StatusForbidden},
+		{"192.168.1.1:1234", "", http.StatusForbidden},
+	} {
+		r := httptest.NewRequest("GET", "/download/a.txt", nil)
+		r.RemoteAddr = c.remote
+		if c.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		if res, _ := do(t, h, r); res.StatusCode != c.want {
+			t.Errorf("%s (X-Forwarded-For %q): status = %d, want %d", c.remote, c.forwarded, res.StatusCode, c.want)
+		}
+	}
+	if _, err := New(Config{Root: newTestRoot(t), AllowIPs: []string{"not-a-cidr"}}); err == nil {
+		t.Error("invalid CIDR was accepted")
+	}
+}
@@ -0,0 +1,104 @@
+package fileserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// LANIPs 返回本机所有启用中的非回环 IPv4 地址，手机等设备通过这些地址访问
+func LANIPs() []string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var ips []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipNet, ok := a.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil || ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			ips = append(ips, ipNet.IP.String())
+		}
+	}
+	return ips
+}
+
+// externalBase 返回其他设备可以访问的 scheme://host[:port]。
+// 在本机用 localhost / 127.0.0.1 打开页面时，换成局域网地址，否则扫码的手机无法访问
+func externalBase(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host, port = r.Host, ""
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		if ips := LANIPs(); len(ips) > 0 {
+			host = ips[0]
+		}
+	}
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	} else if net.ParseIP(host) != nil && net.ParseIP(host).To4() == nil {
+		host = "[" + host + "]"
+	}
+	return scheme + "://" + host
+}
+
+// parsePublicURL 检查 -public-url，只能是 scheme://host[:port]，子路径由 -base-path 指定
+func parsePublicURL(v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	u, err := url.Parse(strings.TrimSuffix(v, "/"))
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+		return "", fmt.Errorf("invalid public URL %q: want scheme://host[:port]", v)
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// origin 返回生成绝对地址使用的 scheme://host[:port]：优先使用 -public-url；
+// 受信任的反向代理转发的请求按 X-Forwarded-Proto、X-Forwarded-Host 还原浏览器看到的地址；否则见 externalBase
+func (s *server) origin(r *http.Request) string {
+	if s.publicURL != "" {
+		return s.publicURL
+	}
+	if _, proxied := s.peer(r); proxied {
+		proto := firstHeader(r, "X-Forwarded-Proto")
+		host := firstHeader(r, "X-Forwarded-Host")
+		if proto != "" || host != "" {
+			if proto != "http" && proto != "https" {
+				proto = "http"
+				if r.TLS != nil {
+					proto = "https"
+				}
+			}
+			if host == "" {
+				host = r.Host
+			}
+			return proto + "://" + host
+		}
+	}
+	return externalBase(r)
+}
+
+// firstHeader 返回请求头中逗号分隔的第一个值，经过多层代理时第一个是最外层的
+func firstHeader(r *http.Request, key string) string {
+	v, _, _ := strings.Cut(r.Header.Get(key), ",")
+	return strings.TrimSpace(v)
+}
@@ -0,0 +1,51 @@
+package fileserver
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCopyLink(t *testing.T) {
+	root := newTestRoot(t)
+	os.WriteFile(filepath.Join(root, "a b.txt"), []byte("x"), 0644)
+	link := func(h *Handler, target string, header map[string]string) string {
+		t.Helper()
+		r := httptest.NewRequest("GET", target, nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		_, body := do(t, h, r)
+		_, rest, ok := strings.Cut(body, `class="copy-btn" data-url="`)
+		if !ok {
+			t.Fatalf("GET %s: no copy link", target)
+		}
+		return rest[:strings.Index(rest, `"`)]
+	}
+	forwarded := map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "files.example.org"}
+
+	h := newTestHandler(t, Config{Root: root})
+	if got := link(h, "/", nil); got != "http://example.com/download/a%20b.txt" {
+		t.Errorf("link = %q", got)
+	}
+	// 不受信任的来源发来的 X-Forwarded-* 不采信
+	if got := link(h, "/", forwarded); got != "http://example.com/download/a%20b.txt" {
+		t.Errorf("untrusted proxy: link = %q", got)
+	}
+	h = newTestHandler(t, Config{Root: root, BasePath: "/files", TrustedProxies: []string{"192.0.2.0/24"}})
+	if got := link(h, "/files/", forwarded); got != "https://files.example.org/files/download/a%20b.txt" {
+		t.Errorf("trusted proxy: link = %q", got)
+	}
+	h = newTestHandler(t, Config{Root: root, PublicURL: "https://dl.example.com/", TrustedProxies: []string{"192.0.2.0/24"}})
+	if got := link(h, "/", forwarded); got != "https://dl.example.com/download/a%20b.txt" {
+		t.Errorf("public URL: link = %q", got)
+	}
+
+	for _, v := range []string{"dl.example.com", "ftp://dl.example.com", "https://dl.example.com/files"} {
+		if _, err := New(Config{Root: root, PublicURL: v}); err == nil {
+			t.Errorf("PublicURL %q: no error", v)
+		}
+	}
+}
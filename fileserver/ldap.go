@@ -0,0 +1,163 @@
+package fileserver
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapConfig 是配置文件中的 LDAP / Active Directory 认证设置
+type ldapConfig struct {
+	URL                string   `json:"url"`                  // ldap://host:389 或 ldaps://host:636
+	StartTLS           bool     `json:"start_tls"`            // ldap:// 连接后升级为 TLS
+	InsecureSkipVerify bool     `json:"insecure_skip_verify"` // 不校验服务器证书，仅用于测试
+	BindDN             string   `json:"bind_dn"`              // 用于搜索用户的服务账号，为空时匿名搜索
+	BindPassword       string   `json:"bind_password"`
+	BaseDN             string   `json:"base_dn"`        // 搜索用户的起点
+	Filter             string   `json:"filter"`         // 搜索条件，%s 替换为转义后的用户名，默认 (uid=%s)
+	GroupAttr          string   `json:"group_attr"`     // 用户条目中记录所属组的属性，默认 memberOf
+	RequireGroups      []string `json:"require_groups"` // 必须属于其中某个组（组 DN 或 CN），为空不限制
+}
+
+// ldapAuth 先用服务账号搜索出用户 DN，再用用户输入的密码绑定验证。
+// 浏览器每个请求都会带上 Basic Auth，所以验证成功的结果会缓存几分钟
+type ldapAuth struct {
+	cfg *ldapConfig
+
+	mu    sync.Mutex
+	cache map[[32]byte]ldapCached
+}
+
+type ldapCached struct {
+	user    *user
+	expires time.Time
+}
+
+const ldapCacheTTL = 5 * time.Minute
+
+func newLDAPAuth(cfg *ldapConfig) (*ldapAuth, error) {
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return nil, errors.New("ldap: url and base_dn are required")
+	}
+	if cfg.Filter == "" {
+		cfg.Filter = "(uid=%s)"
+	}
+	if !strings.Contains(cfg.Filter, "%s") {
+		return nil, errors.New("ldap: filter must contain %s")
+	}
+	if cfg.GroupAttr == "" {
+		cfg.GroupAttr = "memberOf"
+	}
+	return &ldapAuth{cfg: cfg, cache: make(map[[32]byte]ldapCached)}, nil
+}
+
+func (a *ldapAuth) authenticate(name, password string) (*user, error) {
+	// 空密码在 LDAP 中是匿名绑定，总能成功，必须拒绝
+	if name == "" || password == "" {
+		return nil, nil
+	}
+
+	key := sha256.Sum256([]byte(name + "\x00" + password))
+	a.mu.Lock()
+	if c, ok := a.cache[key]; ok && time.Now().Before(c.expires) {
+		a.mu.Unlock()
+		return c.user, nil
+	}
+	a.mu.Unlock()
+
+	u, err := a.bind(name, password)
+	if err != nil || u == nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	for k, c := range a.cache {
+		if time.Now().After(c.expires) {
+			delete(a.cache, k)
+		}
+	}
+	a.cache[key] = ldapCached{user: u, expires: time.Now().Add(ldapCacheTTL)}
+	a.mu.Unlock()
+	return u, nil
+}
+
+func (a *ldapAuth) bind(name, password string) (*user, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: a.cfg.InsecureSkipVerify}
+	conn, err := ldap.DialURL(a.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetTimeout(10 * time.Second)
+
+	if a.cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+	if a.cfg.BindDN != "" {
+		if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap: service account bind: %w", err)
+		}
+	}
+
+	res, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 10, false,
+		strings.ReplaceAll(a.cfg.Filter, "%s", ldap.EscapeFilter(name)),
+		[]string{"dn", a.cfg.GroupAttr}, nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Entries) != 1 {
+		return nil, nil
+	}
+	entry := res.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	u := &user{Name: name}
+	memberOf := entry.GetAttributeValues(a.cfg.GroupAttr)
+	for _, dn := range memberOf {
+		u.Groups = append(u.Groups, groupName(dn))
+	}
+	if len(a.cfg.RequireGroups) > 0 && !hasAnyGroup(memberOf, a.cfg.RequireGroups) {
+		return nil, nil
+	}
+	return u, nil
+}
+
+// groupName 取组 DN 的第一段作为组名，例如 CN=Developers,OU=Groups,DC=corp 得到 Developers
+func groupName(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+		return dn
+	}
+	return parsed.RDNs[0].Attributes[0].Value
+}
+
+// hasAnyGroup 判断用户的组 DN 中是否有要求的组，要求的组可以写完整 DN 或组名
+func hasAnyGroup(memberOf, required []string) bool {
+	for _, dn := range memberOf {
+		for _, g := range required {
+			if strings.EqualFold(dn, g) || strings.EqualFold(groupName(dn), g) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package fileserver
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+)
+
+func TestLDAPConfig(t *testing.T) {
+	for _, cfg := range []ldapConfig{
+		{BaseDN: "dc=corp"},
+		{URL: "ldap://127.0.0.1"},
+		{URL: "ldap://127.0.0.1", BaseDN: "dc=corp", Filter: "(uid=alice)"},
+	} {
+		if _, err := newLDAPAuth(&cfg); err == nil {
+			t.Errorf("config %+v was accepted", cfg)
+		}
+	}
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	// 地址不可达，只有不需要连接服务器的情况才能通过
+	a, err := newLDAPAuth(&ldapConfig{URL: "ldap://127.0.0.1:1", BaseDN: "dc=corp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, err := a.authenticate("alice", ""); u != nil || err != nil {
+		t.Errorf("empty password: user = %v, err = %v", u, err)
+	}
+	if _, err := a.authenticate("alice", "pw"); err == nil {
+		t.Error("unreachable server: no error")
+	}
+	a.cache[sha256.Sum256([]byte("alice\x00pw"))] = ldapCached{user: &user{Name: "alice"}, expires: time.Now().Add(time.Minute)}
+	if u, err := a.authenticate("alice", "pw"); err != nil || u == nil || u.Name != "alice" {
+		t.Errorf("cached login: user = %v, err = %v", u, err)
+	}
+	if u, _ := a.authenticate("alice", "other"); u != nil {
+		t.Error("cached login accepted a different password")
+	}
+}
+
+func TestLDAPGroups(t *testing.T) {
+	if g := groupName("CN=Developers,OU=Groups,DC=corp"); g != "Developers" {
+		t.Errorf("groupName = %q", g)
+	}
+	memberOf := []string{"CN=Developers,OU=Groups,DC=corp", "CN=VPN,OU=Groups,DC=corp"}
+	for required, want := range map[string]bool{
+		"developers":                     true,
+		"cn=vpn,ou=groups,dc=corp":       true,
+		"Admins":                         false,
+		"CN=Developers,OU=Other,DC=corp": false,
+	} {
+		if got := hasAnyGroup(memberOf, []string{required}); got != want {
+			t.Errorf("hasAnyGroup(%q) = %v, want %v", required, got, want)
+		}
+	}
+}
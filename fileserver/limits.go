@@ -0,0 +1,135 @@
+package fileserver
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 上传限制：-max-upload 单个文件的大小，-max-body 单个请求体的大小，-quota 根目录下所有文件的总大小。
+// 超出时在写满磁盘之前拒绝，分别返回 413 和 507
+
+var (
+	errTooLarge = errors.New("file exceeds the upload size limit")
+	errQuota    = errors.New("disk quota exceeded")
+)
+
+// uploadLimits 是上传限制，0 表示不限制
+type uploadLimits struct {
+	maxFile    int64
+	maxBody    int64
+	quota      int64
+	maxExtract int64 // 上传后解压时解压出的总大小
+
+	mu        sync.Mutex
+	used      int64     // 根目录已用空间
+	checkedAt time.Time // used 的统计时间
+}
+
+// 已用空间的统计结果在这段时间内重复使用，上传完成后重新统计
+const usageTTL = time.Minute
+
+// diskUsage 统计根目录下所有文件的总大小
+func (s *server) diskUsage() int64 {
+	l := s.limits
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.checkedAt) < usageTTL {
+		return l.used
+	}
+	var total int64
+	filepath.WalkDir(s.root, func(name string, d fs.DirEntry, err error) error {
+		// 去重的对象都是树中文件的硬链接，不重复统计
+		if err == nil && d.IsDir() && name == filepath.Join(s.root, objectsDir) {
+			return filepath.SkipDir
+		}
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	l.used, l.checkedAt = total, time.Now()
+	return total
+}
+
+// uploaded 在写入文件后调用，下次检查配额时重新统计
+func (s *server) uploaded() {
+	s.limits.mu.Lock()
+	s.limits.checkedAt = time.Time{}
+	s.limits.mu.Unlock()
+}
+
+// uploadAllowed 在写入之前检查大小已知的上传，size 为 -1 表示未知
+func (s *server) uploadAllowed(size int64) error {
+	l := s.limits
+	if size < 0 {
+		return nil
+	}
+	if l.maxFile > 0 && size > l.maxFile {
+		return errTooLarge
+	}
+	if l.quota > 0 && s.diskUsage()+size > l.quota {
+		return errQuota
+	}
+	return nil
+}
+
+// uploadLimit 返回一个上传最多能写入多少字节，以及超出时返回的错误，-1 表示不限制
+func (s *server) uploadLimit() (int64, error) {
+	l := s.limits
+	n, err := int64(-1), errTooLarge
+	if l.maxFile > 0 {
+		n = l.maxFile
+	}
+	if l.quota > 0 {
+		if left := max(l.quota-s.diskUsage(), 0); n < 0 || left < n {
+			n, err = left, errQuota
+		}
+	}
+	return n, err
+}
+
+// limitUpload 限制上传内容最多能写入多少字节，超出时读取返回错误，写到一半的临时文件会被删除
+func (s *server) limitUpload(r io.Reader) io.Reader {
+	n, err := s.uploadLimit()
+	if n < 0 {
+		return r
+	}
+	return &limitedReader{r: r, n: n, err: err}
+}
+
+// limitBody 限制修改文件的请求的请求体大小
+func (s *server) limitBody(w http.ResponseWriter, r *http.Request) {
+	if s.limits.maxBody > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.limits.maxBody)
+	}
+}
+
+// limitedReader 与 io.LimitReader 类似，但超出时返回错误而不是 EOF
+type limitedReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, l.err
+	}
+	// 多读一个字节，才能区分正好达到上限和超过上限
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, l.err
+	}
+	return n, err
+}
@@ -0,0 +1,46 @@
+package fileserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUploadLimits(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root}, WithReadWrite(), WithUploadLimits(8, 0, 20))
+	put := func(p, body string, knownLength bool) int {
+		var r *http.Request
+		if knownLength {
+			r = httptest.NewRequest("PUT", p, strings.NewReader(body))
+		} else {
+			// 分块传输时事先不知道大小，写到超出限制时才失败
+			r = httptest.NewRequest("PUT", p, io.MultiReader(strings.NewReader(body)))
+			r.ContentLength = -1
+		}
+		res, _ := do(t, h, r)
+		return res.StatusCode
+	}
+	if got := put("/api/files/big.txt", "123456789", true); got != http.StatusRequestEntityTooLarge {
+		t.Errorf("too large: status = %d, want 413", got)
+	}
+	if got := put("/api/files/chunked.txt", "123456789", false); got != http.StatusRequestEntityTooLarge {
+		t.Errorf("too large without Content-Length: status = %d, want 413", got)
+	}
+	if got := put("/api/files/ok.txt", "12345678", true); got != http.StatusCreated {
+		t.Errorf("within limit: status = %d", got)
+	}
+	// 已用 5+5+8 字节，配额 20
+	if got := put("/api/files/quota.txt", "123", true); got != http.StatusInsufficientStorage {
+		t.Errorf("over quota: status = %d, want 507", got)
+	}
+	for _, name := range []string{"big.txt", "chunked.txt", "quota.txt"} {
+		if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+			t.Errorf("%s was written", name)
+		}
+	}
+}
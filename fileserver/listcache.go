@@ -0,0 +1,106 @@
+package fileserver
+
+import (
+	"io/fs"
+	"log"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// 目录列表缓存：每次列出目录都要 ReadDir 再逐个 Stat，文件很多又经常被访问的目录会一直读盘。
+// 读到的目录项（连同文件信息）按目录缓存在内存中，目录中的文件有变化时由 fsnotify 通知失效；
+// 另外每次使用前比较目录本身的修改时间，刚刚增删的文件不用等 fsnotify 的通知就能看到。
+// 只缓存本地根目录，-no-cache 关闭
+
+// maxCachedDirs 是最多缓存的目录数，每个目录占用一个 inotify watch
+const maxCachedDirs = 1000
+
+// listingCache 按本地路径缓存目录项
+type listingCache struct {
+	mu     sync.Mutex
+	dirs   map[string]*cachedDir
+	warned bool // 是否已经记录过无法监视的日志，inotify watch 用完时不要每次请求都记录
+}
+
+type cachedDir struct {
+	cancel  func()
+	gen     int  // 每次有变化加一，读目录期间有变化时结果不能缓存
+	valid   bool // entries 是否可用
+	modTime time.Time
+	entries []fs.DirEntry
+}
+
+func newListingCache() *listingCache {
+	return &listingCache{dirs: map[string]*cachedDir{}}
+}
+
+// readDir 返回 fsys 中 name 的目录项，dir 是它的本地路径，用作缓存的键和监视的目录
+func (c *listingCache) readDir(fsys fs.FS, name, dir string) ([]fs.DirEntry, error) {
+	dir = filepath.Clean(filepath.FromSlash(dir))
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return fs.ReadDir(fsys, name)
+	}
+
+	c.mu.Lock()
+	d := c.dirs[dir]
+	if d == nil {
+		if len(c.dirs) >= maxCachedDirs {
+			// 超过上限时随便丢掉一个
+			for k, old := range c.dirs {
+				old.cancel()
+				delete(c.dirs, k)
+				break
+			}
+		}
+		// 先订阅再读目录，读的过程中发生的变化也能收到
+		d = &cachedDir{}
+		cancel, err := watcher.subscribe(dir, func() { c.invalidate(d) })
+		if err != nil {
+			if !c.warned {
+				c.warned = true
+				log.Printf("Failed to watch %s, listings are not cached: %v", dir, err)
+			}
+			c.mu.Unlock()
+			return fs.ReadDir(fsys, name)
+		}
+		d.cancel = cancel
+		c.dirs[dir] = d
+	}
+	if d.valid && d.modTime.Equal(info.ModTime()) {
+		entries := slices.Clone(d.entries)
+		c.mu.Unlock()
+		return entries, nil
+	}
+	gen := d.gen
+	c.mu.Unlock()
+
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	// 缓存的目录项带上文件信息，以后调用 Info 不再读盘；读取期间被删除的文件跳过
+	cached := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		if fi, err := e.Info(); err == nil {
+			cached = append(cached, fs.FileInfoToDirEntry(fi))
+		}
+	}
+
+	c.mu.Lock()
+	if c.dirs[dir] == d && d.gen == gen {
+		d.valid, d.modTime, d.entries = true, info.ModTime(), cached
+	}
+	c.mu.Unlock()
+	return slices.Clone(cached), nil
+}
+
+// invalidate 在目录有变化时丢弃缓存的目录项，继续监视
+func (c *listingCache) invalidate(d *cachedDir) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d.gen++
+	d.valid, d.entries = false, nil
+}
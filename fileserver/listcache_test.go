@@ -0,0 +1,49 @@
+package fileserver
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListingCache(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root})
+	list := func() string {
+		_, body := do(t, h, httptest.NewRequest("GET", "/api/list/", nil))
+		return body
+	}
+	list()
+	d := h.s.listings.dirs[filepath.Clean(filepath.FromSlash(h.s.root+"/"))]
+	if d == nil || !d.valid {
+		t.Fatal("root directory was not cached")
+	}
+
+	// 新增的文件不用等 fsnotify，目录的修改时间变了就会重新读取
+	os.WriteFile(filepath.Join(root, "new.txt"), []byte("x"), 0644)
+	if body := list(); !strings.Contains(body, "new.txt") {
+		t.Errorf("new file missing from listing: %s", body)
+	}
+	// 文件大小变化不影响目录的修改时间，由 fsnotify 通知
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("hello, world"), 0644)
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(list(), `"size":12`) {
+		if time.Now().After(deadline) {
+			t.Fatal("size change was not picked up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestListingCacheDisabled(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t), DisableListingCache: true})
+	if h.s.listings != nil {
+		t.Error("listing cache enabled")
+	}
+	if h := newTestHandler(t, Config{FS: os.DirFS(newTestRoot(t))}); h.s.listings != nil {
+		t.Error("listing cache enabled for Config.FS")
+	}
+}
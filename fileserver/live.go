@@ -0,0 +1,87 @@
+package fileserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 目录实时更新：目录列表页面用 EventSource 连接 GET /api/events/<目录>，目录中的文件有变化时
+// 服务端推送一个 change 事件，页面随即刷新，复制构建产物时不用一直按 F5。
+// 变化由 fsnotify 监视，只监视有页面打开着的目录，最后一个页面关闭后取消监视。只支持本地根目录
+
+// liveDebounce 是收到变化后等待的时间，复制一批文件时合并成一次刷新
+var liveDebounce = 500 * time.Millisecond
+
+// liveHeartbeat 是没有变化时发送注释行的间隔，防止代理因为连接空闲而断开
+const liveHeartbeat = 25 * time.Second
+
+// eventsHandler 处理 GET /api/events/<目录>，以 Server-Sent Events 推送目录的变化
+func (s *server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	p := cleanPath(strings.TrimPrefix(r.URL.Path, "/api/events"))
+	if s.root == "" {
+		apiError(w, http.StatusNotImplemented, "live updates are only available for local directories")
+		return
+	}
+	if isHidden(p) {
+		apiError(w, http.StatusNotFound, "directory not found")
+		return
+	}
+	if info, err := s.stat(p); err != nil || !info.IsDir() {
+		apiError(w, http.StatusNotFound, "directory not found")
+		return
+	}
+	changes := make(chan struct{}, 1)
+	cancel, err := watcher.subscribe(s.root+p, func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		log.Printf("Failed to watch %s: %v", p, err)
+		apiError(w, http.StatusServiceUnavailable, "failed to watch directory")
+		return
+	}
+	defer cancel()
+
+	rc := http.NewResponseController(w)
+	// 连接会一直保持，不受 -write-timeout 限制
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+	rc.Flush()
+
+	data, _ := json.Marshal(map[string]string{"path": p})
+	heartbeat := time.NewTicker(liveHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-changes:
+			select {
+			case <-time.After(liveDebounce):
+			case <-r.Context().Done():
+				return
+			}
+			// 等待期间的变化已经包含在这次通知中
+			select {
+			case <-changes:
+			default:
+			}
+			fmt.Fprintf(w, "event: change\ndata: %s\n\n", data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package fileserver
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLiveEvents(t *testing.T) {
+	liveDebounce = 10 * time.Millisecond
+	root := newTestRoot(t)
+	srv := httptest.NewServer(newTestHandler(t, Config{Root: root}))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/api/events/sub/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	lines := make(chan string)
+	go func() {
+		sc := bufio.NewScanner(res.Body)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+		close(lines)
+	}()
+	// 连接建立后服务端先发送 retry，此时已经开始监视
+	if line := <-lines; !strings.HasPrefix(line, "retry:") {
+		t.Fatalf("first line = %q", line)
+	}
+	os.WriteFile(filepath.Join(root, "sub", "new.txt"), []byte("x"), 0644)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("stream closed")
+			}
+			if line == "event: change" {
+				if data := <-lines; data != `data: {"path":"/sub"}` {
+					t.Errorf("data = %q", data)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("no change event")
+		}
+	}
+}
+
+func TestLiveEventsErrors(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)})
+	for _, p := range []string{"/api/events/a.txt", "/api/events/missing/", "/api/events/.uploads/"} {
+		if res, _ := do(t, h, httptest.NewRequest("GET", p, nil)); res.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s: status = %d, want 404", p, res.StatusCode)
+		}
+	}
+	if _, body := do(t, h, httptest.NewRequest("GET", "/sub/", nil)); !strings.Contains(body, `data-events="/api/events/sub/"`) {
+		t.Error("listing does not link to /api/events")
+	}
+}
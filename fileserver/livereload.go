@@ -0,0 +1,174 @@
+package fileserver
+
+import (
+	"bytes"
+	"context"
+	"html"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/fsnotify/fsnotify"
+)
+
+// 开发模式的自动刷新（-live-reload）：静态网站模式和单页应用模式下返回的 HTML 页面末尾加上一个脚本，
+// 脚本通过 WebSocket 连接 /api/livereload，根目录下任何文件有变化时服务端通知所有页面刷新；
+// 只改了 CSS 时只重新加载样式表，不刷新整个页面。这样本程序可以直接当作静态网站的开发服务器使用
+
+// liveReloadDelay 是收到变化后等待的时间，编辑器保存、构建工具一次写入多个文件时只刷新一次
+var liveReloadDelay = 100 * time.Millisecond
+
+var bodyEnd = regexp.MustCompile(`(?i)</body\s*>`)
+
+// liveReload 递归监视根目录，把变化广播给所有连接的页面
+type liveReload struct {
+	w *fsnotify.Watcher
+
+	mu      sync.Mutex
+	clients map[chan string]bool
+}
+
+func newLiveReload(root string) (*liveReload, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	lr := &liveReload{w: w, clients: map[chan string]bool{}}
+	if err := lr.watchTree(root); err != nil {
+		w.Close()
+		return nil, err
+	}
+	go lr.run()
+	return lr, nil
+}
+
+// watchTree 监视 dir 和其中的所有子目录，fsnotify 不会自动监视子目录
+func (lr *liveReload) watchTree(dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if p != dir && (hiddenFiles[foldPath(d.Name())] || d.Name() == ".git" || d.Name() == "node_modules") {
+			return filepath.SkipDir
+		}
+		return lr.w.Add(p)
+	})
+}
+
+func (lr *liveReload) run() {
+	var timer <-chan time.Time
+	cssOnly := true
+	for {
+		select {
+		case ev, ok := <-lr.w.Events:
+			if !ok {
+				return
+			}
+			if hiddenFiles[foldPath(filepath.Base(ev.Name))] || ev.Op == fsnotify.Chmod {
+				continue
+			}
+			// 新建的子目录也要监视
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					lr.watchTree(ev.Name)
+				}
+			}
+			cssOnly = cssOnly && strings.EqualFold(filepath.Ext(ev.Name), ".css")
+			if timer == nil {
+				timer = time.After(liveReloadDelay)
+			}
+		case <-timer:
+			msg := "reload"
+			if cssOnly {
+				msg = "css"
+			}
+			lr.broadcast(msg)
+			timer, cssOnly = nil, true
+		case err, ok := <-lr.w.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("File watcher error: %v", err)
+		}
+	}
+}
+
+func (lr *liveReload) broadcast(msg string) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	for ch := range lr.clients {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// handler 处理 /api/livereload 的 WebSocket 连接，有变化时发送 reload 或 css
+func (lr *liveReload) handler(w http.ResponseWriter, r *http.Request) {
+	// 默认只接受同源页面的连接
+	c, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer c.CloseNow()
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	ctx := c.CloseRead(r.Context())
+
+	ch := make(chan string, 1)
+	lr.mu.Lock()
+	lr.clients[ch] = true
+	lr.mu.Unlock()
+	defer func() {
+		lr.mu.Lock()
+		delete(lr.clients, ch)
+		lr.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-ch:
+			wctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			err := c.Write(wctx, websocket.MessageText, []byte(msg))
+			cancel()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// isHTML 判断是否为需要插入自动刷新脚本的页面
+func isHTML(p string) bool {
+	ext := strings.ToLower(path.Ext(p))
+	return ext == ".html" || ext == ".htm"
+}
+
+// serveLiveHTML 返回插入了自动刷新脚本的 HTML 页面，内容和原文件不同，不使用预压缩文件和 ETag
+func (s *server) serveLiveHTML(w http.ResponseWriter, r *http.Request, p string, info fs.FileInfo) {
+	b, err := s.readFile(p)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	// 插入到 </body> 之前，没有时加在最后
+	script := []byte(`<script src="` + html.EscapeString(s.base) + `/static/livereload.js"></script>`)
+	if m := bodyEnd.FindAllIndex(b, -1); m != nil {
+		i := m[len(m)-1][0]
+		b = append(b[:i:i], append(script, b[i:]...)...)
+	} else {
+		b = append(b, script...)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, p, info.ModTime(), bytes.NewReader(b))
+}
@@ -0,0 +1,77 @@
+package fileserver
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+func TestLiveReload(t *testing.T) {
+	liveReloadDelay = 10 * time.Millisecond
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "index.html"), []byte("<html><BODY>hi</BODY></html>"), 0644)
+	os.WriteFile(filepath.Join(root, "style.css"), []byte("body{}"), 0644)
+	h := newTestHandler(t, Config{Root: root, ServeIndex: true, LiveReload: true})
+
+	_, body := do(t, h, httptest.NewRequest("GET", "/", nil))
+	if want := `hi<script src="/static/livereload.js"></script></BODY>`; !strings.Contains(body, want) {
+		t.Errorf("page = %q, want script before </body>", body)
+	}
+	if _, body := do(t, h, httptest.NewRequest("GET", "/style.css", nil)); body != "body{}" {
+		t.Errorf("style.css = %q", body)
+	}
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/static/livereload.js", nil)); res.StatusCode != 200 {
+		t.Errorf("livereload.js: status = %d", res.StatusCode)
+	}
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/api/livereload", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.CloseNow()
+	next := func() string {
+		t.Helper()
+		_, msg, err := c.Read(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(msg)
+	}
+
+	// 等连接登记好再修改文件
+	time.Sleep(50 * time.Millisecond)
+	os.WriteFile(filepath.Join(root, "style.css"), []byte("body{color:red}"), 0644)
+	if msg := next(); msg != "css" {
+		t.Errorf("after changing style.css: %q, want css", msg)
+	}
+	// 新建的子目录中的文件也会触发
+	os.Mkdir(filepath.Join(root, "docs"), 0755)
+	time.Sleep(50 * time.Millisecond)
+	next()
+	os.WriteFile(filepath.Join(root, "docs", "a.html"), []byte("x"), 0644)
+	if msg := next(); msg != "reload" {
+		t.Errorf("after writing docs/a.html: %q, want reload", msg)
+	}
+}
+
+func TestLiveReloadDisabled(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "index.html"), []byte("<body>hi</body>"), 0644)
+	h := newTestHandler(t, Config{Root: root, ServeIndex: true})
+	if _, body := do(t, h, httptest.NewRequest("GET", "/", nil)); body != "<body>hi</body>" {
+		t.Errorf("page = %q", body)
+	}
+	if _, err := New(Config{FS: os.DirFS(root), LiveReload: true}); err == nil {
+		t.Error("LiveReload with FS: no error")
+	}
+}
@@ -0,0 +1,70 @@
+package fileserver
+
+import (
+	"bytes"
+	"html/template"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// 超过这个大小的 Markdown 不再渲染，直接按原文输出
+const maxMarkdownSize = 4 << 20
+
+// goldmark 默认不输出原始 HTML，并过滤 javascript: 之类的危险链接，
+// 所以渲染结果可以直接嵌入页面
+var md = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+func isMarkdown(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".md", ".markdown":
+		return true
+	}
+	return false
+}
+
+// isReadme 判断是否为目录说明文件，README.md 优先于 README.txt
+func isReadme(name string) bool {
+	switch strings.ToLower(name) {
+	case "readme.md", "readme.markdown", "readme.txt", "readme":
+		return true
+	}
+	return false
+}
+
+// renderReadme 渲染目录说明 p，Markdown 转成 HTML，其余按纯文本显示
+func (s *server) renderReadme(p string) template.HTML {
+	info, err := s.stat(p)
+	if err != nil || info.Size() > maxMarkdownSize {
+		return ""
+	}
+	src, err := s.readFile(p)
+	if err != nil {
+		return ""
+	}
+	if isMarkdown(p) {
+		content, _ := renderMarkdown(src)
+		return content
+	}
+	return template.HTML("<pre>" + template.HTMLEscapeString(string(src)) + "</pre>")
+}
+
+// renderMarkdown 把 Markdown 源文转换成安全的 HTML 片段
+func renderMarkdown(src []byte) (template.HTML, error) {
+	var buf bytes.Buffer
+	if err := md.Convert(src, &buf); err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
+
+// DocumentData 是 Markdown、源码等文档预览页面共用的数据
+type DocumentData struct {
+	Page
+	Name     string
+	Download string
+	Parent   string
+	Content  template.HTML
+}
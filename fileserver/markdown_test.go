@@ -0,0 +1,52 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMarkdownView(t *testing.T) {
+	h := newTestHandler(t, Config{FS: fstest.MapFS{
+		"doc.md": {Data: []byte("# Title\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\n<script>alert(1)</script>\n\n[x](javascript:alert(1))")},
+	}})
+	res, body := do(t, h, httptest.NewRequest("GET", "/view/doc.md", nil))
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", res.StatusCode)
+	}
+	for _, want := range []string{"<h1>Title</h1>", "<table>", `href="/download/doc.md"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page does not contain %s", want)
+		}
+	}
+	for _, bad := range []string{"<script>alert(1)</script>", "javascript:alert"} {
+		if strings.Contains(body, bad) {
+			t.Errorf("page contains unsafe %s", bad)
+		}
+	}
+	if _, body := do(t, h, httptest.NewRequest("GET", "/view/doc.md?raw=1", nil)); !strings.HasPrefix(body, "# Title") {
+		t.Errorf("raw view = %q", body)
+	}
+}
+
+func TestReadme(t *testing.T) {
+	h := newTestHandler(t, Config{FS: fstest.MapFS{
+		"md/README.md":   {Data: []byte("# Project")},
+		"md/README.txt":  {Data: []byte("ignored")},
+		"txt/readme.txt": {Data: []byte("<b>plain</b>")},
+		"none/a.txt":     {Data: []byte("a")},
+	}})
+	for p, want := range map[string]string{
+		"/md/":  "<h1>Project</h1>",
+		"/txt/": "<pre>&lt;b&gt;plain&lt;/b&gt;</pre>",
+	} {
+		if _, body := do(t, h, httptest.NewRequest("GET", p, nil)); !strings.Contains(body, want) {
+			t.Errorf("%s: listing does not contain %s", p, want)
+		}
+	}
+	if _, body := do(t, h, httptest.NewRequest("GET", "/md/", nil)); strings.Contains(body, "ignored") {
+		t.Error("README.txt was rendered although README.md exists")
+	}
+}
@@ -0,0 +1,109 @@
+package fileserver
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 常见音视频扩展名，部分系统的 mime 表里没有这些类型
+var mediaTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".webm": "video/webm",
+	".ogv":  "video/ogg",
+	".mov":  "video/quicktime",
+	".mkv":  "video/x-matroska",
+	".mp3":  "audio/mpeg",
+	".flac": "audio/flac",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".opus": "audio/ogg",
+	".m4a":  "audio/mp4",
+	".wav":  "audio/wav",
+}
+
+// isMedia 判断是否为浏览器可直接播放的音视频类型
+func isMedia(contentType string) bool {
+	return strings.HasPrefix(contentType, "video/") || strings.HasPrefix(contentType, "audio/")
+}
+
+// mediaType 根据扩展名判断类型，判断不出时使用嗅探结果
+func mediaType(name, sniffed string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := mediaTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return sniffed
+}
+
+type PlayerData struct {
+	Page
+	Name     string
+	Src      string // 原始数据流地址，支持 Range 请求
+	Download string
+	Parent   string
+	Audio    bool
+	Autoplay bool
+	Prev     string // 同目录上一首，只有音频才有
+	Next     string // 同目录下一首
+}
+
+// playerHandler 渲染音视频播放页面，媒体本身通过 ?raw=1 获取
+func (s *server) playerHandler(w http.ResponseWriter, r *http.Request, decodedPath string) {
+	escaped := r.URL.EscapedPath()
+	data := PlayerData{
+		Page:     s.page(w, r),
+		Name:     path.Base(decodedPath),
+		Src:      s.base + escaped + "?raw=1",
+		Download: s.base + "/download" + strings.TrimPrefix(escaped, "/view"),
+		Parent:   s.base + parentDir(decodedPath),
+		Audio:    strings.HasPrefix(mediaType(decodedPath, ""), "audio/"),
+		Autoplay: r.URL.Query().Get("autoplay") != "",
+	}
+	if data.Audio {
+		data.Prev, data.Next = s.siblingTracks(parentDir(decodedPath), data.Name, s.base+"/view"+parentDir(decodedPath))
+	}
+
+	s.render(w, "player.html", data)
+}
+
+// siblingTracks 找出同目录中按名字排序的上一首、下一首音频，prefix 是所在目录的查看地址
+func (s *server) siblingTracks(dir, name, prefix string) (prev, next string) {
+	entries, err := s.readDir(dir)
+	if err != nil {
+		return "", ""
+	}
+
+	var tracks []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(mediaType(e.Name(), ""), "audio/") {
+			tracks = append(tracks, e.Name())
+		}
+	}
+	sort.Strings(tracks)
+
+	link := func(n string) string {
+		return (&url.URL{Path: prefix}).EscapedPath() + url.PathEscape(n)
+	}
+	for i, t := range tracks {
+		if t != name {
+			continue
+		}
+		if i > 0 {
+			prev = link(tracks[i-1])
+		}
+		if i < len(tracks)-1 {
+			next = link(tracks[i+1])
+		}
+		break
+	}
+	return prev, next
+}
@@ -0,0 +1,50 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestVideoPlayer(t *testing.T) {
+	h := newTestHandler(t, Config{FS: fstest.MapFS{"movie.mp4": {Data: []byte("0123456789")}}})
+	res, body := do(t, h, httptest.NewRequest("GET", "/view/movie.mp4", nil))
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, `<video src="/view/movie.mp4?raw=1"`) {
+		t.Fatalf("player page: status = %d", res.StatusCode)
+	}
+	r := httptest.NewRequest("GET", "/view/movie.mp4?raw=1", nil)
+	r.Header.Set("Range", "bytes=4-")
+	res, body = do(t, h, r)
+	if res.StatusCode != http.StatusPartialContent || body != "456789" || res.Header.Get("Content-Type") != "video/mp4" {
+		t.Errorf("raw range: got %d %q %s", res.StatusCode, body, res.Header.Get("Content-Type"))
+	}
+}
+
+func TestAudioPlayer(t *testing.T) {
+	h := newTestHandler(t, Config{FS: fstest.MapFS{
+		"album/01 intro.mp3": {Data: []byte("a")},
+		"album/02 song.flac": {Data: []byte("b")},
+		"album/03 outro.ogg": {Data: []byte("c")},
+		"album/cover.jpg":    {Data: []byte("d")},
+	}})
+	for p, want := range map[string][]string{
+		"/view/album/01%20intro.mp3":            {`<audio id="player"`, `href="/view/album/02%20song.flac?autoplay=1" id="next"`},
+		"/view/album/02%20song.flac":            {`href="/view/album/01%20intro.mp3?autoplay=1"`, `href="/view/album/03%20outro.ogg?autoplay=1"`},
+		"/view/album/03%20outro.ogg?autoplay=1": {"autoplay"},
+	} {
+		res, body := do(t, h, httptest.NewRequest("GET", p, nil))
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status = %d", p, res.StatusCode)
+		}
+		for _, s := range want {
+			if !strings.Contains(body, s) {
+				t.Errorf("%s: page does not contain %s", p, s)
+			}
+		}
+	}
+	if _, body := do(t, h, httptest.NewRequest("GET", "/view/album/03%20outro.ogg", nil)); strings.Contains(body, `id="next"`) {
+		t.Error("last track has a next link")
+	}
+}
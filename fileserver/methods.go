@@ -0,0 +1,60 @@
+package fileserver
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// 每个地址支持的请求方法。OPTIONS 直接返回 Allow，其他不支持的方法返回 405，
+// 避免 OPTIONS、POST 等请求落到下载处理中把文件内容发回去
+
+// routeMethods 返回地址 p 支持的方法（不含 OPTIONS）
+func routeMethods(p string) []string {
+	switch {
+	case strings.HasPrefix(p, "/api/files/"):
+		return []string{http.MethodHead, http.MethodPut, http.MethodPost, http.MethodPatch, http.MethodDelete}
+	case p == "/api/share", p == "/api/unlock", p == "/api/move", p == "/api/mkdir", p == "/api/zip", strings.HasPrefix(p, "/admin/"),
+		p == "/api/batch/delete", p == "/api/batch/move",
+		strings.HasPrefix(p, "/trash/"), strings.HasPrefix(p, "/api/trash/"):
+		return []string{http.MethodPost}
+	case strings.HasPrefix(p, "/edit/"), strings.HasPrefix(p, "/history/"):
+		return []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	case p == "/auth/logout":
+		return []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	return []string{http.MethodGet, http.MethodHead}
+}
+
+// allowHeader 返回 Allow 头的内容，只读模式下去掉会修改文件的方法
+func (s *server) allowHeader(p string) (string, []string) {
+	var methods []string
+	for _, m := range routeMethods(p) {
+		if !s.readOnly() || !writeMethod(m, p) {
+			methods = append(methods, m)
+		}
+	}
+	return strings.Join(append(methods, http.MethodOptions), ", "), methods
+}
+
+// allowMethods 应答 OPTIONS 请求，拒绝地址不支持的方法
+func (s *server) allowMethods(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allow, methods := s.allowHeader(r.URL.Path)
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Allow", allow)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if slices.Contains(methods, r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Allow", allow)
+		if slices.Contains(routeMethods(r.URL.Path), r.Method) {
+			s.httpError(w, r, http.StatusMethodNotAllowed, "Server is read-only")
+			return
+		}
+		s.httpError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	})
+}
@@ -0,0 +1,54 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHead(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)})
+	for p, disposition := range map[string]string{"/download/a.txt": "attachment", "/view/a.txt": "inline"} {
+		res, body := do(t, h, httptest.NewRequest("HEAD", p, nil))
+		if res.StatusCode != http.StatusOK || body != "" {
+			t.Errorf("HEAD %s: got %d, %d bytes", p, res.StatusCode, len(body))
+		}
+		if res.Header.Get("Content-Length") != "5" || res.Header.Get("Content-Type") == "" {
+			t.Errorf("HEAD %s: headers %v", p, res.Header)
+		}
+		if cd := res.Header.Get("Content-Disposition"); !strings.HasPrefix(cd, disposition) {
+			t.Errorf("HEAD %s: Content-Disposition = %q", p, cd)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	for _, c := range []struct {
+		readWrite bool
+		path      string
+		allow     string
+	}{
+		{false, "/download/a.txt", "GET, HEAD, OPTIONS"},
+		{false, "/api/files/a.txt", "HEAD, OPTIONS"},
+		{true, "/api/files/a.txt", "HEAD, PUT, POST, PATCH, DELETE, OPTIONS"},
+		{true, "/api/mkdir", "POST, OPTIONS"},
+	} {
+		var opts []Option
+		if c.readWrite {
+			opts = append(opts, WithReadWrite())
+		}
+		h := newTestHandler(t, Config{Root: newTestRoot(t)}, opts...)
+		res, _ := do(t, h, httptest.NewRequest("OPTIONS", c.path, nil))
+		if res.StatusCode != http.StatusNoContent || res.Header.Get("Allow") != c.allow {
+			t.Errorf("OPTIONS %s (rw %v): got %d, Allow %q, want %q", c.path, c.readWrite, res.StatusCode, res.Header.Get("Allow"), c.allow)
+		}
+	}
+
+	// 不支持的方法返回 405，不能落到下载处理中
+	h := newTestHandler(t, Config{Root: newTestRoot(t)})
+	res, body := do(t, h, httptest.NewRequest("POST", "/download/a.txt", nil))
+	if res.StatusCode != http.StatusMethodNotAllowed || body == "hello" || res.Header.Get("Allow") != "GET, HEAD, OPTIONS" {
+		t.Errorf("POST /download/: got %d %q", res.StatusCode, body)
+	}
+}
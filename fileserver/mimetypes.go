@@ -0,0 +1,48 @@
+package fileserver
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// 自定义 MIME 类型：-mime 参数（.apk=application/vnd.android.package-archive，可以重复）或配置文件的 mime_types
+// 按扩展名指定 Content-Type，优先于系统的 MIME 表和内容嗅探。下载、在线查看、分享链接、静态网站都使用，
+// 同一个扩展名两处都写了时以命令行参数为准。配置文件中的可以重新加载
+
+// parseMimeType 解析 -mime 参数，格式为 .ext=type，扩展名不区分大小写，可以省略开头的点
+func parseMimeType(s string) (ext, typ string, err error) {
+	ext, typ, ok := strings.Cut(s, "=")
+	ext, typ = normalizeExt(ext), strings.TrimSpace(typ)
+	if !ok || ext == "." || typ == "" {
+		return "", "", fmt.Errorf("invalid MIME type %q, expected .ext=type", s)
+	}
+	if _, _, err := mime.ParseMediaType(typ); err != nil {
+		return "", "", fmt.Errorf("invalid MIME type %q: %w", s, err)
+	}
+	return ext, typ, nil
+}
+
+// normalizeExt 把扩展名统一成 .ext 的小写形式
+func normalizeExt(ext string) string {
+	return "." + strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ext)), ".")
+}
+
+// mimeOverride 返回文件名 name 的扩展名指定的 Content-Type
+func (s *server) mimeOverride(name string) (string, bool) {
+	types := s.conf().mimeTypes
+	if len(types) == 0 {
+		return "", false
+	}
+	t, ok := types[strings.ToLower(path.Ext(name))]
+	return t, ok
+}
+
+// setContentType 有指定的类型时设置 Content-Type，http.ServeContent 不会再按扩展名或内容判断
+func (s *server) setContentType(w http.ResponseWriter, name string) {
+	if t, ok := s.mimeOverride(name); ok {
+		w.Header().Set("Content-Type", t)
+	}
+}
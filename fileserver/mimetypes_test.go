@@ -0,0 +1,47 @@
+package fileserver
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMimeTypes(t *testing.T) {
+	root := newTestRoot(t)
+	for _, name := range []string{"app.APK", "module.wasm", "notes.md", "movie.mkv"} {
+		os.WriteFile(filepath.Join(root, name), []byte("PK\x03\x04 binary"), 0644)
+	}
+	config := writeConfig(t, `{"mime_types": {"mkv": "video/x-matroska", ".wasm": "application/octet-stream"}}`)
+	h := newTestHandler(t, Config{Root: root, ConfigFile: config, MimeTypes: []string{".apk=application/vnd.android.package-archive", ".wasm=application/wasm", "md=text/plain; charset=utf-8"}})
+
+	tests := []struct{ target, want string }{
+		{"/download/app.APK", "application/vnd.android.package-archive"},
+		{"/download/module.wasm", "application/wasm"}, // 命令行参数优先于配置文件
+		{"/download/movie.mkv", "video/x-matroska"},
+		{"/view/notes.md?raw=1", "text/plain; charset=utf-8"},
+		{"/view/app.APK", "application/vnd.android.package-archive"},
+		{"/download/a.txt", "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		res, _ := do(t, h, httptest.NewRequest("GET", tt.target, nil))
+		if got := res.Header.Get("Content-Type"); got != tt.want {
+			t.Errorf("GET %s: Content-Type = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+
+	// 配置文件中的类型可以重新加载
+	os.WriteFile(config, []byte(`{"mime_types": {".mkv": "video/webm"}}`), 0600)
+	if err := h.s.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/download/movie.mkv", nil)); res.Header.Get("Content-Type") != "video/webm" {
+		t.Errorf("after reload: Content-Type = %q", res.Header.Get("Content-Type"))
+	}
+
+	for _, bad := range []string{"apk", ".apk=", "=text/plain", ".apk=not a type"} {
+		if _, err := New(Config{Root: root, MimeTypes: []string{bad}}); err == nil {
+			t.Errorf("-mime %q accepted", bad)
+		}
+	}
+}
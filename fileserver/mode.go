@@ -0,0 +1,87 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// 运行模式：默认只读，-mode rw 时才开放上传、删除、重命名等修改文件的接口。
+// 所有修改文件的功能都通过 writeRequest 识别，由 checkMode 统一拦截，不需要各自判断。
+// 浏览器会给跨站提交的表单带上 Basic Auth 凭据和登录 Cookie，所以 POST 等请求还要检查 Origin / Sec-Fetch-Site，
+// 只接受本站页面、-cors-origins 允许的来源和不带这两个头的命令行工具
+
+const (
+	ModeReadOnly  = "ro"
+	ModeReadWrite = "rw"
+)
+
+// readOnly 判断当前是否为只读模式
+func (s *server) readOnly() bool {
+	return !s.writable.Load()
+}
+
+// writeRequest 判断请求是否会修改文件
+func writeRequest(r *http.Request) bool {
+	return writeMethod(r.Method, r.URL.Path)
+}
+
+// writeMethod 判断用方法 method 请求地址 p 是否会修改文件。生成分享链接、输入目录密码、打包下载、管理页面的操作虽然是 POST，但不修改文件
+func writeMethod(method, p string) bool {
+	if !unsafeMethod(method) {
+		return false
+	}
+	switch p {
+	case "/api/share", "/api/unlock", "/api/zip":
+		return false
+	}
+	return !strings.HasPrefix(p, "/admin/")
+}
+
+// checkMode 在只读模式下拒绝所有修改文件的请求
+func (s *server) checkMode(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.readOnly() && writeRequest(r) {
+			w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+			s.httpError(w, r, http.StatusMethodNotAllowed, "Server is read-only")
+			return
+		}
+		if unsafeMethod(r.Method) && s.crossSite(r) {
+			s.httpError(w, r, http.StatusForbidden, "Cross-site request rejected")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// unsafeMethod 判断请求方法是否可能修改服务器上的状态
+func unsafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// crossSite 判断请求是否由其他站点的网页发起
+func (s *server) crossSite(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// 老浏览器不一定带 Origin，但会带 Sec-Fetch-Site；两者都没有的是命令行工具
+		site := r.Header.Get("Sec-Fetch-Site")
+		return site != "" && site != "same-origin" && site != "none"
+	}
+	if s.corsConf != nil && s.corsConf.allowOrigin(origin) != "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		// 包括沙箱 iframe 等发出的 Origin: null
+		return true
+	}
+	host := r.Host
+	if _, proxied := s.peer(r); proxied && r.Header.Get("X-Forwarded-Host") != "" {
+		host = r.Header.Get("X-Forwarded-Host")
+	}
+	return !strings.EqualFold(u.Host, host)
+}
@@ -0,0 +1,50 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCrossSiteWrite(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root, CORSOrigins: []string{"https://app.example"}}, WithReadWrite())
+
+	for _, c := range []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"cross-site origin", map[string]string{"Origin": "https://evil.example", "Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"null origin", map[string]string{"Origin": "null"}, http.StatusForbidden},
+		{"cross-site without origin", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"same-site subdomain", map[string]string{"Origin": "https://sub.example.com"}, http.StatusForbidden},
+		{"same origin", map[string]string{"Origin": "http://example.com", "Sec-Fetch-Site": "same-origin"}, http.StatusOK},
+		{"cors origin", map[string]string{"Origin": "https://app.example"}, http.StatusOK},
+		{"command line", nil, http.StatusOK},
+	} {
+		from, to := "/a.txt", "/moved.txt"
+		if c.want != http.StatusOK {
+			to = "/should-not-exist.txt"
+		}
+		r := httptest.NewRequest("POST", "/api/move", strings.NewReader("from="+from+"&to="+to))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for k, v := range c.headers {
+			r.Header.Set(k, v)
+		}
+		res, _ := do(t, h, r)
+		if res.StatusCode != c.want {
+			t.Errorf("%s: status = %d, want %d", c.name, res.StatusCode, c.want)
+		}
+		if res.StatusCode == http.StatusOK {
+			// 移回原处，下一项继续使用
+			os.Rename(filepath.Join(root, "moved.txt"), filepath.Join(root, "a.txt"))
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "should-not-exist.txt")); err == nil {
+		t.Error("cross-site request moved the file")
+	}
+}
@@ -0,0 +1,286 @@
+package fileserver
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+)
+
+// 单点登录：配置文件 oidc 段落启用后，浏览器访问时跳转到身份提供方登录，
+// 回来后把用户名和组写入签名的 session cookie。组可以在访问控制规则中用 @组名 引用，
+// 从而决定读写权限。Google、Keycloak 等走标准 OIDC，GitHub 不支持 OIDC，单独处理
+
+// oidcConfig 是配置文件中的单点登录设置
+type oidcConfig struct {
+	Provider     string   `json:"provider"`      // oidc（默认）或 github
+	Issuer       string   `json:"issuer"`        // OIDC 发行方，例如 https://accounts.google.com
+	ClientID     string   `json:"client_id"`     // 应用 ID
+	ClientSecret string   `json:"client_secret"` // 应用密钥
+	RedirectURL  string   `json:"redirect_url"`  // 回调地址，必须是 <本服务地址>/auth/callback
+	Scopes       []string `json:"scopes"`        // 额外申请的 scope
+	UserClaim    string   `json:"user_claim"`    // 用户名所在的字段，默认 email
+	GroupsClaim  string   `json:"groups_claim"`  // 组列表所在的字段，默认 groups
+	Hours        float64  `json:"session_hours"` // 登录有效时间，默认 12 小时
+}
+
+const (
+	sessionCookie = "session"
+	stateCookie   = "oidc_state"
+)
+
+// oidcAuth 负责登录跳转、回调和 session cookie
+type oidcAuth struct {
+	cfg      *oidcConfig
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier // provider 为 github 时为 nil
+	secret   []byte
+	ttl      time.Duration
+}
+
+func newOIDCAuth(cfg *oidcConfig, secret []byte) (*oidcAuth, error) {
+	if cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("oidc: client_id and redirect_url are required")
+	}
+	if cfg.UserClaim == "" {
+		cfg.UserClaim = "email"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if cfg.Hours <= 0 {
+		cfg.Hours = 12
+	}
+	a := &oidcAuth{
+		cfg:    cfg,
+		secret: secret,
+		ttl:    time.Duration(cfg.Hours * float64(time.Hour)),
+		oauth: &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+		},
+	}
+
+	switch cfg.Provider {
+	case "github":
+		a.oauth.Endpoint = endpoints.GitHub
+		a.oauth.Scopes = append([]string{"read:user", "read:org"}, cfg.Scopes...)
+	case "", "oidc":
+		if cfg.Issuer == "" {
+			return nil, errors.New("oidc: issuer is required")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("oidc: %w", err)
+		}
+		a.oauth.Endpoint = provider.Endpoint()
+		a.oauth.Scopes = append([]string{oidc.ScopeOpenID, "profile", "email"}, cfg.Scopes...)
+		a.verifier = provider.Verifier(&oidc.Config{ClientID: cfg.ClientID})
+	default:
+		return nil, fmt.Errorf("oidc: unknown provider %q", cfg.Provider)
+	}
+	return a, nil
+}
+
+// session 是 session cookie 中保存的登录信息
+type session struct {
+	Name    string   `json:"n"`
+	Groups  []string `json:"g,omitempty"`
+	Expires int64    `json:"e"`
+}
+
+func (a *oidcAuth) sign(payload string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte("session\x00" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// user 从 session cookie 中取出已登录的用户，没有或已过期时返回 nil
+func (a *oidcAuth) user(r *http.Request) *user {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+	payload, sig, ok := strings.Cut(c.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(a.sign(payload))) {
+		return nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil
+	}
+	var sess session
+	if err := json.Unmarshal(b, &sess); err != nil || time.Now().Unix() > sess.Expires {
+		return nil
+	}
+	return &user{Name: sess.Name, Groups: sess.Groups}
+}
+
+func (a *oidcAuth) setSession(w http.ResponseWriter, r *http.Request, u *user) {
+	b, _ := json.Marshal(session{Name: u.Name, Groups: u.Groups, Expires: time.Now().Add(a.ttl).Unix()})
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name: sessionCookie, Value: payload + "." + a.sign(payload), Path: "/",
+		MaxAge: int(a.ttl.Seconds()), HttpOnly: true, Secure: r.TLS != nil, SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// loginHandler 处理 /auth/login?next=，记下 state 后跳转到身份提供方
+func (a *oidcAuth) loginHandler(w http.ResponseWriter, r *http.Request) {
+	next := localRedirect(r.URL.Query().Get("next"))
+	b := make([]byte, 16)
+	rand.Read(b)
+	state := hex.EncodeToString(b)
+
+	// state 同时用作 OIDC 的 nonce，跳转目标跟在 state 后面一起放进 cookie
+	http.SetCookie(w, &http.Cookie{
+		Name: stateCookie, Value: state + ":" + base64.RawURLEncoding.EncodeToString([]byte(next)), Path: "/auth/",
+		MaxAge: 600, HttpOnly: true, Secure: r.TLS != nil, SameSite: http.SameSiteLaxMode,
+	})
+	var opts []oauth2.AuthCodeOption
+	if a.verifier != nil {
+		opts = append(opts, oidc.Nonce(state))
+	}
+	http.Redirect(w, r, a.oauth.AuthCodeURL(state, opts...), http.StatusFound)
+}
+
+// callbackHandler 处理 /auth/callback，校验 state，换取令牌并写入 session cookie
+func (a *oidcAuth) callbackHandler(w http.ResponseWriter, r *http.Request) {
+	c, err := r.Cookie(stateCookie)
+	if err != nil {
+		http.Error(w, "Login expired, please try again", http.StatusBadRequest)
+		return
+	}
+	state, encodedNext, _ := strings.Cut(c.Value, ":")
+	if r.URL.Query().Get("state") != state {
+		http.Error(w, "Invalid login state", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: "/auth/", MaxAge: -1})
+	if e := r.URL.Query().Get("error"); e != "" {
+		http.Error(w, "Login failed: "+e, http.StatusUnauthorized)
+		return
+	}
+
+	token, err := a.oauth.Exchange(r.Context(), r.URL.Query().Get("code"))
+	if err != nil {
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		log.Printf("OIDC code exchange failed: %v", err)
+		return
+	}
+	var u *user
+	if a.verifier != nil {
+		u, err = a.idTokenUser(r.Context(), token, state)
+	} else {
+		u, err = a.githubUser(r.Context(), token)
+	}
+	if err != nil {
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		log.Printf("OIDC login failed: %v", err)
+		return
+	}
+
+	a.setSession(w, r, u)
+	next := "/"
+	if b, err := base64.RawURLEncoding.DecodeString(encodedNext); err == nil {
+		next = localRedirect(string(b))
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// logoutHandler 处理 /auth/logout，只清除本地 session，不退出身份提供方
+func (a *oidcAuth) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// idTokenUser 校验 ID Token，并按配置取出用户名和组
+func (a *oidcAuth) idTokenUser(ctx context.Context, token *oauth2.Token, nonce string) (*user, error) {
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("no id_token in token response")
+	}
+	idToken, err := a.verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("nonce mismatch")
+	}
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	if v, ok := claims["email_verified"].(bool); ok && !v && a.cfg.UserClaim == "email" {
+		return nil, errors.New("email not verified")
+	}
+	name, _ := claims[a.cfg.UserClaim].(string)
+	if name == "" {
+		return nil, fmt.Errorf("claim %q missing", a.cfg.UserClaim)
+	}
+	u := &user{Name: name}
+	switch g := claims[a.cfg.GroupsClaim].(type) {
+	case []any:
+		for _, v := range g {
+			if s, ok := v.(string); ok {
+				u.Groups = append(u.Groups, s)
+			}
+		}
+	case string:
+		u.Groups = strings.Fields(g)
+	}
+	return u, nil
+}
+
+// githubUser 用 GitHub 的接口取登录名，所属组织作为组
+func (a *oidcAuth) githubUser(ctx context.Context, token *oauth2.Token) (*user, error) {
+	client := a.oauth.Client(ctx, token)
+	var profile struct {
+		Login string `json:"login"`
+	}
+	if err := getJSON(client, "https://api.github.com/user", &profile); err != nil {
+		return nil, err
+	}
+	if profile.Login == "" {
+		return nil, errors.New("github: empty login")
+	}
+	var orgs []struct {
+		Login string `json:"login"`
+	}
+	if err := getJSON(client, "https://api.github.com/user/orgs", &orgs); err != nil {
+		return nil, err
+	}
+	u := &user{Name: profile.Login}
+	for _, o := range orgs {
+		u.Groups = append(u.Groups, o.Login)
+	}
+	return u, nil
+}
+
+func getJSON(client *http.Client, url string, v any) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
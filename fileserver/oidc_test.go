@@ -0,0 +1,86 @@
+package fileserver
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestOIDCLoginRedirect(t *testing.T) {
+	config := writeConfig(t, `{"oidc":{"provider":"github","client_id":"id","redirect_url":"http://example.com/auth/callback"}}`)
+	h := newTestHandler(t, Config{Root: newTestRoot(t), ConfigFile: config})
+
+	for next, want := range map[string]string{
+		"/sub/":          "/sub/",
+		"//evil.example": "/",
+		`/\evil.example`: "/",
+		"https://evil/":  "/",
+	} {
+		res, _ := do(t, h, httptest.NewRequest("GET", "/auth/login?next="+url.QueryEscape(next), nil))
+		if res.StatusCode != http.StatusFound || !strings.HasPrefix(res.Header.Get("Location"), "https://github.com/") {
+			t.Fatalf("login: status = %d, Location = %q", res.StatusCode, res.Header.Get("Location"))
+		}
+		var saved string
+		for _, c := range res.Cookies() {
+			if c.Name == stateCookie {
+				_, encoded, _ := strings.Cut(c.Value, ":")
+				b, _ := base64.RawURLEncoding.DecodeString(encoded)
+				saved = string(b)
+			}
+		}
+		if saved != want {
+			t.Errorf("next=%q: saved %q, want %q", next, saved, want)
+		}
+	}
+}
+
+func TestOIDCSession(t *testing.T) {
+	config := writeConfig(t, `{
+		"require_auth": true,
+		"oidc": {"provider": "github", "client_id": "id", "redirect_url": "http://example.com/auth/callback"},
+		"acl": [{"path": "/sub/**", "users": ["@staff"], "action": "allow"}, {"path": "/sub/**", "users": ["*"], "action": "deny"}]
+	}`)
+	h := newTestHandler(t, Config{Root: newTestRoot(t), ConfigFile: config})
+	login := func(u *user) *http.Cookie {
+		w := httptest.NewRecorder()
+		h.s.oidc.setSession(w, httptest.NewRequest("GET", "/auth/callback", nil), u)
+		return w.Result().Cookies()[0]
+	}
+	get := func(p string, c *http.Cookie) int {
+		r := httptest.NewRequest("GET", p, nil)
+		if c != nil {
+			r.AddCookie(c)
+		}
+		res, _ := do(t, h, r)
+		return res.StatusCode
+	}
+
+	staff := login(&user{Name: "alice", Groups: []string{"staff"}})
+	guest := login(&user{Name: "bob"})
+	if got := get("/download/a.txt", nil); got == http.StatusOK {
+		t.Error("anonymous request was allowed")
+	}
+	if got := get("/download/sub/b.txt", staff); got != http.StatusOK {
+		t.Errorf("staff: status = %d", got)
+	}
+	if got := get("/download/sub/b.txt", guest); got != http.StatusForbidden {
+		t.Errorf("guest: status = %d, want 403", got)
+	}
+	// 改动 cookie 中的组后签名不再匹配
+	payload, sig, _ := strings.Cut(guest.Value, ".")
+	b, _ := base64.RawURLEncoding.DecodeString(payload)
+	forged := strings.Replace(string(b), `"n":"bob"`, `"n":"bob","g":["staff"]`, 1)
+	guest.Value = base64.RawURLEncoding.EncodeToString([]byte(forged)) + "." + sig
+	if got := get("/download/sub/b.txt", guest); got == http.StatusOK {
+		t.Error("forged session cookie was accepted")
+	}
+
+	r := httptest.NewRequest("GET", "/auth/callback?state=other&code=x", nil)
+	r.AddCookie(&http.Cookie{Name: stateCookie, Value: "expected:Lw"})
+	if res, _ := do(t, h, r); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("callback with wrong state: status = %d, want 400", res.StatusCode)
+	}
+}
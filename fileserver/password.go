@@ -0,0 +1,132 @@
+package fileserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 目录密码：目录下放一个 .password 文件（第一行为密码，也可以写成 sha256:<十六进制摘要>），
+// 或者通过 -protect /path=password 声明。访问该目录及其子目录下的任何内容之前都要先输入密码，
+// 验证通过后在 cookie 中保存签名，与全局的用户认证相互独立
+
+const passwordFile = ".password"
+
+// PasswordData 是密码输入页面的数据
+type PasswordData struct {
+	Page
+	Dir   string // 受保护的目录
+	Next  string // 验证通过后跳转的地址
+	Wrong bool   // 上一次输入的密码错误
+}
+
+// dirPassword 返回目录 dir（相对根目录）的密码，没有设置时返回空
+func (s *server) dirPassword(dir string) string {
+	if pw, ok := s.protected[foldPath(dir)]; ok {
+		return pw
+	}
+	b, err := s.readFile(path.Join(dir, passwordFile))
+	if err != nil {
+		return ""
+	}
+	pw, _, _ := strings.Cut(string(b), "\n")
+	return strings.TrimSpace(pw)
+}
+
+// checkPassword 比较用户输入和设置的密码，支持 sha256: 前缀的摘要形式和用户库使用的 bcrypt 摘要
+func checkPassword(want, got string) bool {
+	if strings.HasPrefix(want, "$2a$") || strings.HasPrefix(want, "$2b$") || strings.HasPrefix(want, "$2y$") {
+		return bcrypt.CompareHashAndPassword([]byte(want), []byte(got)) == nil
+	}
+	if digest, ok := strings.CutPrefix(want, "sha256:"); ok {
+		sum := sha256.Sum256([]byte(got))
+		return subtle.ConstantTimeCompare([]byte(strings.ToLower(digest)), []byte(hex.EncodeToString(sum[:]))) == 1
+	}
+	return subtle.ConstantTimeCompare([]byte(want), []byte(got)) == 1
+}
+
+// unlockCookie 返回目录的 cookie 名和值，密码修改后旧的 cookie 自动失效
+func (s *server) unlockCookie(dir, password string) (string, string) {
+	dir = foldPath(dir)
+	name := sha256.Sum256([]byte(dir))
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(dir + "\x00" + password))
+	return "dirpw_" + hex.EncodeToString(name[:8]), hex.EncodeToString(mac.Sum(nil))
+}
+
+// lockedDir 从根目录开始逐级检查 p 的上级目录，返回第一个还没有解锁的受保护目录
+func (s *server) lockedDir(r *http.Request, p string) (string, bool) {
+	dir := "/"
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	for i := 0; ; i++ {
+		if pw := s.dirPassword(dir); pw != "" {
+			name, value := s.unlockCookie(dir, pw)
+			c, err := r.Cookie(name)
+			if err != nil || !hmac.Equal([]byte(c.Value), []byte(value)) {
+				return dir, true
+			}
+		}
+		if i >= len(parts) || parts[i] == "" {
+			return "", false
+		}
+		dir = path.Join(dir, parts[i])
+	}
+}
+
+// protect 在所有处理函数之前检查目录密码
+func (s *server) protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/unlock" {
+			s.unlockHandler(w, r)
+			return
+		}
+
+		p, ok := targetPath(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// 密码文件、未完成的上传等程序自己使用的文件永远不能被访问
+		if isHidden(p) {
+			s.httpError(w, r, http.StatusNotFound, "File not found")
+			return
+		}
+		if dir, locked := s.lockedDir(r, p); locked {
+			s.renderStatus(w, http.StatusUnauthorized, "password.html", PasswordData{Page: s.page(w, r), Dir: dir, Next: r.URL.RequestURI()})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// unlockHandler 处理密码输入表单，验证通过后写入 cookie 并跳回原来的页面
+func (s *server) unlockHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		s.httpError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	dir := path.Clean("/" + r.FormValue("dir"))
+	next := localRedirect(r.FormValue("next"))
+
+	pw := s.dirPassword(dir)
+	if pw == "" {
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	}
+	if !checkPassword(pw, r.FormValue("password")) {
+		s.renderStatus(w, http.StatusUnauthorized, "password.html", PasswordData{Page: s.page(w, r), Dir: dir, Next: next, Wrong: true})
+		return
+	}
+
+	name, value := s.unlockCookie(dir, pw)
+	http.SetCookie(w, &http.Cookie{Name: name, Value: value, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
@@ -0,0 +1,67 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func unlock(t *testing.T, h http.Handler, dir, password, next string) *http.Response {
+	t.Helper()
+	form := url.Values{"dir": {dir}, "password": {password}, "next": {next}}
+	r := httptest.NewRequest("POST", "/api/unlock", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, _ := do(t, h, r)
+	return res
+}
+
+func TestProtectedDir(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t), Protect: map[string]string{"/sub": "pw"}})
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/download/sub/b.txt", nil)); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("locked download: status = %d, want 401", res.StatusCode)
+	}
+	if res := unlock(t, h, "/sub", "wrong", "/sub/"); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong password: status = %d, want 401", res.StatusCode)
+	}
+	res := unlock(t, h, "/sub", "pw", "/sub/")
+	if res.StatusCode != http.StatusSeeOther || len(res.Cookies()) != 1 {
+		t.Fatalf("unlock: status = %d, cookies = %v", res.StatusCode, res.Cookies())
+	}
+	r := httptest.NewRequest("GET", "/download/sub/b.txt", nil)
+	r.AddCookie(res.Cookies()[0])
+	if res, body := do(t, h, r); res.StatusCode != http.StatusOK || body != "world" {
+		t.Errorf("unlocked download: got %d %q", res.StatusCode, body)
+	}
+}
+
+func TestUnlockRedirect(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t), Protect: map[string]string{"/sub": "pw"}})
+	for next, want := range map[string]string{
+		"/sub/b.txt?x=1":        "/sub/b.txt?x=1",
+		"//evil.example":        "/",
+		`/\evil.example`:        "/",
+		`/\/evil.example`:       "/",
+		"https://evil.example/": "/",
+		"/\t/evil.example":      "/",
+		"evil.example":          "/",
+		"":                      "/",
+	} {
+		res := unlock(t, h, "/sub", "pw", next)
+		if loc := res.Header.Get("Location"); loc != want {
+			t.Errorf("next=%q: Location = %q, want %q", next, loc, want)
+		}
+	}
+}
+
+func TestProtectedDirCase(t *testing.T) {
+	defer func(v bool) { caseInsensitive = v }(caseInsensitive)
+	caseInsensitive = true
+	h := newTestHandler(t, Config{Root: newTestRoot(t), Protect: map[string]string{"/Sub": "pw"}})
+	for _, p := range []string{"/sub/", "/SUB/", "/Sub/"} {
+		if res, _ := do(t, h, httptest.NewRequest("GET", p, nil)); res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want 401", p, res.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package fileserver
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// PDF 在线查看：/view/ 打开 PDF 时渲染一个阅读页面，用浏览器内置的 PDF 阅读器显示 ?raw=1 的原文，
+// 页面上可以翻页、跳到指定页，?page=N 打开时直接定位到第 N 页，地址可以直接发给别人。
+// 原文带着 Content-Type: application/pdf 和 Content-Disposition: inline 返回，支持 Range 请求，
+// 阅读器可以先显示前几页，不用等整个文件下载完
+
+func isPDF(name string) bool {
+	return strings.EqualFold(path.Ext(name), ".pdf")
+}
+
+// PDFData 是 PDF 阅读页面的数据
+type PDFData struct {
+	Page
+	Name     string
+	Src      string // 原文地址
+	Download string
+	Parent   string
+	Start    int // 打开时显示的页码
+}
+
+// pdfHandler 渲染 PDF 阅读页面，PDF 本身通过 ?raw=1 获取
+func (s *server) pdfHandler(w http.ResponseWriter, r *http.Request, decodedPath string) {
+	escaped := r.URL.EscapedPath()
+	data := PDFData{
+		Page:     s.page(w, r),
+		Name:     path.Base(decodedPath),
+		Src:      s.base + escaped + "?raw=1",
+		Download: s.base + "/download" + strings.TrimPrefix(escaped, "/view"),
+		Parent:   s.base + parentDir(decodedPath),
+		Start:    1,
+	}
+	if n, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && n > 1 {
+		data.Start = n
+	}
+	s.render(w, "pdf.html", data)
+}
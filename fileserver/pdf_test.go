@@ -0,0 +1,36 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPDFViewer(t *testing.T) {
+	root := newTestRoot(t)
+	// 文件头前面有多余的字节，嗅探不出是 PDF
+	os.WriteFile(filepath.Join(root, "sub", "手册.pdf"), []byte("\n\n%PDF-1.4\n%%EOF"), 0644)
+	h := newTestHandler(t, Config{Root: root})
+
+	res, body := do(t, h, httptest.NewRequest("GET", "/view/sub/%E6%89%8B%E5%86%8C.pdf?page=3", nil))
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, `src="/view/sub/%E6%89%8B%E5%86%8C.pdf?raw=1#page=3"`) || !strings.Contains(body, `value="3"`) {
+		t.Fatalf("viewer: got %d %s", res.StatusCode, body)
+	}
+
+	res, body = do(t, h, httptest.NewRequest("GET", "/view/sub/%E6%89%8B%E5%86%8C.pdf?raw=1", nil))
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, "%PDF") {
+		t.Fatalf("raw: got %d %q", res.StatusCode, body)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "application/pdf" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cd := res.Header.Get("Content-Disposition"); !strings.HasPrefix(cd, "inline;") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	if res.Header.Get("Accept-Ranges") != "bytes" {
+		t.Errorf("raw PDF does not accept ranges: %v", res.Header)
+	}
+}
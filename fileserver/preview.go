@@ -0,0 +1,150 @@
+package fileserver
+
+import (
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// 在线查看（/view/）的预览渲染器按扩展名、文件名或 MIME 类型注册，内置的 Markdown、源码高亮也是这样注册的。
+// 第三方可以用 RegisterPreview 或 Config.Previews 加入 HEIC、DICOM、parquet 等格式，不需要修改 viewHandler。
+// 音视频由播放页面处理，不经过这里
+
+// PreviewRenderer 把文件渲染成预览页面中的 HTML 片段
+type PreviewRenderer interface {
+	// RenderPreview 读取文件内容生成 HTML，返回的内容直接嵌入页面，不会再转义。
+	// 返回 ErrNoPreview（例如文件过大）或其他错误时，按原文输出文件
+	RenderPreview(name string, info fs.FileInfo, src io.Reader) (template.HTML, error)
+}
+
+// PreviewFunc 让普通函数实现 PreviewRenderer
+type PreviewFunc func(name string, info fs.FileInfo, src io.Reader) (template.HTML, error)
+
+func (f PreviewFunc) RenderPreview(name string, info fs.FileInfo, src io.Reader) (template.HTML, error) {
+	return f(name, info, src)
+}
+
+// ErrNoPreview 表示文件不适合预览，由调用方按原文输出
+var ErrNoPreview = errors.New("no preview for this file")
+
+var (
+	previewMu sync.RWMutex
+	previews  = make(map[string]PreviewRenderer)
+)
+
+// RegisterPreview 为 match 注册预览渲染器，通常在 init 中调用，后注册的覆盖先注册的。
+// match 可以是扩展名（.heic）、文件名（Dockerfile）、MIME 类型（image/heic）或某一大类（image/*）
+func RegisterPreview(match string, r PreviewRenderer) {
+	previewMu.Lock()
+	defer previewMu.Unlock()
+	previews[previewKey(match)] = r
+}
+
+// previewKey 扩展名和 MIME 类型不区分大小写，文件名区分
+func previewKey(match string) string {
+	if strings.HasPrefix(match, ".") || strings.Contains(match, "/") {
+		return strings.ToLower(match)
+	}
+	return match
+}
+
+// previewFor 查找 name 使用的渲染器，依次匹配扩展名、文件名、MIME 类型、MIME 大类，Config.Previews 优先于全局注册的
+func (s *server) previewFor(name string) PreviewRenderer {
+	keys := []string{strings.ToLower(path.Ext(name)), name}
+	if t := mediaType(name, ""); t != "" {
+		t, _, _ = strings.Cut(t, ";")
+		major, _, _ := strings.Cut(t, "/")
+		keys = append(keys, strings.ToLower(t), strings.ToLower(major)+"/*")
+	}
+	previewMu.RLock()
+	defer previewMu.RUnlock()
+	for _, k := range keys {
+		if k == "" {
+			continue
+		}
+		if r, ok := s.previews[k]; ok {
+			return r
+		}
+		if r, ok := previews[k]; ok {
+			return r
+		}
+	}
+	return nil
+}
+
+// previewHandler 用渲染器生成预览页面，渲染失败时返回 false，由调用方按原文输出
+func (s *server) previewHandler(w http.ResponseWriter, r *http.Request, decodedPath string, info fs.FileInfo, pr PreviewRenderer) bool {
+	f, err := s.open(decodedPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	content, err := pr.RenderPreview(info.Name(), info, f)
+	if err != nil {
+		if !errors.Is(err, ErrNoPreview) {
+			log.Printf("Failed to render preview of %s: %v", decodedPath, err)
+		}
+		return false
+	}
+
+	data := DocumentData{
+		Page:     s.page(w, r),
+		Name:     path.Base(decodedPath),
+		Download: s.base + "/download" + strings.TrimPrefix(r.URL.EscapedPath(), "/view"),
+		Parent:   s.base + parentDir(decodedPath),
+		Content:  content,
+	}
+	name := "preview.html"
+	if b, ok := pr.(builtinPreview); ok {
+		name = b.tpl
+	}
+	s.render(w, name, data)
+	return true
+}
+
+// builtinPreview 是内置的渲染器，整个文件读入内存后渲染，使用各自的页面模板
+type builtinPreview struct {
+	maxSize int64
+	tpl     string
+	render  func(name string, src []byte) (template.HTML, error)
+}
+
+func (b builtinPreview) RenderPreview(name string, info fs.FileInfo, src io.Reader) (template.HTML, error) {
+	if info.Size() > b.maxSize {
+		return "", ErrNoPreview
+	}
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return "", err
+	}
+	return b.render(name, data)
+}
+
+func init() {
+	// Markdown 渲染成网页
+	markdown := builtinPreview{maxSize: maxMarkdownSize, tpl: "markdown.html", render: func(_ string, src []byte) (template.HTML, error) {
+		return renderMarkdown(src)
+	}}
+	RegisterPreview(".md", markdown)
+	RegisterPreview(".markdown", markdown)
+
+	// 源码高亮显示
+	code := builtinPreview{maxSize: maxHighlightSize, tpl: "code.html", render: highlight}
+	for ext := range codeExts {
+		RegisterPreview(ext, code)
+	}
+	for name := range codeNames {
+		RegisterPreview(name, code)
+	}
+
+	// JSON、XML 格式化成可以折叠的树
+	tree := builtinPreview{maxSize: maxTreeSize, tpl: "tree.html", render: renderTree}
+	RegisterPreview(".json", tree)
+	RegisterPreview(".xml", tree)
+}
@@ -0,0 +1,47 @@
+package fileserver
+
+import (
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPreviewRenderer(t *testing.T) {
+	fsys := fstest.MapFS{
+		"photo.heic":  {Data: []byte("heic data")},
+		"big.heic":    {Data: []byte(strings.Repeat("x", 100))},
+		"notes.md":    {Data: []byte("# Notes")},
+		"Jenkinsfile": {Data: []byte("pipeline {}")},
+		"data.csv":    {Data: []byte("a,b")},
+	}
+	heic := PreviewFunc(func(name string, info fs.FileInfo, src io.Reader) (template.HTML, error) {
+		if info.Size() > 50 {
+			return "", ErrNoPreview
+		}
+		b, _ := io.ReadAll(src)
+		return template.HTML("<figure>" + template.HTMLEscapeString(string(b)) + "</figure>"), nil
+	})
+	h := newTestHandler(t, Config{FS: fsys}, WithPreview(".HEIC", heic),
+		WithPreview("text/*", PreviewFunc(func(string, fs.FileInfo, io.Reader) (template.HTML, error) {
+			return "<table></table>", nil
+		})))
+
+	for _, c := range []struct{ path, want string }{
+		{"/view/photo.heic", "<figure>heic data</figure>"},
+		{"/view/big.heic", strings.Repeat("x", 100)},
+		{"/view/notes.md", "<h1>Notes</h1>"},
+		{"/view/Jenkinsfile", `class="chroma"`},
+		{"/view/data.csv", "<table></table>"},
+		{"/view/photo.heic?raw=1", "heic data"},
+	} {
+		res, body := do(t, h, httptest.NewRequest("GET", c.path, nil))
+		if res.StatusCode != http.StatusOK || !strings.Contains(body, c.want) {
+			t.Errorf("%s: status = %d, body does not contain %q", c.path, res.StatusCode, c.want)
+		}
+	}
+}
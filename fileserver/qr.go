@@ -0,0 +1,56 @@
+package fileserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// qrHandler 生成指向本服务某个地址的二维码，/qr?target=/download/a.zip[&format=svg]
+func (s *server) qrHandler(w http.ResponseWriter, r *http.Request) {
+	// 只允许本站路径，避免被用来给任意网址生成二维码
+	target, err := url.Parse(r.URL.Query().Get("target"))
+	if err != nil || target.Scheme != "" || target.Host != "" || !strings.HasPrefix(target.Path, "/") {
+		http.Error(w, "Invalid target", http.StatusBadRequest)
+		return
+	}
+
+	// 重新转义路径，目录链接中可能带有空格、中文等字符
+	q, err := qrcode.New(s.origin(r)+target.RequestURI(), qrcode.Medium)
+	if err != nil {
+		http.Error(w, "Target too long", http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "svg" {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		writeQRSVG(w, q.Bitmap())
+		return
+	}
+
+	png, err := q.PNG(256)
+	if err != nil {
+		http.Error(w, "Failed to render QR code", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(png)
+}
+
+// writeQRSVG 把二维码点阵输出为 SVG，每个黑色模块是一个 1x1 的方块
+func writeQRSVG(w http.ResponseWriter, bitmap [][]bool) {
+	n := len(bitmap)
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, n, n)
+	fmt.Fprintf(w, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range bitmap {
+		for x, black := range row {
+			if black {
+				fmt.Fprintf(w, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	fmt.Fprint(w, `"/></svg>`)
+}
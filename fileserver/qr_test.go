@@ -0,0 +1,26 @@
+package fileserver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestQRCode(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)})
+	res, body := do(t, h, httptest.NewRequest("GET", "/qr?target=/download/a.txt", nil))
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "image/png" || !bytes.HasPrefix([]byte(body), []byte("\x89PNG")) {
+		t.Errorf("png: status = %d, type = %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	res, body = do(t, h, httptest.NewRequest("GET", "/qr?format=svg&target=/sub/", nil))
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(body, "<svg") {
+		t.Errorf("svg: status = %d", res.StatusCode)
+	}
+	for _, target := range []string{"https://evil.example/", "//evil.example/x", "relative"} {
+		if res, _ := do(t, h, httptest.NewRequest("GET", "/qr?target="+target, nil)); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("target %q: status = %d, want 400", target, res.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package fileserver
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+)
+
+// 重新加载配置：配置文件中的用户、LDAP、访问控制规则、管理员、Cache-Control 规则、MIME 类型和 webhook 可以在运行时重新读取，
+// 不用重启服务（管理页面上的“重新加载配置”）。OIDC 和 JWT 设置只在启动时读取，修改后需要重启
+
+// access 是可以重新加载的设置，重新加载时整个替换，处理请求时通过 s.conf() 读取当前的设置
+type access struct {
+	auth        []authenticator // 依次尝试的用户认证方式
+	requireAuth bool            // 所有请求都必须登录
+	acl         []aclRule       // 访问控制规则
+	admins      []string        // 管理员，写法同 aclRule.Users
+	cacheRules  []cacheRule     // Cache-Control 规则
+
+	mimeTypes map[string]string // 扩展名（小写，带点）对应的 Content-Type
+}
+
+// conf 返回当前的设置
+func (s *server) conf() *access {
+	return s.access.Load()
+}
+
+// merge 把配置文件 fc 合并到来自 Config 的设置上
+func (s *server) merge(fc *fileConfig) (*access, error) {
+	// Clip 保证 append 不会改动 s.flags 的底层数组
+	a := &access{
+		auth:        append(slices.Clip(s.flags.auth), localUsers(fc.Users)),
+		requireAuth: s.flags.requireAuth || fc.RequireAuth,
+		acl:         fc.ACL,
+		admins:      append(slices.Clip(s.flags.admins), fc.Admins...),
+		cacheRules:  append(slices.Clip(s.flags.cacheRules), fc.Cache...),
+		mimeTypes:   s.flags.mimeTypes,
+	}
+	if len(fc.MimeTypes) > 0 {
+		// 同一个扩展名以命令行参数为准
+		a.mimeTypes = make(map[string]string)
+		for ext, typ := range fc.MimeTypes {
+			a.mimeTypes[normalizeExt(ext)] = typ
+		}
+		maps.Copy(a.mimeTypes, s.flags.mimeTypes)
+	}
+	if fc.LDAP != nil {
+		la, err := newLDAPAuth(fc.LDAP)
+		if err != nil {
+			return nil, err
+		}
+		a.auth = append(a.auth, la)
+	}
+	return a, nil
+}
+
+// reload 重新读取配置文件，有错误时保留原来的设置
+func (s *server) reload() error {
+	if s.configFile == "" {
+		return fmt.Errorf("no config file, start the server with -config")
+	}
+	fc, err := loadConfig(s.configFile)
+	if err != nil {
+		return err
+	}
+	a, err := s.merge(fc)
+	if err != nil {
+		return err
+	}
+	s.access.Store(a)
+	s.webhooks.set(fc.Webhooks)
+	log.Printf("Reloaded config: %s (%d users, %d acl rules)\n", s.configFile, len(fc.Users), len(fc.ACL))
+	return nil
+}
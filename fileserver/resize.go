@@ -0,0 +1,291 @@
+package fileserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// 缩放图片：/view/ 下的 JPEG、PNG、GIF 带上 ?w=、?h=（最大宽高，保持比例，只缩小不放大）或 ?quality=（JPEG 质量，1 到 100）
+// 时返回缩放后的图片，相册和远程客户端浏览照片时不用下载 12 MP 的原图。生成的图片保存在 -image-cache 目录中，
+// 原图没变时直接返回缓存；原图的修改时间或大小变了，缓存的键跟着变，旧的缓存不会再用到。
+// 缩放时按 EXIF 的方向旋转，GIF 只取第一帧，输出为 PNG
+
+// 缩放参数的上限
+const (
+	maxResizeSide   = 4096
+	maxResizePixels = 100 << 20 // 原图超过这么多像素时不缩放，避免解码时占用太多内存
+	defaultQuality  = 85
+)
+
+var errResize = errors.New("invalid resize parameters")
+
+// resizeSlots 限制同时缩放的图片数，解码大图很占内存和 CPU
+var resizeSlots = make(chan struct{}, max(runtime.NumCPU()/2, 1))
+
+// resizeOptions 是请求中的缩放参数
+type resizeOptions struct {
+	width, height, quality int
+}
+
+// isResizable 判断 name 是否为可以缩放的图片格式
+func isResizable(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+	return false
+}
+
+// parseResize 读取 ?w=、?h=、?quality=，都没有时返回 false
+func parseResize(r *http.Request) (resizeOptions, bool, error) {
+	q := r.URL.Query()
+	if !q.Has("w") && !q.Has("h") && !q.Has("quality") {
+		return resizeOptions{}, false, nil
+	}
+	var o resizeOptions
+	for _, v := range []struct {
+		key      string
+		dst      *int
+		min, max int
+	}{{"w", &o.width, 1, maxResizeSide}, {"h", &o.height, 1, maxResizeSide}, {"quality", &o.quality, 1, 100}} {
+		s := q.Get(v.key)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < v.min || n > v.max {
+			return o, true, fmt.Errorf("%w: %s must be between %d and %d", errResize, v.key, v.min, v.max)
+		}
+		*v.dst = n
+	}
+	if o.quality == 0 {
+		o.quality = defaultQuality
+	}
+	return o, true, nil
+}
+
+// fitSize 返回 w×h 的图片缩小到不超过 maxW×maxH（为 0 表示不限制）后的大小，保持比例，不放大
+func fitSize(w, h, maxW, maxH int) (int, int) {
+	scale := 1.0
+	if maxW > 0 && w > maxW {
+		scale = float64(maxW) / float64(w)
+	}
+	if maxH > 0 && h > maxH {
+		scale = min(scale, float64(maxH)/float64(h))
+	}
+	return max(int(float64(w)*scale+0.5), 1), max(int(float64(h)*scale+0.5), 1)
+}
+
+// resizeImage 用面积平均把 src 缩小到 w×h，缩小照片时比只取最近的像素清晰得多
+func resizeImage(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	rgba, ok := src.(*image.RGBA)
+	if !ok || b.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	}
+	sw, sh := b.Dx(), b.Dy()
+	if sw == w && sh == h {
+		return rgba
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for dy := 0; dy < h; dy++ {
+		y0, y1 := dy*sh/h, max((dy+1)*sh/h, dy*sh/h+1)
+		for dx := 0; dx < w; dx++ {
+			x0, x1 := dx*sw/w, max((dx+1)*sw/w, dx*sw/w+1)
+			var r, g, bl, a, n uint64
+			for y := y0; y < y1; y++ {
+				row := rgba.Pix[y*rgba.Stride+x0*4 : y*rgba.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += uint64(row[i])
+					g += uint64(row[i+1])
+					bl += uint64(row[i+2])
+					a += uint64(row[i+3])
+					n++
+				}
+			}
+			p := dst.Pix[dy*dst.Stride+dx*4:]
+			p[0], p[1], p[2], p[3] = uint8(r/n), uint8(g/n), uint8(bl/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// orient 按 EXIF 的方向 o 翻转、旋转图片，得到正常显示的方向
+func orient(img *image.RGBA, o int) *image.RGBA {
+	if o <= 1 || o > 8 {
+		return img
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		for dx := 0; dx < dw; dx++ {
+			// 目标像素 (dx, dy) 对应的原图像素
+			var sx, sy int
+			switch o {
+			case 2:
+				sx, sy = w-1-dx, dy
+			case 3:
+				sx, sy = w-1-dx, h-1-dy
+			case 4:
+				sx, sy = dx, h-1-dy
+			case 5:
+				sx, sy = dy, dx
+			case 6:
+				sx, sy = dy, h-1-dx
+			case 7:
+				sx, sy = w-1-dy, h-1-dx
+			case 8:
+				sx, sy = w-1-dy, dx
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], img.Pix[sy*img.Stride+sx*4:])
+		}
+	}
+	return dst
+}
+
+// renderResized 解码原图 src，缩放并编码成 JPEG（原图是 JPEG 时）或 PNG
+func renderResized(src io.ReadSeeker, name string, o resizeOptions) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(src)
+	if err != nil {
+		return nil, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxResizePixels {
+		return nil, fmt.Errorf("%w: image is too large", errResize)
+	}
+	orientation := 1
+	if isJPEG(name) {
+		src.Seek(0, io.SeekStart)
+		orientation = jpegOrientation(src)
+	}
+	src.Seek(0, io.SeekStart)
+	var img image.Image
+	if strings.EqualFold(path.Ext(name), ".gif") {
+		img, err = gif.Decode(src)
+	} else {
+		img, _, err = image.Decode(src)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 最大宽高按旋转后的方向计算
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if orientation >= 5 {
+		dw, dh := fitSize(h, w, o.width, o.height)
+		w, h = dh, dw
+	} else {
+		w, h = fitSize(w, h, o.width, o.height)
+	}
+	out := orient(resizeImage(img, w, h), orientation)
+
+	var buf bytes.Buffer
+	if isJPEG(name) {
+		err = jpeg.Encode(&buf, out, &jpeg.Options{Quality: o.quality})
+	} else {
+		err = png.Encode(&buf, out)
+	}
+	return buf.Bytes(), err
+}
+
+// resizedType 返回缩放后的图片的 Content-Type 和缓存文件的扩展名
+func resizedType(name string) (string, string) {
+	if isJPEG(name) {
+		return "image/jpeg", ".jpg"
+	}
+	return "image/png", ".png"
+}
+
+// resizeHandler 返回原图 p 缩放后的图片，先查缓存，没有时生成并保存
+func (s *server) resizeHandler(w http.ResponseWriter, r *http.Request, p string, info fs.FileInfo, o resizeOptions) {
+	// 缓存的键包含原图的路径、修改时间、大小和缩放参数
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%d\x00%d\x00%d\x00%d", p, info.ModTime().UnixNano(), info.Size(), o.width, o.height, o.quality)))
+	key := hex.EncodeToString(sum[:16])
+	contentType, ext := resizedType(p)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+key+`"`)
+
+	var cached string
+	if s.imageCache != "" {
+		cached = filepath.Join(s.imageCache, key[:2], key+ext)
+		if f, err := os.Open(cached); err == nil {
+			defer f.Close()
+			http.ServeContent(w, r, "", info.ModTime(), f)
+			return
+		}
+	}
+
+	f, err := s.open(p)
+	if err != nil {
+		s.pathError(w, r, err)
+		return
+	}
+	defer f.Close()
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		// 远程文件系统不能 Seek，读到内存中
+		b, err := io.ReadAll(f)
+		if err != nil {
+			s.httpError(w, r, http.StatusInternalServerError, "Failed to read image")
+			return
+		}
+		rs = bytes.NewReader(b)
+	}
+	resizeSlots <- struct{}{}
+	data, err := renderResized(rs, p, o)
+	<-resizeSlots
+	if err != nil {
+		s.httpError(w, r, http.StatusUnprocessableEntity, "Failed to resize image")
+		return
+	}
+	if cached != "" {
+		if err := writeCacheFile(cached, data); err != nil {
+			log.Printf("Failed to cache resized image %s: %v", p, err)
+		}
+	}
+	http.ServeContent(w, r, "", info.ModTime(), bytes.NewReader(data))
+}
+
+// writeCacheFile 先写临时文件再改名，同时请求同一张图片时不会读到写了一半的文件
+func writeCacheFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
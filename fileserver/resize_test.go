@@ -0,0 +1,77 @@
+package fileserver
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// halfImage 返回左半边红色、右半边蓝色的图片
+func halfImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, image.Rect(0, 0, w/2, h), image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(w/2, 0, w, h), image.NewUniform(color.RGBA{0, 0, 255, 255}), image.Point{}, draw.Src)
+	return img
+}
+
+func TestResizeImage(t *testing.T) {
+	root := newTestRoot(t)
+	var buf bytes.Buffer
+	png.Encode(&buf, halfImage(400, 200))
+	os.WriteFile(filepath.Join(root, "wide.png"), buf.Bytes(), 0644)
+	// 方向 6：原图要顺时针转 90 度才是正的，左边的红色转到上面
+	os.WriteFile(filepath.Join(root, "phone.jpg"), exifJPEG(t, halfImage(40, 20), []tiffTag{shortTag(tagOrientation, 6)}, nil, nil), 0644)
+	cache := t.TempDir()
+	h := newTestHandler(t, Config{Root: root, ImageCache: cache})
+	decode := func(p string) (image.Image, *http.Response) {
+		t.Helper()
+		res, body := do(t, h, httptest.NewRequest("GET", p, nil))
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: got %d %s", p, res.StatusCode, body)
+		}
+		img, _, err := image.Decode(bytes.NewReader([]byte(body)))
+		if err != nil {
+			t.Fatalf("%s: %v", p, err)
+		}
+		return img, res
+	}
+
+	img, res := decode("/view/wide.png?w=100")
+	if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 50 || res.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("w=100: got %v %s", b, res.Header.Get("Content-Type"))
+	}
+	if cached, _ := filepath.Glob(filepath.Join(cache, "*", "*.png")); len(cached) != 1 {
+		t.Errorf("cached files = %v", cached)
+	}
+	if img, _ := decode("/view/wide.png?w=100"); img.Bounds().Dx() != 100 {
+		t.Errorf("cached: got %v", img.Bounds())
+	}
+	// 只缩小不放大
+	if img, _ := decode("/view/wide.png?w=1000&h=100"); img.Bounds() != image.Rect(0, 0, 200, 100) {
+		t.Errorf("w=1000&h=100: got %v", img.Bounds())
+	}
+
+	img, res = decode("/view/phone.jpg?h=1000&quality=90")
+	if b := img.Bounds(); b.Dx() != 20 || b.Dy() != 40 || res.Header.Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("rotated: got %v %s", b, res.Header.Get("Content-Type"))
+	}
+	if r, _, b, _ := img.At(10, 5).RGBA(); r < b {
+		t.Errorf("rotated: top is not red: %v", img.At(10, 5))
+	}
+	if r, _, b, _ := img.At(10, 35).RGBA(); b < r {
+		t.Errorf("rotated: bottom is not blue: %v", img.At(10, 35))
+	}
+
+	for _, p := range []string{"/view/wide.png?w=0", "/view/wide.png?h=abc", "/view/phone.jpg?quality=101"} {
+		if res, _ := do(t, h, httptest.NewRequest("GET", p, nil)); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", p, res.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package fileserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 断点续传上传，参考 tus 协议的做法，只保留最核心的部分：
+//
+//	HEAD  /api/files/<路径>   返回 Upload-Offset（已收到的字节数）和 Upload-Length，没有未完成的上传时返回 404
+//	PATCH /api/files/<路径>   请求头 Upload-Offset 为本段的起始位置，Upload-Length 为文件总大小，请求体为本段内容
+//
+// 未完成的文件保存在根目录的 .uploads 下，连接断开后先 HEAD 查询进度，再从该位置继续 PATCH。
+// 最后一段写完后文件移动到目标位置，返回 201
+
+const uploadsDir = ".uploads"
+
+// 超过这个时间没有继续的上传会在下次上传时清理
+const partialTTL = 7 * 24 * time.Hour
+
+// partialUpload 是未完成上传的记录，和数据文件放在一起
+type partialUpload struct {
+	Path   string `json:"path"`
+	Length int64  `json:"length"`
+}
+
+// uploadLocks 保证同一个文件同时只有一个请求在追加数据，没有请求持有或等待时才删除，
+// 否则等待中的请求和新来的请求会拿到两把不同的锁
+var (
+	uploadLocksMu sync.Mutex
+	uploadLocks   = make(map[string]*uploadLock)
+)
+
+type uploadLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lockUpload 锁住数据文件 data，返回解锁函数
+func lockUpload(data string) func() {
+	uploadLocksMu.Lock()
+	l := uploadLocks[data]
+	if l == nil {
+		l = &uploadLock{}
+		uploadLocks[data] = l
+	}
+	l.refs++
+	uploadLocksMu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		uploadLocksMu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(uploadLocks, data)
+		}
+		uploadLocksMu.Unlock()
+	}
+}
+
+// partialFile 返回目标路径 p 对应的数据文件和记录文件
+func (s *server) partialFile(p string) (data, meta string) {
+	sum := sha256.Sum256([]byte(p))
+	base := s.root + "/" + uploadsDir + "/" + hex.EncodeToString(sum[:16])
+	return base, base + ".json"
+}
+
+// uploadStatus 处理 HEAD，返回上传进度
+func (s *server) uploadStatus(w http.ResponseWriter, p string) {
+	data, meta := s.partialFile(p)
+	pu, err := readPartial(meta)
+	info, err2 := os.Stat(data)
+	if err != nil || err2 != nil || pu.Path != p {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(info.Size(), 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(pu.Length, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// uploadChunk 处理 PATCH，把本段内容追加到未完成的文件中
+func (s *server) uploadChunk(w http.ResponseWriter, r *http.Request, p string) {
+	if p == "/" || isHidden(p) {
+		apiError(w, http.StatusForbidden, errBadName.Error())
+		return
+	}
+	if err := s.checkSymlinks(path.Dir(p)); err != nil {
+		fileError(w, err)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		apiError(w, http.StatusBadRequest, "missing or invalid Upload-Offset")
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		apiError(w, http.StatusBadRequest, "missing or invalid Upload-Length")
+		return
+	}
+	overwrite := r.URL.Query().Get("overwrite") != ""
+	if info, err := os.Stat(s.root + p); err == nil && (info.IsDir() || !overwrite) {
+		fileError(w, errFileExists)
+		return
+	}
+
+	data, meta := s.partialFile(p)
+	defer lockUpload(data)()
+	if offset == 0 {
+		if err := s.uploadAllowed(length); err != nil {
+			fileError(w, err)
+			return
+		}
+		s.cleanPartials()
+		if err := os.MkdirAll(path.Dir(data), 0755); err != nil {
+			fileError(w, err)
+			return
+		}
+		b, _ := json.Marshal(partialUpload{Path: p, Length: length})
+		if err := os.WriteFile(meta, b, 0644); err != nil {
+			fileError(w, err)
+			return
+		}
+		if err := os.WriteFile(data, nil, 0644); err != nil {
+			fileError(w, err)
+			return
+		}
+	}
+	pu, err := readPartial(meta)
+	if err != nil || pu.Path != p {
+		apiError(w, http.StatusNotFound, "no upload in progress, start from offset 0")
+		return
+	}
+	if pu.Length != length {
+		apiError(w, http.StatusBadRequest, "Upload-Length does not match the upload in progress")
+		return
+	}
+
+	f, err := os.OpenFile(data, os.O_WRONLY, 0)
+	if err != nil {
+		fileError(w, err)
+		return
+	}
+	defer f.Close()
+	size, _ := f.Seek(0, io.SeekEnd)
+	if size != offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(size, 10))
+		apiError(w, http.StatusConflict, "Upload-Offset does not match the received size")
+		return
+	}
+
+	// 连接中途断开时已经写入的部分仍然保留，下次从新的位置继续
+	n, err := io.Copy(f, io.LimitReader(r.Body, length-offset+1))
+	size = offset + n
+	if size > length {
+		f.Truncate(offset)
+		apiError(w, http.StatusBadRequest, "chunk exceeds Upload-Length")
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(size, 10))
+	if err != nil {
+		var maxBytes *http.MaxBytesError
+		if errors.As(err, &maxBytes) {
+			fileError(w, err)
+			return
+		}
+		apiError(w, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+	if size < length {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// 全部收到，移动到目标位置
+	f.Close()
+	if err := os.MkdirAll(path.Dir(s.root+p), 0755); err != nil {
+		fileError(w, err)
+		return
+	}
+	if err := s.replaceFile(data, p); err != nil {
+		fileError(w, err)
+		return
+	}
+	os.Remove(meta)
+	s.uploaded()
+	extracted, err := s.afterUpload(r, p)
+	if err != nil {
+		fileError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"path": p, "extracted": extracted})
+}
+
+func readPartial(meta string) (*partialUpload, error) {
+	b, err := os.ReadFile(meta)
+	if err != nil {
+		return nil, err
+	}
+	var pu partialUpload
+	if err := json.Unmarshal(b, &pu); err != nil {
+		return nil, err
+	}
+	return &pu, nil
+}
+
+// cleanPartials 删除长时间没有继续的上传
+func (s *server) cleanPartials() {
+	dir := s.root + "/" + uploadsDir
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && time.Since(info.ModTime()) > partialTTL {
+			os.Remove(dir + "/" + e.Name())
+		}
+	}
+}
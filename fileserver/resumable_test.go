@@ -0,0 +1,71 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestResumableUpload(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root}, WithReadWrite())
+	chunk := func(offset, body string) *http.Response {
+		r := httptest.NewRequest("PATCH", "/api/files/big.bin", strings.NewReader(body))
+		r.Header.Set("Upload-Offset", offset)
+		r.Header.Set("Upload-Length", "10")
+		res, _ := do(t, h, r)
+		return res
+	}
+	if res := chunk("0", "hello"); res.StatusCode >= 300 {
+		t.Fatalf("first chunk: status = %d", res.StatusCode)
+	}
+	res, _ := do(t, h, httptest.NewRequest("HEAD", "/api/files/big.bin", nil))
+	if res.Header.Get("Upload-Offset") != "5" {
+		t.Fatalf("Upload-Offset = %q, want 5", res.Header.Get("Upload-Offset"))
+	}
+	if res := chunk("3", "xx"); res.StatusCode != http.StatusConflict {
+		t.Errorf("wrong offset: status = %d, want 409", res.StatusCode)
+	}
+	if res := chunk("5", "world"); res.StatusCode != http.StatusCreated {
+		t.Fatalf("last chunk: status = %d", res.StatusCode)
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "big.bin")); string(b) != "helloworld" {
+		t.Errorf("uploaded file = %q", b)
+	}
+	if len(uploadLocks) != 0 {
+		t.Errorf("%d upload locks left", len(uploadLocks))
+	}
+}
+
+func TestLockUpload(t *testing.T) {
+	var wg sync.WaitGroup
+	var inside, most int
+	var mu sync.Mutex
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer lockUpload("same")()
+			mu.Lock()
+			inside++
+			if inside > most {
+				most = inside
+			}
+			mu.Unlock()
+			mu.Lock()
+			inside--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if most != 1 {
+		t.Errorf("%d requests held the lock at once", most)
+	}
+	if len(uploadLocks) != 0 {
+		t.Errorf("%d upload locks left", len(uploadLocks))
+	}
+}
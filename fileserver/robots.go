@@ -0,0 +1,59 @@
+package fileserver
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// robots.txt（-robots）：公网上的实例很快会被各种爬虫翻个底朝天。deny 返回禁止所有爬虫的 robots.txt，
+// allow 返回允许所有的（打开了 -sitemap 时带上站点地图的地址），其他值是自己写的文件；为空时 /robots.txt 照常按根目录中的文件处理。
+// robots.txt 在登录和访问控制之前返回，-require-auth 时爬虫也能读到。
+// -robots-tag 给所有响应加上 X-Robots-Tag（如 noindex, nofollow），不遵守 robots.txt、直接拿到链接的搜索引擎也不会收录
+
+// 内置的两种 robots.txt
+const (
+	robotsDeny  = "User-agent: *\nDisallow: /\n"
+	robotsAllow = "User-agent: *\nDisallow:\n"
+)
+
+// loadRobots 按 -robots 的值准备 robots.txt 的内容，为空时返回 nil
+func loadRobots(v string) ([]byte, error) {
+	switch v {
+	case "":
+		return nil, nil
+	case "deny":
+		return []byte(robotsDeny), nil
+	case "allow":
+		return []byte(robotsAllow), nil
+	}
+	b, err := os.ReadFile(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read robots.txt: %w", err)
+	}
+	return b, nil
+}
+
+// robots 返回 /robots.txt，并给所有响应加上 X-Robots-Tag
+func (s *server) robots(next http.Handler) http.Handler {
+	if s.robotsTxt == nil && s.robotsTag == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.robotsTag != "" {
+			w.Header().Set("X-Robots-Tag", s.robotsTag)
+		}
+		if s.robotsTxt == nil || r.URL.Path != "/robots.txt" || r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body := s.robotsTxt
+		if s.sitemap && string(body) == robotsAllow {
+			body = fmt.Appendf(append([]byte{}, body...), "Sitemap: %s%s/sitemap.xml\n", s.origin(r), s.base)
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+	})
+}
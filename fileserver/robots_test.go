@@ -0,0 +1,42 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRobots(t *testing.T) {
+	root := newTestRoot(t)
+
+	// 要求登录时爬虫也能读到 robots.txt，其他响应都带着 X-Robots-Tag
+	h := newTestHandler(t, Config{Root: root, Robots: "deny", RobotsTag: "noindex, nofollow", RequireAuth: true, Users: []User{{Name: "alice", Password: "pw"}}})
+	res, body := do(t, h, httptest.NewRequest("GET", "/robots.txt", nil))
+	if res.StatusCode != http.StatusOK || body != robotsDeny || res.Header.Get("X-Robots-Tag") != "noindex, nofollow" {
+		t.Fatalf("deny: got %d %q %v", res.StatusCode, body, res.Header)
+	}
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/a.txt", nil)); res.StatusCode != http.StatusUnauthorized || res.Header.Get("X-Robots-Tag") != "noindex, nofollow" {
+		t.Errorf("other response: got %d %v", res.StatusCode, res.Header)
+	}
+
+	_, body = do(t, newTestHandler(t, Config{Root: root, Robots: "allow", Sitemap: true}), httptest.NewRequest("GET", "/robots.txt", nil))
+	if !strings.HasPrefix(body, robotsAllow) || !strings.Contains(body, "Sitemap: http://example.com/sitemap.xml") {
+		t.Errorf("allow: %q", body)
+	}
+
+	custom := filepath.Join(t.TempDir(), "robots.txt")
+	os.WriteFile(custom, []byte("User-agent: BadBot\nDisallow: /\n"), 0644)
+	if _, body := do(t, newTestHandler(t, Config{Root: root, Robots: custom}), httptest.NewRequest("GET", "/robots.txt", nil)); !strings.Contains(body, "BadBot") {
+		t.Errorf("custom: %q", body)
+	}
+	if _, err := New(Config{Root: root, Robots: filepath.Join(root, "missing.txt")}); err == nil {
+		t.Error("missing robots.txt file was accepted")
+	}
+
+	if res, _ := do(t, newTestHandler(t, Config{Root: root}), httptest.NewRequest("GET", "/a.txt", nil)); res.Header.Get("X-Robots-Tag") != "" {
+		t.Error("X-Robots-Tag sent without -robots-tag")
+	}
+}
@@ -0,0 +1,216 @@
+package fileserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 存储：-root s3://bucket/prefix 浏览 S3 兼容存储（AWS S3、MinIO 等）中的对象，对象名中的 / 视为目录。
+// 地址参数 endpoint 指定 MinIO 等服务的地址（默认 s3.amazonaws.com），region 指定区域，insecure=1 使用 http。
+// 凭据依次从 AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY、MINIO_ACCESS_KEY / MINIO_SECRET_KEY、
+// ~/.aws/credentials 和 EC2 实例角色获取
+
+// s3Timeout 是列目录、查询对象信息的超时时间，对象内容的读取不受限制
+const s3Timeout = 30 * time.Second
+
+type s3FS struct {
+	client *minio.Client
+	bucket string
+	prefix string // 以 / 结尾，整个 bucket 时为空
+}
+
+// NewS3FS 按 s3://bucket/prefix?endpoint=host:port&region=xx&insecure=1 打开 S3 兼容存储，返回只读的 fs.FS
+func NewS3FS(rawURL string) (fs.FS, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 root %q, expected s3://bucket/prefix", rawURL)
+	}
+	q := u.Query()
+	endpoint := q.Get("endpoint")
+	if endpoint == "" {
+		endpoint = os.Getenv("S3_ENDPOINT")
+	}
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.FileAWSCredentials{},
+		&credentials.IAM{},
+	})
+	client, err := minio.New(endpoint, &minio.Options{Creds: creds, Secure: q.Get("insecure") == "", Region: q.Get("region")})
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &s3FS{client: client, bucket: u.Host, prefix: prefix}, nil
+}
+
+// key 返回 fs 路径对应的对象名
+func (f *s3FS) key(name string) string {
+	if name == "." {
+		return strings.TrimSuffix(f.prefix, "/")
+	}
+	return f.prefix + name
+}
+
+// s3Error 把对象不存在、没有权限转换成 fs 包的错误，便于返回 404、403
+func s3Error(op, name string, err error) error {
+	switch minio.ToErrorResponse(err).StatusCode {
+	case http.StatusNotFound:
+		err = fs.ErrNotExist
+	case http.StatusForbidden:
+		err = fs.ErrPermission
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (f *s3FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return s3Info{name: ".", dir: true}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+	obj, err := f.client.StatObject(ctx, f.bucket, f.key(name), minio.StatObjectOptions{})
+	if err == nil {
+		return s3Info{name: path.Base(name), size: obj.Size, modTime: obj.LastModified}, nil
+	}
+	if minio.ToErrorResponse(err).StatusCode != http.StatusNotFound {
+		return nil, s3Error("stat", name, err)
+	}
+	// S3 没有真正的目录，有对象以 name/ 开头就认为是目录
+	for obj := range f.client.ListObjectsIter(ctx, f.bucket, minio.ListObjectsOptions{Prefix: f.key(name) + "/", MaxKeys: 1}) {
+		if obj.Err != nil {
+			return nil, s3Error("stat", name, obj.Err)
+		}
+		return s3Info{name: path.Base(name), dir: true}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (f *s3FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	prefix := f.prefix
+	if name != "." {
+		prefix = f.key(name) + "/"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+	var entries []fs.DirEntry
+	for obj := range f.client.ListObjectsIter(ctx, f.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if obj.Err != nil {
+			return nil, s3Error("readdir", name, obj.Err)
+		}
+		rel := strings.TrimPrefix(obj.Key, prefix)
+		if rel == "" {
+			// 控制台创建“文件夹”时留下的空对象
+			continue
+		}
+		info := s3Info{name: strings.TrimSuffix(rel, "/"), size: obj.Size, modTime: obj.LastModified, dir: strings.HasSuffix(rel, "/")}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	// fs.ReadDirFS 要求按文件名排序，S3 中目录前缀和对象分开返回
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	if entries == nil && name != "." {
+		if _, err := f.Stat(name); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+func (f *s3FS) Open(name string) (fs.File, error) {
+	info, err := f.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &s3Dir{fsys: f, name: name, info: info}, nil
+	}
+	// GetObject 在第一次读取时才发请求，Seek 之后按 Range 读取，断点续传和拖动进度都可以使用
+	obj, err := f.client.GetObject(context.Background(), f.bucket, f.key(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3Error("open", name, err)
+	}
+	return &s3File{Object: obj, info: info}, nil
+}
+
+// s3File 是打开的对象，支持 Seek
+type s3File struct {
+	*minio.Object
+	info fs.FileInfo
+}
+
+func (f *s3File) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+var _ io.ReadSeeker = (*s3File)(nil)
+
+// s3Dir 是打开的“目录”
+type s3Dir struct {
+	fsys    *s3FS
+	name    string
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *s3Dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *s3Dir) Close() error               { return nil }
+
+func (d *s3Dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *s3Dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.read = entries, true
+	}
+	return nextEntries(&d.entries, n)
+}
+
+// s3Info 是对象或目录的信息
+type s3Info struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i s3Info) Name() string       { return i.name }
+func (i s3Info) Size() int64        { return i.size }
+func (i s3Info) ModTime() time.Time { return i.modTime }
+func (i s3Info) IsDir() bool        { return i.dir }
+func (i s3Info) Sys() any           { return nil }
+
+func (i s3Info) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
@@ -0,0 +1,124 @@
+package fileserver
+
+import (
+	"encoding/xml"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeS3 是只实现了 HEAD、GET 对象和 ListObjectsV2 的 S3 服务，桶名为 bucket
+func fakeS3(t *testing.T, objects map[string]string) *httptest.Server {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	type content struct {
+		Key          string
+		Size         int64
+		LastModified string
+	}
+	type prefix struct{ Prefix string }
+	type result struct {
+		XMLName        xml.Name `xml:"ListBucketResult"`
+		Name           string
+		Prefix         string
+		IsTruncated    bool
+		Contents       []content
+		CommonPrefixes []prefix
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := strings.CutPrefix(r.URL.Path, "/bucket/")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if key == "" {
+			q := r.URL.Query()
+			res := result{Name: "bucket", Prefix: q.Get("prefix")}
+			seen := map[string]bool{}
+			var keys []string
+			for k := range objects {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				rel, ok := strings.CutPrefix(k, res.Prefix)
+				if !ok {
+					continue
+				}
+				if dir, _, found := strings.Cut(rel, "/"); found && q.Get("delimiter") == "/" {
+					if p := res.Prefix + dir + "/"; !seen[p] {
+						seen[p] = true
+						res.CommonPrefixes = append(res.CommonPrefixes, prefix{p})
+					}
+					continue
+				}
+				res.Contents = append(res.Contents, content{k, int64(len(objects[k])), modTime.Format(time.RFC3339)})
+			}
+			w.Header().Set("Content-Type", "application/xml")
+			xml.NewEncoder(w).Encode(res)
+			return
+		}
+		data, ok := objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method != http.MethodHead {
+				w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`))
+			}
+			return
+		}
+		w.Header().Set("ETag", `"`+strconv.Itoa(len(data))+`"`)
+		http.ServeContent(w, r, key, modTime, strings.NewReader(data))
+	}))
+}
+
+func TestS3FS(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	srv := fakeS3(t, map[string]string{
+		"site/readme.txt":    "hello from s3",
+		"site/docs/guide.md": "# Guide",
+		"site/docs/":         "",
+		"other/secret.txt":   "no",
+	})
+	defer srv.Close()
+
+	fsys, err := NewS3FS("s3://bucket/site?insecure=1&region=us-east-1&endpoint=" + strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name()+map[bool]string{true: "/"}[e.IsDir()])
+	}
+	if strings.Join(names, " ") != "docs/ readme.txt" {
+		t.Errorf("root entries = %v", names)
+	}
+	if info, err := fs.Stat(fsys, "docs"); err != nil || !info.IsDir() {
+		t.Errorf("docs: %v, %v", info, err)
+	}
+	if _, err := fs.Stat(fsys, "missing.txt"); !strings.Contains(err.Error(), fs.ErrNotExist.Error()) {
+		t.Errorf("missing file: err = %v", err)
+	}
+
+	h := newTestHandler(t, Config{FS: fsys})
+	r := httptest.NewRequest("GET", "/download/readme.txt", nil)
+	r.Header.Set("Range", "bytes=6-9")
+	if res, body := do(t, h, r); res.StatusCode != http.StatusPartialContent || body != "from" {
+		t.Errorf("range download: got %d %q", res.StatusCode, body)
+	}
+	if res, body := do(t, h, httptest.NewRequest("GET", "/view/docs/guide.md", nil)); res.StatusCode != http.StatusOK || !strings.Contains(body, "<h1>Guide</h1>") {
+		t.Errorf("markdown preview: status = %d", res.StatusCode)
+	}
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/download/missing.txt", nil)); res.StatusCode != http.StatusNotFound {
+		t.Errorf("missing file: status = %d, want 404", res.StatusCode)
+	}
+}
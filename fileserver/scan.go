@@ -0,0 +1,167 @@
+package fileserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 病毒扫描（-clamd 或 -scan-command）：每个上传的文件写完临时文件、放进目录之前先扫描，
+// 发现病毒时拒绝上传并删除临时文件，-quarantine 时改为移到根目录下隐藏的 .quarantine 中留给管理员检查。
+// 扫描器连不上或出错时同样拒绝上传，宁可让上传失败也不让没扫描过的文件进入目录。
+// HTTP、FTP、SFTP、断点续传、解压出的文件都经过 replaceFile，都会被扫描
+
+const quarantineDir = ".quarantine"
+
+// scanTimeout 是扫描一个文件的最长时间
+const scanTimeout = 5 * time.Minute
+
+var (
+	errInfected = errors.New("file rejected by the virus scanner")
+	errScan     = errors.New("virus scanner unavailable")
+)
+
+// scanner 扫描一个本地文件，发现病毒时返回病毒名称
+type scanner interface {
+	scan(ctx context.Context, name string) (virus string, err error)
+}
+
+// clamdScanner 通过 clamd 的 INSTREAM 命令扫描，addr 是 host:port 或 unix socket 的路径
+type clamdScanner struct {
+	addr string
+}
+
+func (c clamdScanner) scan(ctx context.Context, name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	network, addr := "tcp", c.addr
+	if strings.HasPrefix(addr, "unix:") || strings.HasPrefix(addr, "/") {
+		network, addr = "unix", strings.TrimPrefix(addr, "unix:")
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// INSTREAM：每块前面是 4 字节大端的长度，长度为 0 的块表示结束
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 4+64*1024)
+	for {
+		n, err := f.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return "", err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return "", err
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return "", err
+	}
+	// 回复是 "stream: OK"、"stream: <病毒名> FOUND" 或 "<错误信息> ERROR"
+	reply = strings.TrimSpace(strings.TrimSuffix(reply, "\x00"))
+	switch {
+	case strings.HasSuffix(reply, " OK"):
+		return "", nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND"), nil
+	}
+	return "", fmt.Errorf("clamd: %s", reply)
+}
+
+// commandScanner 运行外部命令扫描，文件路径作为最后一个参数。和 clamscan、clamdscan 一样，
+// 退出码 0 表示没有病毒，1 表示发现病毒（输出的第一行作为病毒名称），其他退出码表示扫描失败
+type commandScanner struct {
+	args []string
+}
+
+func (c commandScanner) scan(ctx context.Context, name string) (string, error) {
+	cmd := exec.CommandContext(ctx, c.args[0], append(c.args[1:], name)...)
+	out, err := cmd.CombinedOutput()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == 1 {
+		virus, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+		if virus == "" {
+			virus = "unknown"
+		}
+		return strings.TrimSpace(virus), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w: %s", c.args[0], err, strings.TrimSpace(string(out)))
+	}
+	return "", nil
+}
+
+// newScanner 根据配置返回扫描器，都没有配置时返回 nil
+func newScanner(clamd, command string) (scanner, error) {
+	switch {
+	case clamd != "" && command != "":
+		return nil, errors.New("use either Clamd or ScanCommand, not both")
+	case clamd != "":
+		return clamdScanner{addr: clamd}, nil
+	case command != "":
+		return commandScanner{args: strings.Fields(command)}, nil
+	}
+	return nil, nil
+}
+
+// scanUpload 扫描写好的临时文件 tmp，它将被保存为 p。发现病毒时删除 tmp 或移入隔离区，返回 errInfected；
+// 扫描失败时删除 tmp，返回 errScan
+func (s *server) scanUpload(tmp, p string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), scanTimeout)
+	defer cancel()
+	virus, err := s.scanner.scan(ctx, tmp)
+	if err != nil {
+		log.Printf("Failed to scan upload %s: %v", p, err)
+		os.Remove(tmp)
+		return errScan
+	}
+	if virus == "" {
+		return nil
+	}
+	log.Printf("Rejected upload %s: %s", p, virus)
+	if s.quarantine {
+		dir := s.root + "/" + quarantineDir
+		name := dir + "/" + strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + path.Base(p)
+		err = os.MkdirAll(dir, 0700)
+		if err == nil {
+			err = os.Rename(tmp, name)
+		}
+		if err != nil {
+			log.Printf("Failed to quarantine %s: %v", p, err)
+		}
+	}
+	os.Remove(tmp)
+	return fmt.Errorf("%w: %s", errInfected, virus)
+}
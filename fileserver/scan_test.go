@@ -0,0 +1,120 @@
+package fileserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd 按 INSTREAM 协议接收文件，内容包含 EICAR 时报告病毒
+func fakeClamd(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				if cmd, _ := r.ReadString(0); cmd != "zINSTREAM\x00" {
+					io.WriteString(conn, "UNKNOWN COMMAND\x00")
+					return
+				}
+				var data bytes.Buffer
+				for {
+					var n uint32
+					if binary.Read(r, binary.BigEndian, &n) != nil {
+						return
+					}
+					if n == 0 {
+						break
+					}
+					io.CopyN(&data, r, int64(n))
+				}
+				if bytes.Contains(data.Bytes(), []byte("EICAR")) {
+					io.WriteString(conn, "stream: Eicar-Test-Signature FOUND\x00")
+				} else {
+					io.WriteString(conn, "stream: OK\x00")
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestScanClamd(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root, Clamd: fakeClamd(t)}, WithReadWrite())
+	if res, body := do(t, h, httptest.NewRequest("PUT", "/api/files/clean.txt", strings.NewReader("clean"))); res.StatusCode != http.StatusCreated {
+		t.Errorf("clean upload: status = %d, body %s", res.StatusCode, body)
+	}
+	res, body := do(t, h, httptest.NewRequest("PUT", "/api/files/virus.com", strings.NewReader(eicar)))
+	if res.StatusCode != http.StatusUnprocessableEntity || !strings.Contains(body, "Eicar-Test-Signature") {
+		t.Errorf("infected upload: status = %d, body %s", res.StatusCode, body)
+	}
+	if _, err := os.Stat(filepath.Join(root, "virus.com")); err == nil {
+		t.Error("infected upload was saved")
+	}
+	// 覆盖已有文件同样扫描，原来的文件不变
+	do(t, h, httptest.NewRequest("PUT", "/api/files/a.txt?overwrite=1", strings.NewReader(eicar)))
+	if b, _ := os.ReadFile(filepath.Join(root, "a.txt")); string(b) != "hello" {
+		t.Errorf("a.txt = %q after an infected overwrite", b)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(root, ".upload-*")); len(matches) != 0 {
+		t.Errorf("temporary files left: %v", matches)
+	}
+
+	// 扫描器不可用时拒绝上传
+	h = newTestHandler(t, Config{Root: root, Clamd: "127.0.0.1:1"}, WithReadWrite())
+	if res, _ := do(t, h, httptest.NewRequest("PUT", "/api/files/new.txt", strings.NewReader("clean"))); res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("scanner down: status = %d, want 503", res.StatusCode)
+	}
+}
+
+// TestScanHelper 是 TestScanCommand 使用的扫描命令，不单独运行
+func TestScanHelper(t *testing.T) {
+	if os.Getenv("TEST_SCAN_HELPER") == "" {
+		t.Skip("helper process")
+	}
+	b, _ := os.ReadFile(os.Args[len(os.Args)-1])
+	if bytes.Contains(b, []byte("EICAR")) {
+		os.Stdout.WriteString("Eicar-Test-Signature\n")
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestScanCommand(t *testing.T) {
+	t.Setenv("TEST_SCAN_HELPER", "1")
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root, ScanCommand: os.Args[0] + " -test.run=^TestScanHelper$ --", Quarantine: true}, WithReadWrite())
+	if res, body := do(t, h, httptest.NewRequest("PUT", "/api/files/clean.txt", strings.NewReader("clean"))); res.StatusCode != http.StatusCreated {
+		t.Errorf("clean upload: status = %d, body %s", res.StatusCode, body)
+	}
+	if res, _ := do(t, h, httptest.NewRequest("PUT", "/api/files/virus.com", strings.NewReader(eicar))); res.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("infected upload: status = %d", res.StatusCode)
+	}
+	matches, _ := filepath.Glob(filepath.Join(root, quarantineDir, "*-virus.com"))
+	if len(matches) != 1 {
+		t.Fatalf("quarantine = %v", matches)
+	}
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/download/.quarantine/"+filepath.Base(matches[0]), nil)); res.StatusCode != http.StatusNotFound {
+		t.Errorf("quarantine download: status = %d, want 404", res.StatusCode)
+	}
+}
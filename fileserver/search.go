@@ -0,0 +1,56 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// 文件名搜索：GET /api/search?q=关键词&path=/目录，在 -index 建立的索引中查找，只返回用户有权读取、
+// 所在目录没有被密码锁住的结果。目录列表页面上的搜索框也使用这个接口
+
+// searchLimit 是默认最多返回的结果数，可以用 limit 参数调整，最多 maxSearchLimit
+const (
+	searchLimit    = 100
+	maxSearchLimit = 1000
+)
+
+// searchHandler 处理 GET /api/search
+func (s *server) searchHandler(w http.ResponseWriter, r *http.Request) {
+	if s.index == nil {
+		apiError(w, http.StatusNotImplemented, "search requires the file index (-index)")
+		return
+	}
+	limit := searchLimit
+	if v := r.FormValue("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			apiError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+	u := currentUser(r)
+	hits, truncated, ready := s.index.search(r.FormValue("path"), r.FormValue("q"), limit, func(p string) bool {
+		if !s.allowed(u, p, permRead) {
+			return false
+		}
+		_, locked := s.lockedDir(r, p)
+		return !locked
+	})
+
+	results := []apiFile{}
+	for _, h := range hits {
+		f := apiFile{Name: h.Name, Path: h.Path, Size: h.Size, IsDir: h.IsDir, ModTime: h.ModTime}
+		escaped := (&url.URL{Path: h.Path}).EscapedPath()
+		if h.IsDir {
+			f.URL = s.base + escaped + "/"
+		} else {
+			f.URL = s.base + "/download" + escaped
+			f.View = s.base + "/view" + escaped
+		}
+		results = append(results, f)
+	}
+	// ready 为 false 表示第一次扫描还没有完成，结果可能不全
+	writeJSON(w, http.StatusOK, map[string]any{"results": results, "truncated": truncated, "ready": ready})
+}
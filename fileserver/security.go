@@ -0,0 +1,34 @@
+package fileserver
+
+import (
+	"net/http"
+)
+
+// 安全相关的响应头，直接暴露在公网时不需要再套一层反向代理来添加。-security-headers=false 关闭
+
+// pageCSP 是本程序生成的页面（目录列表、预览等）使用的 Content-Security-Policy。
+// 脚本和样式都在 /static/ 下，不允许内联脚本；README 中可能引用外部图片，图片不做限制
+const pageCSP = "default-src 'self'; img-src * data:; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'self'"
+
+// securityHeaders 给所有响应加上通用的安全头，HTTPS 时再加上 HSTS
+func (s *server) securityHeaders(next http.Handler) http.Handler {
+	if !s.security {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "same-origin")
+		if r.TLS != nil {
+			h.Set("Strict-Transport-Security", "max-age=31536000")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// pageHeaders 在渲染页面时设置 CSP。用户自己的 HTML 文件在 /view/ 下原样返回，不受影响
+func (s *server) pageHeaders(w http.ResponseWriter) {
+	if s.security {
+		w.Header().Set("Content-Security-Policy", pageCSP)
+	}
+}
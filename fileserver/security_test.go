@@ -0,0 +1,39 @@
+package fileserver
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)})
+	res, _ := do(t, h, httptest.NewRequest("GET", "/", nil))
+	for name, want := range map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"Referrer-Policy":           "same-origin",
+		"Content-Security-Policy":   pageCSP,
+		"Strict-Transport-Security": "",
+	} {
+		if got := res.Header.Get(name); got != want {
+			t.Errorf("listing: %s = %q, want %q", name, got, want)
+		}
+	}
+
+	// 用户的文件原样返回，不加页面的 CSP
+	if res, _ = do(t, h, httptest.NewRequest("GET", "/view/a.txt", nil)); res.Header.Get("Content-Security-Policy") != "" {
+		t.Error("CSP set on a raw file")
+	}
+
+	r := httptest.NewRequest("GET", "/download/a.txt", nil)
+	r.TLS = &tls.ConnectionState{}
+	if res, _ = do(t, h, r); res.Header.Get("Strict-Transport-Security") == "" {
+		t.Error("no HSTS over TLS")
+	}
+
+	h = newTestHandler(t, Config{Root: newTestRoot(t), DisableSecurityHeaders: true})
+	res, _ = do(t, h, httptest.NewRequest("GET", "/", nil))
+	if res.Header.Get("X-Content-Type-Options") != "" || res.Header.Get("Content-Security-Policy") != "" {
+		t.Errorf("security headers disabled: %v", res.Header)
+	}
+}
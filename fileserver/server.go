@@ -0,0 +1,618 @@
+package fileserver
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// FileInfo 是目录列表中的一项，自定义模板（-template）可以使用这些字段
+type FileInfo struct {
+	Name     string // 文件名
+	Size     int64  // 文件大小，单位字节
+	IsDir    bool   // 是否为目录
+	URL      string // 下载地址，目录为浏览地址
+	Original string // 在线查看地址，目录为浏览地址
+	ModTime  string // 最后修改时间，格式 2006-01-02 15:04:05
+	Path     string // 相对根目录的路径
+	Parent   string
+	Edit     string // 在线编辑地址，只读模式或不能编辑时为空
+	History  string // 历史版本页面地址，没有旧版本时为空
+	Thumb    string // 相册中的缩略图地址，只在相册视图中设置
+	Full     string // 相册中放大显示的图片地址
+}
+
+// PageData 是目录列表模板的数据
+type PageData struct {
+	Page
+	Files    []FileInfo    // 文件和目录，目录排在前面
+	Path     string        // 当前目录地址
+	Parent   string        // 上级目录地址，根目录为空
+	Readme   template.HTML // 目录下 README 渲染后的内容
+	Shared   bool          // 是否通过分享链接访问，分享页面不显示管理按钮
+	Writable bool          // 读写模式下显示删除等管理按钮
+	Checksum string        // 在文件旁显示的校验和算法，为空不显示
+	Events   string        // 推送目录变化的地址（Server-Sent Events），为空时不自动刷新
+	Search   string        // 文件名搜索接口地址，未启用索引时为空
+	Feed     string        // 当前目录最近文件的订阅源地址
+	Origin   string        // 复制链接时加在下载地址前的 scheme://host[:port]
+	DirTree  bool          // 打开目录树侧栏，来自 cookie dir-tree
+	Gallery  bool          // 图片用相册显示
+	Images   int           // 目录中图片的个数，有图片时显示切换相册和列表的链接
+	DirSizes bool          // 是否在子目录旁边显示总大小
+	Trash    bool          // 删除的内容放入回收站，显示回收站链接
+}
+
+// server 保存启动时确定的配置和解析好的模板，各个处理函数共用
+type server struct {
+	root        string                     // 根目录绝对路径，使用 / 分隔，使用 Config.FS 时为空
+	fsys        fs.FS                      // 读取文件使用的文件系统，默认为 os.DirFS(root)
+	theme       string                     // 页面主题，对应 static/themes 下的文件名
+	lang        string                     // 无法从请求判断语言时使用的默认语言
+	writable    atomic.Bool                // 读写模式（rw），允许上传、删除等修改，管理员可以在运行时切换
+	limits      *uploadLimits              // 上传大小和配额限制
+	checksum    string                     // 目录列表中显示的校验和算法
+	cacheRules  []cacheRule                // Cache-Control 规则
+	compression bool                       // 是否压缩文本类响应
+	security    bool                       // 是否添加安全相关的响应头
+	spa         bool                       // 单页应用模式，未知地址返回根目录的 index.html
+	serveIndex  bool                       // 静态网站模式，目录下有 index.html 时直接返回
+	base        string                     // 部署在子路径下时的地址前缀，如 /files，根路径时为空
+	corsConf    *corsConfig                // 跨域设置，未启用时为 nil
+	tpl         *template.Template         // 启动时解析好的页面模板
+	hashes      *hashCache                 // 已经计算过的校验和
+	hooks       Hooks                      // 嵌入其他程序时的回调
+	middleware  []Middleware               // 嵌入其他程序时插入的中间件
+	previews    map[string]PreviewRenderer // Config.Previews 中的预览渲染器
+	version     VersionInfo                // /api/version 返回的版本信息
+	webhooks    *webhooks                  // 下载、上传、删除时的通知，没有配置文件时为 nil
+	liveReload  *liveReload                // 开发模式的自动刷新，未启用时为 nil
+	listings    *listingCache              // 目录列表缓存，关闭或不是本地根目录时为 nil
+	index       *fileIndex                 // 文件名搜索和目录大小使用的索引，未启用时为 nil
+	sizes       *dirSizes                  // 目录总大小的缓存，关闭时为 nil
+	stats       *downloadStats             // 下载统计，未启用时为 nil
+	auditLog    *auditLog                  // 审计日志，未启用时为 nil
+	trashTTL    time.Duration              // 回收站的保留时间，为 0 时不使用回收站
+	versions    int                        // 每个文件保留的旧版本个数，为 0 时不保留
+	dedupe      bool                       // 写入的文件按内容去重
+	scanner     scanner                    // 扫描上传文件的病毒扫描器，未启用时为 nil
+	quarantine  bool                       // 有病毒的上传移入隔离区
+	hideGPS     bool                       // 图片页面不显示照片中的 GPS 位置
+	imageCache  string                     // 缩放后的图片的缓存目录，为空时不缓存
+	stripEXIF   bool                       // 发送的 JPEG、PNG 去掉 EXIF 等元数据
+	sitemap     bool                       // 是否提供 /sitemap.xml
+	sitemapSkip []string                   // 不出现在站点地图中的路径
+	robotsTxt   []byte                     // -robots 指定的 robots.txt，为 nil 时按普通文件处理
+	robotsTag   string                     // 所有响应都带上的 X-Robots-Tag
+	requests    requestTracker             // 正在处理的请求，管理页面显示
+	logs        *LogBuffer                 // Config.Logs，管理页面显示的最近日志
+
+	secret    []byte            // 签名分享链接、目录密码 cookie 使用的密钥
+	shares    *shareStore       // 签名分享链接
+	protected map[string]string // 通过 -protect 声明的受保护目录及密码
+
+	access     atomic.Pointer[access] // 用户、访问控制等可以重新加载的设置，通过 conf() 读取
+	flags      access                 // 来自 Config 的部分，重新加载时和配置文件合并
+	configFile string                 // Config.ConfigFile
+	users      *userStore             // 用户库，未启用时为 nil
+	tokens     *tokenAuth             // Bearer 令牌认证，未启用时为 nil
+	oidc       *oidcAuth              // 单点登录，未启用时为 nil
+
+	allowIPs       []*net.IPNet // 只允许这些地址访问，为空表示不限制
+	denyIPs        []*net.IPNet // 禁止这些地址访问
+	trustedProxies []*net.IPNet // 受信任的反向代理，只有它们的 X-Forwarded-For 才会被采信
+	unixSocket     bool         // 是否监听 unix socket，此时 X-Forwarded-For 总是被采信
+	publicURL      string       // Config.PublicURL，为空时从请求推断
+}
+
+// page 返回所有页面共用的模板数据，用户在页面上切换过的主题优先
+func (s *server) page(w http.ResponseWriter, r *http.Request) Page {
+	theme := s.theme
+	if c, err := r.Cookie("theme"); err == nil && slices.Contains(Themes(), c.Value) {
+		theme = c.Value
+	}
+	p := Page{Lang: Lang{Code: negotiateLang(w, r, s.lang)}, Theme: theme, Base: s.base}
+	if u := currentUser(r); u != nil {
+		p.User = u.Name
+		p.Logout = s.oidc != nil
+	}
+	return p
+}
+
+// render 执行指定名字的模板。先渲染到缓冲区，这样可以带上 Content-Length，
+// HEAD 请求时 net/http 会丢掉响应体，只发送响应头
+func (s *server) render(w http.ResponseWriter, name string, data any) {
+	s.renderStatus(w, http.StatusOK, name, data)
+}
+
+// renderStatus 和 render 相同，但使用指定的状态码
+func (s *server) renderStatus(w http.ResponseWriter, status int, name string, data any) {
+	var buf bytes.Buffer
+	if err := s.tpl.ExecuteTemplate(&buf, name, data); err != nil {
+		log.Printf("Failed to render %s: %v", name, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	s.pageHeaders(w)
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	// 文件下载处理
+	mux.HandleFunc("/download/", s.downloadHandler)
+	// 文件查看处理
+	mux.HandleFunc("/view/", s.viewHandler)
+	// 在线编辑文本文件
+	mux.HandleFunc("/edit/", s.editHandler)
+	mux.HandleFunc("/history/", s.historyHandler)
+	// 签名分享链接及生成接口
+	mux.HandleFunc("/s/", s.shareHandler)
+	mux.HandleFunc("/api/share", s.shareAPIHandler)
+	// JSON 目录列表
+	mux.HandleFunc("/api/list/", s.apiListHandler)
+	// 勾选的文件打包下载
+	mux.HandleFunc("/api/zip", s.batchZipHandler)
+	// 文件校验和
+	mux.HandleFunc("/api/hash/", s.hashAPIHandler)
+	// 程序版本
+	mux.HandleFunc("/api/version", s.versionHandler)
+	// 目录变化推送
+	mux.HandleFunc("/api/events/", s.eventsHandler)
+	// 文件名搜索
+	mux.HandleFunc("/api/search", s.searchHandler)
+	// 最近文件的订阅源
+	mux.HandleFunc("/feed.xml", s.feedHandler)
+	// 站点地图，关闭时 /sitemap.xml 照常按文件处理
+	if s.sitemap {
+		mux.HandleFunc("/sitemap.xml", s.sitemapHandler)
+	}
+	// 目录总大小
+	mux.HandleFunc("/api/size/", s.dirSizeHandler)
+	// 管理员查看下载统计和管理页面
+	mux.HandleFunc("/stats", s.statsHandler)
+	mux.HandleFunc("/admin", s.adminHandler)
+	mux.HandleFunc("/admin/", s.adminHandler)
+	if s.liveReload != nil {
+		mux.HandleFunc("/api/livereload", s.liveReload.handler)
+	}
+	// 上传等修改文件的接口，只读模式下被 checkMode 拦截
+	mux.HandleFunc("/api/files/", s.filesHandler)
+	mux.HandleFunc("/api/move", s.moveHandler)
+	mux.HandleFunc("/api/mkdir", s.mkdirHandler)
+	mux.HandleFunc("/api/batch/delete", s.batchHandler)
+	mux.HandleFunc("/api/batch/move", s.batchHandler)
+	// 回收站
+	mux.HandleFunc("/trash", s.trashHandler)
+	mux.HandleFunc("/trash/", s.trashHandler)
+	mux.HandleFunc("/api/trash", s.trashHandler)
+	mux.HandleFunc("/api/trash/", s.trashHandler)
+	// 分享用的二维码
+	mux.HandleFunc("/qr", s.qrHandler)
+	// 单点登录
+	if s.oidc != nil {
+		mux.HandleFunc("/auth/login", s.oidc.loginHandler)
+		mux.HandleFunc("/auth/callback", s.oidc.callbackHandler)
+		mux.HandleFunc("/auth/logout", s.oidc.logoutHandler)
+	}
+	// 内置的样式、脚本等静态资源
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(staticAssets))))
+	// 根目录文件处理
+	mux.HandleFunc("/", s.handler)
+
+	return mux
+}
+
+// hiddenFiles 是程序自己使用的文件，不出现在目录列表中
+var hiddenFiles = map[string]bool{
+	passwordFile:  true,
+	uploadsDir:    true,
+	trashDir:      true,
+	versionsDir:   true,
+	objectsDir:    true,
+	quarantineDir: true,
+}
+
+// isHidden 判断路径中是否有某一级是程序自己使用的文件，这些路径不能被访问
+func isHidden(p string) bool {
+	for _, part := range strings.Split(p, "/") {
+		if hiddenFiles[foldPath(part)] {
+			return true
+		}
+	}
+	return false
+}
+
+// localRedirect 检查登录、输入密码后要跳回的地址，只允许本站路径，其他情况返回 /。
+// 浏览器把 \ 当作 /，/\evil.example 和 //evil.example 一样会跳到其他网站
+func localRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.ContainsAny(next, "\\\r\n\t") {
+		return "/"
+	}
+	u, err := url.Parse(next)
+	if err != nil || u.Scheme != "" || u.Host != "" || strings.HasPrefix(u.Path, "//") {
+		return "/"
+	}
+	return next
+}
+
+// parentDir 返回 p 的上级目录，以 / 结尾。使用 path 包，永远 / 分隔
+func parentDir(p string) string {
+	dir := path.Dir(p)
+	if dir == "." || dir == "/" {
+		return "/"
+	}
+	return dir + "/"
+}
+
+// cleanPath 把请求中的路径规范成以 / 开头、不含 .. 的形式
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// targetPath 返回请求访问的文件或目录（相对根目录），与根目录内容无关的请求返回 false
+func targetPath(r *http.Request) (string, bool) {
+	p := r.URL.Path
+	switch {
+	case strings.HasPrefix(p, "/download/"):
+		return archiveTarget(cleanPath(strings.TrimPrefix(p, "/download"))), true
+	case strings.HasPrefix(p, "/view/"):
+		return archiveTarget(cleanPath(strings.TrimPrefix(p, "/view"))), true
+	case strings.HasPrefix(p, "/edit/"):
+		return cleanPath(strings.TrimPrefix(p, "/edit")), true
+	case strings.HasPrefix(p, "/history/"):
+		return cleanPath(strings.TrimPrefix(p, "/history")), true
+	case p == "/api/share", p == "/api/mkdir", p == "/api/search", p == "/feed.xml":
+		return cleanPath(r.FormValue("path")), true
+	case p == "/api/move":
+		return cleanPath(r.FormValue("from")), true
+	case strings.HasPrefix(p, "/api/list/"):
+		return cleanPath(strings.TrimPrefix(p, "/api/list")), true
+	case strings.HasPrefix(p, "/api/hash/"):
+		return cleanPath(strings.TrimPrefix(p, "/api/hash")), true
+	case strings.HasPrefix(p, "/api/files/"):
+		return cleanPath(strings.TrimPrefix(p, "/api/files")), true
+	case strings.HasPrefix(p, "/api/events/"):
+		return cleanPath(strings.TrimPrefix(p, "/api/events")), true
+	case strings.HasPrefix(p, "/api/size/"):
+		return cleanPath(strings.TrimPrefix(p, "/api/size")), true
+	case p == "/qr", p == "/stats", p == "/admin", strings.HasPrefix(p, "/admin/"), p == "/trash", strings.HasPrefix(p, "/trash/"), strings.HasPrefix(p, "/static/"), strings.HasPrefix(p, "/s/"), strings.HasPrefix(p, "/api/"), strings.HasPrefix(p, "/auth/"):
+		return "", false
+	}
+	return cleanPath(p), true
+}
+
+// listLinks 决定目录列表中各项链接的前缀，普通浏览和分享链接的地址格式不同
+type listLinks struct {
+	dir      string // 当前目录相对根目录的路径，以 / 结尾
+	browse   string // 子目录地址前缀
+	download string // 文件下载地址前缀
+	view     string // 文件查看地址前缀
+	viewArgs string // 追加在查看地址后的参数
+}
+
+// listFiles 读取目录 dir（相对根目录）的内容并生成列表项，同时返回目录说明文件名
+func (s *server) listFiles(dir string, l listLinks) ([]FileInfo, string, error) {
+	files, err := s.readDir(dir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var list []FileInfo
+	var readme string
+	for _, f := range files {
+		info, _ := f.Info()
+		name := f.Name()
+		if hiddenFiles[name] {
+			continue
+		}
+		if !f.IsDir() && isReadme(name) && (readme == "" || isMarkdown(name)) {
+			readme = name
+		}
+		modTime := info.ModTime().Format("2006-01-02 15:04:05")
+		var urlStr string
+		var original string
+		if f.IsDir() {
+			urlStr = l.browse + name + "/"
+			original = l.browse + name + "/"
+		} else {
+			encodedName := url.PathEscape(name)
+			urlStr = l.download + encodedName
+			original = l.view + encodedName + l.viewArgs
+		}
+		list = append(list, FileInfo{
+			Name:     name,
+			Size:     info.Size(),
+			IsDir:    f.IsDir(),
+			URL:      urlStr,
+			Original: original,
+			ModTime:  modTime,
+			Path:     l.dir + name,
+		})
+	}
+
+	// 文件夹排前，名字排序
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].IsDir != list[j].IsDir {
+			return list[i].IsDir
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list, readme, nil
+}
+
+func (s *server) handler(w http.ResponseWriter, r *http.Request) {
+	if s.serveIndex && s.indexHandler(w, r) {
+		return
+	}
+	if s.spa && s.spaHandler(w, r) {
+		return
+	}
+	list, readme, err := s.listFiles(r.URL.Path, listLinks{
+		dir:      r.URL.Path,
+		browse:   s.base + r.URL.Path,
+		download: s.base + "/download" + r.URL.Path,
+		view:     s.base + "/view" + r.URL.Path,
+	})
+	if err != nil {
+		s.pathError(w, r, err)
+		return
+	}
+	// 没有读权限的文件和目录不显示
+	u := currentUser(r)
+	list = slices.DeleteFunc(list, func(f FileInfo) bool {
+		return !s.allowed(u, cleanPath(f.Path), permRead)
+	})
+	for i, f := range list {
+		if !f.IsDir && s.hasVersions(cleanPath(f.Path)) {
+			list[i].History = s.base + "/history" + strings.TrimPrefix(f.URL, s.base+"/download")
+		}
+	}
+	if !s.readOnly() {
+		for i, f := range list {
+			if !f.IsDir && isEditable(f.Name) && s.allowed(u, f.Path, permWrite) {
+				list[i].Edit = s.base + "/edit" + strings.TrimPrefix(f.URL, s.base+"/download")
+			}
+		}
+	}
+
+	if s.hooks.OnListing != nil {
+		list = s.hooks.OnListing(r, r.URL.Path, list)
+	}
+
+	// 计算上级目录
+	current := strings.TrimSuffix(r.URL.Path, "/")
+	parent := ""
+	if current != "" && current != "/" {
+		parent = s.base + parentDir(current)
+	}
+
+	data := PageData{Page: s.page(w, r), Files: list, Path: r.URL.EscapedPath(), Parent: parent, Checksum: s.checksum}
+	// 没有写权限（比如只读的用户）时不显示上传等按钮
+	data.Writable = !s.readOnly() && s.allowed(u, cleanPath(r.URL.Path), permWrite)
+	if readme != "" {
+		data.Readme = s.renderReadme(path.Join(r.URL.Path, readme))
+	}
+	if s.root != "" {
+		data.Events = s.base + "/api/events" + r.URL.EscapedPath()
+	}
+	if s.index != nil {
+		data.Search = s.base + "/api/search"
+	}
+	data.Feed = s.base + "/feed.xml?path=" + url.QueryEscape(cleanPath(r.URL.Path))
+	data.DirSizes = s.sizes != nil
+	data.Trash = s.trashTTL > 0
+	data.Origin = s.origin(r)
+	if c, err := r.Cookie("dir-tree"); err == nil && c.Value == "open" {
+		data.DirTree = true
+	}
+	if data.Gallery, data.Images = galleryView(r, list); data.Gallery {
+		s.setThumbs(list)
+	}
+
+	s.render(w, "listing.html", data)
+}
+
+func (s *server) downloadHandler(w http.ResponseWriter, r *http.Request) {
+	// 去掉 /download 前缀，r.URL.Path 已经解码过，不能再解码一次，否则文件名中的 % 会出错
+	decodedPath := cleanPath(strings.TrimPrefix(r.URL.Path, "/download"))
+	if archive, member, ok := splitArchive(decodedPath); ok {
+		s.archiveDownload(w, r, archive, member)
+		return
+	}
+
+	// s.stat 获取指定文件或目录的状态信息（FileInfo），路径已经由 cleanPath 去掉了 .. 等冗余部分
+	info, err := s.stat(decodedPath)
+	if err != nil || info.IsDir() {
+		s.httpError(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+	if !s.allowDownload(w, r, decodedPath, info) {
+		return
+	}
+	f, err := s.open(decodedPath)
+	if err != nil {
+		s.pathError(w, r, err)
+		return
+	}
+	defer f.Close()
+	if info, f, err = s.stripMetadata(info, f); err != nil {
+		s.httpError(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", info.Name()))
+	w.Header().Set("ETag", fileETag(info))
+	s.setContentType(w, info.Name())
+	s.serveDownload(w, r, decodedPath, info, f)
+}
+
+// contentDisposition 按 RFC 6266 生成 Content-Disposition：filename 是只含 ASCII 的名字，其他字符换成 _，
+// 引号和反斜杠转义；名字不全是可打印的 ASCII 时再加上 RFC 5987 编码的 filename*，浏览器优先使用它，中文名不会乱码
+func contentDisposition(disposition, name string) string {
+	var ascii, ext strings.Builder
+	exact := true
+	for _, r := range name {
+		switch {
+		case r == '"' || r == '\\':
+			ascii.WriteByte('\\')
+			ascii.WriteRune(r)
+			exact = false
+		case r < ' ' || r >= 0x7f:
+			ascii.WriteByte('_')
+			exact = false
+		default:
+			ascii.WriteRune(r)
+		}
+	}
+	v := disposition + `; filename="` + ascii.String() + `"`
+	if exact {
+		return v
+	}
+	// attr-char 以外的字节都要百分号编码
+	for _, b := range []byte(name) {
+		if 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || strings.IndexByte("!#$&+-.^_`|~", b) >= 0 {
+			ext.WriteByte(b)
+		} else {
+			fmt.Fprintf(&ext, "%%%02X", b)
+		}
+	}
+	return v + "; filename*=UTF-8''" + ext.String()
+}
+
+func (s *server) viewHandler(w http.ResponseWriter, r *http.Request) {
+	decodedPath := cleanPath(strings.TrimPrefix(r.URL.Path, "/view"))
+	if archive, dir, ok := splitArchive(decodedPath); ok {
+		s.archiveHandler(w, r, archive, dir)
+		return
+	}
+
+	info, err := s.stat(decodedPath)
+	if err != nil || info.IsDir() {
+		s.httpError(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+
+	// 图片带着 ?w=、?h=、?quality= 时返回缩放后的图片
+	if isResizable(info.Name()) {
+		o, ok, err := parseResize(r)
+		if err != nil {
+			s.httpError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if ok {
+			s.resizeHandler(w, r, decodedPath, info, o)
+			return
+		}
+	}
+
+	raw := r.URL.Query().Get("raw") != ""
+
+	// 压缩包显示其中的内容，?raw=1 按原来的方式查看
+	if !raw && isArchive(info.Name()) {
+		s.archiveHandler(w, r, decodedPath, "/")
+		return
+	}
+
+	// PDF 渲染阅读页面，阅读器通过 ?raw=1 读取原文
+	if !raw && isPDF(info.Name()) {
+		s.pdfHandler(w, r, decodedPath)
+		return
+	}
+
+	// 浏览器直接打开的图片显示图片页面，<img> 引用的照常返回图片
+	if !raw && isImage(info.Name()) {
+		if wantsPage(r) {
+			s.imageHandler(w, r, decodedPath)
+			return
+		}
+		w.Header().Set("Vary", "Accept")
+	}
+
+	// 音视频文件先渲染播放页面，页面中的播放器再通过 ?raw=1 拉取数据流
+	if !raw && isMedia(mediaType(info.Name(), "")) {
+		s.playerHandler(w, r, decodedPath)
+		return
+	}
+
+	// Markdown、源码等有预览渲染器的文件渲染成网页，?raw=1 查看原文
+	if pr := s.previewFor(info.Name()); !raw && pr != nil && s.previewHandler(w, r, decodedPath, info, pr) {
+		return
+	}
+
+	// CSV、TSV 显示成表格
+	if comma, ok := isCSV(info.Name()); ok && !raw && s.csvHandler(w, r, decodedPath, comma) {
+		return
+	}
+
+	// 自动检测 MIME 类型
+	f, err := s.open(decodedPath)
+	if err != nil {
+		s.httpError(w, r, http.StatusInternalServerError, "Failed to open file")
+		return
+	}
+	defer f.Close()
+
+	// 读取前 512 字节判断类型
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	contentType := http.DetectContentType(buf[:n])
+
+	// 重置读取位置，不能 Seek 的文件重新打开
+	if rs, ok := f.(io.Seeker); ok {
+		rs.Seek(0, io.SeekStart)
+	} else {
+		f.Close()
+		if f, err = s.open(decodedPath); err != nil {
+			s.httpError(w, r, http.StatusInternalServerError, "Failed to open file")
+			return
+		}
+		defer f.Close()
+	}
+	if info, f, err = s.stripMetadata(info, f); err != nil {
+		s.httpError(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	// 设置为 inline 显示
+	w.Header().Set("Content-Disposition", contentDisposition("inline", info.Name()))
+
+	// 音视频使用扩展名对应的类型，嗅探结果不可靠
+	if t := mediaType(info.Name(), contentType); isMedia(t) {
+		contentType = t
+	}
+	// 文件头前面多了几个字节的 PDF 嗅探不出来，浏览器会当成下载
+	if isPDF(info.Name()) {
+		contentType = "application/pdf"
+	}
+	if t, ok := s.mimeOverride(info.Name()); ok {
+		contentType = t
+	}
+
+	// ServeContent 处理 Range 请求（播放器才能拖动进度）以及 ETag / Last-Modified 条件请求，
+	// 文件没变时返回 304，不再传输内容
+	w.Header().Set("Content-Type", contentType)
+	// 去掉了元数据的图片不能用预先压缩的版本，那是原图压缩的
+	if _, stripped := f.(*piecesFile); !stripped && s.servePrecompressed(w, r, decodedPath, info) {
+		return
+	}
+	w.Header().Set("ETag", fileETag(info))
+	serveContent(w, r, info, f)
+}
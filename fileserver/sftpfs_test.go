@@ -0,0 +1,72 @@
+package fileserver
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// newTestSFTP 在内存管道上启动 SFTP 服务，返回指向 root 的 sftpFS
+func newTestSFTP(t *testing.T, root string) *sftpFS {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	srv, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, sftp.ReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	client, err := sftp.NewClientPipe(cr, cw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 先关闭服务端的管道，客户端的接收循环读到 EOF 后 client.Close 才能返回
+	t.Cleanup(func() {
+		srv.Close()
+		cr.Close()
+		client.Close()
+	})
+	return &sftpFS{root: root, client: client}
+}
+
+func TestSFTPFS(t *testing.T) {
+	fsys := newTestSFTP(t, newTestRoot(t))
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Name() != "a.txt" || !entries[1].IsDir() {
+		t.Fatalf("root entries = %v", entries)
+	}
+	if _, err := fs.Stat(fsys, "missing.txt"); !strings.Contains(err.Error(), fs.ErrNotExist.Error()) {
+		t.Errorf("missing file: err = %v", err)
+	}
+
+	h := newTestHandler(t, Config{FS: fsys})
+	if res, body := do(t, h, httptest.NewRequest("GET", "/", nil)); res.StatusCode != http.StatusOK || !strings.Contains(body, "a.txt") {
+		t.Errorf("listing: status = %d", res.StatusCode)
+	}
+	r := httptest.NewRequest("GET", "/download/a.txt", nil)
+	r.Header.Set("Range", "bytes=0-1")
+	if res, body := do(t, h, r); res.StatusCode != http.StatusPartialContent || body != "he" {
+		t.Errorf("range download: got %d %q", res.StatusCode, body)
+	}
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/download/missing.txt", nil)); res.StatusCode != http.StatusNotFound {
+		t.Errorf("missing file: status = %d, want 404", res.StatusCode)
+	}
+}
+
+func TestNewSFTPFSInvalid(t *testing.T) {
+	for _, u := range []string{"sftp:///path", "ftp://host/path"} {
+		if _, err := NewSFTPFS(u); err == nil {
+			t.Errorf("NewSFTPFS(%q) succeeded", u)
+		}
+	}
+}
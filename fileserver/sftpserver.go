@@ -0,0 +1,542 @@
+package fileserver
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// 内置 SFTP 服务（-sftp :2022）：和网页共用同一个根目录、同一套用户和访问控制规则，
+// 可以用 sftp、scp（OpenSSH 9 起默认走 SFTP 协议）、WinSCP 等客户端下载，不支持 rsync 和 shell。
+// 默认只读，SFTPServerConfig.Writable 并且服务本身是读写模式时才允许上传、删除和重命名。
+// 用户名和密码与网页登录相同，也可以用 authorized_keys 中的公钥登录；匿名用户用 anonymous 登录，不需要密码。
+// 和 FTP 一样，受保护的目录在 SFTP 中不可访问
+
+// SFTPServerConfig 是 SFTP 服务的设置
+type SFTPServerConfig struct {
+	HostKey        string // 主机私钥文件，不存在时生成一个 ed25519 密钥并保存
+	AuthorizedKeys string // authorized_keys 格式的公钥文件，每行的注释是登录的用户名，为空时只能用密码登录
+	Writable       bool   // 允许上传、删除、重命名，服务本身还要是读写模式
+}
+
+const sftpHandshakeTimeout = 30 * time.Second
+
+// ServeSFTP 在 ln 上提供 SFTP 服务，直到 ln 被关闭
+func (h *Handler) ServeSFTP(ln net.Listener, conf SFTPServerConfig) error {
+	signer, err := loadHostKey(conf.HostKey)
+	if err != nil {
+		return err
+	}
+	keys, err := loadAuthorizedKeys(conf.AuthorizedKeys)
+	if err != nil {
+		return err
+	}
+	s := h.s
+	config := &ssh.ServerConfig{
+		NoClientAuth: true,
+		NoClientAuthCallback: func(c ssh.ConnMetadata) (*ssh.Permissions, error) {
+			if c.User() != "anonymous" || s.conf().requireAuth {
+				return nil, errors.New("password or public key required")
+			}
+			return sshPermissions(nil), nil
+		},
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if c.User() == "anonymous" && !s.conf().requireAuth {
+				return sshPermissions(nil), nil
+			}
+			for _, a := range s.conf().auth {
+				u, err := a.authenticate(c.User(), string(password))
+				if err != nil {
+					log.Printf("Auth backend error: %v", err)
+					continue
+				}
+				if u != nil {
+					return sshPermissions(u), nil
+				}
+			}
+			log.Printf("sftp %s: failed login for %q", c.RemoteAddr(), c.User())
+			// 放慢暴力猜测密码的速度
+			time.Sleep(time.Second)
+			return nil, errors.New("login incorrect")
+		},
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			for _, k := range keys {
+				if k.name == c.User() && bytes.Equal(k.key.Marshal(), key.Marshal()) {
+					return sshPermissions(&user{Name: k.name, Groups: s.userGroups(k.name)}), nil
+				}
+			}
+			return nil, errors.New("unknown public key")
+		},
+	}
+	config.AddHostKey(signer)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveSSH(conn, config, conf.Writable)
+	}
+}
+
+// loadHostKey 读取主机私钥，文件不存在时生成新的 ed25519 密钥，权限为 0600
+func loadHostKey(file string) (ssh.Signer, error) {
+	if file == "" {
+		return nil, errors.New("sftp: no host key file")
+	}
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		block, err := ssh.MarshalPrivateKey(key, "")
+		if err != nil {
+			return nil, err
+		}
+		b = pem.EncodeToMemory(block)
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(file, b, 0600); err != nil {
+			return nil, err
+		}
+		log.Printf("Generated SSH host key %s", file)
+	} else if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("sftp: host key %s: %w", file, err)
+	}
+	log.Printf("SSH host key fingerprint: %s", ssh.FingerprintSHA256(signer.PublicKey()))
+	return signer, nil
+}
+
+// authorizedKey 是允许登录的一个公钥
+type authorizedKey struct {
+	name string
+	key  ssh.PublicKey
+}
+
+// loadAuthorizedKeys 读取 authorized_keys 格式的文件，每个公钥必须带注释作为用户名
+func loadAuthorizedKeys(file string) ([]authorizedKey, error) {
+	if file == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var keys []authorizedKey
+	for len(bytes.TrimSpace(b)) > 0 {
+		key, comment, _, rest, err := ssh.ParseAuthorizedKey(b)
+		if err != nil {
+			return nil, fmt.Errorf("sftp: %s: %w", file, err)
+		}
+		if comment == "" {
+			return nil, fmt.Errorf("sftp: %s: key %s has no user name comment", file, ssh.FingerprintSHA256(key))
+		}
+		keys = append(keys, authorizedKey{name: comment, key: key})
+		b = rest
+	}
+	return keys, nil
+}
+
+// userGroups 返回配置文件中同名本地用户所属的组，用公钥登录时使用
+func (s *server) userGroups(name string) []string {
+	for _, a := range s.conf().auth {
+		if l, ok := a.(localUsers); ok {
+			for _, u := range l {
+				if u.Name == name {
+					return u.Groups
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// sshPermissions 把登录的用户保存在 SSH 连接的 Permissions 中，匿名时 u 为 nil
+func sshPermissions(u *user) *ssh.Permissions {
+	if u == nil {
+		return &ssh.Permissions{}
+	}
+	return &ssh.Permissions{Extensions: map[string]string{"user": u.Name, "groups": strings.Join(u.Groups, "\n")}}
+}
+
+func sshUser(p *ssh.Permissions) *user {
+	name, ok := p.Extensions["user"]
+	if !ok {
+		return nil
+	}
+	u := &user{Name: name}
+	if g := p.Extensions["groups"]; g != "" {
+		u.Groups = strings.Split(g, "\n")
+	}
+	return u
+}
+
+// serveSSH 处理一个 SSH 连接，只接受 session 通道上的 sftp 子系统
+func (s *server) serveSSH(conn net.Conn, config *ssh.ServerConfig, writable bool) {
+	defer conn.Close()
+	if !s.ipAllowed(addrIP(conn.RemoteAddr())) {
+		return
+	}
+	conn.SetDeadline(time.Now().Add(sftpHandshakeTimeout))
+	sc, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	defer sc.Close()
+	conn.SetDeadline(time.Time{})
+	go ssh.DiscardRequests(reqs)
+
+	h := &sftpHandler{s: s, u: sshUser(sc.Permissions), writable: writable, remote: conn.RemoteAddr()}
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go h.session(ch, requests)
+	}
+}
+
+// session 等待 sftp 子系统请求，拒绝 shell、exec 等其他请求
+func (h *sftpHandler) session(ch ssh.Channel, requests <-chan *ssh.Request) {
+	defer ch.Close()
+	for req := range requests {
+		var sub struct{ Name string }
+		if req.Type != "subsystem" || ssh.Unmarshal(req.Payload, &sub) != nil || sub.Name != "sftp" {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+		go ssh.DiscardRequests(requests)
+		srv := sftp.NewRequestServer(ch, sftp.Handlers{FileGet: h, FilePut: h, FileCmd: h, FileList: h})
+		if err := srv.Serve(); err != nil && !errors.Is(err, io.EOF) {
+			log.Printf("sftp %s: %v", h.remote, err)
+		}
+		srv.Close()
+		return
+	}
+}
+
+// sftpHandler 实现 SFTP 请求，一个 SSH 连接一个
+type sftpHandler struct {
+	s        *server
+	u        *user // 登录的用户，匿名时为 nil
+	writable bool
+	remote   net.Addr
+}
+
+// fail 把文件操作的错误转换成 SFTP 状态码，系统错误信息只写入日志
+func (h *sftpHandler) fail(err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return sftp.ErrSSHFxNoSuchFile
+	case errors.Is(err, fs.ErrPermission):
+		return sftp.ErrSSHFxPermissionDenied
+	case errors.Is(err, errFileExists), errors.Is(err, errBadName), errors.Is(err, errTooLarge), errors.Is(err, errQuota), errors.Is(err, errInfected), errors.Is(err, errScan):
+		return err
+	default:
+		log.Printf("sftp %s: %v", h.remote, err)
+		return sftp.ErrSSHFxFailure
+	}
+}
+
+// canWrite 检查能否修改 p
+func (h *sftpHandler) canWrite(p string) error {
+	if !h.writable || h.s.readOnly() {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	if p == "/" {
+		return errBadName
+	}
+	return h.s.sessionAccess(h.u, p, permWrite)
+}
+
+func (h *sftpHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	p := cleanPath(r.Filepath)
+	if err := h.s.sessionAccess(h.u, p, permRead); err != nil {
+		return nil, h.fail(err)
+	}
+	info, err := h.s.stat(p)
+	if err != nil {
+		return nil, h.fail(err)
+	}
+	if info.IsDir() {
+		return nil, sftp.ErrSSHFxFailure
+	}
+	f, err := h.s.open(p)
+	if err != nil {
+		return nil, h.fail(err)
+	}
+	if ra, ok := f.(io.ReaderAt); ok {
+		return ra, nil
+	}
+	if _, ok := f.(io.Seeker); !ok {
+		f.Close()
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+	return &seekReaderAt{f: f}, nil
+}
+
+// seekReaderAt 让只支持 Seek 的文件可以按位置读取，sftp 会在结束时调用 Close
+type seekReaderAt struct {
+	mu sync.Mutex
+	f  fs.File
+}
+
+func (r *seekReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.f.(io.Seeker).Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r.f, b)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *seekReaderAt) Close() error { return r.f.Close() }
+
+func (h *sftpHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	p := cleanPath(r.Filepath)
+	if err := h.canWrite(p); err != nil {
+		return nil, h.fail(err)
+	}
+	dst := h.s.root + p
+	flags := r.Pflags()
+	if info, err := os.Stat(dst); err == nil {
+		switch {
+		case info.IsDir(), flags.Excl:
+			return nil, errFileExists
+		case flags.Append || !flags.Trunc:
+			// 上传先写入临时文件，完成后再替换，没法在原文件上续传
+			return nil, sftp.ErrSSHFxOpUnsupported
+		}
+	}
+	if info, err := os.Stat(path.Dir(dst)); err != nil || !info.IsDir() {
+		return nil, sftp.ErrSSHFxNoSuchFile
+	}
+	tmp, err := os.CreateTemp(path.Dir(dst), ".upload-*")
+	if err != nil {
+		return nil, h.fail(err)
+	}
+	n, limitErr := h.s.uploadLimit()
+	return &sftpUpload{h: h, tmp: tmp, p: p, dst: dst, limit: n, limitErr: limitErr}, nil
+}
+
+// sftpUpload 把上传的内容写入临时文件，Close 时检查没有出错后再移动到目标位置
+type sftpUpload struct {
+	h        *sftpHandler
+	tmp      *os.File
+	p        string // 相对根目录的路径
+	dst      string
+	limit    int64 // 最多能写入的字节数，-1 表示不限制
+	limitErr error
+
+	mu  sync.Mutex
+	err error // 写入或传输过程中的错误
+}
+
+func (u *sftpUpload) WriteAt(b []byte, off int64) (int, error) {
+	if u.limit >= 0 && off+int64(len(b)) > u.limit {
+		u.TransferError(u.limitErr)
+		return 0, u.limitErr
+	}
+	n, err := u.tmp.WriteAt(b, off)
+	if err != nil {
+		u.TransferError(err)
+	}
+	return n, err
+}
+
+// TransferError 在传输中断时由 sftp 调用，临时文件会被丢弃
+func (u *sftpUpload) TransferError(err error) {
+	u.mu.Lock()
+	if u.err == nil {
+		u.err = err
+	}
+	u.mu.Unlock()
+}
+
+func (u *sftpUpload) Close() error {
+	defer u.h.s.uploaded()
+	err := u.tmp.Close()
+	u.mu.Lock()
+	if u.err != nil {
+		err = u.err
+	}
+	u.mu.Unlock()
+	if err == nil {
+		os.Chmod(u.tmp.Name(), 0644)
+		err = u.h.s.replaceFile(u.tmp.Name(), u.p)
+	}
+	if err != nil {
+		os.Remove(u.tmp.Name())
+		return u.h.fail(err)
+	}
+	if info, err := os.Stat(u.dst); err == nil {
+		u.h.notify(eventUpload, u.p, info.Size())
+		u.h.audit(auditEntry{Action: auditUpload, Path: u.p, Size: info.Size()})
+	}
+	return nil
+}
+
+func (h *sftpHandler) Filecmd(r *sftp.Request) error {
+	p := cleanPath(r.Filepath)
+	if r.Method == "Link" || r.Method == "Symlink" {
+		return sftp.ErrSSHFxOpUnsupported
+	}
+	if err := h.canWrite(p); err != nil {
+		return h.fail(err)
+	}
+	dst := h.s.root + p
+	var err error
+	switch r.Method {
+	case "Setstat":
+		// 不修改权限和时间，但客户端上传后会设置，返回成功避免报错
+		_, err = os.Stat(dst)
+	case "Rename", "PosixRename":
+		to := cleanPath(r.Target)
+		if err := h.canWrite(to); err != nil {
+			return h.fail(err)
+		}
+		if strings.HasPrefix(to+"/", p+"/") {
+			return errBadName
+		}
+		// 标准的 SFTP rename 不覆盖已存在的文件，posix-rename@openssh.com 扩展会覆盖
+		if _, err := os.Lstat(h.s.root + to); err == nil && r.Method == "Rename" {
+			return errFileExists
+		}
+		if err = os.Rename(dst, h.s.root+to); err == nil {
+			h.audit(auditEntry{Action: auditRename, Path: p, To: to})
+		}
+	case "Mkdir":
+		err = os.Mkdir(dst, 0755)
+		if errors.Is(err, fs.ErrExist) {
+			err = errFileExists
+		} else if err == nil {
+			h.audit(auditEntry{Action: auditMkdir, Path: p})
+		}
+	case "Rmdir", "Remove":
+		info, serr := os.Lstat(dst)
+		if serr != nil {
+			return h.fail(serr)
+		}
+		if info.IsDir() != (r.Method == "Rmdir") {
+			return sftp.ErrSSHFxFailure
+		}
+		if h.s.trashTTL > 0 && !info.IsDir() {
+			// 文件放入回收站，Rmdir 只能删除空目录，直接删除
+			var who string
+			if h.u != nil {
+				who = h.u.Name
+			}
+			err = h.s.moveToTrash(p, info, who)
+		} else {
+			err = os.Remove(dst)
+		}
+		if err == nil {
+			h.notify(eventDelete, p, 0)
+			e := auditEntry{Action: auditDelete, Path: p}
+			if info.IsDir() {
+				e.Detail = "directory"
+			}
+			h.audit(e)
+		}
+	default:
+		return sftp.ErrSSHFxOpUnsupported
+	}
+	if err != nil {
+		return h.fail(err)
+	}
+	return nil
+}
+
+// notify 发送 SFTP 操作的 webhook 事件
+func (h *sftpHandler) notify(event, p string, size int64) {
+	ev := webhookEvent{Event: event, Path: p, Size: size, Via: "sftp", Client: remoteIP(h.remote)}
+	if h.u != nil {
+		ev.User = h.u.Name
+	}
+	h.s.notify(ev)
+}
+
+// audit 记录 SFTP 会话完成的操作
+func (h *sftpHandler) audit(e auditEntry) {
+	e.Via, e.Client = "sftp", remoteIP(h.remote)
+	if h.u != nil {
+		e.User = h.u.Name
+	}
+	h.s.audit(e)
+}
+
+func (h *sftpHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	p := cleanPath(r.Filepath)
+	if err := h.s.sessionAccess(h.u, p, permRead); err != nil {
+		return nil, h.fail(err)
+	}
+	switch r.Method {
+	case "List":
+		entries, err := h.s.readDir(p)
+		if err != nil {
+			return nil, h.fail(err)
+		}
+		var infos listerAt
+		for _, e := range entries {
+			if isHidden(path.Join(p, e.Name())) {
+				continue
+			}
+			if fi, err := e.Info(); err == nil {
+				infos = append(infos, fi)
+			}
+		}
+		return infos, nil
+	case "Stat", "Lstat":
+		info, err := h.s.stat(p)
+		if err != nil {
+			return nil, h.fail(err)
+		}
+		return listerAt{info}, nil
+	default:
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+}
+
+// listerAt 是一次性读出的目录列表
+type listerAt []fs.FileInfo
+
+func (l listerAt) ListAt(infos []fs.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(infos, l[offset:])
+	if n < len(infos) {
+		return n, io.EOF
+	}
+	return n, nil
+}
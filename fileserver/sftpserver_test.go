@@ -0,0 +1,244 @@
+package fileserver
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// startSFTP 在本机随机端口上启动 SFTP 服务，返回地址
+func startSFTP(t *testing.T, h *Handler, conf SFTPServerConfig) string {
+	t.Helper()
+	if conf.HostKey == "" {
+		conf.HostKey = filepath.Join(t.TempDir(), "host_key")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go h.ServeSFTP(ln, conf)
+	return ln.Addr().String()
+}
+
+func dialSSH(addr, name string, auth ...ssh.AuthMethod) (*ssh.Client, error) {
+	return ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User: name, Auth: auth, HostKeyCallback: ssh.InsecureIgnoreHostKey(), Timeout: 5 * time.Second,
+	})
+}
+
+func dialSFTP(t *testing.T, addr, name string, auth ...ssh.AuthMethod) *sftp.Client {
+	t.Helper()
+	conn, err := dialSSH(addr, name, auth...)
+	if err != nil {
+		t.Fatalf("login as %s: %v", name, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c, err := sftp.NewClient(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func readRemote(c *sftp.Client, p string) (string, error) {
+	f, err := c.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	return string(b), err
+}
+
+func TestSFTPServerReadOnly(t *testing.T) {
+	root := newTestRoot(t)
+	os.WriteFile(filepath.Join(root, "sub", ".password"), []byte("pw"), 0644)
+	os.MkdirAll(filepath.Join(root, uploadsDir), 0755)
+	os.WriteFile(filepath.Join(root, uploadsDir, "part"), []byte("partial"), 0644)
+	h := newTestHandler(t, Config{Root: root}, WithReadWrite())
+	c := dialSFTP(t, startSFTP(t, h, SFTPServerConfig{}), "anonymous")
+
+	infos, err := c.ReadDir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+	}
+	if !slices.Equal(names, []string{"a.txt", "sub"}) {
+		t.Errorf("ReadDir = %q", names)
+	}
+	if got, err := readRemote(c, "/a.txt"); err != nil || got != "hello" {
+		t.Errorf("read a.txt = %q, %v", got, err)
+	}
+	if fi, err := c.Stat("a.txt"); err != nil || fi.Size() != 5 {
+		t.Errorf("Stat = %v, %v", fi, err)
+	}
+	if _, err := readRemote(c, "/"+uploadsDir+"/part"); err == nil {
+		t.Error("read of a hidden file succeeded")
+	}
+	// 受保护的目录在 SFTP 中无法解锁
+	if _, err := readRemote(c, "/sub/b.txt"); err == nil {
+		t.Error("read in a password protected directory succeeded")
+	}
+	if _, err := c.ReadDir("/sub"); err == nil {
+		t.Error("listing a password protected directory succeeded")
+	}
+
+	// 没有 Writable 时即使服务是读写模式也不能修改
+	if _, err := c.Create("/new.txt"); err == nil {
+		t.Error("upload succeeded on a read-only SFTP server")
+	}
+	if err := c.Remove("/a.txt"); err == nil {
+		t.Error("remove succeeded on a read-only SFTP server")
+	}
+	if err := c.Mkdir("/dir"); err == nil {
+		t.Error("mkdir succeeded on a read-only SFTP server")
+	}
+}
+
+func TestSFTPServerAuth(t *testing.T) {
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := ssh.NewSignerFromKey(key)
+	sshPub, _ := ssh.NewPublicKey(pub)
+	keys := filepath.Join(t.TempDir(), "authorized_keys")
+	os.WriteFile(keys, append(bytes.TrimSpace(ssh.MarshalAuthorizedKey(sshPub)), " alice\n"...), 0600)
+
+	config := writeConfig(t, `{
+		"users": [{"name": "alice", "password": "pw", "groups": ["staff"]}, {"name": "bob", "password": "pw"}],
+		"acl": [{"path": "/sub/**", "users": ["@staff"], "action": "allow"}, {"path": "/sub/**", "users": ["*"], "action": "deny"}]
+	}`)
+	h := newTestHandler(t, Config{Root: newTestRoot(t), ConfigFile: config, RequireAuth: true})
+	addr := startSFTP(t, h, SFTPServerConfig{AuthorizedKeys: keys})
+
+	if _, err := dialSSH(addr, "anonymous"); err == nil {
+		t.Error("anonymous login succeeded with require_auth")
+	}
+	if _, err := dialSSH(addr, "alice", ssh.Password("wrong")); err == nil {
+		t.Error("login with a wrong password succeeded")
+	}
+	if _, err := dialSSH(addr, "bob", ssh.PublicKeys(signer)); err == nil {
+		t.Error("alice's key logged in as bob")
+	}
+
+	// 公钥登录的用户使用配置文件中同名用户的组
+	alice := dialSFTP(t, addr, "alice", ssh.PublicKeys(signer))
+	if got, err := readRemote(alice, "/sub/b.txt"); err != nil || got != "world" {
+		t.Errorf("alice: read sub/b.txt = %q, %v", got, err)
+	}
+	bob := dialSFTP(t, addr, "bob", ssh.Password("pw"))
+	if _, err := readRemote(bob, "/sub/b.txt"); err == nil {
+		t.Error("bob: read sub/b.txt succeeded despite the ACL")
+	}
+	if got, err := readRemote(bob, "/a.txt"); err != nil || got != "hello" {
+		t.Errorf("bob: read a.txt = %q, %v", got, err)
+	}
+}
+
+func TestSFTPServerWrite(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root}, WithReadWrite(), WithUploadLimits(10, 0, 0))
+	c := dialSFTP(t, startSFTP(t, h, SFTPServerConfig{Writable: true}), "anonymous")
+
+	if err := c.Mkdir("/docs"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := c.Create("/docs/readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("read me"))
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "docs", "readme.txt")); string(b) != "read me" {
+		t.Errorf("uploaded file = %q", b)
+	}
+
+	f, err = c.Create("/big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(make([]byte, 11))
+	if err := f.Close(); err == nil {
+		t.Error("upload over -max-upload succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(root, "big.bin")); err == nil {
+		t.Error("oversized upload was kept")
+	}
+	if _, err := c.Create("/.password"); err == nil {
+		t.Error("creating .password succeeded")
+	}
+
+	if err := c.Rename("/docs/readme.txt", "/a.txt"); err == nil {
+		t.Error("rename over an existing file succeeded")
+	}
+	if err := c.Rename("/docs/readme.txt", "/docs/README.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Rename("/docs", "/docs/inner"); err == nil {
+		t.Error("moving a directory into itself succeeded")
+	}
+	if err := c.RemoveDirectory("/docs"); err == nil {
+		t.Error("rmdir of a non-empty directory succeeded")
+	}
+	if err := c.Remove("/docs/README.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveDirectory("/docs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "docs")); err == nil {
+		t.Error("docs was not removed")
+	}
+}
+
+// TestSFTPServerNoShell 检查只提供 sftp 子系统，不能执行命令
+func TestSFTPServerNoShell(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)})
+	conn, err := dialSSH(startSFTP(t, h, SFTPServerConfig{}), "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sess, err := conn.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+	if out, err := sess.Output("cat /etc/passwd"); err == nil {
+		t.Errorf("exec succeeded: %q", out)
+	}
+	if _, _, err := conn.OpenChannel("direct-tcpip", nil); err == nil {
+		t.Error("port forwarding channel was accepted")
+	}
+}
+
+func TestLoadAuthorizedKeys(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	sshPub, _ := ssh.NewPublicKey(pub)
+	line := bytes.TrimSpace(ssh.MarshalAuthorizedKey(sshPub))
+	file := filepath.Join(t.TempDir(), "authorized_keys")
+
+	os.WriteFile(file, append(append([]byte("# comment\n\n"), line...), " carol\n"...), 0600)
+	keys, err := loadAuthorizedKeys(file)
+	if err != nil || len(keys) != 1 || keys[0].name != "carol" {
+		t.Errorf("loadAuthorizedKeys = %v, %v", keys, err)
+	}
+	os.WriteFile(file, line, 0600)
+	if _, err := loadAuthorizedKeys(file); err == nil {
+		t.Error("key without a user name was accepted")
+	}
+}
@@ -0,0 +1,451 @@
+package fileserver
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 分享链接 /s/<token>：token 由链接信息的 JSON 和 HMAC-SHA256 签名组成，
+// 服务端不需要保存链接本身就能校验。另外记录每个链接已经被下载的次数、本服务签发过的链接（管理页面列出）和被撤销的链接
+
+var (
+	errShareInvalid = errors.New("invalid share link")
+	errShareExpired = errors.New("share link expired")
+	errShareRevoked = errors.New("share link revoked")
+)
+
+// shareLink 是分享链接中携带的信息
+type shareLink struct {
+	ID      string     `json:"i"`
+	Path    string     `json:"p"`           // 相对根目录的路径，以 / 开头
+	Expires int64      `json:"e,omitempty"` // 过期时间（Unix 秒），0 表示不过期
+	MaxUses int        `json:"n,omitempty"` // 最多下载次数，0 表示不限
+	By      *shareUser `json:"u,omitempty"` // 签发链接的用户，由 Handler.Share（命令行 -share）签发时为 nil
+}
+
+// shareUser 记录签发链接的用户。打开链接时按他的访问控制规则过滤，他看不到的文件通过链接同样看不到
+type shareUser struct {
+	Name   string   `json:"n,omitempty"` // 为空表示没有登录的用户
+	Groups []string `json:"g,omitempty"`
+	Role   string   `json:"r,omitempty"`
+	Root   string   `json:"o,omitempty"`
+}
+
+// newShareUser 记录用户 u，没有登录时也返回非 nil，和程序签发的链接区分开
+func newShareUser(u *user) *shareUser {
+	if u == nil {
+		return &shareUser{}
+	}
+	return &shareUser{Name: u.Name, Groups: u.Groups, Role: u.Role, Root: u.Root}
+}
+
+func (b *shareUser) user() *user {
+	if b.Name == "" {
+		return nil
+	}
+	return &user{Name: b.Name, Groups: b.Groups, Role: b.Role, Root: b.Root}
+}
+
+// shareStore 负责签发、校验分享链接并统计下载次数
+type shareStore struct {
+	secret []byte
+	file   string // 保存下载次数等的文件，为空时只保存在内存中
+
+	mu      sync.Mutex
+	uses    map[string]int
+	links   map[string]shareLink // 本服务签发的链接，用 -share 在命令行生成的不在其中
+	revoked map[string]bool
+}
+
+// shareFile 是 -share-db 文件的内容。早期版本的文件只有 uses 一个映射
+type shareFile struct {
+	Uses    map[string]int       `json:"uses"`
+	Links   map[string]shareLink `json:"links"`
+	Revoked map[string]bool      `json:"revoked"`
+}
+
+func newShareStore(secret []byte, file string) (*shareStore, error) {
+	st := &shareStore{secret: secret, file: file, uses: make(map[string]int), links: make(map[string]shareLink), revoked: make(map[string]bool)}
+	if file == "" {
+		return st, nil
+	}
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var legacy map[string]int
+	if json.Unmarshal(b, &legacy) == nil && legacy != nil {
+		st.uses = legacy
+		return st, nil
+	}
+	var sf shareFile
+	if err := json.Unmarshal(b, &sf); err != nil {
+		return nil, err
+	}
+	for id, n := range sf.Uses {
+		st.uses[id] = n
+	}
+	for id, link := range sf.Links {
+		st.links[id] = link
+	}
+	for id := range sf.Revoked {
+		st.revoked[id] = true
+	}
+	return st, nil
+}
+
+// randomSecret 生成随机密钥，未指定 -share-secret 时使用，重启后之前的链接失效
+func randomSecret() []byte {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return b
+}
+
+func (st *shareStore) sign(payload string) string {
+	mac := hmac.New(sha256.New, st.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// mint 为根目录下的 p 签发分享链接，ttl 和 maxUses 为 0 时不限制，by 是签发的用户
+func (st *shareStore) mint(p string, ttl time.Duration, maxUses int, by *shareUser) string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	link := shareLink{ID: hex.EncodeToString(id), Path: p, MaxUses: maxUses, By: by}
+	if ttl > 0 {
+		link.Expires = time.Now().Add(ttl).Unix()
+	}
+
+	st.mu.Lock()
+	st.links[link.ID] = link
+	st.save()
+	st.mu.Unlock()
+	return st.token(link)
+}
+
+// token 返回链接的令牌，同一个链接每次得到的令牌相同
+func (st *shareStore) token(link shareLink) string {
+	b, _ := json.Marshal(link)
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + st.sign(payload)
+}
+
+// parse 校验签名、有效期和是否被撤销，返回链接信息
+func (st *shareStore) parse(token string) (*shareLink, error) {
+	link, err := st.decode(token)
+	if err != nil {
+		return nil, err
+	}
+	if st.isRevoked(link.ID) {
+		return nil, errShareRevoked
+	}
+	if link.Expires > 0 && time.Now().Unix() > link.Expires {
+		return nil, errShareExpired
+	}
+	if link.MaxUses > 0 && st.used(link.ID) >= link.MaxUses {
+		return nil, errShareExpired
+	}
+	return link, nil
+}
+
+// decode 只校验签名，返回链接信息
+func (st *shareStore) decode(token string) (*shareLink, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(st.sign(payload))) {
+		return nil, errShareInvalid
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errShareInvalid
+	}
+	var link shareLink
+	if err := json.Unmarshal(b, &link); err != nil {
+		return nil, errShareInvalid
+	}
+	return &link, nil
+}
+
+func (st *shareStore) isRevoked(id string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.revoked[id]
+}
+
+// revoke 撤销链接 id，之后再打开返回 410
+func (st *shareStore) revoke(id string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.revoked[id] = true
+	st.save()
+}
+
+// shareInfo 是管理页面上列出的一个分享链接
+type shareInfo struct {
+	shareLink
+	Uses    int
+	Revoked bool
+}
+
+// list 返回本服务签发的、还没有过期的链接，按路径排序
+func (st *shareStore) list() []shareInfo {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := time.Now().Unix()
+	var list []shareInfo
+	for id, link := range st.links {
+		if link.Expires > 0 && now > link.Expires {
+			continue
+		}
+		list = append(list, shareInfo{shareLink: link, Uses: st.uses[id], Revoked: st.revoked[id]})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Path != list[j].Path {
+			return list[i].Path < list[j].Path
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+func (st *shareStore) used(id string) int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.uses[id]
+}
+
+// use 记录一次下载，次数用完时返回 false
+func (st *shareStore) use(link *shareLink) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if link.MaxUses > 0 && st.uses[link.ID] >= link.MaxUses {
+		return false
+	}
+	st.uses[link.ID]++
+	st.save()
+	return true
+}
+
+// save 把下载次数写入文件，调用方需持有锁
+func (st *shareStore) save() {
+	if st.file == "" {
+		return
+	}
+	// 过期的链接不再需要保存，撤销记录一起删掉
+	now := time.Now().Unix()
+	for id, link := range st.links {
+		if link.Expires > 0 && now > link.Expires {
+			delete(st.links, id)
+			delete(st.revoked, id)
+		}
+	}
+	b, _ := json.Marshal(shareFile{Uses: st.uses, Links: st.links, Revoked: st.revoked})
+	tmp := st.file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err == nil {
+		os.Rename(tmp, st.file)
+	}
+}
+
+// shareHandler 处理 /s/<token>[/子路径]，文件直接下载，目录显示只读列表
+func (s *server) shareHandler(w http.ResponseWriter, r *http.Request) {
+	token, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/s/"), "/")
+	link, err := s.shares.parse(token)
+	if errors.Is(err, errShareExpired) {
+		s.httpError(w, r, http.StatusGone, "Share link expired")
+		return
+	}
+	if errors.Is(err, errShareRevoked) {
+		s.httpError(w, r, http.StatusGone, "Share link revoked")
+		return
+	}
+	if err != nil {
+		s.httpError(w, r, http.StatusNotFound, "Share link not found")
+		return
+	}
+
+	// 子路径先清理，保证不会跳出分享的目录；分享的是单个文件时不允许子路径
+	rel := path.Clean("/" + sub)
+	if isHidden(rel) {
+		s.httpError(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+	if target, err := s.stat(link.Path); err != nil || (!target.IsDir() && rel != "/") {
+		s.httpError(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+	p := path.Join(link.Path, rel)
+	info, err := s.stat(p)
+	if err != nil || !s.shareAllowed(link, p) {
+		s.httpError(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+	// 链接不能代替目录密码，打开受保护的目录或其中的文件时同样要输入密码
+	if dir, locked := s.lockedDir(r, p); locked {
+		s.renderStatus(w, http.StatusUnauthorized, "password.html", PasswordData{Page: s.page(w, r), Dir: dir, Next: r.URL.RequestURI()})
+		return
+	}
+
+	base := s.base + "/s/" + token
+	if info.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+		dirURL := base + strings.TrimSuffix(rel, "/") + "/"
+		list, readme, err := s.listFiles(p, listLinks{
+			dir:      strings.TrimSuffix(p, "/") + "/",
+			browse:   dirURL,
+			download: dirURL,
+			view:     dirURL,
+			viewArgs: "?inline=1",
+		})
+		if err != nil {
+			s.httpError(w, r, http.StatusInternalServerError, "Failed to read directory")
+			return
+		}
+		// 签发者没有权限的和还没有解锁的受保护目录不显示
+		list = slices.DeleteFunc(list, func(f FileInfo) bool {
+			_, locked := s.lockedDir(r, f.Path)
+			return locked || !s.shareAllowed(link, f.Path)
+		})
+		if readme != "" && !s.shareAllowed(link, path.Join(p, readme)) {
+			readme = ""
+		}
+		if s.hooks.OnListing != nil {
+			list = s.hooks.OnListing(r, p, list)
+		}
+		data := PageData{Page: s.page(w, r), Files: list, Path: dirURL, Shared: true}
+		if rel != "/" {
+			data.Parent = base + path.Dir(rel)
+			if !strings.HasSuffix(data.Parent, "/") {
+				data.Parent += "/"
+			}
+		}
+		if readme != "" {
+			data.Readme = s.renderReadme(path.Join(p, readme))
+		}
+		s.render(w, "listing.html", data)
+		return
+	}
+
+	if !s.allowDownload(w, r, p, info) {
+		return
+	}
+	disposition := "attachment"
+	if r.URL.Query().Get("inline") != "" {
+		disposition = "inline"
+	}
+	f, err := s.open(p)
+	if err != nil {
+		s.pathError(w, r, err)
+		return
+	}
+	defer f.Close()
+	if info, f, err = s.stripMetadata(info, f); err != nil {
+		s.httpError(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	w.Header().Set("Content-Disposition", contentDisposition(disposition, info.Name()))
+	s.setContentType(w, info.Name())
+	s.serveDownload(&shareUseWriter{ResponseWriter: w, s: s, r: r, link: link}, r, p, info, f)
+}
+
+// shareAllowed 判断通过链接能否读取 p：签发者按访问控制规则能读取的才可以，程序签发的链接不检查
+func (s *server) shareAllowed(link *shareLink, p string) bool {
+	return link.By == nil || s.allowed(link.By.user(), p, permRead)
+}
+
+// shareUseWriter 在真正开始发送文件内容时才记一次下载。HEAD、304 和断点续传的后续分段都不计数
+type shareUseWriter struct {
+	http.ResponseWriter
+	s      *server
+	r      *http.Request
+	link   *shareLink
+	wrote  bool
+	denied bool
+}
+
+func (w *shareUseWriter) WriteHeader(code int) {
+	if w.wrote {
+		return
+	}
+	w.wrote = true
+	first := code == http.StatusOK || code == http.StatusPartialContent && strings.HasPrefix(w.r.Header.Get("Range"), "bytes=0-")
+	if w.r.Method == http.MethodGet && first && !w.s.shares.use(w.link) {
+		// 并发的请求先用完了次数，换成错误页面，已经设置的文件相关响应头不再适用
+		w.denied = true
+		for _, h := range []string{"Content-Length", "Content-Range", "Content-Disposition", "Content-Encoding", "ETag", "Last-Modified", "Accept-Ranges"} {
+			w.Header().Del(h)
+		}
+		w.s.httpError(w.ResponseWriter, w.r, http.StatusGone, "Share link expired")
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *shareUseWriter) Write(b []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.denied {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *shareUseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// shareAPIHandler 处理 POST /api/share，参数 path、hours、downloads，返回分享地址
+func (s *server) shareAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		s.httpError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	p := path.Clean("/" + r.FormValue("path"))
+	if _, err := s.stat(p); err != nil {
+		s.httpError(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+	// 有根目录的用户只能分享根目录下面的内容，上级目录只能浏览；自己不能读取、还没有解锁的也不能分享
+	u := currentUser(r)
+	if u != nil && u.Root != "" && !within(u.Root, p) || !s.allowed(u, p, permRead) {
+		s.httpError(w, r, http.StatusForbidden, "Forbidden")
+		return
+	}
+	if _, locked := s.lockedDir(r, p); locked {
+		s.httpError(w, r, http.StatusForbidden, "Password protected")
+		return
+	}
+	hours, _ := strconv.ParseFloat(r.FormValue("hours"), 64)
+	downloads, _ := strconv.Atoi(r.FormValue("downloads"))
+	if hours < 0 || downloads < 0 {
+		s.httpError(w, r, http.StatusBadRequest, "Invalid hours or downloads")
+		return
+	}
+
+	token := s.shares.mint(p, time.Duration(hours*float64(time.Hour)), downloads, newShareUser(u))
+	s.auditHTTP(r, auditEntry{Action: auditShare, Path: p, Detail: fmt.Sprintf("hours=%g downloads=%d", hours, downloads)})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"url": s.origin(r) + s.base + "/s/" + token})
+}
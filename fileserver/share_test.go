@@ -0,0 +1,198 @@
+package fileserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShareLinkSignature(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)}, WithShareSecret("test"))
+	dir, err := h.Share("sub", time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, body := do(t, h, httptest.NewRequest("GET", "/s/"+dir+"/", nil))
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, "/s/"+dir+"/b.txt") {
+		t.Fatalf("shared directory: status = %d", res.StatusCode)
+	}
+	if _, body := do(t, h, httptest.NewRequest("GET", "/s/"+dir+"/b.txt", nil)); body != "world" {
+		t.Errorf("file in shared directory = %q", body)
+	}
+	// 子路径不能跳出分享的目录
+	if res, body := do(t, h, httptest.NewRequest("GET", "/s/"+dir+"/../a.txt", nil)); res.StatusCode == http.StatusOK && body == "hello" {
+		t.Error("share link escaped the shared directory")
+	}
+
+	// 改动链接内容后签名不再匹配
+	payload, sig, _ := strings.Cut(dir, ".")
+	forged := h.s.shares.mint("/", 0, 0, nil)
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+	for _, token := range []string{payload + "." + sig[1:], forgedPayload + "." + sig, "garbage"} {
+		if res, _ := do(t, h, httptest.NewRequest("GET", "/s/"+token+"/", nil)); res.StatusCode != http.StatusNotFound {
+			t.Errorf("tampered token %q: status = %d, want 404", token, res.StatusCode)
+		}
+	}
+	// 其他密钥签发的链接无效
+	other := newTestHandler(t, Config{Root: newTestRoot(t)}, WithShareSecret("other"))
+	if res, _ := do(t, other, httptest.NewRequest("GET", "/s/"+dir+"/", nil)); res.StatusCode != http.StatusNotFound {
+		t.Errorf("token from another secret: status = %d, want 404", res.StatusCode)
+	}
+}
+
+func TestShareLinkExpiry(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)}, WithShareSecret("test"))
+	b, _ := json.Marshal(shareLink{ID: "x", Path: "/a.txt", Expires: time.Now().Add(-time.Minute).Unix()})
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	token := payload + "." + h.s.shares.sign(payload)
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/s/"+token, nil)); res.StatusCode != http.StatusGone {
+		t.Errorf("expired link: status = %d, want 410", res.StatusCode)
+	}
+}
+
+func TestShareDownloadLimit(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)}, WithShareSecret("test"))
+	token, err := h.Share("a.txt", 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(method, rng string) int {
+		r := httptest.NewRequest(method, "/s/"+token, nil)
+		if rng != "" {
+			r.Header.Set("Range", rng)
+		}
+		res, _ := do(t, h, r)
+		return res.StatusCode
+	}
+	// HEAD 和断点续传的后续分段不计数
+	for _, c := range []struct {
+		method, rng string
+		want        int
+	}{
+		{"HEAD", "", http.StatusOK},
+		{"HEAD", "", http.StatusOK},
+		{"GET", "bytes=2-", http.StatusPartialContent},
+		{"GET", "", http.StatusOK},
+		{"HEAD", "", http.StatusOK},
+		{"GET", "bytes=0-1", http.StatusPartialContent},
+		{"GET", "", http.StatusGone},
+		{"HEAD", "", http.StatusGone},
+	} {
+		if got := get(c.method, c.rng); got != c.want {
+			t.Errorf("%s %s: status = %d, want %d", c.method, c.rng, got, c.want)
+		}
+	}
+}
+
+func TestShareStoreFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "shares.json")
+	// 早期版本的文件只有下载次数
+	os.WriteFile(file, []byte(`{"abc": 2}`), 0600)
+	st, err := newShareStore([]byte("test"), file)
+	if err != nil || st.used("abc") != 2 {
+		t.Fatalf("legacy file: uses = %d, err = %v", st.used("abc"), err)
+	}
+
+	token := st.mint("/a.txt", time.Hour, 3, nil)
+	link, _ := st.parse(token)
+	st.revoke("abc")
+	st, err = newShareStore([]byte("test"), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.used("abc") != 2 || !st.isRevoked("abc") {
+		t.Error("uses or revocation lost after reload")
+	}
+	if list := st.list(); len(list) != 1 || list[0].ID != link.ID || st.token(list[0].shareLink) != token {
+		t.Errorf("minted links after reload = %+v", list)
+	}
+}
+
+// mintShare 以用户 name（为空表示不登录）通过 /api/share 生成链接，返回 /s/ 后面的令牌
+func mintShare(t *testing.T, h http.Handler, name, p string) string {
+	t.Helper()
+	r := httptest.NewRequest("POST", "/api/share", strings.NewReader("path="+p))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if name != "" {
+		r.SetBasicAuth(name, "pw")
+	}
+	res, body := do(t, h, r)
+	var data struct{ URL string }
+	if err := json.Unmarshal([]byte(body), &data); err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("share %s as %q: got %d %s", p, name, res.StatusCode, body)
+	}
+	_, token, _ := strings.Cut(data.URL, "/s/")
+	return token
+}
+
+func TestShareACL(t *testing.T) {
+	config := writeConfig(t, `{
+		"users": [{"name": "alice", "password": "pw", "groups": ["staff"]}, {"name": "bob", "password": "pw"}],
+		"acl": [
+			{"path": "/sub/**", "users": ["@staff"], "action": "allow"},
+			{"path": "/sub/**", "users": ["*"], "action": "deny"}
+		]
+	}`)
+	h := newTestHandler(t, Config{Root: newTestRoot(t), ConfigFile: config}, WithShareSecret("test"))
+
+	// bob 看不到 /sub，分享根目录后通过链接同样看不到
+	token := mintShare(t, h, "bob", "/")
+	if _, body := do(t, h, httptest.NewRequest("GET", "/s/"+token+"/", nil)); !strings.Contains(body, "a.txt") || strings.Contains(body, ">sub</a>") {
+		t.Errorf("bob's share lists denied directory: %s", body)
+	}
+	for _, p := range []string{"/sub/", "/sub/b.txt"} {
+		if res, body := do(t, h, httptest.NewRequest("GET", "/s/"+token+p, nil)); res.StatusCode != http.StatusNotFound || body == "world" {
+			t.Errorf("bob's share %s: status = %d", p, res.StatusCode)
+		}
+	}
+	// alice 可以读取，她分享的链接也可以
+	token = mintShare(t, h, "alice", "/")
+	if _, body := do(t, h, httptest.NewRequest("GET", "/s/"+token+"/sub/b.txt", nil)); body != "world" {
+		t.Errorf("alice's share /sub/b.txt = %q", body)
+	}
+	// 不能分享自己读取不了的路径
+	r := httptest.NewRequest("POST", "/api/share", strings.NewReader("path=/sub"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("bob", "pw")
+	if res, _ := do(t, h, r); res.StatusCode != http.StatusForbidden {
+		t.Errorf("bob sharing /sub: status = %d, want 403", res.StatusCode)
+	}
+}
+
+func TestShareLockedDir(t *testing.T) {
+	root := newTestRoot(t)
+	os.MkdirAll(filepath.Join(root, "locked"), 0755)
+	os.WriteFile(filepath.Join(root, "locked", "secret.txt"), []byte("LOCKED"), 0644)
+	os.WriteFile(filepath.Join(root, "locked", passwordFile), []byte("pw"), 0644)
+	h := newTestHandler(t, Config{Root: root}, WithShareSecret("test"))
+
+	// 分享根目录不能绕过其中目录的密码：列表中不显示，直接打开时要求输入密码
+	token := mintShare(t, h, "", "/")
+	if _, body := do(t, h, httptest.NewRequest("GET", "/s/"+token+"/", nil)); strings.Contains(body, ">locked</a>") {
+		t.Error("share listing shows a locked directory")
+	}
+	res, body := do(t, h, httptest.NewRequest("GET", "/s/"+token+"/locked/secret.txt", nil))
+	if res.StatusCode != http.StatusUnauthorized || body == "LOCKED" {
+		t.Errorf("locked file through share: status = %d", res.StatusCode)
+	}
+	// 输入密码后可以打开
+	cookie := unlock(t, h, "/locked", "pw", "/").Cookies()[0]
+	r := httptest.NewRequest("GET", "/s/"+token+"/locked/secret.txt", nil)
+	r.AddCookie(cookie)
+	if _, body := do(t, h, r); body != "LOCKED" {
+		t.Errorf("unlocked file through share = %q", body)
+	}
+
+	// 没有解锁时不能分享受保护的目录
+	r = httptest.NewRequest("POST", "/api/share", strings.NewReader("path=/locked"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if res, _ := do(t, h, r); res.StatusCode == http.StatusOK {
+		t.Error("shared a locked directory without the password")
+	}
+}
@@ -0,0 +1,40 @@
+package fileserver
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// 静态网站模式（-serve-index）：目录下有 index.html 时直接返回它，不生成目录列表，?list=1 仍然显示列表。
+// 其他文件也按原路径返回，网页中引用的样式、脚本、图片才能正常加载
+
+// indexHandler 处理静态网站模式下的请求，需要显示目录列表时返回 false
+func (s *server) indexHandler(w http.ResponseWriter, r *http.Request) bool {
+	if r.URL.Query().Get("list") != "" {
+		return false
+	}
+	p := cleanPath(r.URL.Path)
+	info, err := s.stat(p)
+	if err != nil {
+		return false
+	}
+	if !info.IsDir() {
+		s.serveStatic(w, r, p, info)
+		return true
+	}
+	index := path.Join(p, "index.html")
+	info, err = s.stat(index)
+	if err != nil || info.IsDir() || !s.allowed(currentUser(r), index, permRead) {
+		return false
+	}
+	// 页面中的相对地址以目录为基准，缺少结尾的 / 时先跳转
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		u := *r.URL
+		u.Path += "/"
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+		return true
+	}
+	s.serveStatic(w, r, index, info)
+	return true
+}
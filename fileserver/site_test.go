@@ -0,0 +1,41 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServeIndex(t *testing.T) {
+	root := newTestRoot(t)
+	os.Mkdir(filepath.Join(root, "docs"), 0755)
+	os.WriteFile(filepath.Join(root, "docs", "index.html"), []byte("<h1>Docs</h1>"), 0644)
+	os.WriteFile(filepath.Join(root, "docs", "style.css"), []byte("h1{}"), 0644)
+	h := newTestHandler(t, Config{Root: root, ServeIndex: true})
+
+	if res, body := do(t, h, httptest.NewRequest("GET", "/docs/", nil)); res.StatusCode != http.StatusOK || body != "<h1>Docs</h1>" {
+		t.Errorf("index: got %d %q", res.StatusCode, body)
+	}
+	res, body := do(t, h, httptest.NewRequest("GET", "/docs/style.css", nil))
+	if body != "h1{}" || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/css") {
+		t.Errorf("asset: got %q, Content-Type %q", body, res.Header.Get("Content-Type"))
+	}
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/docs?x=1", nil)); res.StatusCode != http.StatusMovedPermanently || res.Header.Get("Location") != "/docs/?x=1" {
+		t.Errorf("no trailing slash: got %d, Location %q", res.StatusCode, res.Header.Get("Location"))
+	}
+	if _, body := do(t, h, httptest.NewRequest("GET", "/docs/?list=1", nil)); !strings.Contains(body, "style.css") || strings.Contains(body, "<h1>Docs</h1>") {
+		t.Error("?list=1 did not show the listing")
+	}
+	// 没有 index.html 的目录照常显示列表
+	if _, body := do(t, h, httptest.NewRequest("GET", "/sub/", nil)); !strings.Contains(body, "b.txt") {
+		t.Error("directory without index.html is not listed")
+	}
+
+	h = newTestHandler(t, Config{Root: root, ServeIndex: true}, WithBasePath("/files"))
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/files/docs", nil)); res.Header.Get("Location") != "/files/docs/" {
+		t.Errorf("base path: Location = %q, want /files/docs/", res.Header.Get("Location"))
+	}
+}
@@ -0,0 +1,98 @@
+package fileserver
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// 站点地图（-sitemap）：GET /sitemap.xml 列出所有目录的浏览地址和文件的下载地址，公开的下载站可以被搜索引擎收录。
+// 只列出不登录就能访问的内容：访问控制规则拒绝匿名用户的、目录密码保护的、-sitemap-exclude 匹配的都不出现。
+// 超过 50000 个地址时（站点地图协议的上限）/sitemap.xml 返回索引，各部分在 /sitemap.xml?page=N。
+// 有 -index 时从索引中取，否则每次遍历目录
+
+// 一个站点地图文件最多的地址数
+const sitemapLimit = 50000
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+// sitemapVisible 判断 p 能否出现在站点地图中
+func (s *server) sitemapVisible(p string) bool {
+	for _, pattern := range s.sitemapSkip {
+		if matchGlob(pattern, p) {
+			return false
+		}
+	}
+	return s.sessionAccess(nil, p, permRead) == nil
+}
+
+// sitemapHandler 处理 GET /sitemap.xml
+func (s *server) sitemapHandler(w http.ResponseWriter, r *http.Request) {
+	var entries []indexHit
+	if s.index != nil && s.index.isReady() {
+		entries = s.index.all("/")
+	} else {
+		entries = walkFiles(s.fsys, "/", func(p string) bool { return !s.sitemapVisible(p) })
+	}
+	urls := []sitemapURL{{Loc: s.origin(r) + s.base + "/"}}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	for _, e := range entries {
+		if !s.sitemapVisible(e.Path) {
+			continue
+		}
+		loc := s.origin(r) + s.base + (&url.URL{Path: e.Path}).EscapedPath()
+		if e.IsDir {
+			loc += "/"
+		} else {
+			loc = s.origin(r) + s.base + "/download" + (&url.URL{Path: e.Path}).EscapedPath()
+		}
+		urls = append(urls, sitemapURL{Loc: loc, LastMod: e.ModTime.UTC().Format(time.RFC3339)})
+	}
+
+	var doc any = sitemapURLSet{URLs: urls}
+	if len(urls) > sitemapLimit {
+		pages := (len(urls) + sitemapLimit - 1) / sitemapLimit
+		if v := r.FormValue("page"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > pages {
+				s.httpError(w, r, http.StatusNotFound, "File not found")
+				return
+			}
+			doc = sitemapURLSet{URLs: urls[(n-1)*sitemapLimit : min(n*sitemapLimit, len(urls))]}
+		} else {
+			index := sitemapIndex{}
+			for n := 1; n <= pages; n++ {
+				index.Sitemaps = append(index.Sitemaps, sitemapURL{Loc: fmt.Sprintf("%s%s/sitemap.xml?page=%d", s.origin(r), s.base, n)})
+			}
+			doc = index
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(doc); err != nil {
+		s.httpError(w, r, http.StatusInternalServerError, "Failed to build sitemap")
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,44 @@
+package fileserver
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSitemap(t *testing.T) {
+	root := newTestRoot(t)
+	os.MkdirAll(filepath.Join(root, "private"), 0755)
+	os.WriteFile(filepath.Join(root, "private", "secret.txt"), []byte("x"), 0644)
+	os.MkdirAll(filepath.Join(root, "locked"), 0755)
+	os.WriteFile(filepath.Join(root, "locked", passwordFile), []byte("pw"), 0644)
+	os.WriteFile(filepath.Join(root, "locked", "c.txt"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(root, "sub", "我的 文件.tmp"), []byte("x"), 0644)
+	config := writeConfig(t, `{"acl": [{"path": "/private/**", "users": ["*"], "action": "deny"}]}`)
+
+	h := newTestHandler(t, Config{Root: root, ConfigFile: config, Sitemap: true, SitemapExclude: []string{"**/*.tmp"}})
+	res, body := do(t, h, httptest.NewRequest("GET", "/sitemap.xml", nil))
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("Content-Type"), "application/xml") {
+		t.Fatalf("sitemap: got %d %s", res.StatusCode, body)
+	}
+	var set sitemapURLSet
+	if err := xml.Unmarshal([]byte(body), &set); err != nil {
+		t.Fatal(err)
+	}
+	var locs []string
+	for _, u := range set.URLs {
+		locs = append(locs, strings.TrimPrefix(u.Loc, "http://example.com"))
+	}
+	// 访问控制拒绝的、密码保护的、排除的都不出现
+	if got := strings.Join(locs, " "); got != "/ /download/a.txt /sub/ /download/sub/b.txt" {
+		t.Errorf("sitemap = %s", got)
+	}
+
+	if _, body := do(t, newTestHandler(t, Config{Root: root}), httptest.NewRequest("GET", "/sitemap.xml", nil)); strings.Contains(body, "urlset") {
+		t.Errorf("disabled sitemap: %s", body)
+	}
+}
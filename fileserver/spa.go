@@ -0,0 +1,50 @@
+package fileserver
+
+import (
+	"io/fs"
+	"net/http"
+)
+
+// 单页应用模式（-spa）：根目录下的文件按原路径直接返回，其余地址（目录、不存在的路径）一律返回根目录的 index.html，
+// 由前端路由（React Router、Vue Router 等）处理。/download/、/view/ 等内置地址不受影响
+
+const spaIndex = "/index.html"
+
+// spaHandler 处理单页应用模式下的请求，根目录没有 index.html 时返回 false，按普通目录列表处理
+func (s *server) spaHandler(w http.ResponseWriter, r *http.Request) bool {
+	p := cleanPath(r.URL.Path)
+	if info, err := s.stat(p); err == nil && !info.IsDir() {
+		s.serveStatic(w, r, p, info)
+		return true
+	}
+	info, err := s.stat(spaIndex)
+	if err != nil || info.IsDir() || !s.allowed(currentUser(r), spaIndex, permRead) {
+		return false
+	}
+	// 入口页面引用的资源文件名通常带有哈希，入口页面本身每次都要重新验证。-cache-control 规则匹配时以规则为准
+	if _, ok := s.cacheRuleFor(r); !ok {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	s.serveStatic(w, r, spaIndex, info)
+	return true
+}
+
+// serveStatic 按原样返回文件，Content-Type 由扩展名决定，有预压缩文件时优先使用。开启自动刷新时 HTML 页面另外处理
+func (s *server) serveStatic(w http.ResponseWriter, r *http.Request, p string, info fs.FileInfo) {
+	if s.liveReload != nil && isHTML(p) {
+		s.serveLiveHTML(w, r, p, info)
+		return
+	}
+	if s.servePrecompressed(w, r, p, info) {
+		return
+	}
+	f, err := s.open(p)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("ETag", fileETag(info))
+	s.setContentType(w, info.Name())
+	serveContent(w, r, info, f)
+}
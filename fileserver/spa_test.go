@@ -0,0 +1,33 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSPA(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":    {Data: []byte("<div id=app></div>")},
+		"assets/app.js": {Data: []byte("app()")},
+	}
+	h := newTestHandler(t, Config{FS: fsys, SPA: true})
+	for p, want := range map[string]string{"/settings/profile": "<div id=app></div>", "/assets/app.js": "app()"} {
+		res, body := do(t, h, httptest.NewRequest("GET", p, nil))
+		if res.StatusCode != http.StatusOK || body != want {
+			t.Errorf("%s: got %d %q", p, res.StatusCode, body)
+		}
+	}
+	res, _ := do(t, h, httptest.NewRequest("GET", "/settings/profile", nil))
+	if cc := res.Header.Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("fallback Cache-Control = %q, want no-cache", cc)
+	}
+
+	// -cache-control 规则匹配时以规则为准
+	h = newTestHandler(t, Config{FS: fsys, SPA: true, CacheControl: []string{"/**=public, max-age=60"}})
+	res, _ = do(t, h, httptest.NewRequest("GET", "/settings/profile", nil))
+	if cc := res.Header.Get("Cache-Control"); cc != "public, max-age=60" {
+		t.Errorf("fallback with rule: Cache-Control = %q", cc)
+	}
+}
@@ -0,0 +1,622 @@
+// 页面中的翻译，见 templates/layout.html 的 i18n 模板
+const i18nData = document.getElementById('i18n');
+const messages = i18nData ? JSON.parse(i18nData.textContent) : {};
+function t(key) {
+  return messages[key] || key;
+}
+
+// -base-path 指定的地址前缀，脚本中的站内地址都要加上
+const baseMeta = document.querySelector('meta[name="base-path"]');
+const base = baseMeta ? baseMeta.content : '';
+
+// 把字节数显示成易读的大小
+function humanSize(n) {
+  const KB = 1024, MB = KB*1024, GB = MB*1024;
+  if (n >= GB) return (n/GB).toFixed(2) + ' GB';
+  if (n >= MB) return (n/MB).toFixed(2) + ' MB';
+  if (n >= KB) return (n/KB).toFixed(2) + ' KB';
+  return n + ' Byte';
+}
+
+document.querySelectorAll('.size[data-bytes]').forEach(el => {
+  const bytes = parseInt(el.getAttribute('data-bytes'), 10) || 0;
+  el.textContent = humanSize(bytes);
+});
+
+// 音频播放结束自动切到下一首
+const player = document.querySelector('audio#player');
+if (player) {
+  player.addEventListener('ended', function () {
+    const next = document.getElementById('next');
+    if (next) location.href = next.href;
+  });
+}
+
+// PDF 翻页：改变阅读器地址中的 #page=，浏览器内置的阅读器跳到对应的页，地址栏的 ?page= 同步更新
+const pdfFrame = document.getElementById('pdf-frame');
+if (pdfFrame) {
+  const pageInput = document.getElementById('pdf-page');
+  const showPage = function (n) {
+    n = Math.max(1, parseInt(n, 10) || 1);
+    pageInput.value = n;
+    pdfFrame.src = pdfFrame.dataset.src + '#page=' + n;
+    const u = new URL(location.href);
+    u.searchParams.set('page', n);
+    history.replaceState(null, '', u);
+  };
+  document.getElementById('pdf-prev').addEventListener('click', () => showPage(+pageInput.value - 1));
+  document.getElementById('pdf-next').addEventListener('click', () => showPage(+pageInput.value + 1));
+  pageInput.addEventListener('change', () => showPage(pageInput.value));
+}
+
+// JSON、XML 树全部展开、全部折叠
+document.querySelectorAll('.tree-toggle').forEach(btn => {
+  btn.addEventListener('click', function () {
+    const open = btn.dataset.open === 'true';
+    document.querySelectorAll('.tree details').forEach(d => d.open = open);
+  });
+});
+
+// 深色/浅色切换，选择写入 cookie，服务端渲染下一个页面时直接使用
+const themeLink = document.getElementById('theme');
+const themeToggle = document.getElementById('theme-toggle');
+if (themeLink && themeToggle) {
+  themeToggle.addEventListener('click', function () {
+    const current = themeLink.getAttribute('data-theme');
+    const dark = current === 'dark' ||
+      (current === 'auto' && window.matchMedia('(prefers-color-scheme: dark)').matches);
+    const next = dark ? 'light' : 'dark';
+    themeLink.setAttribute('href', base + '/static/themes/' + next + '.css');
+    themeLink.setAttribute('data-theme', next);
+    document.cookie = 'theme=' + next + '; path=/; max-age=31536000; SameSite=Lax';
+  });
+}
+
+// 二维码按钮：弹出指向该文件或目录的二维码
+const qrOverlay = document.getElementById('qr-overlay');
+if (qrOverlay) {
+  document.querySelectorAll('.qr-btn').forEach(btn => {
+    btn.addEventListener('click', function () {
+      qrOverlay.querySelector('img').src = base + '/qr?target=' + encodeURIComponent(btn.dataset.target);
+      qrOverlay.hidden = false;
+    });
+  });
+  qrOverlay.addEventListener('click', function () {
+    qrOverlay.hidden = true;
+  });
+}
+
+// 分享按钮：询问有效期和下载次数，生成签名分享链接
+document.querySelectorAll('.share-btn').forEach(btn => {
+  btn.addEventListener('click', function () {
+    const hours = prompt(t('js.share.hours'), '24');
+    if (hours === null) return;
+    const downloads = prompt(t('js.share.downloads'), '0');
+    if (downloads === null) return;
+    const body = new URLSearchParams({path: btn.dataset.path, hours: hours, downloads: downloads});
+    fetch(base + '/api/share', {method: 'POST', body: body})
+      .then(res => res.ok ? res.json() : res.text().then(msg => Promise.reject(msg)))
+      .then(data => prompt(t('js.share.done'), data.url))
+      .catch(err => alert(t('js.share.failed') + err));
+  });
+});
+
+// 复制链接按钮：把下载地址放到剪贴板，不是 HTTPS 等浏览器不允许写剪贴板时弹出地址让用户自己复制
+document.querySelectorAll('.copy-btn').forEach(btn => {
+  btn.addEventListener('click', function () {
+    const fallback = () => prompt(t('js.copy.prompt'), btn.dataset.url);
+    if (!navigator.clipboard) {
+      fallback();
+      return;
+    }
+    navigator.clipboard.writeText(btn.dataset.url).then(() => {
+      btn.textContent = '✓';
+      setTimeout(() => btn.textContent = '📋', 1500);
+    }, fallback);
+  });
+});
+
+// 把相对根目录的路径转换成接口地址，每一段分别转义
+function apiPath(prefix, p) {
+  return base + prefix + p.split('/').map(encodeURIComponent).join('/');
+}
+
+// 校验和列：页面打开后依次向 /api/hash 查询，服务端有缓存，同时只发两个请求避免大目录压垮磁盘
+const checksums = Array.from(document.querySelectorAll('.checksum'));
+function nextChecksum() {
+  const el = checksums.shift();
+  if (!el) return;
+  el.textContent = '…';
+  fetch(apiPath('/api/hash', el.dataset.path) + '?algo=' + el.dataset.algo)
+    .then(res => res.ok ? res.json() : Promise.reject())
+    .then(data => el.textContent = data.hash, () => el.textContent = '')
+    .finally(nextChecksum);
+}
+nextChecksum();
+nextChecksum();
+
+// 目录总大小：依次向 /api/size 查询，同时只发两个请求；服务端还没算完时返回 202，过两秒再查
+const dirSizes = Array.from(document.querySelectorAll('.dir-size'));
+function loadDirSize(el) {
+  return fetch(apiPath('/api/size', el.dataset.path)).then(res => {
+    if (res.status === 202) return new Promise(r => setTimeout(r, 2000)).then(() => loadDirSize(el));
+    return res.ok ? res.json() : Promise.reject();
+  });
+}
+function nextDirSize() {
+  const el = dirSizes.shift();
+  if (!el) return;
+  loadDirSize(el)
+    .then(data => {
+      el.textContent = humanSize(data.size);
+      el.title = data.files + ' ' + t('js.size.files');
+    }, () => el.textContent = '')
+    .finally(() => {
+      el.classList.remove('loading');
+      nextDirSize();
+    });
+}
+nextDirSize();
+nextDirSize();
+
+// 接口出错时取出 JSON 中的错误信息
+function apiFailure(res) {
+  return res.json().then(data => Promise.reject(data.error), () => Promise.reject(res.statusText));
+}
+
+// 重命名/移动按钮：输入新的路径（相对根目录），成功后刷新页面
+document.querySelectorAll('.move-btn').forEach(btn => {
+  btn.addEventListener('click', function () {
+    const to = prompt(t('js.move.prompt'), btn.dataset.path);
+    if (to === null || to === btn.dataset.path) return;
+    const body = new URLSearchParams({from: btn.dataset.path, to: to});
+    fetch(base + '/api/move', {method: 'POST', body: body})
+      .then(res => res.ok ? location.reload() : apiFailure(res))
+      .catch(err => alert(t('js.move.failed') + err));
+  });
+});
+
+// 新建目录按钮：在当前目录下创建子目录，成功后进入新目录
+const mkdirBtn = document.getElementById('mkdir-btn');
+if (mkdirBtn) {
+  mkdirBtn.addEventListener('click', function () {
+    const name = prompt(t('js.mkdir.prompt'));
+    if (!name) return;
+    const p = decodeURIComponent(mkdirBtn.dataset.dir) + name;
+    fetch(base + '/api/mkdir', {method: 'POST', body: new URLSearchParams({path: p})})
+      .then(res => res.ok ? location.href = apiPath('', p) + '/' : apiFailure(res))
+      .catch(err => alert(t('js.mkdir.failed') + err));
+  });
+}
+
+// 上传：拖放到页面或点击按钮选择文件或整个目录，每个文件按 8 MB 分段用 PATCH 断点续传上传，
+// 同时最多上传 3 个文件，全部完成后刷新页面。目录中的文件带着相对路径上传，服务端自动创建子目录
+const dropZone = document.getElementById('drop-zone');
+const uploadChunk = 8 << 20;
+const uploadParallel = 3;
+const uploadQueue = [];
+let uploadsActive = 0;
+
+// files 中每一项为 {file, rel}，rel 是相对当前目录的路径
+function queueUploads(files) {
+  const dir = decodeURIComponent(dropZone.dataset.dir);
+  const list = document.getElementById('upload-list');
+  for (const f of files) {
+    const li = document.createElement('li');
+    li.innerHTML = '<span class="upload-name"></span> <progress max="1" value="0"></progress> <span class="upload-status"></span>';
+    li.querySelector('.upload-name').textContent = f.rel;
+    list.appendChild(li);
+    uploadQueue.push({file: f.file, path: dir + f.rel, li: li, extract: document.getElementById('upload-extract').checked});
+  }
+  nextUpload();
+}
+
+// 选择框中的文件，选择目录时 webkitRelativePath 带有目录名
+function pickedFiles(input) {
+  return Array.from(input.files, file => ({file: file, rel: file.webkitRelativePath || file.name}));
+}
+
+// 拖放的内容中可能有目录，递归读出其中所有文件
+async function droppedFiles(items) {
+  const out = [];
+  async function walk(entry, prefix) {
+    if (entry.isFile) {
+      const file = await new Promise((resolve, reject) => entry.file(resolve, reject));
+      out.push({file: file, rel: prefix + entry.name});
+      return;
+    }
+    const reader = entry.createReader();
+    for (;;) {
+      // readEntries 每次只返回一部分，读到空为止
+      const batch = await new Promise((resolve, reject) => reader.readEntries(resolve, reject));
+      if (batch.length === 0) break;
+      for (const child of batch) await walk(child, prefix + entry.name + '/');
+    }
+  }
+  const entries = Array.from(items, item => item.webkitGetAsEntry && item.webkitGetAsEntry()).filter(e => e);
+  for (const entry of entries) await walk(entry, '');
+  return out;
+}
+
+function nextUpload() {
+  while (uploadsActive < uploadParallel && uploadQueue.length > 0) {
+    const job = uploadQueue.shift();
+    uploadsActive++;
+    uploadFile(job, false).then(() => {
+      job.li.querySelector('.upload-status').textContent = t('js.upload.done');
+    }, err => {
+      job.li.classList.add('error');
+      job.li.querySelector('.upload-status').textContent = t('js.upload.failed') + err;
+    }).finally(() => {
+      uploadsActive--;
+      if (uploadsActive === 0 && uploadQueue.length === 0 && !document.querySelector('.upload-list .error')) {
+        location.reload();
+      }
+      nextUpload();
+    });
+  }
+}
+
+// 发送一段，onprogress 报告本段已发送的字节数
+function sendChunk(url, file, offset, onprogress) {
+  return new Promise((resolve, reject) => {
+    const xhr = new XMLHttpRequest();
+    xhr.open('PATCH', url);
+    xhr.setRequestHeader('Upload-Offset', offset);
+    xhr.setRequestHeader('Upload-Length', file.size);
+    xhr.upload.onprogress = e => onprogress(e.loaded);
+    xhr.onload = () => {
+      const next = parseInt(xhr.getResponseHeader('Upload-Offset'), 10);
+      if (xhr.status < 300) return resolve(isNaN(next) ? file.size : next);
+      let msg = xhr.statusText;
+      try { msg = JSON.parse(xhr.responseText).error; } catch (e) {}
+      reject({status: xhr.status, message: msg});
+    };
+    xhr.onerror = () => reject({status: 0, message: 'network error'});
+    xhr.send(file.slice(offset, offset + uploadChunk));
+  });
+}
+
+async function uploadFile(job, overwrite) {
+  const args = new URLSearchParams();
+  if (overwrite) args.set('overwrite', '1');
+  if (job.extract) args.set('extract', '1');
+  const query = args.toString();
+  const url = apiPath('/api/files', job.path) + (query ? '?' + query : '');
+  const bar = job.li.querySelector('progress');
+  let offset = 0, retries = 0;
+  do {
+    try {
+      offset = await sendChunk(url, job.file, offset, n => bar.value = job.file.size ? (offset + n) / job.file.size : 1);
+      retries = 0;
+    } catch (err) {
+      if (err.status === 409 && offset === 0 && !overwrite) {
+        if (!confirm(t('js.upload.exists') + '\n' + job.path)) throw t('js.upload.skipped');
+        return uploadFile(job, true);
+      }
+      // 网络中断时查询服务端已收到多少，从那里继续
+      if (err.status === 0 && retries++ < 5) {
+        await new Promise(r => setTimeout(r, 2000 * retries));
+        const res = await fetch(url, {method: 'HEAD'}).catch(() => null);
+        if (res && res.ok) offset = parseInt(res.headers.get('Upload-Offset'), 10) || 0;
+        continue;
+      }
+      throw err.message;
+    }
+  } while (offset < job.file.size);
+  bar.value = 1;
+}
+
+if (dropZone) {
+  ['dragenter', 'dragover'].forEach(type => document.addEventListener(type, e => {
+    e.preventDefault();
+    dropZone.classList.add('active');
+  }));
+  ['dragleave', 'drop'].forEach(type => document.addEventListener(type, e => {
+    e.preventDefault();
+    dropZone.classList.remove('active');
+  }));
+  document.addEventListener('drop', e => {
+    if (e.dataTransfer.items && e.dataTransfer.items.length && e.dataTransfer.items[0].webkitGetAsEntry) {
+      droppedFiles(e.dataTransfer.items).then(queueUploads);
+    } else {
+      queueUploads(Array.from(e.dataTransfer.files, file => ({file: file, rel: file.name})));
+    }
+  });
+  ['upload-input', 'upload-folder'].forEach(id => document.getElementById(id).addEventListener('change', e => {
+    queueUploads(pickedFiles(e.target));
+    e.target.value = '';
+  }));
+}
+
+// 文件名搜索：在当前目录和子目录中查找，输入停顿一会儿后查询，有关键词时用结果代替文件列表
+const fileList = document.getElementById('file-list');
+const searchInput = document.getElementById('search');
+if (searchInput) {
+  const results = document.getElementById('search-results');
+  const status = document.getElementById('search-status');
+  let timer = null, seq = 0;
+  const show = function (searching) {
+    fileList.hidden = searching;
+    results.hidden = status.hidden = !searching;
+  };
+  const run = function () {
+    const q = searchInput.value.trim();
+    if (!q) return show(false);
+    const n = ++seq;
+    const args = new URLSearchParams({q: q, path: decodeURIComponent(searchInput.dataset.dir)});
+    fetch(searchInput.dataset.api + '?' + args)
+      .then(res => res.ok ? res.json() : apiFailure(res))
+      .then(data => {
+        if (n !== seq) return;
+        results.textContent = '';
+        for (const f of data.results) {
+          const li = document.createElement('li');
+          li.className = f.is_dir ? 'directory' : 'file';
+          li.innerHTML = '<span class="icon"></span> <a></a> <span class="size"></span>';
+          li.querySelector('.icon').textContent = f.is_dir ? '📁' : '📄';
+          const a = li.querySelector('a');
+          a.href = f.is_dir ? f.url : f.view;
+          a.textContent = f.path;
+          if (!f.is_dir) li.querySelector('.size').textContent = humanSize(f.size);
+          results.appendChild(li);
+        }
+        const notes = [];
+        if (data.results.length === 0) notes.push(t('js.search.none'));
+        if (data.truncated) notes.push(t('js.search.truncated'));
+        if (!data.ready) notes.push(t('js.search.indexing'));
+        status.textContent = notes.join(' ');
+        show(true);
+      })
+      .catch(err => { status.textContent = t('js.search.failed') + err; show(true); });
+  };
+  searchInput.addEventListener('input', function () {
+    clearTimeout(timer);
+    timer = setTimeout(run, 200);
+  });
+}
+
+// 目录树侧栏：从根目录开始按需通过 /api/list 读取子目录，打开时展开到当前目录；是否显示记在 cookie 中，服务端渲染下一个页面时直接使用
+const dirTree = document.getElementById('dir-tree');
+const dirTreeToggle = document.getElementById('dir-tree-toggle');
+if (dirTree && dirTreeToggle) {
+  const current = decodeURIComponent(dirTree.dataset.dir).replace(/\/?$/, '/');
+  // node 生成目录 p 的一项，点击前面的箭头时才读取子目录
+  const node = function (name, p, href) {
+    const li = document.createElement('li');
+    li.innerHTML = '<button type="button" class="dir-tree-twisty" aria-expanded="false">▸</button><a></a><ul hidden></ul>';
+    const a = li.querySelector('a');
+    a.textContent = name;
+    a.href = href;
+    li.dataset.path = p;
+    if (p === current) a.setAttribute('aria-current', 'page');
+    li.querySelector('button').addEventListener('click', () => expand(li, li.querySelector('ul').hidden));
+    return li;
+  };
+  const load = function (li) {
+    if (li.loaded) return li.loaded;
+    const ul = li.querySelector(':scope > ul');
+    li.loaded = fetch(apiPath('/api/list', li.dataset.path))
+      .then(res => res.ok ? res.json() : Promise.reject())
+      .then(data => data.files.filter(f => f.is_dir).forEach(f => ul.appendChild(node(f.name, f.path + '/', f.url))))
+      .catch(() => {})
+      .then(() => { if (!ul.children.length) li.classList.add('empty'); });
+    return li.loaded;
+  };
+  const expand = function (li, open) {
+    const ul = li.querySelector(':scope > ul');
+    const btn = li.querySelector(':scope > button');
+    ul.hidden = !open;
+    btn.textContent = open ? '▾' : '▸';
+    btn.setAttribute('aria-expanded', open);
+    return open ? load(li) : Promise.resolve();
+  };
+  // 依次展开根目录到当前目录
+  const reveal = async function () {
+    let li = node('/', '/', base + '/');
+    dirTree.querySelector('ul').appendChild(li);
+    for (;;) {
+      await expand(li, true);
+      const next = Array.from(li.querySelector(':scope > ul').children).find(c => current.startsWith(c.dataset.path));
+      if (!next) break;
+      li = next;
+    }
+    li.querySelector('a').scrollIntoView({block: 'nearest'});
+  };
+  let revealed = false;
+  const show = function (open) {
+    dirTree.hidden = !open;
+    document.body.classList.toggle('dir-tree-open', open);
+    dirTreeToggle.setAttribute('aria-expanded', open);
+    if (open && !revealed) {
+      revealed = true;
+      reveal();
+    }
+  };
+  if (!dirTree.hidden) show(true);
+  dirTreeToggle.addEventListener('click', function () {
+    const open = dirTree.hidden;
+    show(open);
+    document.cookie = 'dir-tree=' + (open ? 'open' : 'closed') + '; path=/; max-age=31536000; SameSite=Lax';
+  });
+}
+
+// 相册：点击缩略图在当前页面放大显示，←→ 或两边的按钮切换，Esc 或点击空白处关闭；按住 Ctrl 等点击照常在新标签页打开图片页面
+const lightbox = document.getElementById('lightbox');
+if (lightbox) {
+  const items = Array.from(document.querySelectorAll('#gallery a'));
+  const img = lightbox.querySelector('img');
+  const caption = lightbox.querySelector('figcaption');
+  let index = 0;
+  const show = function (i) {
+    index = (i + items.length) % items.length;
+    img.src = items[index].dataset.full;
+    caption.textContent = items[index].title;
+    lightbox.hidden = false;
+    // 预先加载下一张，切换时不用等
+    new Image().src = items[(index + 1) % items.length].dataset.full;
+  };
+  const close = function () {
+    lightbox.hidden = true;
+    img.removeAttribute('src');
+    items[index].focus();
+  };
+  items.forEach((a, i) => a.addEventListener('click', function (e) {
+    if (e.ctrlKey || e.metaKey || e.shiftKey || e.altKey) return;
+    e.preventDefault();
+    show(i);
+  }));
+  lightbox.querySelector('.lightbox-prev').addEventListener('click', () => show(index - 1));
+  lightbox.querySelector('.lightbox-next').addEventListener('click', () => show(index + 1));
+  lightbox.querySelector('.lightbox-close').addEventListener('click', close);
+  lightbox.addEventListener('click', function (e) {
+    if (e.target === lightbox || e.target.tagName === 'FIGURE') close();
+  });
+  document.addEventListener('keydown', function (e) {
+    if (lightbox.hidden) return;
+    switch (e.key) {
+    case 'ArrowLeft':
+      show(index - 1);
+      break;
+    case 'ArrowRight':
+      show(index + 1);
+      break;
+    case 'Escape':
+    case 'Backspace':
+      close();
+      break;
+    default:
+      return;
+    }
+    e.preventDefault();
+  });
+}
+
+// 键盘操作：↑↓ 在列表（搜索时为搜索结果）中移动，Enter 打开，Backspace 回到上级目录，/ 跳到搜索框，Esc 离开搜索框
+if (fileList) {
+  const itemLinks = function () {
+    const results = document.getElementById('search-results');
+    const list = results && !results.hidden ? results : fileList;
+    return Array.from(list.querySelectorAll(':scope > li > a:first-of-type'));
+  };
+  document.addEventListener('keydown', function (e) {
+    if (e.defaultPrevented || e.ctrlKey || e.metaKey || e.altKey || lightbox && !lightbox.hidden) return;
+    const el = e.target;
+    const typing = el.tagName === 'INPUT' && el.type !== 'checkbox' && el.type !== 'button' ||
+      el.tagName === 'TEXTAREA' || el.tagName === 'SELECT' || el.isContentEditable;
+    if (typing) {
+      if (e.key === 'Escape' && el === searchInput) searchInput.blur();
+      // 在搜索框中按 ↓ 进入结果
+      if (e.key !== 'ArrowDown' || el !== searchInput) return;
+    }
+    const item = el.closest && el.closest('li');
+    switch (e.key) {
+    case 'ArrowDown':
+    case 'ArrowUp': {
+      const links = itemLinks();
+      if (links.length === 0) return;
+      const i = links.findIndex(a => a.parentElement === item);
+      const next = e.key === 'ArrowDown' ? Math.min(i + 1, links.length - 1) : Math.max(i - 1, 0);
+      links[next].focus();
+      break;
+    }
+    case 'Enter': {
+      // 链接上按 Enter 浏览器自己会打开，焦点在复选框等其他地方时打开所在的项
+      if (!item || el.tagName === 'A' || el.tagName === 'BUTTON') return;
+      const link = item.querySelector(':scope > a:first-of-type');
+      if (!link) return;
+      location.href = link.href;
+      break;
+    }
+    case 'Backspace': {
+      const back = document.querySelector('.back-link');
+      if (!back) return;
+      location.href = back.href;
+      break;
+    }
+    case '/':
+      if (!searchInput) return;
+      searchInput.focus();
+      break;
+    default:
+      return;
+    }
+    e.preventDefault();
+  });
+}
+
+// 勾选文件打包下载：有勾选时才能点击，全选框同时勾选或取消所有项
+const batchForm = document.getElementById('batch-form');
+const selects = Array.from(document.querySelectorAll('input.select'));
+if (batchForm) {
+  const selectAll = document.getElementById('select-all');
+  const update = function () {
+    const n = selects.filter(c => c.checked).length;
+    batchForm.querySelectorAll('.batch-action').forEach(btn => btn.disabled = n === 0);
+    selectAll.checked = n === selects.length;
+    selectAll.indeterminate = n > 0 && n < selects.length;
+  };
+  selects.forEach(c => c.addEventListener('change', update));
+  selectAll.addEventListener('change', function () {
+    selects.forEach(c => c.checked = selectAll.checked);
+    update();
+  });
+}
+
+// 批量删除、移动勾选的项：逐项执行，失败的列出原因，完成后刷新页面
+function batchAction(api, params, failed) {
+  const body = new URLSearchParams(params);
+  selects.filter(c => c.checked).forEach(c => body.append('path', c.value));
+  fetch(base + api, {method: 'POST', body: body})
+    .then(res => res.ok ? res.json() : apiFailure(res))
+    .then(data => {
+      const errors = data.results.filter(r => !r.ok).map(r => r.path + ': ' + r.error);
+      if (errors.length) alert(t(failed) + '\n' + errors.join('\n'));
+      location.reload();
+    })
+    .catch(err => alert(t(failed) + err));
+}
+const batchDelete = document.getElementById('batch-delete');
+if (batchDelete) {
+  batchDelete.addEventListener('click', function () {
+    const n = selects.filter(c => c.checked).length;
+    if (!confirm(t('js.batch.confirmDelete').replace('%d', n))) return;
+    batchAction('/api/batch/delete', {recursive: '1'}, 'js.delete.failed');
+  });
+}
+const batchMove = document.getElementById('batch-move');
+if (batchMove) {
+  batchMove.addEventListener('click', function () {
+    const to = prompt(t('js.batch.movePrompt'), batchMove.dataset.dir);
+    if (to === null || to === batchMove.dataset.dir) return;
+    batchAction('/api/batch/move', {to: to}, 'js.move.failed');
+  });
+}
+
+// 目录有变化时自动刷新：服务端通过 Server-Sent Events 推送，上传中、搜索中或页面在后台时等到结束/切回来再刷新
+const eventsList = document.querySelector('ul[data-events]');
+if (eventsList && window.EventSource) {
+  let stale = false;
+  const refresh = function () {
+    if (!stale || document.hidden || uploadsActive > 0 || (qrOverlay && !qrOverlay.hidden) || (searchInput && searchInput.value) ||
+      selects.some(c => c.checked) || (lightbox && !lightbox.hidden)) return;
+    location.reload();
+  };
+  new EventSource(eventsList.dataset.events).addEventListener('change', function () {
+    stale = true;
+    refresh();
+  });
+  document.addEventListener('visibilitychange', refresh);
+  if (qrOverlay) qrOverlay.addEventListener('click', () => setTimeout(refresh));
+}
+
+// 删除按钮：确认后删除文件或整个目录
+document.querySelectorAll('.delete-btn').forEach(btn => {
+  btn.addEventListener('click', function () {
+    const dir = btn.dataset.dir === 'true';
+    if (!confirm(t(dir ? 'js.delete.confirmDir' : 'js.delete.confirm') + '\n' + btn.dataset.path)) return;
+    fetch(apiPath('/api/files', btn.dataset.path) + (dir ? '?recursive=1' : ''), {method: 'DELETE'})
+      .then(res => res.ok ? btn.closest('li').remove() : apiFailure(res))
+      .catch(err => alert(t('js.delete.failed') + err));
+  });
+});
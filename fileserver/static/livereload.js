@@ -0,0 +1,23 @@
+// -live-reload 插入到 HTML 页面中的脚本：文件有变化时刷新页面，只改了 CSS 时只重新加载样式表。
+// 连接断开（比如服务重启）后每秒重连一次，重连成功说明服务又起来了，刷新一次
+(function () {
+  const script = document.currentScript;
+  const url = new URL(script.src.replace(/\/static\/livereload\.js.*$/, '/api/livereload'));
+  url.protocol = url.protocol === 'https:' ? 'wss:' : 'ws:';
+
+  function reloadStyles() {
+    document.querySelectorAll('link[rel="stylesheet"]').forEach(link => {
+      const href = new URL(link.href);
+      href.searchParams.set('livereload', Date.now());
+      link.href = href.toString();
+    });
+  }
+
+  function connect(reconnected) {
+    const ws = new WebSocket(url);
+    ws.onopen = () => { if (reconnected) location.reload(); };
+    ws.onmessage = e => e.data === 'css' ? reloadStyles() : location.reload();
+    ws.onclose = () => setTimeout(() => connect(true), 1000);
+  }
+  connect(false);
+})();
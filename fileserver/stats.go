@@ -0,0 +1,271 @@
+package fileserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// 下载统计（-stats-db）：每次下载的路径、字节数、客户端 IP、时间和状态码记录到一个 bbolt 数据库文件，
+// 重启后仍然保留，用来了解哪些文件真正有人在用。记录在后台批量写入，不拖慢下载；
+// 超过保留时间（-stats-retention，默认 90 天）的记录每小时清理一次
+
+// downloadRecord 是一次下载
+type downloadRecord struct {
+	Path   string    `json:"path"`
+	Bytes  int64     `json:"bytes"` // 实际发送的字节数，客户端中途断开时小于文件大小
+	Client string    `json:"client,omitempty"`
+	User   string    `json:"user,omitempty"`
+	Status int       `json:"status"` // HTTP 为响应状态码，FTP 为回复码（226 完成，426 中断）
+	Via    string    `json:"via"`    // http、ftp
+	Time   time.Time `json:"time"`
+}
+
+// defaultStatsRetention 是没有指定保留时间时记录保留的时间
+const defaultStatsRetention = 90 * 24 * time.Hour
+
+// statsQueue 是等待写入的记录数，队列满时丢弃新的记录，不阻塞下载
+const statsQueue = 1024
+
+var statsPruneInterval = time.Hour
+
+var statsBucket = []byte("downloads")
+
+// downloadStats 保存下载记录。键是 8 字节的时间（UnixNano）加 8 字节的序号，按时间排序
+type downloadStats struct {
+	db        *bolt.DB
+	retention time.Duration
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan downloadRecord
+	done   chan struct{}
+
+	amu    sync.Mutex
+	active map[*transfer]struct{} // 正在进行的下载
+}
+
+// transfer 是一个正在进行的下载，rec.Time 是开始时间
+type transfer struct {
+	rec  downloadRecord
+	size int64
+	sent atomic.Int64
+}
+
+// Write 只统计字节数，和 io.MultiWriter 一起使用
+func (t *transfer) Write(b []byte) (int, error) {
+	t.sent.Add(int64(len(b)))
+	return len(b), nil
+}
+
+// transferWriter 统计 HTTP 下载已经发送的字节数
+type transferWriter struct {
+	http.ResponseWriter
+	t *transfer
+}
+
+func (w *transferWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.t.sent.Add(int64(n))
+	return n, err
+}
+
+func (w *transferWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func openDownloadStats(file string, retention time.Duration) (*downloadStats, error) {
+	if retention <= 0 {
+		retention = defaultStatsRetention
+	}
+	// 另一个进程正在使用同一个文件时 bbolt 会一直等待文件锁，这里最多等 1 秒
+	db, err := bolt.Open(file, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(statsBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	st := &downloadStats{db: db, retention: retention, queue: make(chan downloadRecord, statsQueue), done: make(chan struct{}), active: map[*transfer]struct{}{}}
+	go st.run()
+	return st, nil
+}
+
+// record 把一次下载放入写入队列
+func (st *downloadStats) record(rec downloadRecord) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	if st.closed {
+		return
+	}
+	select {
+	case st.queue <- rec:
+	default:
+		log.Printf("Download stats queue is full, dropping record for %s", rec.Path)
+	}
+}
+
+func (st *downloadStats) run() {
+	defer close(st.done)
+	st.prune()
+	ticker := time.NewTicker(statsPruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case rec, ok := <-st.queue:
+			if !ok {
+				return
+			}
+			// 把队列中已有的记录一起写入，一次事务只同步一次磁盘
+			batch := []downloadRecord{rec}
+		drain:
+			for len(batch) < statsQueue {
+				select {
+				case rec, ok := <-st.queue:
+					if !ok {
+						break drain
+					}
+					batch = append(batch, rec)
+				default:
+					break drain
+				}
+			}
+			if err := st.write(batch); err != nil {
+				log.Printf("Failed to save download stats: %v", err)
+			}
+		case <-ticker.C:
+			st.prune()
+		}
+	}
+}
+
+func (st *downloadStats) write(batch []downloadRecord) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(statsBucket)
+		for _, rec := range batch {
+			v, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			seq, _ := b.NextSequence()
+			if err := b.Put(statsKey(rec.Time, seq), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func statsKey(t time.Time, seq uint64) []byte {
+	k := make([]byte, 16)
+	// 1970 年之前（包括零值）当作最早的时间
+	if t.Unix() > 0 {
+		binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	}
+	binary.BigEndian.PutUint64(k[8:], seq)
+	return k
+}
+
+// prune 删除超过保留时间的记录
+func (st *downloadStats) prune() {
+	cutoff := statsKey(time.Now().Add(-st.retention), 0)
+	var n int
+	err := st.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(statsBucket).Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to prune download stats: %v", err)
+	} else if n > 0 {
+		log.Printf("Pruned %d download records older than %s", n, st.retention)
+	}
+}
+
+// each 按时间顺序读取 since 之后的记录，fn 返回 false 时停止
+func (st *downloadStats) each(since time.Time, fn func(rec downloadRecord) bool) error {
+	return st.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(statsBucket).Cursor()
+		for k, v := c.Seek(statsKey(since, 0)); k != nil; k, v = c.Next() {
+			var rec downloadRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return fmt.Errorf("corrupt record %x: %w", k, err)
+			}
+			if !fn(rec) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// start 开始跟踪一个下载，结束时调用 finish
+func (st *downloadStats) start(rec downloadRecord, size int64) *transfer {
+	t := &transfer{rec: rec, size: size}
+	st.amu.Lock()
+	st.active[t] = struct{}{}
+	st.amu.Unlock()
+	return t
+}
+
+func (st *downloadStats) finish(t *transfer) {
+	st.amu.Lock()
+	delete(st.active, t)
+	st.amu.Unlock()
+}
+
+// transfers 返回正在进行的下载，先开始的在前
+func (st *downloadStats) transfers() []*transfer {
+	st.amu.Lock()
+	list := make([]*transfer, 0, len(st.active))
+	for t := range st.active {
+		list = append(list, t)
+	}
+	st.amu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].rec.Time.Before(list[j].rec.Time) })
+	return list
+}
+
+// close 写完队列中剩下的记录后关闭数据库
+func (st *downloadStats) close() error {
+	st.mu.Lock()
+	if st.closed {
+		st.mu.Unlock()
+		return nil
+	}
+	st.closed = true
+	close(st.queue)
+	st.mu.Unlock()
+	<-st.done
+	return st.db.Close()
+}
+
+// downloadRecord 返回 HTTP 请求 r 下载 p 的记录，字节数和状态码在下载结束后填写
+func (s *server) downloadRecord(r *http.Request, p string) downloadRecord {
+	rec := downloadRecord{Path: p, Via: "http", Time: time.Now()}
+	if u := currentUser(r); u != nil {
+		rec.User = u.Name
+	}
+	if ip := s.clientIP(r); ip != nil {
+		rec.Client = ip.String()
+	}
+	return rec
+}
@@ -0,0 +1,65 @@
+package fileserver
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDownloadStats(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "stats.db")
+	h := newTestHandler(t, Config{Root: newTestRoot(t), StatsDB: db})
+	do(t, h, httptest.NewRequest("GET", "/download/a.txt", nil))
+	r := httptest.NewRequest("GET", "/download/sub/b.txt", nil)
+	r.Header.Set("Range", "bytes=0-1")
+	do(t, h, r)
+	// HEAD 不算下载
+	do(t, h, httptest.NewRequest("HEAD", "/download/a.txt", nil))
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开后记录仍然在
+	st, err := openDownloadStats(db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.close()
+	var recs []downloadRecord
+	st.each(time.Time{}, func(rec downloadRecord) bool {
+		recs = append(recs, rec)
+		return true
+	})
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want 2: %+v", len(recs), recs)
+	}
+	if r := recs[0]; r.Path != "/a.txt" || r.Bytes != 5 || r.Status != 200 || r.Client != "192.0.2.1" || r.Via != "http" {
+		t.Errorf("first record = %+v", r)
+	}
+	if r := recs[1]; r.Path != "/sub/b.txt" || r.Bytes != 2 || r.Status != 206 {
+		t.Errorf("range record = %+v", r)
+	}
+}
+
+func TestDownloadStatsRetention(t *testing.T) {
+	st, err := openDownloadStats(filepath.Join(t.TempDir(), "stats.db"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.close()
+	now := time.Now()
+	st.write([]downloadRecord{
+		{Path: "/old", Time: now.Add(-2 * time.Hour)},
+		{Path: "/new", Time: now.Add(-time.Minute)},
+	})
+	st.prune()
+	var paths []string
+	st.each(time.Time{}, func(rec downloadRecord) bool {
+		paths = append(paths, rec.Path)
+		return true
+	})
+	if len(paths) != 1 || paths[0] != "/new" {
+		t.Errorf("records after prune = %v, want [/new]", paths)
+	}
+}
@@ -0,0 +1,172 @@
+package fileserver
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// 下载统计页面：GET /stats?days=7，从 -stats-db 的记录中统计下载最多的文件、每天（days=1 时每小时）的流量、
+// 不同的客户端，另外列出正在进行的下载。只有配置文件 admins 中的用户可以打开
+
+// statsRanges 是页面上可以选择的统计天数
+var statsRanges = []int{1, 7, 30, 90}
+
+// statsTop 是下载最多的文件、客户端各显示的个数
+const statsTop = 20
+
+// StatsData 是 /stats 页面的数据
+type StatsData struct {
+	Page
+	Days       int   // 统计最近几天
+	Ranges     []int // 可以选择的天数
+	Downloads  int
+	Bytes      int64
+	Clients    int // 不同的客户端 IP 个数
+	Files      []StatsItem
+	TopClients []StatsItem
+	Traffic    []StatsBucket
+	Active     []StatsTransfer
+}
+
+// StatsItem 是下载最多的一个文件或客户端
+type StatsItem struct {
+	Name      string
+	Downloads int
+	Bytes     int64
+}
+
+// StatsBucket 是一天或一小时的流量，Percent 是相对流量最大的时段的比例
+type StatsBucket struct {
+	Label     string
+	Downloads int
+	Bytes     int64
+	Percent   int
+}
+
+// StatsTransfer 是一个正在进行的下载
+type StatsTransfer struct {
+	Path    string
+	Client  string
+	User    string
+	Via     string
+	Sent    int64
+	Size    int64
+	Percent int
+	Elapsed string
+}
+
+// statsHandler 处理 GET /stats
+func (s *server) statsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	if s.stats == nil {
+		s.httpError(w, r, http.StatusNotFound, "Download statistics are disabled, start the server with -stats-db")
+		return
+	}
+	days, _ := strconv.Atoi(r.FormValue("days"))
+	if !slices.Contains(statsRanges, days) {
+		days = 7
+	}
+	data := StatsData{Page: s.page(w, r), Days: days, Ranges: statsRanges}
+
+	// 只有一天时按小时统计，否则按服务器的本地时间按天统计。按天用 AddDate，夏令时切换的那天不是 24 小时
+	now := time.Now()
+	var starts []time.Time
+	layout := "01-02"
+	if days == 1 {
+		layout = "15:00"
+		for i := 23; i >= 0; i-- {
+			starts = append(starts, now.Truncate(time.Hour).Add(-time.Duration(i)*time.Hour))
+		}
+	} else {
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		for i := days - 1; i >= 0; i-- {
+			starts = append(starts, today.AddDate(0, 0, -i))
+		}
+	}
+	data.Traffic = make([]StatsBucket, len(starts))
+	for i, t := range starts {
+		data.Traffic[i].Label = t.Format(layout)
+	}
+
+	files := map[string]*StatsItem{}
+	clients := map[string]*StatsItem{}
+	err := s.stats.each(starts[0], func(rec downloadRecord) bool {
+		data.Downloads++
+		data.Bytes += rec.Bytes
+		countDownload(files, rec.Path, rec.Bytes)
+		if rec.Client != "" {
+			countDownload(clients, rec.Client, rec.Bytes)
+		}
+		// 记录按时间排序，starts[i] <= rec.Time 的最后一个时段
+		i := sort.Search(len(starts), func(i int) bool { return starts[i].After(rec.Time) }) - 1
+		if i >= 0 {
+			data.Traffic[i].Downloads++
+			data.Traffic[i].Bytes += rec.Bytes
+		}
+		return true
+	})
+	if err != nil {
+		log.Printf("Failed to read download stats: %v", err)
+		s.httpError(w, r, http.StatusInternalServerError, "Failed to read download statistics")
+		return
+	}
+	data.Clients = len(clients)
+	data.Files = topItems(files)
+	data.TopClients = topItems(clients)
+
+	var peak int64
+	for _, b := range data.Traffic {
+		peak = max(peak, b.Bytes)
+	}
+	for i := range data.Traffic {
+		if peak > 0 {
+			data.Traffic[i].Percent = int(data.Traffic[i].Bytes * 100 / peak)
+		}
+	}
+
+	for _, t := range s.stats.transfers() {
+		at := StatsTransfer{Path: t.rec.Path, Client: t.rec.Client, User: t.rec.User, Via: t.rec.Via, Sent: t.sent.Load(), Size: t.size,
+			Elapsed: time.Since(t.rec.Time).Round(time.Second).String()}
+		if at.Size > 0 {
+			at.Percent = int(min(at.Sent*100/at.Size, 100))
+		}
+		data.Active = append(data.Active, at)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	s.render(w, "stats.html", data)
+}
+
+// countDownload 给 m 中的 name 加一次下载
+func countDownload(m map[string]*StatsItem, name string, bytes int64) {
+	it := m[name]
+	if it == nil {
+		it = &StatsItem{Name: name}
+		m[name] = it
+	}
+	it.Downloads++
+	it.Bytes += bytes
+}
+
+// topItems 返回下载次数最多的 statsTop 个，次数相同时按名字排序
+func topItems(m map[string]*StatsItem) []StatsItem {
+	list := make([]StatsItem, 0, len(m))
+	for _, it := range m {
+		list = append(list, *it)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Downloads != list[j].Downloads {
+			return list[i].Downloads > list[j].Downloads
+		}
+		return list[i].Name < list[j].Name
+	})
+	if len(list) > statsTop {
+		list = list[:statsTop]
+	}
+	return list
+}
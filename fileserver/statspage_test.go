@@ -0,0 +1,63 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStatsPage(t *testing.T) {
+	config := writeConfig(t, `{
+		"users": [{"name": "alice", "password": "pw", "groups": ["admin"]}, {"name": "bob", "password": "pw"}],
+		"admins": ["@admin"]
+	}`)
+	h := newTestHandler(t, Config{Root: newTestRoot(t), ConfigFile: config, StatsDB: filepath.Join(t.TempDir(), "stats.db")})
+	defer h.Close()
+	get := func(name, target string) (*http.Response, string) {
+		t.Helper()
+		r := httptest.NewRequest("GET", target, nil)
+		if name != "" {
+			r.SetBasicAuth(name, "pw")
+		}
+		return do(t, h, r)
+	}
+
+	if res, _ := get("", "/stats"); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("anonymous: status = %d, want 401", res.StatusCode)
+	}
+	if res, _ := get("bob", "/stats"); res.StatusCode != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d, want 403", res.StatusCode)
+	}
+
+	get("bob", "/download/a.txt")
+	get("bob", "/download/a.txt")
+	get("alice", "/download/sub/b.txt")
+	// 记录在后台写入
+	var body string
+	waitIndex(t, "download records", func() bool {
+		_, body = get("alice", "/stats?days=1")
+		return strings.Contains(body, "<code>/sub/b.txt</code>")
+	})
+	if i, j := strings.Index(body, "<code>/a.txt</code>"), strings.Index(body, "<code>/sub/b.txt</code>"); i < 0 || i > j {
+		t.Errorf("most downloaded file is not listed first:\n%s", body)
+	}
+	if !strings.Contains(body, `data-bytes="15"`) {
+		t.Errorf("total traffic missing:\n%s", body)
+	}
+
+	tr := h.s.stats.start(downloadRecord{Path: "/big.iso", Client: "192.0.2.9", Via: "http"}, 1000)
+	tr.Write(make([]byte, 250))
+	if _, body := get("alice", "/stats"); !strings.Contains(body, `<progress max="100" value="25">`) || !strings.Contains(body, "/big.iso") {
+		t.Errorf("active transfer missing:\n%s", body)
+	}
+	h.s.stats.finish(tr)
+
+	off := newTestHandler(t, Config{Root: newTestRoot(t), ConfigFile: config})
+	r := httptest.NewRequest("GET", "/stats", nil)
+	r.SetBasicAuth("alice", "pw")
+	if res, _ := do(t, off, r); res.StatusCode != http.StatusNotFound {
+		t.Errorf("without -stats-db: status = %d, want 404", res.StatusCode)
+	}
+}
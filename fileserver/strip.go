@@ -0,0 +1,211 @@
+package fileserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// 去掉图片的元数据（-strip-exif）：公开分享照片时，查看、下载、分享链接返回的 JPEG 和 PNG 都去掉 EXIF（GPS 位置、相机序列号、
+// 缩略图）、XMP、IPTC 和文字注释，图片页面也不再显示拍摄信息。不重新编码，只是跳过这些段，画质不变，仍然支持断点续传；
+// JPEG 的方向另外写一个只有方向的 EXIF，竖着拍的照片不会倒下。磁盘上的原图不变，FTP 和 SFTP 访问的也是原图
+
+// 不能随机读取的文件（远程文件系统）读到内存中处理，超过这个大小时拒绝
+const maxStripSize = 256 << 20
+
+var errStrip = errors.New("failed to strip image metadata")
+
+// piece 是输出中的一段：data 不为 nil 时是新写入的内容，否则是原文件从 off 开始的 n 个字节
+type piece struct {
+	off, n int64
+	data   []byte
+}
+
+// jpegPieces 返回 JPEG 去掉元数据后的各段，不是 JPEG 时返回 false
+func jpegPieces(ra io.ReaderAt, size int64) ([]piece, bool) {
+	var b [4]byte
+	if _, err := ra.ReadAt(b[:2], 0); err != nil || b[0] != 0xFF || b[1] != 0xD8 {
+		return nil, false
+	}
+	pieces := []piece{{off: 0, n: 2}}
+	if o := jpegOrientation(io.NewSectionReader(ra, 0, size)); o != 1 {
+		pieces = append(pieces, piece{data: orientationSegment(o)})
+	}
+	for p := int64(2); p < size; {
+		if _, err := ra.ReadAt(b[:2], p); err != nil || b[0] != 0xFF {
+			return nil, false
+		}
+		m := b[1]
+		switch {
+		case m == 0xFF:
+			// 填充字节
+			p++
+			continue
+		case m == 0xDA || m == 0xD9:
+			// 图像数据开始后原样输出
+			return append(pieces, piece{off: p, n: size - p}), true
+		case m >= 0xD0 && m <= 0xD7 || m == 0x01:
+			pieces = append(pieces, piece{off: p, n: 2})
+			p += 2
+			continue
+		}
+		if _, err := ra.ReadAt(b[2:4], p+2); err != nil {
+			return nil, false
+		}
+		n := 2 + int64(binary.BigEndian.Uint16(b[2:4]))
+		// APP1（EXIF、XMP）、APP13（IPTC）和注释去掉，其余（量化表、ICC 颜色配置等）保留
+		if m != 0xE1 && m != 0xED && m != 0xFE {
+			pieces = append(pieces, piece{off: p, n: n})
+		}
+		p += n
+	}
+	return nil, false
+}
+
+// orientationSegment 生成一个只记录方向 o 的 APP1 段
+func orientationSegment(o int) []byte {
+	be := binary.BigEndian
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	seg = append(seg, "Exif\x00\x00MM\x00\x2A\x00\x00\x00\x08"...)
+	seg = be.AppendUint16(seg, 1)
+	seg = be.AppendUint16(seg, tagOrientation)
+	seg = be.AppendUint16(seg, 3)
+	seg = be.AppendUint32(seg, 1)
+	seg = be.AppendUint16(seg, uint16(o))
+	seg = append(seg, 0, 0, 0, 0, 0, 0)
+	be.PutUint16(seg[2:], uint16(len(seg)-2))
+	return seg
+}
+
+// 去掉的 PNG 块：EXIF 和各种文字（作者、软件、XMP 等）
+var pngMetadata = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true}
+
+// pngPieces 返回 PNG 去掉元数据后的各段，不是 PNG 时返回 false
+func pngPieces(ra io.ReaderAt, size int64) ([]piece, bool) {
+	var b [8]byte
+	if _, err := ra.ReadAt(b[:], 0); err != nil || string(b[:]) != "\x89PNG\r\n\x1a\n" {
+		return nil, false
+	}
+	pieces := []piece{{off: 0, n: 8}}
+	for p := int64(8); p < size; {
+		if _, err := ra.ReadAt(b[:], p); err != nil {
+			return nil, false
+		}
+		// 长度、类型、数据、CRC
+		n := 12 + int64(binary.BigEndian.Uint32(b[:4]))
+		if !pngMetadata[string(b[4:8])] {
+			pieces = append(pieces, piece{off: p, n: min(n, size-p)})
+		}
+		p += n
+	}
+	return pieces, true
+}
+
+// piecesFile 把各段拼成一个可以 Seek 的文件，http.ServeContent 可以按范围读取
+type piecesFile struct {
+	ra     io.ReaderAt
+	pieces []piece
+	info   fs.FileInfo
+	size   int64
+	pos    int64
+	closer io.Closer
+}
+
+func (f *piecesFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *piecesFile) Close() error { return f.closer.Close() }
+
+func (f *piecesFile) Read(b []byte) (int, error) {
+	if f.pos >= f.size {
+		return 0, io.EOF
+	}
+	start := int64(0)
+	for _, pc := range f.pieces {
+		n := pc.n
+		if pc.data != nil {
+			n = int64(len(pc.data))
+		}
+		if f.pos < start+n {
+			rel := f.pos - start
+			want := min(int64(len(b)), n-rel)
+			var got int
+			var err error
+			if pc.data != nil {
+				got = copy(b[:want], pc.data[rel:])
+			} else {
+				got, err = f.ra.ReadAt(b[:want], pc.off+rel)
+				if err == io.EOF && int64(got) == want {
+					err = nil
+				}
+			}
+			f.pos += int64(got)
+			return got, err
+		}
+		start += n
+	}
+	return 0, io.EOF
+}
+
+func (f *piecesFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+// strippedInfo 是去掉元数据后的文件信息，大小变了，修改时间不变
+type strippedInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (i strippedInfo) Size() int64 { return i.size }
+
+// stripMetadata 在 -strip-exif 时把 JPEG、PNG 文件 f 换成去掉元数据的版本，其他文件原样返回
+func (s *server) stripMetadata(info fs.FileInfo, f fs.File) (fs.FileInfo, fs.File, error) {
+	name := strings.ToLower(info.Name())
+	if !s.stripEXIF || !isJPEG(name) && !strings.HasSuffix(name, ".png") {
+		return info, f, nil
+	}
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		if info.Size() > maxStripSize {
+			return nil, nil, fmt.Errorf("%w: image is too large", errStrip)
+		}
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		ra = bytes.NewReader(b)
+	}
+	var pieces []piece
+	if isJPEG(name) {
+		pieces, ok = jpegPieces(ra, info.Size())
+	} else {
+		pieces, ok = pngPieces(ra, info.Size())
+	}
+	if !ok {
+		// 扩展名和内容不符，不敢原样发送，可能带着元数据
+		return nil, nil, errStrip
+	}
+	var size int64
+	for _, pc := range pieces {
+		if pc.data != nil {
+			size += int64(len(pc.data))
+		} else {
+			size += pc.n
+		}
+	}
+	return strippedInfo{info, size}, &piecesFile{ra: ra, pieces: pieces, info: strippedInfo{info, size}, size: size, closer: f}, nil
+}
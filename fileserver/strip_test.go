@@ -0,0 +1,82 @@
+package fileserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pngWithText 在 PNG 的 IHDR 后面插入一个 tEXt 块
+func pngWithText(t *testing.T, text string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4)))
+	b := buf.Bytes()
+	ihdrEnd := 8 + 12 + int(binary.BigEndian.Uint32(b[8:]))
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)))
+	chunk = append(chunk, "tEXt"+text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	return append(append(append([]byte{}, b[:ihdrEnd]...), chunk...), b[ihdrEnd:]...)
+}
+
+func TestStripEXIF(t *testing.T) {
+	root := newTestRoot(t)
+	photo := exifJPEG(t, image.NewGray(image.Rect(0, 0, 4, 4)),
+		[]tiffTag{asciiTag(tagMake, "Canon"), shortTag(tagOrientation, 6)}, nil,
+		[]tiffTag{asciiTag(tagGPSLatRef, "N"), rationalTag(tagGPSLat, 31, 1, 14, 1, 24, 1), asciiTag(tagGPSLonRef, "E"), rationalTag(tagGPSLon, 121, 1, 28, 1, 12, 1)})
+	os.WriteFile(filepath.Join(root, "photo.jpg"), photo, 0644)
+	os.WriteFile(filepath.Join(root, "shot.png"), pngWithText(t, "Author\x00Alice"), 0644)
+	os.WriteFile(filepath.Join(root, "fake.jpg"), []byte("not a jpeg"), 0644)
+	h := newTestHandler(t, Config{Root: root, StripEXIF: true})
+
+	for _, p := range []string{"/download/photo.jpg", "/view/photo.jpg?raw=1"} {
+		res, body := do(t, h, httptest.NewRequest("GET", p, nil))
+		if res.StatusCode != http.StatusOK || strings.Contains(body, "Canon") || res.Header.Get("Content-Length") != strconv.Itoa(len(body)) {
+			t.Fatalf("%s: got %d, %d bytes, headers %v", p, res.StatusCode, len(body), res.Header)
+		}
+		// 方向保留下来，GPS 去掉了
+		if e, err := readEXIF(strings.NewReader(body)); err == nil && (e.GPS || e.Camera != "") {
+			t.Errorf("%s: metadata was kept: %+v", p, e)
+		}
+		if o := jpegOrientation(strings.NewReader(body)); o != 6 {
+			t.Errorf("%s: orientation = %d, want 6", p, o)
+		}
+		if _, err := jpeg.Decode(strings.NewReader(body)); err != nil {
+			t.Errorf("%s: stripped image does not decode: %v", p, err)
+		}
+	}
+
+	res, body := do(t, h, httptest.NewRequest("GET", "/download/shot.png", nil))
+	if res.StatusCode != http.StatusOK || strings.Contains(body, "Alice") {
+		t.Fatalf("png: got %d %q", res.StatusCode, body)
+	}
+	if _, err := png.Decode(strings.NewReader(body)); err != nil {
+		t.Errorf("stripped png does not decode: %v", err)
+	}
+
+	// 断点续传按去掉元数据后的内容计算
+	r := httptest.NewRequest("GET", "/download/photo.jpg", nil)
+	r.Header.Set("Range", "bytes=0-3")
+	if res, body := do(t, h, r); res.StatusCode != http.StatusPartialContent || len(body) != 4 || res.Header.Get("Content-Range") == "" {
+		t.Errorf("range: got %d %q", res.StatusCode, body)
+	}
+
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/download/fake.jpg", nil)); res.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("fake jpeg: got %d, want 422", res.StatusCode)
+	}
+
+	// 没有 -strip-exif 时原样返回
+	if _, body := do(t, newTestHandler(t, Config{Root: root}), httptest.NewRequest("GET", "/download/photo.jpg", nil)); body != string(photo) {
+		t.Error("download without StripEXIF was modified")
+	}
+}
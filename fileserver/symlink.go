@@ -0,0 +1,211 @@
+package fileserver
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// 符号链接（-follow-symlinks）：根目录是本地目录时，浏览、查看、下载、搜索、目录大小都通过 symlinkFS 读取，
+// 按同一个策略处理符号链接：
+//   - never：不跟随任何符号链接，它们不出现在目录列表中，访问时返回 404
+//   - within-root（默认）：只跟随目标仍在根目录下的符号链接，指向外面的和已经失效的都当作不存在
+//   - always：跟随所有符号链接，和以前一样
+//
+// 允许跟随的链接在目录列表中显示为目标的类型和大小，指向上级目录形成循环的目录链接不列出，
+// 遍历整个目录（索引、目录大小）不会陷入死循环。上传、新建目录、移动、删除、解压、从回收站恢复和在线编辑时，
+// 写入位置的路径同样要符合这个策略
+
+// 符号链接策略
+const (
+	SymlinksNever      = "never"
+	SymlinksWithinRoot = "within-root"
+	SymlinksAlways     = "always"
+)
+
+// SymlinkPolicies 返回所有符号链接策略
+func SymlinkPolicies() []string {
+	return []string{SymlinksNever, SymlinksWithinRoot, SymlinksAlways}
+}
+
+// errSymlink 表示路径经过了策略不允许的符号链接，对外当作文件不存在
+var errSymlink = fmt.Errorf("symbolic link not allowed: %w", fs.ErrNotExist)
+
+// symlinkFS 按策略检查经过符号链接的路径，其他和 os.DirFS(root) 相同。
+// 和 os.DirFS 不同的是接受不是 UTF-8 的文件名，-filename-encoding 的旧文件名才能打开
+type symlinkFS struct {
+	root   string // 根目录的本地路径
+	real   string // 根目录解析所有符号链接后的路径
+	policy string
+}
+
+func newSymlinkFS(root, policy string) *symlinkFS {
+	real, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		// 根目录还不存在时按原样使用
+		real = root
+	}
+	return &symlinkFS{root: root, real: real, policy: policy}
+}
+
+// validName 和 fs.ValidPath 一样检查路径，但不要求是 UTF-8。Windows 上还不能含有 \ 和 :，不能是 NUL 等设备名
+func validName(name string) bool {
+	_, err := filepath.Localize(strings.ToValidUTF8(name, "_"))
+	return err == nil
+}
+
+// local 返回 io/fs 路径 name 的本地路径
+func (f *symlinkFS) local(name string) string {
+	if name == "." {
+		return f.root
+	}
+	return filepath.Join(f.root, filepath.FromSlash(name))
+}
+
+// check 检查 name 经过的符号链接是否符合策略，不存在的路径交给后面的操作报告
+func (f *symlinkFS) check(name string) error {
+	switch f.policy {
+	case SymlinksAlways:
+		return nil
+	case SymlinksNever:
+		if name == "." {
+			return nil
+		}
+		p := f.root
+		for _, part := range strings.Split(name, "/") {
+			p = filepath.Join(p, part)
+			info, err := os.Lstat(p)
+			if err != nil {
+				return nil
+			}
+			if info.Mode()&fs.ModeSymlink != 0 {
+				return errSymlink
+			}
+		}
+		return nil
+	}
+	real, err := filepath.EvalSymlinks(f.local(name))
+	if err != nil {
+		if _, lerr := os.Lstat(f.local(name)); lerr == nil {
+			// 失效的链接
+			return errSymlink
+		}
+		if name == "." {
+			return nil
+		}
+		// 不存在的路径检查它已经存在的上级目录，上传时不会经过链接在根目录外面创建目录
+		return f.check(path.Dir(name))
+	}
+	if !within(filepath.ToSlash(f.real), filepath.ToSlash(real)) {
+		return errSymlink
+	}
+	return nil
+}
+
+func (f *symlinkFS) Open(name string) (fs.File, error) {
+	if !validName(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := f.check(name); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return os.Open(f.local(name))
+}
+
+func (f *symlinkFS) Stat(name string) (fs.FileInfo, error) {
+	if !validName(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := f.check(name); err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return os.Stat(f.local(name))
+}
+
+// ReadDir 列出目录，允许跟随的符号链接换成目标的信息，不允许的和形成循环的去掉
+func (f *symlinkFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !validName(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := f.check(name); err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries, err := os.ReadDir(f.local(name))
+	if err != nil {
+		return nil, err
+	}
+	var ancestors map[string]bool
+	list := entries[:0]
+	for _, e := range entries {
+		if e.Type()&fs.ModeSymlink == 0 {
+			list = append(list, e)
+			continue
+		}
+		p := path.Join(name, e.Name())
+		if f.check(p) != nil {
+			continue
+		}
+		info, err := os.Stat(f.local(p))
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			if ancestors == nil {
+				ancestors = f.ancestors(name)
+			}
+			if real, err := filepath.EvalSymlinks(f.local(p)); err != nil || ancestors[real] {
+				continue
+			}
+		}
+		list = append(list, fs.FileInfoToDirEntry(renamed{info, e.Name()}))
+	}
+	return list, nil
+}
+
+// ancestors 返回目录 name 和它的每一级上级目录解析符号链接后的路径，目录链接指向其中之一就形成循环
+func (f *symlinkFS) ancestors(name string) map[string]bool {
+	dirs := map[string]bool{}
+	for p := name; ; p = path.Dir(p) {
+		if real, err := filepath.EvalSymlinks(f.local(p)); err == nil {
+			dirs[real] = true
+		}
+		if p == "." {
+			return dirs
+		}
+	}
+}
+
+// renamed 把链接目标的信息换成链接自己的名字
+type renamed struct {
+	fs.FileInfo
+	name string
+}
+
+func (r renamed) Name() string { return r.name }
+
+// checkSymlinks 检查根目录下的本地路径 p（/ 开头）是否符合符号链接策略，写入前用来检查目标位置
+func (s *server) checkSymlinks(p string) error {
+	fsys := s.fsys
+	if e, ok := fsys.(*encodedFS); ok {
+		fsys = e.FS
+	}
+	if f, ok := fsys.(*symlinkFS); ok {
+		return f.check(fsName(p))
+	}
+	return nil
+}
+
+// validSymlinkPolicy 检查配置中的策略，为空时使用 within-root
+func validSymlinkPolicy(policy string) (string, error) {
+	if policy == "" {
+		return SymlinksWithinRoot, nil
+	}
+	if !slices.Contains(SymlinkPolicies(), policy) {
+		return "", fmt.Errorf("unknown symlink policy %q, expected %s", policy, strings.Join(SymlinkPolicies(), ", "))
+	}
+	return policy, nil
+}
@@ -0,0 +1,183 @@
+package fileserver
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFollowSymlinks(t *testing.T) {
+	root := newTestRoot(t)
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644)
+	links := map[string]string{
+		"out":       outside,
+		"outfile":   filepath.Join(outside, "secret.txt"),
+		"in":        filepath.Join(root, "sub"),
+		"file-link": filepath.Join(root, "a.txt"),
+		"loop":      root,
+		"broken":    filepath.Join(root, "missing"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+	get := func(h *Handler, target string) (int, string) {
+		t.Helper()
+		res, body := do(t, h, httptest.NewRequest("GET", target, nil))
+		return res.StatusCode, body
+	}
+
+	tests := []struct {
+		policy string
+		ok     []string // 可以下载的路径
+		denied []string // 返回 404 的路径
+		listed []string // 目录列表中出现的链接
+	}{
+		{SymlinksWithinRoot, []string{"/a.txt", "/in/b.txt", "/file-link"}, []string{"/out/secret.txt", "/outfile", "/broken"}, []string{"in/", "file-link"}},
+		{SymlinksNever, []string{"/a.txt"}, []string{"/in/b.txt", "/file-link", "/out/secret.txt", "/outfile"}, nil},
+		{SymlinksAlways, []string{"/a.txt", "/in/b.txt", "/file-link", "/out/secret.txt", "/outfile"}, []string{"/broken"}, []string{"in/", "file-link", "out/", "outfile"}},
+	}
+	for _, tt := range tests {
+		h := newTestHandler(t, Config{Root: root, FollowSymlinks: tt.policy}, WithReadWrite())
+		for _, p := range tt.ok {
+			if status, _ := get(h, "/download"+p); status != http.StatusOK {
+				t.Errorf("%s: GET %s: status = %d, want 200", tt.policy, p, status)
+			}
+		}
+		for _, p := range tt.denied {
+			if status, _ := get(h, "/download"+p); status != http.StatusNotFound {
+				t.Errorf("%s: GET %s: status = %d, want 404", tt.policy, p, status)
+			}
+		}
+		_, body := get(h, "/api/list/")
+		for name := range links {
+			want := false
+			for _, l := range tt.listed {
+				want = want || strings.TrimSuffix(l, "/") == name
+			}
+			if got := strings.Contains(body, `"name":"`+name+`"`); got != want {
+				t.Errorf("%s: %s listed = %v, want %v\n%s", tt.policy, name, got, want, body)
+			}
+		}
+		// 指向目录的链接显示为目录
+		if tt.policy != SymlinksNever && !strings.Contains(body, `"url":"/in/"`) {
+			t.Errorf("%s: link to a directory is not listed as a directory\n%s", tt.policy, body)
+		}
+	}
+
+	// 不能经过指向根目录外面的链接上传
+	h := newTestHandler(t, Config{Root: root}, WithReadWrite())
+	if res, _ := do(t, h, httptest.NewRequest("PUT", "/api/files/out/new/x.txt", strings.NewReader("x"))); res.StatusCode != http.StatusNotFound {
+		t.Errorf("upload through a link: status = %d, want 404", res.StatusCode)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new")); err == nil {
+		t.Error("upload created a directory outside the root")
+	}
+	if res, _ := do(t, h, httptest.NewRequest("PUT", "/api/files/in/new.txt", strings.NewReader("x"))); res.StatusCode != http.StatusCreated {
+		t.Errorf("upload through a link inside the root: status = %d", res.StatusCode)
+	}
+	if _, err := New(Config{Root: root, FollowSymlinks: "sometimes"}); err == nil {
+		t.Error("unknown policy accepted")
+	}
+}
+
+// newSymlinkRoot 返回测试用的根目录，其中 out 是指向根目录外面的目录链接，外面的目录里有 secret.txt
+func newSymlinkRoot(t *testing.T) (root, outside string) {
+	t.Helper()
+	root = newTestRoot(t)
+	outside = t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644)
+	if err := os.Symlink(outside, filepath.Join(root, "out")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	return root, outside
+}
+
+func TestSymlinkEdit(t *testing.T) {
+	root, outside := newSymlinkRoot(t)
+	h := newTestHandler(t, Config{Root: root}, WithReadWrite())
+	res, body := do(t, h, httptest.NewRequest("GET", "/edit/out/secret.txt", nil))
+	if res.StatusCode != http.StatusNotFound || strings.Contains(body, "secret") {
+		t.Errorf("edit through a link: status = %d, want 404\n%s", res.StatusCode, body)
+	}
+	if status := postForm(t, h, "/edit/out/secret.txt", url.Values{"content": {"changed"}}); status != http.StatusNotFound {
+		t.Errorf("save through a link: status = %d, want 404", status)
+	}
+	if b, _ := os.ReadFile(filepath.Join(outside, "secret.txt")); string(b) != "secret" {
+		t.Errorf("file outside the root changed: %q", b)
+	}
+}
+
+// 所有写入的路径都不能经过指向根目录外面的链接：先检查再创建上级目录、移动或保存
+func TestSymlinkWrites(t *testing.T) {
+	root, outside := newSymlinkRoot(t)
+	h := newTestHandler(t, Config{Root: root}, WithReadWrite())
+	request := func(method, target string, body io.Reader, header map[string]string) int {
+		t.Helper()
+		r := httptest.NewRequest(method, target, body)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		res, _ := do(t, h, r)
+		return res.StatusCode
+	}
+	ctype, body := multipartBody(t, [][2]string{{"out/new/x.txt", "x"}})
+	zipBody := bytes.NewReader(zipArchive(t, map[string]string{"out/new/x.txt": "x"}))
+	for _, c := range []struct {
+		name string
+		send func() int
+	}{
+		{"mkdir", func() int { return postForm(t, h, "/api/mkdir", url.Values{"path": {"/out/new"}}) }},
+		{"move into", func() int {
+			return postForm(t, h, "/api/move", url.Values{"from": {"/a.txt"}, "to": {"/out/new/a.txt"}})
+		}},
+		{"move out of", func() int {
+			return postForm(t, h, "/api/move", url.Values{"from": {"/out/secret.txt"}, "to": {"/secret.txt"}})
+		}},
+		{"delete", func() int { return request("DELETE", "/api/files/out/secret.txt", nil, nil) }},
+		{"multipart", func() int { return request("POST", "/api/files/", body, map[string]string{"Content-Type": ctype}) }},
+		{"resumable", func() int {
+			return request("PATCH", "/api/files/out/new/x.txt", strings.NewReader("x"), map[string]string{"Upload-Offset": "0", "Upload-Length": "1"})
+		}},
+		{"extract", func() int { return request("PUT", "/api/files/dist.zip?extract=1", zipBody, nil) }},
+	} {
+		if status := c.send(); status < 400 {
+			t.Errorf("%s through a link: status = %d", c.name, status)
+		}
+		if _, err := os.Stat(filepath.Join(outside, "new")); err == nil {
+			t.Errorf("%s created a directory outside the root", c.name)
+			os.RemoveAll(filepath.Join(outside, "new"))
+		}
+		if b, err := os.ReadFile(filepath.Join(outside, "secret.txt")); err != nil || string(b) != "secret" {
+			t.Errorf("%s changed a file outside the root: %q, %v", c.name, b, err)
+			os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644)
+		}
+	}
+
+	// 删除后原来的上级目录换成了链接，不能恢复到链接的目标里
+	if status := request("DELETE", "/api/files/sub/b.txt", nil, nil); status != http.StatusOK {
+		t.Fatalf("delete: status = %d", status)
+	}
+	os.Remove(filepath.Join(root, "sub"))
+	if err := os.Symlink(outside, filepath.Join(root, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	items := h.s.trashItems()
+	if len(items) != 1 {
+		t.Fatalf("trash = %+v", items)
+	}
+	if status := postForm(t, h, "/api/trash/restore", url.Values{"id": {items[0].ID}}); status < 400 {
+		t.Errorf("restore through a link: status = %d", status)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "b.txt")); err == nil {
+		t.Error("restored outside the root")
+	}
+}
@@ -0,0 +1,200 @@
+package fileserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Bearer Token 认证，供脚本调用 JSON 接口和下载文件：
+// -api-token 指定一个固定的令牌，配置文件 jwt 段落启用 JWT 校验（共享密钥或 JWKS 地址）
+
+// jwtConfig 是配置文件中的 JWT 校验设置
+type jwtConfig struct {
+	Secret      string `json:"secret"`       // HS256/384/512 共享密钥
+	JWKSURL     string `json:"jwks_url"`     // RS*/ES* 公钥的 JWKS 地址
+	Issuer      string `json:"issuer"`       // 要求的 iss，为空不检查
+	Audience    string `json:"audience"`     // 要求的 aud，为空不检查
+	UserClaim   string `json:"user_claim"`   // 用户名所在的字段，默认 sub
+	GroupsClaim string `json:"groups_claim"` // 组列表所在的字段，默认 groups
+}
+
+// tokenAuth 校验 Authorization: Bearer 中的令牌
+type tokenAuth struct {
+	apiToken string // 固定令牌，对应用户 api
+	jwt      *jwtConfig
+	jwks     *jwksCache
+}
+
+func newTokenAuth(apiToken string, cfg *jwtConfig) *tokenAuth {
+	t := &tokenAuth{apiToken: apiToken, jwt: cfg}
+	if cfg != nil {
+		if cfg.UserClaim == "" {
+			cfg.UserClaim = "sub"
+		}
+		if cfg.GroupsClaim == "" {
+			cfg.GroupsClaim = "groups"
+		}
+		if cfg.JWKSURL != "" {
+			t.jwks = &jwksCache{url: cfg.JWKSURL}
+		}
+	}
+	return t
+}
+
+// authenticate 返回令牌对应的用户，令牌无效时返回错误
+func (t *tokenAuth) authenticate(token string) (*user, error) {
+	if t.apiToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t.apiToken)) == 1 {
+		return &user{Name: "api"}, nil
+	}
+	if t.jwt == nil || (t.jwt.Secret == "" && t.jwks == nil) {
+		return nil, errors.New("invalid token")
+	}
+
+	var methods []string
+	if t.jwt.Secret != "" {
+		methods = append(methods, "HS256", "HS384", "HS512")
+	}
+	if t.jwks != nil {
+		methods = append(methods, "RS256", "RS384", "RS512", "ES256", "ES384", "ES512")
+	}
+	opts := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithExpirationRequired()}
+	if t.jwt.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(t.jwt.Issuer))
+	}
+	if t.jwt.Audience != "" {
+		opts = append(opts, jwt.WithAudience(t.jwt.Audience))
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(tok *jwt.Token) (any, error) {
+		if _, ok := tok.Method.(*jwt.SigningMethodHMAC); ok {
+			if t.jwt.Secret == "" {
+				return nil, errors.New("HMAC tokens are not accepted")
+			}
+			return []byte(t.jwt.Secret), nil
+		}
+		if t.jwks == nil {
+			return nil, errors.New("no JWKS configured")
+		}
+		kid, _ := tok.Header["kid"].(string)
+		return t.jwks.key(kid)
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	name, _ := claims[t.jwt.UserClaim].(string)
+	if name == "" {
+		return nil, fmt.Errorf("token has no %q claim", t.jwt.UserClaim)
+	}
+	u := &user{Name: name}
+	if groups, ok := claims[t.jwt.GroupsClaim].([]any); ok {
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				u.Groups = append(u.Groups, s)
+			}
+		}
+	}
+	return u, nil
+}
+
+// jwksCache 缓存 JWKS 中的公钥，遇到未知的 kid 时重新拉取（最多每分钟一次）
+type jwksCache struct {
+	url string
+
+	mu      sync.Mutex
+	keys    map[string]any
+	fetched time.Time
+}
+
+func (c *jwksCache) key(kid string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if k, ok := c.keys[kid]; ok && time.Since(c.fetched) < time.Hour {
+		return k, nil
+	}
+	if time.Since(c.fetched) > time.Minute {
+		if keys, err := fetchJWKS(c.url); err == nil {
+			c.keys, c.fetched = keys, time.Now()
+		} else if c.keys == nil {
+			return nil, err
+		}
+	}
+	if k, ok := c.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// fetchJWKS 下载并解析 JWKS，只支持 RSA 和 EC 公钥
+func fetchJWKS(url string) (map[string]any, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: %s", url, resp.Status)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	b64 := base64.RawURLEncoding.DecodeString
+	keys := make(map[string]any)
+	for _, k := range set.Keys {
+		switch k.Kty {
+		case "RSA":
+			n, err1 := b64(k.N)
+			e, err2 := b64(k.E)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			curve := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}[k.Crv]
+			x, err1 := b64(k.X)
+			y, err2 := b64(k.Y)
+			if curve == nil || err1 != nil || err2 != nil {
+				continue
+			}
+			// RFC 7518 要求坐标正好是曲线的字节数，长度不对的密钥直接忽略
+			size := (curve.Params().BitSize + 7) / 8
+			if len(x) != size || len(y) != size {
+				continue
+			}
+			point := append(append([]byte{4}, x...), y...)
+			// 不在曲线上的点解析时返回错误，同样忽略
+			if pub, err := ecdsa.ParseUncompressedPublicKey(curve, point); err == nil {
+				keys[k.Kid] = pub
+			}
+		}
+	}
+	return keys, nil
+}
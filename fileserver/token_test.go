@@ -0,0 +1,104 @@
+package fileserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func signToken(t *testing.T, method jwt.SigningMethod, key any, claims jwt.MapClaims) string {
+	t.Helper()
+	s, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestBearerToken(t *testing.T) {
+	config := writeConfig(t, `{"require_auth":true,"jwt":{"secret":"s3cret","issuer":"me"}}`)
+	h := newTestHandler(t, Config{Root: newTestRoot(t), ConfigFile: config, APIToken: "fixed"})
+	exp := time.Now().Add(time.Hour).Unix()
+
+	for _, c := range []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"api token", "fixed", http.StatusOK},
+		{"valid jwt", signToken(t, jwt.SigningMethodHS256, []byte("s3cret"), jwt.MapClaims{"sub": "alice", "iss": "me", "exp": exp}), http.StatusOK},
+		{"wrong secret", signToken(t, jwt.SigningMethodHS256, []byte("other"), jwt.MapClaims{"sub": "alice", "iss": "me", "exp": exp}), http.StatusUnauthorized},
+		{"empty secret", signToken(t, jwt.SigningMethodHS256, []byte(""), jwt.MapClaims{"sub": "alice", "iss": "me", "exp": exp}), http.StatusUnauthorized},
+		{"alg none", signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, jwt.MapClaims{"sub": "alice", "iss": "me", "exp": exp}), http.StatusUnauthorized},
+		{"wrong issuer", signToken(t, jwt.SigningMethodHS256, []byte("s3cret"), jwt.MapClaims{"sub": "alice", "iss": "you", "exp": exp}), http.StatusUnauthorized},
+		{"no expiry", signToken(t, jwt.SigningMethodHS256, []byte("s3cret"), jwt.MapClaims{"sub": "alice", "iss": "me"}), http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest("GET", "/download/a.txt", nil)
+		if c.token != "" {
+			r.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		if res, _ := do(t, h, r); res.StatusCode != c.want {
+			t.Errorf("%s: status = %d, want %d", c.name, res.StatusCode, c.want)
+		}
+	}
+}
+
+func TestJWTConfigWithoutKey(t *testing.T) {
+	config := writeConfig(t, `{"require_auth":true,"jwt":{"issuer":"me"}}`)
+	if _, err := New(Config{Root: newTestRoot(t), ConfigFile: config}); err == nil {
+		t.Error("jwt config without secret or jwks_url was accepted")
+	}
+	// 绕过配置文件检查时也不能用空密钥校验
+	ta := newTokenAuth("", &jwtConfig{Issuer: "me"})
+	token := signToken(t, jwt.SigningMethodHS256, []byte(""), jwt.MapClaims{"sub": "alice", "iss": "me", "exp": time.Now().Add(time.Hour).Unix()})
+	if _, err := ta.authenticate(token); err == nil {
+		t.Error("token signed with an empty secret was accepted")
+	}
+}
+
+func TestFetchJWKS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := key.PublicKey.Bytes()
+	x, y := b[1:33], b[33:]
+	offCurve := slices.Clone(y)
+	offCurve[31] ^= 1
+	enc := base64.RawURLEncoding.EncodeToString
+	ec := func(kid string, x, y []byte) map[string]string {
+		return map[string]string{"kid": kid, "kty": "EC", "crv": "P-256", "x": enc(x), "y": enc(y)}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			ec("ok", x, y),
+			ec("long", append([]byte{0, 0}, x...), y), // 坐标比曲线长时不能越界
+			ec("short", x[1:], y),
+			ec("off-curve", x, offCurve),
+		}})
+	}))
+	defer srv.Close()
+
+	keys, err := fetchJWKS(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub, ok := keys["ok"].(*ecdsa.PublicKey); !ok || !pub.Equal(&key.PublicKey) {
+		t.Errorf("valid key = %v", keys["ok"])
+	}
+	for _, kid := range []string{"long", "short", "off-curve"} {
+		if keys[kid] != nil {
+			t.Errorf("%s key accepted", kid)
+		}
+	}
+}
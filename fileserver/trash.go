@@ -0,0 +1,266 @@
+package fileserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 回收站：读写模式下删除的文件和目录先移动到根目录下隐藏的 .trash 中，可以在 /trash 页面或
+// /api/trash 接口恢复到原来的位置或者彻底删除，误删不会立即丢失。超过保留时间（-trash-retention，默认 30 天）的
+// 在下一次删除或打开回收站时清理，和未完成的上传一样不需要后台任务。-trash=false 时直接删除
+
+const trashDir = ".trash"
+
+// defaultTrashRetention 是没有指定保留时间时回收站中的内容保留的时间
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+// trashItem 是回收站中的一项，保存在 .trash/<id>/info.json，删除的内容在 .trash/<id>/data
+type trashItem struct {
+	ID      string    `json:"id"`
+	Path    string    `json:"path"` // 删除前的路径
+	IsDir   bool      `json:"is_dir"`
+	Size    int64     `json:"size"` // 目录为其中所有文件的总大小
+	User    string    `json:"user,omitempty"`
+	Deleted time.Time `json:"deleted"`
+}
+
+var errTrashNotFound = errors.New("not in the trash")
+
+// trashPath 返回回收站中 id 的目录（本地路径）
+func (s *server) trashPath(id string) string {
+	return s.root + "/" + trashDir + "/" + id
+}
+
+// moveToTrash 把 p 移动到回收站，who 是删除的用户
+func (s *server) moveToTrash(p string, info os.FileInfo, who string) error {
+	s.purgeExpired()
+	b := make([]byte, 4)
+	rand.Read(b)
+	it := trashItem{ID: time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b), Path: p, IsDir: info.IsDir(), Size: info.Size(), User: who, Deleted: time.Now()}
+	if it.IsDir {
+		it.Size, _, _ = walkSize(s.fsys, p)
+	}
+	dir := s.trashPath(it.ID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	meta, err := json.Marshal(it)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(dir+"/info.json", meta, 0600); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	if err := os.Rename(s.root+p, dir+"/data"); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	return nil
+}
+
+// trashItems 返回回收站中的内容，最近删除的在前
+func (s *server) trashItems() []trashItem {
+	entries, _ := os.ReadDir(s.root + "/" + trashDir)
+	var items []trashItem
+	for _, e := range entries {
+		b, err := os.ReadFile(s.trashPath(e.Name()) + "/info.json")
+		if err != nil {
+			continue
+		}
+		var it trashItem
+		if json.Unmarshal(b, &it) == nil && it.ID == e.Name() {
+			items = append(items, it)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Deleted.After(items[j].Deleted) })
+	return items
+}
+
+// findTrash 返回回收站中的一项，id 必须是 trashItems 列出的，不能是任意路径
+func (s *server) findTrash(id string) (trashItem, error) {
+	items := s.trashItems()
+	i := slices.IndexFunc(items, func(it trashItem) bool { return it.ID == id })
+	if id == "" || i < 0 {
+		return trashItem{}, errTrashNotFound
+	}
+	return items[i], nil
+}
+
+// restore 把回收站中的一项恢复到原来的位置，原位置已经有同名文件时返回 errFileExists
+func (s *server) restore(it trashItem) error {
+	// 原位置的上级目录可能已经换成了指向根目录外面的链接
+	if err := s.checkSymlinks(path.Dir(it.Path)); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(s.root + it.Path); err == nil {
+		return errFileExists
+	}
+	if err := os.MkdirAll(path.Dir(s.root+it.Path), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(s.trashPath(it.ID)+"/data", s.root+it.Path); err != nil {
+		return err
+	}
+	return os.RemoveAll(s.trashPath(it.ID))
+}
+
+// purge 彻底删除回收站中的一项，回收站中的内容计入配额，删除后重新统计
+func (s *server) purge(it trashItem) error {
+	defer s.uploaded()
+	return os.RemoveAll(s.trashPath(it.ID))
+}
+
+// purgeExpired 彻底删除超过保留时间的内容
+func (s *server) purgeExpired() {
+	for _, it := range s.trashItems() {
+		if time.Since(it.Deleted) > s.trashTTL {
+			s.purge(it)
+		}
+	}
+}
+
+// TrashData 是 /trash 页面的数据
+type TrashData struct {
+	Page
+	Items     []TrashEntry
+	Retention int    // 保留天数
+	Done      string // 刚完成的操作的提示（翻译键）
+	Error     string
+}
+
+// TrashEntry 是回收站页面上的一项
+type TrashEntry struct {
+	ID      string
+	Path    string
+	IsDir   bool
+	Size    int64
+	User    string
+	Deleted string
+}
+
+// trashHandler 处理回收站页面 GET /trash 和 POST /trash/restore、/trash/purge，
+// 以及同样的 JSON 接口 GET /api/trash、POST /api/trash/restore、/api/trash/purge。
+// 只列出、只能操作当前用户对原路径有写权限的内容，id 为空时 purge 清空这些内容
+func (s *server) trashHandler(w http.ResponseWriter, r *http.Request) {
+	api := strings.HasPrefix(r.URL.Path, "/api/")
+	fail := func(status int, msg string) {
+		if api {
+			apiError(w, status, msg)
+		} else {
+			s.renderTrash(w, r, status, "", msg)
+		}
+	}
+	if s.trashTTL == 0 {
+		fail(http.StatusNotFound, "Trash is disabled")
+		return
+	}
+	s.purgeExpired()
+	u := currentUser(r)
+	action := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api"), "/trash")
+	if action == "" {
+		if api {
+			items := []trashItem{}
+			for _, it := range s.trashItems() {
+				if s.allowed(u, it.Path, permWrite) {
+					items = append(items, it)
+				}
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"items": items, "retention_days": int(s.trashTTL.Hours() / 24)})
+			return
+		}
+		var done string
+		if d := r.FormValue("done"); d == "restore" || d == "purge" {
+			done = "trash.done." + d
+		}
+		s.renderTrash(w, r, http.StatusOK, done, "")
+		return
+	}
+
+	var items []trashItem
+	id := r.FormValue("id")
+	switch action {
+	case "/restore":
+		it, err := s.findTrash(id)
+		if err != nil {
+			fail(http.StatusNotFound, "Not in the trash")
+			return
+		}
+		items = append(items, it)
+	case "/purge":
+		if id == "" {
+			items = s.trashItems()
+			break
+		}
+		it, err := s.findTrash(id)
+		if err != nil {
+			fail(http.StatusNotFound, "Not in the trash")
+			return
+		}
+		items = append(items, it)
+	default:
+		fail(http.StatusNotFound, "Not found")
+		return
+	}
+
+	done := []string{}
+	for _, it := range items {
+		if !s.allowed(u, it.Path, permWrite) {
+			if id == "" {
+				continue
+			}
+			fail(http.StatusForbidden, "Forbidden")
+			return
+		}
+		if action == "/restore" {
+			if _, locked := s.lockedDir(r, it.Path); locked {
+				fail(http.StatusForbidden, "Target directory is password protected")
+				return
+			}
+			if err := s.restore(it); err != nil {
+				if errors.Is(err, errFileExists) {
+					fail(http.StatusConflict, "A file with the same name already exists at "+it.Path)
+				} else {
+					fail(http.StatusInternalServerError, "Failed to restore "+it.Path)
+				}
+				return
+			}
+			s.auditHTTP(r, auditEntry{Action: auditRestore, Path: it.Path})
+		} else {
+			if err := s.purge(it); err != nil {
+				fail(http.StatusInternalServerError, "Failed to purge "+it.Path)
+				return
+			}
+			s.auditHTTP(r, auditEntry{Action: auditPurge, Path: it.Path})
+		}
+		done = append(done, it.Path)
+	}
+	if api {
+		writeJSON(w, http.StatusOK, map[string]any{strings.TrimPrefix(action, "/") + "d": done})
+		return
+	}
+	http.Redirect(w, r, s.base+"/trash?done="+strings.TrimPrefix(action, "/"), http.StatusSeeOther)
+}
+
+// renderTrash 渲染 /trash 页面
+func (s *server) renderTrash(w http.ResponseWriter, r *http.Request, status int, done, errMsg string) {
+	data := TrashData{Page: s.page(w, r), Retention: int(s.trashTTL.Hours() / 24), Done: done, Error: errMsg}
+	u := currentUser(r)
+	for _, it := range s.trashItems() {
+		if s.allowed(u, it.Path, permWrite) {
+			data.Items = append(data.Items, TrashEntry{ID: it.ID, Path: it.Path, IsDir: it.IsDir, Size: it.Size, User: it.User,
+				Deleted: it.Deleted.Format("2006-01-02 15:04:05")})
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	s.renderStatus(w, status, "trash.html", data)
+}
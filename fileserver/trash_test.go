@@ -0,0 +1,90 @@
+package fileserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrash(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root}, WithReadWrite())
+	post := func(target string, form url.Values) (*http.Response, string) {
+		t.Helper()
+		r := httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return do(t, h, r)
+	}
+	list := func() []trashItem {
+		t.Helper()
+		res, body := do(t, h, httptest.NewRequest("GET", "/api/trash", nil))
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("GET /api/trash: status = %d, body %s", res.StatusCode, body)
+		}
+		var data struct{ Items []trashItem }
+		json.Unmarshal([]byte(body), &data)
+		return data.Items
+	}
+
+	do(t, h, httptest.NewRequest("DELETE", "/api/files/a.txt", nil))
+	do(t, h, httptest.NewRequest("DELETE", "/api/files/sub?recursive=1", nil))
+	items := list()
+	if len(items) != 2 || items[0].Path != "/sub" || !items[0].IsDir || items[0].Size != 5 || items[1].Path != "/a.txt" {
+		t.Fatalf("trash = %+v", items)
+	}
+	// 回收站不能直接访问，也不出现在目录列表中
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/download/.trash/"+items[1].ID+"/data", nil)); res.StatusCode != http.StatusNotFound {
+		t.Errorf("trash download: status = %d, want 404", res.StatusCode)
+	}
+	if _, body := do(t, h, httptest.NewRequest("GET", "/", nil)); strings.Contains(body, ".trash") {
+		t.Error(".trash is listed")
+	}
+	if _, body := do(t, h, httptest.NewRequest("GET", "/trash", nil)); !strings.Contains(body, "/a.txt") {
+		t.Errorf("trash page:\n%s", body)
+	}
+
+	// 恢复到原来的位置，原位置被占用时返回 409
+	if res, _ := post("/api/trash/restore", url.Values{"id": {items[0].ID}}); res.StatusCode != http.StatusOK {
+		t.Fatalf("restore: status = %d", res.StatusCode)
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "sub", "b.txt")); string(b) != "world" {
+		t.Errorf("restored file = %q", b)
+	}
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("new"), 0644)
+	if res, _ := post("/api/trash/restore", url.Values{"id": {items[1].ID}}); res.StatusCode != http.StatusConflict {
+		t.Errorf("restore over an existing file: status = %d, want 409", res.StatusCode)
+	}
+	if res, _ := post("/api/trash/restore", url.Values{"id": {"../sub"}}); res.StatusCode != http.StatusNotFound {
+		t.Errorf("restore of an unknown id: status = %d, want 404", res.StatusCode)
+	}
+
+	// 页面上的表单彻底删除后跳回回收站
+	res, _ := post("/trash/purge", url.Values{"id": {items[1].ID}})
+	if res.StatusCode != http.StatusSeeOther || len(list()) != 0 {
+		t.Errorf("purge: status = %d, trash = %+v", res.StatusCode, list())
+	}
+
+	// 超过保留时间的自动清理
+	h.s.trashTTL = time.Millisecond
+	do(t, h, httptest.NewRequest("DELETE", "/api/files/a.txt", nil))
+	time.Sleep(5 * time.Millisecond)
+	if items := list(); len(items) != 0 {
+		t.Errorf("expired items = %+v", items)
+	}
+
+	// 关闭回收站时直接删除
+	off := newTestHandler(t, Config{Root: root, DisableTrash: true}, WithReadWrite())
+	do(t, off, httptest.NewRequest("DELETE", "/api/files/sub?recursive=1", nil))
+	if entries, _ := os.ReadDir(filepath.Join(root, trashDir)); len(entries) != 0 {
+		t.Errorf("trash with -trash=false: %v", entries)
+	}
+	if res, _ := do(t, off, httptest.NewRequest("GET", "/api/trash", nil)); res.StatusCode != http.StatusNotFound {
+		t.Errorf("trash api with -trash=false: status = %d, want 404", res.StatusCode)
+	}
+}
@@ -0,0 +1,251 @@
+package fileserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"path"
+	"strings"
+)
+
+// JSON、XML 格式化预览：在线查看 .json、.xml 时按结构缩进显示，对象、数组、元素都可以折叠展开，
+// 折叠后显示其中有几项，页面上有全部展开、全部折叠的按钮，?raw=1 是原文。键和元素的顺序与原文一致。
+// 配色使用源码高亮的 class，跟着主题切换。解析失败（格式有误）时按源码高亮显示，超过 maxTreeSize 时直接输出原文
+
+// 格式化显示的文件大小和嵌套层数上限
+const (
+	maxTreeSize  = 4 << 20
+	maxTreeDepth = 200
+)
+
+var errTreeDepth = errors.New("nested too deeply")
+
+// renderTree 把 JSON 或 XML 渲染成可以折叠的树，格式有误时按源码高亮显示
+func renderTree(name string, src []byte) (template.HTML, error) {
+	var buf bytes.Buffer
+	var err error
+	if strings.EqualFold(path.Ext(name), ".xml") {
+		err = xmlTree(&buf, src)
+	} else {
+		err = jsonTree(&buf, src)
+	}
+	if err != nil {
+		return highlight(name, src)
+	}
+	return template.HTML(buf.String()), nil
+}
+
+// jsonNode 是 JSON 中的一个值，对象的键按原文的顺序保存
+type jsonNode struct {
+	key      string     // 在对象中的键，数组元素和顶层为空
+	token    json.Token // 字符串、数字、布尔值、null，或者对象、数组的开头 { [
+	children []*jsonNode
+}
+
+// jsonTree 逐个读取 JSON 的记号输出树，不解码到 map 中，键的顺序不变
+func jsonTree(w *bytes.Buffer, src []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(src))
+	dec.UseNumber()
+	n, err := readJSON(dec, 0)
+	if err != nil {
+		return err
+	}
+	// 后面还有内容的不是合法的 JSON
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after top-level value")
+	}
+	writeJSONNode(w, n, "")
+	return nil
+}
+
+// readJSON 读取一个值
+func readJSON(dec *json.Decoder, depth int) (*jsonNode, error) {
+	if depth > maxTreeDepth {
+		return nil, errTreeDepth
+	}
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	n := &jsonNode{token: tok}
+	d, ok := tok.(json.Delim)
+	if !ok {
+		return n, nil
+	}
+	for dec.More() {
+		var key string
+		if d == '{' {
+			k, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key = jsonString(k.(string))
+		}
+		c, err := readJSON(dec, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		c.key = key
+		n.children = append(n.children, c)
+	}
+	// 结尾的 } 或 ]
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// writeJSONNode 输出一个值，comma 是后面的逗号
+func writeJSONNode(w *bytes.Buffer, n *jsonNode, comma string) {
+	head := ""
+	if n.key != "" {
+		head = `<span class="nt">` + template.HTMLEscapeString(n.key) + `</span>: `
+	}
+	d, ok := n.token.(json.Delim)
+	if !ok {
+		w.WriteString(`<div class="tree-leaf">` + head + jsonScalar(n.token) + comma + `</div>`)
+		return
+	}
+	end := "}"
+	if d == '[' {
+		end = "]"
+	}
+	var children bytes.Buffer
+	for i, c := range n.children {
+		sep := ","
+		if i == len(n.children)-1 {
+			sep = ""
+		}
+		writeJSONNode(&children, c, sep)
+	}
+	writeBranch(w, head+d.String(), len(n.children), children.Bytes(), end+comma)
+}
+
+// jsonScalar 返回字符串、数字、布尔值、null 的 HTML
+func jsonScalar(tok json.Token) string {
+	switch v := tok.(type) {
+	case string:
+		return `<span class="s">` + template.HTMLEscapeString(jsonString(v)) + `</span>`
+	case json.Number:
+		return `<span class="m">` + v.String() + `</span>`
+	case bool:
+		return fmt.Sprintf(`<span class="kc">%t</span>`, v)
+	}
+	return `<span class="kc">null</span>`
+}
+
+// jsonString 把字符串编码成 JSON，不转义 <、>、&
+func jsonString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// writeBranch 输出可以折叠的一项：head、tail 是开头和结尾的 HTML，children 是其中 n 项的 HTML
+func writeBranch(w *bytes.Buffer, head string, n int, children []byte, tail string) {
+	if n == 0 {
+		w.WriteString(`<div class="tree-leaf">` + head + tail + `</div>`)
+		return
+	}
+	fmt.Fprintf(w, `<details open><summary>%s<span class="tree-count">%d</span></summary><div class="tree-children">`, head, n)
+	w.Write(children)
+	w.WriteString(`</div><div class="tree-leaf">` + tail + `</div></details>`)
+}
+
+// xmlNode 是 XML 中的一个元素，或者文字、注释等（raw 不为空）
+type xmlNode struct {
+	start    xml.StartElement
+	children []*xmlNode
+	raw      string // 不是元素时已转义的 HTML
+}
+
+// xmlTree 解析 XML 并输出树，不展开命名空间，元素名保留原来的前缀
+func xmlTree(w *bytes.Buffer, src []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(src))
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		top := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if len(stack) > maxTreeDepth {
+				return errTreeDepth
+			}
+			n := &xmlNode{start: t.Copy()}
+			top.children = append(top.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) == 1 || top.start.Name != t.Name {
+				return fmt.Errorf("unexpected end element </%s>", xmlName(t.Name))
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			s := strings.TrimSpace(string(t))
+			if s == "" {
+				continue
+			}
+			top.children = append(top.children, &xmlNode{raw: `<span class="s">` + template.HTMLEscapeString(s) + `</span>`})
+		case xml.Comment:
+			top.children = append(top.children, &xmlNode{raw: `<span class="c1">` + template.HTMLEscapeString("<!--"+string(t)+"-->") + `</span>`})
+		case xml.ProcInst:
+			top.children = append(top.children, &xmlNode{raw: template.HTMLEscapeString("<?" + t.Target + " " + string(t.Inst) + "?>")})
+		case xml.Directive:
+			top.children = append(top.children, &xmlNode{raw: template.HTMLEscapeString("<!" + string(t) + ">")})
+		}
+	}
+	if len(stack) != 1 {
+		return errors.New("unclosed element")
+	}
+	for _, n := range root.children {
+		writeXMLNode(w, n)
+	}
+	return nil
+}
+
+func xmlName(n xml.Name) string {
+	if n.Space != "" {
+		return n.Space + ":" + n.Local
+	}
+	return n.Local
+}
+
+// writeXMLNode 输出一个元素，只有一段文字的元素写在一行中
+func writeXMLNode(w *bytes.Buffer, n *xmlNode) {
+	if n.raw != "" {
+		w.WriteString(`<div class="tree-leaf">` + n.raw + `</div>`)
+		return
+	}
+	var head strings.Builder
+	head.WriteString(`&lt;<span class="nt">` + template.HTMLEscapeString(xmlName(n.start.Name)) + `</span>`)
+	for _, a := range n.start.Attr {
+		fmt.Fprintf(&head, ` <span class="na">%s</span>=<span class="s">&#34;%s&#34;</span>`,
+			template.HTMLEscapeString(xmlName(a.Name)), template.HTMLEscapeString(a.Value))
+	}
+	end := `&lt;/<span class="nt">` + template.HTMLEscapeString(xmlName(n.start.Name)) + `</span>&gt;`
+	if len(n.children) == 0 {
+		w.WriteString(`<div class="tree-leaf">` + head.String() + `/&gt;</div>`)
+		return
+	}
+	if len(n.children) == 1 && n.children[0].start.Name.Local == "" {
+		w.WriteString(`<div class="tree-leaf">` + head.String() + `&gt;` + n.children[0].raw + end + `</div>`)
+		return
+	}
+	var children bytes.Buffer
+	for _, c := range n.children {
+		writeXMLNode(&children, c)
+	}
+	writeBranch(w, head.String()+"&gt;", len(n.children), children.Bytes(), end)
+}
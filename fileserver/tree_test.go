@@ -0,0 +1,51 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTreePreview(t *testing.T) {
+	root := newTestRoot(t)
+	os.WriteFile(filepath.Join(root, "api.json"), []byte(`{"zeta":1,"alpha":{"list":[true,null,"<b>"]},"empty":{}}`), 0644)
+	os.WriteFile(filepath.Join(root, "feed.xml"), []byte(`<?xml version="1.0"?><rss xmlns:dc="x"><!-- c --><item id="1"><dc:title>A &amp; B</dc:title><br/></item></rss>`), 0644)
+	os.WriteFile(filepath.Join(root, "bad.json"), []byte(`{"a":`), 0644)
+	h := newTestHandler(t, Config{Root: root})
+
+	res, body := do(t, h, httptest.NewRequest("GET", "/view/api.json", nil))
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, "<details open>") || !strings.Contains(body, `class="tree-toggle"`) {
+		t.Fatalf("json: got %d %s", res.StatusCode, body)
+	}
+	// 键的顺序不变，逗号只在不是最后一项时出现，内容被转义
+	if z, a := strings.Index(body, `&#34;zeta&#34;`), strings.Index(body, `&#34;alpha&#34;`); z < 0 || a < z {
+		t.Errorf("key order was not kept: %s", body)
+	}
+	for _, want := range []string{`<span class="m">1</span>,</div>`, `<span class="kc">null</span>,</div>`, `&#34;&lt;b&gt;&#34;</span></div>`, `&#34;empty&#34;</span>: {}</div>`, `<span class="tree-count">3</span>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("json: missing %s", want)
+		}
+	}
+	if strings.Contains(body, "<b>") {
+		t.Error("json: string was not escaped")
+	}
+
+	_, body = do(t, h, httptest.NewRequest("GET", "/view/feed.xml", nil))
+	for _, want := range []string{`<span class="nt">dc:title</span>&gt;<span class="s">A &amp; B</span>&lt;/`, `<span class="na">id</span>=<span class="s">&#34;1&#34;</span>`, `<span class="nt">br</span>/&gt;`, `&lt;!-- c --&gt;`, `&lt;?xml version=&#34;1.0&#34;?&gt;`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("xml: missing %s in %s", want, body)
+		}
+	}
+
+	// 格式有误时按源码显示
+	if res, body := do(t, h, httptest.NewRequest("GET", "/view/bad.json", nil)); res.StatusCode != http.StatusOK || strings.Contains(body, "<details") || !strings.Contains(body, "chroma") {
+		t.Errorf("bad json: got %d %s", res.StatusCode, body)
+	}
+
+	if _, body := do(t, h, httptest.NewRequest("GET", "/view/api.json?raw=1", nil)); !strings.HasPrefix(body, `{"zeta"`) {
+		t.Errorf("raw: %q", body)
+	}
+}
@@ -0,0 +1,257 @@
+package fileserver
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 用户库（-users users.json）：保存在一个 JSON 文件中的用户，每个用户有一个角色和一个根目录，
+// 比如给每个家庭成员一个自己的文件夹。用户用 users 子命令或管理页面添加、修改、删除，
+// 直接修改文件后最多一秒生效，不用重启服务
+
+// 用户的角色，为空时不限制（配置文件 users 中的用户默认如此），权限仍然由访问控制规则决定
+const (
+	RoleAdmin    = "admin"    // 可以读写，并且可以打开 /admin 和 /stats
+	RoleUploader = "uploader" // 可以读写
+	RoleViewer   = "viewer"   // 只能浏览和下载
+)
+
+// Roles 是所有角色
+var Roles = []string{RoleAdmin, RoleUploader, RoleViewer}
+
+// validate 检查角色和根目录，并把根目录规范成以 / 开头的形式
+func (u *User) validate() error {
+	if u.Name == "" {
+		return errors.New("user name is required")
+	}
+	if strings.ContainsAny(u.Name, ":\r\n") {
+		// Basic Auth 用冒号分隔用户名和密码
+		return fmt.Errorf("user %s: name must not contain ':' or line breaks", u.Name)
+	}
+	if u.Role != "" && !slices.Contains(Roles, u.Role) {
+		return fmt.Errorf("user %s: unknown role %q, want one of %s", u.Name, u.Role, strings.Join(Roles, ", "))
+	}
+	if u.Root != "" {
+		u.Root = path.Clean("/" + filepath.ToSlash(u.Root))
+	}
+	return nil
+}
+
+// HashPassword 返回保存到用户库中的密码摘要（bcrypt）
+func HashPassword(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// ReadUsersFile 读取用户库，文件不存在时返回空列表
+func ReadUsersFile(file string) ([]User, error) {
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var users []User
+	if err := json.Unmarshal(b, &users); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	for i := range users {
+		if err := users[i].validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return users, nil
+}
+
+// WriteUsersFile 保存用户库，先写临时文件再改名，写到一半时服务不会读到不完整的文件
+func WriteUsersFile(file string, users []User) error {
+	for i := range users {
+		if err := users[i].validate(); err != nil {
+			return err
+		}
+	}
+	if users == nil {
+		users = []User{}
+	}
+	b, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	// 文件中有密码摘要，只有自己可以读
+	if err := os.WriteFile(tmp, append(b, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// usersCheckInterval 是检查用户库文件是否被修改的最短间隔
+var usersCheckInterval = time.Second
+
+// userStore 是 -users 指定的用户库
+type userStore struct {
+	file string
+
+	mu      sync.Mutex
+	users   []User
+	modTime time.Time // 上次读取时文件的修改时间
+	checked time.Time // 上次检查文件的时间
+
+	// 浏览器每个请求都会带上 Basic Auth，bcrypt 很慢，验证成功的用户名和密码缓存一会儿。
+	// 键是用户名和密码的摘要，值是过期时间，重新读取用户库时清空
+	verified map[[32]byte]time.Time
+}
+
+const usersCacheTTL = 5 * time.Minute
+
+func openUserStore(file string) (*userStore, error) {
+	st := &userStore{file: file}
+	if err := st.load(); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// load 重新读取文件，调用时持有 mu 或者还没有开始使用
+func (st *userStore) load() error {
+	var modTime time.Time
+	if info, err := os.Stat(st.file); err == nil {
+		modTime = info.ModTime()
+	}
+	users, err := ReadUsersFile(st.file)
+	if err != nil {
+		return err
+	}
+	st.users, st.modTime, st.checked = users, modTime, time.Now()
+	st.verified = make(map[[32]byte]time.Time)
+	return nil
+}
+
+// refresh 文件在其他地方（users 子命令、手工编辑）修改过时重新读取，读取失败时保留原来的用户
+func (st *userStore) refresh() {
+	if time.Since(st.checked) < usersCheckInterval {
+		return
+	}
+	st.checked = time.Now()
+	var modTime time.Time
+	if info, err := os.Stat(st.file); err == nil {
+		modTime = info.ModTime()
+	}
+	if modTime.Equal(st.modTime) {
+		return
+	}
+	if err := st.load(); err != nil {
+		log.Printf("Failed to reload users: %v", err)
+	}
+}
+
+func (st *userStore) authenticate(name, password string) (*user, error) {
+	key := sha256.Sum256([]byte(name + "\x00" + password))
+	st.mu.Lock()
+	st.refresh()
+	i := slices.IndexFunc(st.users, func(u User) bool { return u.Name == name })
+	var u User
+	if i >= 0 {
+		u = st.users[i]
+	}
+	expires, cached := st.verified[key]
+	st.mu.Unlock()
+	if i < 0 {
+		return nil, nil
+	}
+	if !cached || time.Now().After(expires) {
+		if !checkPassword(u.Password, password) {
+			return nil, nil
+		}
+		st.mu.Lock()
+		for k, e := range st.verified {
+			if time.Now().After(e) {
+				delete(st.verified, k)
+			}
+		}
+		// 验证期间用户库可能重新读取过，密码摘要没变时才缓存，改过的密码不能因此继续有效
+		if j := slices.IndexFunc(st.users, func(u User) bool { return u.Name == name }); j >= 0 && st.users[j].Password == u.Password {
+			st.verified[key] = time.Now().Add(usersCacheTTL)
+		}
+		st.mu.Unlock()
+	}
+	return u.session(), nil
+}
+
+// list 返回所有用户，按用户名排序
+func (st *userStore) list() []User {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.refresh()
+	users := slices.Clone(st.users)
+	slices.SortFunc(users, func(a, b User) int { return strings.Compare(a.Name, b.Name) })
+	return users
+}
+
+// put 添加或修改一个用户并保存，password 为空时修改用户保留原来的密码
+func (st *userStore) put(u User, password string) error {
+	if err := u.validate(); err != nil {
+		return err
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.refresh()
+	users := slices.Clone(st.users)
+	i := slices.IndexFunc(users, func(old User) bool { return old.Name == u.Name })
+	switch {
+	case password != "":
+		hash, err := HashPassword(password)
+		if err != nil {
+			return err
+		}
+		u.Password = hash
+	case i >= 0:
+		u.Password = users[i].Password
+	default:
+		return fmt.Errorf("user %s: password is required", u.Name)
+	}
+	if i >= 0 {
+		if u.Groups == nil {
+			u.Groups = users[i].Groups
+		}
+		users[i] = u
+	} else {
+		users = append(users, u)
+	}
+	return st.save(users)
+}
+
+// remove 删除一个用户并保存
+func (st *userStore) remove(name string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.refresh()
+	i := slices.IndexFunc(st.users, func(u User) bool { return u.Name == name })
+	if i < 0 {
+		return fmt.Errorf("no such user: %s", name)
+	}
+	return st.save(slices.Delete(slices.Clone(st.users), i, i+1))
+}
+
+func (st *userStore) save(users []User) error {
+	if err := WriteUsersFile(st.file, users); err != nil {
+		return err
+	}
+	return st.load()
+}
@@ -0,0 +1,174 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUserStoreRoles(t *testing.T) {
+	root := newTestRoot(t)
+	os.MkdirAll(filepath.Join(root, "home", "alice"), 0755)
+	os.MkdirAll(filepath.Join(root, "home", "bob"), 0755)
+	os.WriteFile(filepath.Join(root, "home", "alice", "notes.txt"), []byte("alice"), 0644)
+	os.WriteFile(filepath.Join(root, "home", "bob", "secret.txt"), []byte("bob"), 0644)
+	file := filepath.Join(t.TempDir(), "users.json")
+	hash, err := HashPassword("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = WriteUsersFile(file, []User{
+		{Name: "alice", Password: hash, Role: RoleUploader, Root: "home/alice/"},
+		{Name: "viewer", Password: "pw", Role: RoleViewer},
+		{Name: "carol", Password: "pw", Role: RoleAdmin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newTestHandler(t, Config{Root: root, Mode: ModeReadWrite, UsersFile: file})
+	send := func(name, method, target string) (*http.Response, string) {
+		t.Helper()
+		r := httptest.NewRequest(method, target, strings.NewReader("data"))
+		r.SetBasicAuth(name, "pw")
+		return do(t, h, r)
+	}
+
+	// 根目录的上级目录只能浏览，只看得到通往根目录的子目录
+	res, body := send("alice", "GET", "/")
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, "home") || strings.Contains(body, "a.txt") {
+		t.Errorf("alice listing /: status = %d\n%s", res.StatusCode, body)
+	}
+	if _, body := send("alice", "GET", "/home/"); strings.Contains(body, "bob") {
+		t.Error("alice sees bob's folder")
+	}
+	for _, target := range []string{"/download/a.txt", "/download/home/bob/secret.txt", "/download/home/alice2"} {
+		if res, _ := send("alice", "GET", target); res.StatusCode != http.StatusForbidden {
+			t.Errorf("alice GET %s: status = %d, want 403", target, res.StatusCode)
+		}
+	}
+	if res, _ := send("alice", "GET", "/download/home/alice/notes.txt"); res.StatusCode != http.StatusOK {
+		t.Errorf("alice downloading her file: status = %d", res.StatusCode)
+	}
+	if res, _ := send("alice", "PUT", "/api/files/home/alice/new.txt"); res.StatusCode != http.StatusCreated {
+		t.Errorf("alice uploading to her folder: status = %d", res.StatusCode)
+	}
+	if res, _ := send("alice", "PUT", "/api/files/home/new.txt"); res.StatusCode != http.StatusForbidden {
+		t.Errorf("alice uploading to the parent folder: status = %d, want 403", res.StatusCode)
+	}
+	r := httptest.NewRequest("POST", "/api/share", strings.NewReader("path=/home"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("alice", "pw")
+	if res, _ := do(t, h, r); res.StatusCode != http.StatusForbidden {
+		t.Errorf("alice sharing the parent folder: status = %d, want 403", res.StatusCode)
+	}
+
+	// viewer 只能读
+	if res, _ := send("viewer", "GET", "/download/home/bob/secret.txt"); res.StatusCode != http.StatusOK {
+		t.Errorf("viewer download: status = %d", res.StatusCode)
+	}
+	if res, _ := send("viewer", "PUT", "/api/files/v.txt"); res.StatusCode != http.StatusForbidden {
+		t.Errorf("viewer upload: status = %d, want 403", res.StatusCode)
+	}
+
+	// 角色为 admin 的用户可以打开管理页面
+	if res, _ := send("carol", "GET", "/admin"); res.StatusCode != http.StatusOK {
+		t.Errorf("admin role: status = %d", res.StatusCode)
+	}
+	if res, _ := send("alice", "GET", "/admin"); res.StatusCode != http.StatusForbidden {
+		t.Errorf("uploader on /admin: status = %d, want 403", res.StatusCode)
+	}
+}
+
+func TestUserStoreAdmin(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "users.json")
+	WriteUsersFile(file, []User{{Name: "carol", Password: "pw", Role: RoleAdmin}})
+	h := newTestHandler(t, Config{Root: newTestRoot(t), UsersFile: file})
+	post := func(target string, form url.Values) *http.Response {
+		t.Helper()
+		r := httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("carol", "pw")
+		res, _ := do(t, h, r)
+		return res
+	}
+	login := func(name, password string) int {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.SetBasicAuth(name, password)
+		res, _ := do(t, h, r)
+		return res.StatusCode
+	}
+
+	if res := post("/admin/user", url.Values{"name": {"dave"}, "role": {"viewer"}, "root": {"/sub"}}); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("new user without password: status = %d, want 400", res.StatusCode)
+	}
+	if res := post("/admin/user", url.Values{"name": {"dave"}, "role": {"owner"}, "password": {"secret"}}); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown role: status = %d, want 400", res.StatusCode)
+	}
+	if res := post("/admin/user", url.Values{"name": {"dave"}, "role": {"viewer"}, "root": {"/sub"}, "password": {"secret"}}); res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("add user: status = %d", res.StatusCode)
+	}
+	if got := login("dave", "secret"); got != http.StatusOK {
+		t.Errorf("new user login: status = %d", got)
+	}
+	users, err := ReadUsersFile(file)
+	if err != nil || len(users) != 2 || users[1].Root != "/sub" || !strings.HasPrefix(users[1].Password, "$2") {
+		t.Fatalf("users file = %+v, %v", users, err)
+	}
+	// 不填密码时保留原来的密码
+	post("/admin/user", url.Values{"name": {"dave"}, "role": {"uploader"}, "root": {"/"}})
+	if got := login("dave", "secret"); got != http.StatusOK {
+		t.Errorf("login after changing role: status = %d", got)
+	}
+	if u := h.s.users.list()[1]; u.Role != RoleUploader || u.Root != "/" {
+		t.Errorf("changed user = %+v", u)
+	}
+	post("/admin/deluser", url.Values{"name": {"dave"}})
+	if got := login("dave", "secret"); got != http.StatusUnauthorized {
+		t.Errorf("removed user login: status = %d, want 401", got)
+	}
+
+	// 在其他地方修改文件后自动重新读取
+	usersCheckInterval = 0
+	t.Cleanup(func() { usersCheckInterval = time.Second })
+	WriteUsersFile(file, []User{{Name: "carol", Password: "pw", Role: RoleAdmin}, {Name: "erin", Password: "pw2"}})
+	os.Chtimes(file, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if got := login("erin", "pw2"); got != http.StatusOK {
+		t.Errorf("user added to the file: status = %d", got)
+	}
+}
+
+func TestUserStoreCache(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "users.json")
+	hash, _ := HashPassword("pw")
+	WriteUsersFile(file, []User{{Name: "alice", Password: hash, Role: RoleViewer}})
+	st, err := openUserStore(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := st.authenticate("alice", "wrong"); u != nil || len(st.verified) != 0 {
+		t.Fatalf("wrong password: user = %v, cached = %d", u, len(st.verified))
+	}
+	for range 2 {
+		if u, _ := st.authenticate("alice", "pw"); u == nil || u.Role != RoleViewer {
+			t.Fatalf("authenticate = %+v", u)
+		}
+	}
+	if len(st.verified) != 1 {
+		t.Errorf("cached = %d, want 1", len(st.verified))
+	}
+	// 修改用户后缓存清空，旧密码立即失效，新的角色立即生效
+	if err := st.put(User{Name: "alice", Role: RoleUploader}, "new"); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := st.authenticate("alice", "pw"); u != nil {
+		t.Error("old password still accepted")
+	}
+	if u, _ := st.authenticate("alice", "new"); u == nil || u.Role != RoleUploader {
+		t.Errorf("new password: %+v", u)
+	}
+}
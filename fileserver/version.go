@@ -0,0 +1,77 @@
+package fileserver
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// 版本信息：GET /api/version 返回程序的版本、提交、编译时间和 Go 版本，用来分辨多份程序中哪一份是最新的。
+// 编译时用 -ldflags 写入的值优先，没有写入的字段从 Go 记录在程序中的构建信息（模块版本、vcs.revision、vcs.time）读取
+
+// VersionInfo 是程序的版本信息
+type VersionInfo struct {
+	Version  string `json:"version"`
+	Commit   string `json:"commit,omitempty"`
+	Date     string `json:"date,omitempty"` // 编译时间，没有写入时为提交时间
+	Go       string `json:"go"`
+	Platform string `json:"platform"` // 操作系统/架构，如 linux/amd64
+}
+
+// WithBuildInfo 用构建信息补全 v 中为空的字段
+func (v VersionInfo) WithBuildInfo() VersionInfo {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v.Version == "" && info.Main.Version != "" {
+			v.Version = info.Main.Version
+		}
+		var revision, modified string
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				revision = s.Value
+			case "vcs.time":
+				if v.Date == "" {
+					v.Date = s.Value
+				}
+			case "vcs.modified":
+				modified = s.Value
+			}
+		}
+		// 工作区有未提交的修改时，提交号后面加上 -dirty
+		if v.Commit == "" && revision != "" {
+			v.Commit = revision
+			if modified == "true" {
+				v.Commit += "-dirty"
+			}
+		}
+	}
+	if v.Version == "" {
+		v.Version = "(devel)"
+	}
+	v.Go = runtime.Version()
+	v.Platform = runtime.GOOS + "/" + runtime.GOARCH
+	return v
+}
+
+// String 返回一行适合打印的版本信息
+func (v VersionInfo) String() string {
+	s := v.Version
+	var extra []string
+	if v.Commit != "" {
+		extra = append(extra, v.Commit)
+	}
+	if v.Date != "" {
+		extra = append(extra, v.Date)
+	}
+	if len(extra) > 0 {
+		s += " (" + strings.Join(extra, ", ") + ")"
+	}
+	return fmt.Sprintf("%s %s %s", s, v.Go, v.Platform)
+}
+
+// versionHandler 处理 GET /api/version
+func (s *server) versionHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.version)
+}
@@ -0,0 +1,37 @@
+package fileserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestVersionAPI(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t), Version: VersionInfo{Version: "1.4.0", Commit: "abc123", Date: "2026-10-14T00:00:00Z"}})
+	res, body := do(t, h, httptest.NewRequest(http.MethodGet, "/api/version", nil))
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", res.StatusCode)
+	}
+	var v VersionInfo
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		t.Fatal(err)
+	}
+	want := VersionInfo{Version: "1.4.0", Commit: "abc123", Date: "2026-10-14T00:00:00Z", Go: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	if v != want {
+		t.Errorf("version = %+v, want %+v", v, want)
+	}
+	if s := v.String(); s != "1.4.0 (abc123, 2026-10-14T00:00:00Z) "+want.Go+" "+want.Platform {
+		t.Errorf("String() = %q", s)
+	}
+
+	// 没有写入版本时也有 Go 版本等信息
+	h = newTestHandler(t, Config{Root: newTestRoot(t)})
+	_, body = do(t, h, httptest.NewRequest(http.MethodGet, "/api/version", nil))
+	v = VersionInfo{}
+	json.Unmarshal([]byte(body), &v)
+	if v.Version == "" || v.Go != runtime.Version() {
+		t.Errorf("default version = %+v", v)
+	}
+}
@@ -0,0 +1,218 @@
+package fileserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 历史版本（-versions N）：上传、在线编辑、FTP、SFTP 覆盖已有的文件时，旧的内容保存到根目录下隐藏的 .versions 中，
+// 每个文件保留最近的 N 个版本。目录列表中有旧版本的文件旁边有“历史”链接，打开 /history/<路径> 可以下载或恢复旧版本，
+// 恢复时当前的内容同样保存为一个版本。版本按路径保存，文件移动或删除后旧版本不跟着走
+
+const versionsDir = ".versions"
+
+// fileVersion 是一个文件的一个旧版本，ID 是被覆盖时的时间（UnixNano）
+type fileVersion struct {
+	ID      string
+	Size    int64
+	ModTime time.Time // 这个版本的修改时间
+}
+
+// versionPath 返回保存文件 p 的旧版本的目录（本地路径），用路径的摘要命名，不用在 .versions 中重建目录结构
+func (s *server) versionPath(p string) string {
+	sum := sha256.Sum256([]byte(foldPath(p)))
+	return s.root + "/" + versionsDir + "/" + hex.EncodeToString(sum[:12])
+}
+
+// replaceFile 用写好的临时文件 tmp 替换根目录下的 p。启用了病毒扫描时先扫描，启用了去重时换成相同内容的对象，
+// 启用了历史版本时先保存原来的文件
+func (s *server) replaceFile(tmp, p string) error {
+	if s.scanner != nil {
+		if err := s.scanUpload(tmp, p); err != nil {
+			return err
+		}
+	}
+	if s.dedupe {
+		s.dedupeFile(tmp)
+	}
+	s.keepVersion(p)
+	return os.Rename(tmp, s.root+p)
+}
+
+// keepVersion 把 p 当前的内容保存为一个版本，然后删除超出个数的旧版本。所有写入都是写临时文件再改名，
+// 原来的文件不会再被修改，所以用硬链接保存，不支持硬链接时复制一份
+func (s *server) keepVersion(p string) {
+	if s.versions <= 0 {
+		return
+	}
+	info, err := os.Lstat(s.root + p)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	dir := s.versionPath(p)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Printf("Failed to keep a version of %s: %v", p, err)
+		return
+	}
+	// 记下原来的路径，方便手工查找
+	os.WriteFile(dir+"/path", []byte(p+"\n"), 0600)
+	name := dir + "/" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := os.Link(s.root+p, name); err != nil {
+		if err := copyFile(s.root+p, name); err != nil {
+			log.Printf("Failed to keep a version of %s: %v", p, err)
+			return
+		}
+	}
+	versions := s.fileVersions(p)
+	for _, v := range versions[min(len(versions), s.versions):] {
+		os.Remove(dir + "/" + v.ID)
+	}
+}
+
+// copyFile 把 src 复制到 dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// fileVersions 返回 p 的旧版本，最近的在前
+func (s *server) fileVersions(p string) []fileVersion {
+	entries, _ := os.ReadDir(s.versionPath(p))
+	var versions []fileVersion
+	for _, e := range entries {
+		if _, err := strconv.ParseInt(e.Name(), 10, 64); err != nil || !e.Type().IsRegular() {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			versions = append(versions, fileVersion{ID: e.Name(), Size: info.Size(), ModTime: info.ModTime()})
+		}
+	}
+	// ID 的位数相同，按字符串比较就是按时间
+	sort.Slice(versions, func(i, j int) bool { return versions[i].ID > versions[j].ID })
+	return versions
+}
+
+// hasVersions 判断 p 是否有旧版本，目录列表用来决定是否显示“历史”链接
+func (s *server) hasVersions(p string) bool {
+	if s.versions <= 0 {
+		return false
+	}
+	_, err := os.Stat(s.versionPath(p))
+	return err == nil
+}
+
+// HistoryData 是 /history 页面的数据
+type HistoryData struct {
+	Page
+	Name     string
+	Path     string
+	Parent   string // 所在目录的浏览地址
+	Download string // 当前版本的下载地址
+	Size     int64
+	ModTime  string
+	Versions []HistoryVersion
+	Writable bool // 可以恢复旧版本
+	Restored bool // 刚恢复了一个旧版本
+}
+
+// HistoryVersion 是页面上的一个旧版本
+type HistoryVersion struct {
+	ID      string
+	Size    int64
+	ModTime string
+}
+
+// historyHandler 处理 GET /history/<路径>（列出旧版本，?v=<ID> 下载某个版本）和 POST /history/<路径>（v=<ID> 恢复）。
+// 访问控制在 authorize 中已经按路径检查过，恢复需要写权限
+func (s *server) historyHandler(w http.ResponseWriter, r *http.Request) {
+	p := cleanPath(strings.TrimPrefix(r.URL.Path, "/history"))
+	if s.versions <= 0 {
+		s.httpError(w, r, http.StatusNotFound, "File history is disabled, start the server with -versions")
+		return
+	}
+	info, err := os.Stat(s.root + p)
+	if isHidden(p) || (err != nil && !s.hasVersions(p)) || (err == nil && !info.Mode().IsRegular()) {
+		s.httpError(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+	var version *fileVersion
+	if id := r.FormValue("v"); id != "" {
+		for _, v := range s.fileVersions(p) {
+			if v.ID == id {
+				version = &v
+				break
+			}
+		}
+		if version == nil {
+			s.httpError(w, r, http.StatusNotFound, "Version not found")
+			return
+		}
+	}
+
+	name := path.Base(p)
+	switch {
+	case r.Method == http.MethodPost:
+		if version == nil {
+			s.httpError(w, r, http.StatusBadRequest, "Missing version")
+			return
+		}
+		f, err := os.Open(s.versionPath(p) + "/" + version.ID)
+		if err != nil {
+			s.httpError(w, r, http.StatusNotFound, "Version not found")
+			return
+		}
+		err = s.saveFile(p, f, true)
+		f.Close()
+		if err != nil {
+			log.Printf("Failed to restore %s to version %s: %v", p, version.ID, err)
+			s.httpError(w, r, http.StatusInternalServerError, "Failed to restore the version")
+			return
+		}
+		s.auditHTTP(r, auditEntry{Action: auditRestore, Path: p, Detail: "version " + version.ModTime.Format(time.RFC3339)})
+		http.Redirect(w, r, s.base+"/history"+(&url.URL{Path: p}).EscapedPath()+"?restored=1", http.StatusSeeOther)
+	case version != nil:
+		f, err := os.Open(s.versionPath(p) + "/" + version.ID)
+		if err != nil {
+			s.httpError(w, r, http.StatusNotFound, "Version not found")
+			return
+		}
+		defer f.Close()
+		w.Header().Set("Content-Disposition", contentDisposition("attachment", name))
+		http.ServeContent(w, r, name, version.ModTime, f)
+	default:
+		data := HistoryData{Page: s.page(w, r), Name: name, Path: p, Parent: s.base + parentDir(p),
+			Writable: !s.readOnly() && s.allowed(currentUser(r), p, permWrite), Restored: r.FormValue("restored") != ""}
+		if err == nil {
+			data.Download = s.base + "/download" + (&url.URL{Path: p}).EscapedPath()
+			data.Size, data.ModTime = info.Size(), info.ModTime().Format("2006-01-02 15:04:05")
+		}
+		for _, v := range s.fileVersions(p) {
+			data.Versions = append(data.Versions, HistoryVersion{ID: v.ID, Size: v.Size, ModTime: v.ModTime.Format("2006-01-02 15:04:05")})
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		s.render(w, "history.html", data)
+	}
+}
@@ -0,0 +1,95 @@
+package fileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVersions(t *testing.T) {
+	root := newTestRoot(t)
+	h := newTestHandler(t, Config{Root: root, Versions: 2}, WithReadWrite())
+	put := func(content string) {
+		t.Helper()
+		res, body := do(t, h, httptest.NewRequest("PUT", "/api/files/a.txt?overwrite=1", strings.NewReader(content)))
+		if res.StatusCode >= 300 {
+			t.Fatalf("PUT: status = %d, body %s", res.StatusCode, body)
+		}
+	}
+
+	// 第一次上传新文件不产生版本，没有历史链接
+	if _, body := do(t, h, httptest.NewRequest("GET", "/", nil)); strings.Contains(body, "/history/") {
+		t.Error("history link without versions")
+	}
+	put("v2")
+	put("v3")
+	put("v4")
+	versions := h.s.fileVersions("/a.txt")
+	if len(versions) != 2 {
+		t.Fatalf("versions = %+v, want 2", versions)
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "a.txt")); string(b) != "v4" {
+		t.Errorf("current content = %q", b)
+	}
+	if _, body := do(t, h, httptest.NewRequest("GET", "/", nil)); !strings.Contains(body, "/history/a.txt") || strings.Contains(body, ".versions") {
+		t.Errorf("listing:\n%s", body)
+	}
+	if res, body := do(t, h, httptest.NewRequest("GET", "/history/a.txt", nil)); res.StatusCode != http.StatusOK || strings.Count(body, "?v=") != 2 {
+		t.Errorf("history page: status = %d\n%s", res.StatusCode, body)
+	}
+
+	// 最近的版本在前，下载旧版本
+	res, body := do(t, h, httptest.NewRequest("GET", "/history/a.txt?v="+versions[0].ID, nil))
+	if res.StatusCode != http.StatusOK || body != "v3" || !strings.Contains(res.Header.Get("Content-Disposition"), "attachment") {
+		t.Errorf("download version: status = %d, body %q", res.StatusCode, body)
+	}
+	if res, body := do(t, h, httptest.NewRequest("GET", "/history/a.txt?v="+versions[1].ID, nil)); body != "v2" {
+		t.Errorf("older version: status = %d, body %q", res.StatusCode, body)
+	}
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/history/a.txt?v=../../a.txt", nil)); res.StatusCode != http.StatusNotFound {
+		t.Errorf("bad version: status = %d, want 404", res.StatusCode)
+	}
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/download/.versions/", nil)); res.StatusCode != http.StatusNotFound {
+		t.Errorf(".versions download: status = %d, want 404", res.StatusCode)
+	}
+
+	// 恢复旧版本，当前内容保存为新的版本
+	r := httptest.NewRequest("POST", "/history/a.txt", strings.NewReader(url.Values{"v": {versions[1].ID}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if res, _ := do(t, h, r); res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("restore: status = %d", res.StatusCode)
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "a.txt")); string(b) != "v2" {
+		t.Errorf("restored content = %q", b)
+	}
+	versions = h.s.fileVersions("/a.txt")
+	if len(versions) != 2 {
+		t.Fatalf("versions after restore = %+v", versions)
+	}
+	if _, body := do(t, h, httptest.NewRequest("GET", "/history/a.txt?v="+versions[0].ID, nil)); body != "v4" {
+		t.Errorf("version kept by restore = %q", body)
+	}
+
+	// 只读模式下不能恢复
+	h.s.writable.Store(false)
+	r = httptest.NewRequest("POST", "/history/a.txt", strings.NewReader("v="+versions[1].ID))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if res, _ := do(t, h, r); res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("restore in read-only mode: status = %d, want 405", res.StatusCode)
+	}
+}
+
+func TestVersionsDisabled(t *testing.T) {
+	h := newTestHandler(t, Config{Root: newTestRoot(t)}, WithReadWrite())
+	do(t, h, httptest.NewRequest("PUT", "/api/files/a.txt?overwrite=1", strings.NewReader("new")))
+	if res, _ := do(t, h, httptest.NewRequest("GET", "/history/a.txt", nil)); res.StatusCode != http.StatusNotFound {
+		t.Errorf("history without -versions: status = %d, want 404", res.StatusCode)
+	}
+	if _, err := os.Stat(filepath.Join(h.s.root, versionsDir)); err == nil {
+		t.Error(".versions created without -versions")
+	}
+}
@@ -0,0 +1,108 @@
+package fileserver
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// 文件监视：目录实时更新和目录列表缓存都需要知道目录中的文件什么时候有变化。
+// 每个用户能创建的 inotify 实例有限（Linux 默认 128 个），所以进程中的所有服务共用一个 fsnotify，
+// 按目录分发事件，同一个目录只监视一次，最后一个订阅取消时停止监视
+
+// watcher 是进程中共用的目录监视
+var watcher dirWatcher
+
+// dirWatcher 把 fsnotify 的事件分发给订阅了对应目录的回调
+type dirWatcher struct {
+	mu   sync.Mutex
+	w    *fsnotify.Watcher // 第一次订阅时创建
+	subs map[string]map[*watch]bool
+}
+
+type watch struct{ notify func() }
+
+// subscribe 订阅目录 dir（本地路径，不包括子目录）的变化，有变化时在后台调用 notify，不需要时调用 cancel。
+// notify 不要阻塞，也可以调用 cancel
+func (d *dirWatcher) subscribe(dir string, notify func()) (cancel func(), err error) {
+	dir = filepath.Clean(filepath.FromSlash(dir))
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.w == nil {
+		if d.w, err = fsnotify.NewWatcher(); err != nil {
+			return nil, err
+		}
+		d.subs = map[string]map[*watch]bool{}
+		go d.run(d.w)
+	}
+	if d.subs[dir] == nil {
+		if err := d.w.Add(dir); err != nil {
+			return nil, err
+		}
+		d.subs[dir] = map[*watch]bool{}
+	}
+	wt := &watch{notify: notify}
+	d.subs[dir][wt] = true
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if !d.subs[dir][wt] {
+			return
+		}
+		delete(d.subs[dir], wt)
+		if len(d.subs[dir]) == 0 {
+			delete(d.subs, dir)
+			d.w.Remove(dir)
+		}
+	}, nil
+}
+
+func (d *dirWatcher) run(w *fsnotify.Watcher) {
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			// 程序自己使用的文件不显示在列表中，它们的变化不需要通知
+			if hiddenFiles[foldPath(filepath.Base(ev.Name))] {
+				continue
+			}
+			// 被监视的目录本身被删除或改名时 ev.Name 就是这个目录
+			d.notify(filepath.Dir(ev.Name), ev.Name)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// 丢失了事件，不知道哪些目录有变化，全部通知一遍
+				d.notify()
+				continue
+			}
+			log.Printf("File watcher error: %v", err)
+		}
+	}
+}
+
+// notify 调用订阅了 dirs 的回调，dirs 为空时调用所有回调。回调在锁外调用，回调中可以取消订阅
+func (d *dirWatcher) notify(dirs ...string) {
+	var calls []func()
+	d.mu.Lock()
+	if len(dirs) == 0 {
+		for dir := range d.subs {
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, dir := range dirs {
+		for wt := range d.subs[dir] {
+			calls = append(calls, wt.notify)
+		}
+	}
+	d.mu.Unlock()
+	for _, f := range calls {
+		f()
+	}
+}
@@ -0,0 +1,238 @@
+package fileserver
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// webhook：下载完成、上传完成、删除文件时向配置的地址 POST 一个 JSON，用来通知 Slack 频道或者触发流水线。
+// 请求体用 secret 做 HMAC-SHA256 签名，放在 X-Webhook-Signature: sha256=<hex> 中，接收方用同样的密钥校验。
+// 通知在后台发送，不会拖慢下载和上传；失败时重试两次，仍然失败只记录日志
+//
+//	"webhooks": [{"url": "https://hooks.slack.com/services/...", "secret": "xxx", "events": ["download"]}]
+
+// webhook 事件
+const (
+	eventDownload = "download"
+	eventUpload   = "upload"
+	eventDelete   = "delete"
+)
+
+// webhookConfig 是配置文件中的一个 webhook
+type webhookConfig struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"` // 签名请求体的密钥，为空时不签名
+	Events []string `json:"events"` // download、upload、delete，为空表示全部
+}
+
+func (c *webhookConfig) validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q", c.URL)
+	}
+	for _, e := range c.Events {
+		if e != eventDownload && e != eventUpload && e != eventDelete {
+			return fmt.Errorf("unknown event %q, use download, upload or delete", e)
+		}
+	}
+	return nil
+}
+
+// webhookEvent 是 POST 给 webhook 的 JSON
+type webhookEvent struct {
+	Event  string    `json:"event"`
+	Path   string    `json:"path"`
+	Size   int64     `json:"size"`
+	User   string    `json:"user,omitempty"`
+	Client string    `json:"client,omitempty"` // 客户端 IP
+	Via    string    `json:"via"`              // http、ftp、sftp
+	Time   time.Time `json:"time"`
+	Text   string    `json:"text"` // 一句话的说明，Slack 的 incoming webhook 直接显示这个字段
+}
+
+// webhookQueue 保存等待发送的事件，队列满时丢弃新的事件，不阻塞请求
+const webhookQueue = 256
+
+var webhookRetries = []time.Duration{time.Second, 5 * time.Second}
+
+// webhooks 在后台依次发送事件。有配置文件时总是创建，重新加载配置时用 set 替换地址
+type webhooks struct {
+	mu     sync.RWMutex
+	hooks  []webhookConfig
+	queue  chan webhookEvent
+	client *http.Client
+}
+
+func newWebhooks(hooks []webhookConfig) *webhooks {
+	w := &webhooks{hooks: hooks, queue: make(chan webhookEvent, webhookQueue), client: &http.Client{Timeout: 10 * time.Second}}
+	go w.run()
+	return w
+}
+
+// set 替换 webhook 地址，队列中还没有发送的事件发给新的地址
+func (w *webhooks) set(hooks []webhookConfig) {
+	w.mu.Lock()
+	w.hooks = hooks
+	w.mu.Unlock()
+}
+
+// active 判断是否配置了 webhook，w 为 nil 时返回 false
+func (w *webhooks) active() bool {
+	if w == nil {
+		return false
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return len(w.hooks) > 0
+}
+
+func (w *webhooks) run() {
+	for ev := range w.queue {
+		body, err := json.Marshal(ev)
+		if err != nil {
+			log.Printf("Failed to encode webhook event: %v", err)
+			continue
+		}
+		w.mu.RLock()
+		hooks := w.hooks
+		w.mu.RUnlock()
+		for _, h := range hooks {
+			if len(h.Events) == 0 || slices.Contains(h.Events, ev.Event) {
+				w.deliver(h, ev.Event, body)
+			}
+		}
+	}
+}
+
+// deliver 发送一个事件，网络错误和 5xx 时重试
+func (w *webhooks) deliver(h webhookConfig, event string, body []byte) {
+	var err error
+	for i := 0; ; i++ {
+		if err = w.post(h, event, body); err == nil {
+			return
+		}
+		if i == len(webhookRetries) {
+			break
+		}
+		time.Sleep(webhookRetries[i])
+	}
+	log.Printf("Webhook %s failed: %v", redactURL(h.URL), err)
+}
+
+func (w *webhooks) post(h webhookConfig, event string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Go-Download-Static-Files")
+	req.Header.Set("X-Webhook-Event", event)
+	if h.Secret != "" {
+		req.Header.Set("X-Webhook-Signature", webhookSignature(h.Secret, body))
+	}
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 500 {
+		return fmt.Errorf("%s", res.Status)
+	}
+	// 4xx 重试也不会成功
+	if res.StatusCode >= 300 {
+		log.Printf("Webhook %s rejected %s event: %s", redactURL(h.URL), event, res.Status)
+	}
+	return nil
+}
+
+// webhookSignature 返回 sha256=<请求体的 HMAC-SHA256>
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// redactURL 只保留地址的主机部分，Slack 等服务的 webhook 地址本身就是密钥，不能写进日志
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "webhook"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// notify 把事件放入发送队列，没有配置 webhook 时什么也不做
+func (s *server) notify(ev webhookEvent) {
+	if !s.webhooks.active() {
+		return
+	}
+	ev.Time = time.Now().UTC()
+	who := ev.User
+	if who == "" {
+		who = "anonymous"
+		if ev.Client != "" {
+			who += " (" + ev.Client + ")"
+		}
+	}
+	switch ev.Event {
+	case eventDownload:
+		ev.Text = fmt.Sprintf("%s downloaded %s (%d bytes) via %s", who, ev.Path, ev.Size, ev.Via)
+	case eventUpload:
+		ev.Text = fmt.Sprintf("%s uploaded %s (%d bytes) via %s", who, ev.Path, ev.Size, ev.Via)
+	case eventDelete:
+		ev.Text = fmt.Sprintf("%s deleted %s via %s", who, ev.Path, ev.Via)
+	}
+	select {
+	case s.webhooks.queue <- ev:
+	default:
+		log.Printf("Webhook queue is full, dropping %s event for %s", ev.Event, ev.Path)
+	}
+}
+
+// notifyHTTP 发送 HTTP 请求触发的事件
+func (s *server) notifyHTTP(r *http.Request, event, p string, size int64) {
+	if !s.webhooks.active() {
+		return
+	}
+	ev := webhookEvent{Event: event, Path: p, Size: size, Via: "http"}
+	if u := currentUser(r); u != nil {
+		ev.User = u.Name
+	}
+	if ip := s.clientIP(r); ip != nil {
+		ev.Client = ip.String()
+	}
+	s.notify(ev)
+}
+
+// notifyUpload 在上传完成后发送 upload 事件并写入审计日志，大小从保存好的文件读取
+func (s *server) notifyUpload(r *http.Request, p string) {
+	if !s.webhooks.active() && s.auditLog == nil {
+		return
+	}
+	var size int64
+	if info, err := s.stat(p); err == nil {
+		size = info.Size()
+	}
+	s.notifyHTTP(r, eventUpload, p, size)
+	s.auditHTTP(r, auditEntry{Action: auditUpload, Path: p, Size: size})
+}
+
+// remoteIP 返回 FTP、SFTP 连接的客户端 IP
+func remoteIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,73 @@
+package fileserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	type received struct {
+		event webhookEvent
+		ok    bool // 签名是否正确
+	}
+	events := make(chan received, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var ev webhookEvent
+		json.Unmarshal(body, &ev)
+		ok := r.Header.Get("X-Webhook-Signature") == webhookSignature("s3cret", body) && r.Header.Get("X-Webhook-Event") == ev.Event
+		events <- received{ev, ok}
+	}))
+	defer hook.Close()
+
+	config := writeConfig(t, `{"webhooks": [{"url": "`+hook.URL+`", "secret": "s3cret", "events": ["download", "upload", "delete"]}]}`)
+	h := newTestHandler(t, Config{Root: newTestRoot(t), ConfigFile: config}, WithReadWrite())
+	next := func(want, p string, size int64) {
+		t.Helper()
+		select {
+		case got := <-events:
+			if !got.ok {
+				t.Errorf("%s event: bad signature", want)
+			}
+			if got.event.Event != want || got.event.Path != p || got.event.Size != size || got.event.Via != "http" {
+				t.Errorf("event = %+v, want %s %s (%d bytes)", got.event, want, p, size)
+			}
+			if got.event.Text == "" || got.event.Client == "" {
+				t.Errorf("event without text or client: %+v", got.event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s event", want)
+		}
+	}
+
+	do(t, h, httptest.NewRequest("PUT", "/api/files/new.txt", strings.NewReader("uploaded")))
+	next(eventUpload, "/new.txt", 8)
+	do(t, h, httptest.NewRequest("GET", "/download/a.txt", nil))
+	next(eventDownload, "/a.txt", 5)
+	do(t, h, httptest.NewRequest("DELETE", "/api/files/new.txt", nil))
+	next(eventDelete, "/new.txt", 0)
+
+	// 分段下载和 HEAD 不算完整的下载
+	req := httptest.NewRequest("GET", "/download/a.txt", nil)
+	req.Header.Set("Range", "bytes=0-1")
+	do(t, h, req)
+	do(t, h, httptest.NewRequest("HEAD", "/download/a.txt", nil))
+	do(t, h, httptest.NewRequest("GET", "/download/sub/b.txt", nil))
+	next(eventDownload, "/sub/b.txt", 5)
+}
+
+func TestWebhookConfig(t *testing.T) {
+	for _, c := range []string{
+		`{"webhooks": [{"url": "ftp://example.com/hook"}]}`,
+		`{"webhooks": [{"url": "https://example.com/hook", "events": ["rename"]}]}`,
+	} {
+		if _, err := New(Config{Root: t.TempDir(), ConfigFile: writeConfig(t, c)}); err == nil {
+			t.Errorf("%s: no error", c)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// stringList 是可以重复指定的命令行参数，例如 -protect /a=x -protect /b=y
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// byteSize 是带单位的字节数参数，例如 512K、100M、2G，不带单位时为字节
+type byteSize int64
+
+func (b *byteSize) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(v string) error {
+	units := map[byte]int64{'K': 1 << 10, 'M': 1 << 20, 'G': 1 << 30, 'T': 1 << 40}
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(v)), "B")
+	mul := int64(1)
+	if s != "" {
+		if u, ok := units[s[len(s)-1]]; ok {
+			mul, s = u, s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", v)
+	}
+	*b = byteSize(n * float64(mul))
+	return nil
+}
+
+// flagName 返回命令行参数 arg 的参数名和是否带有 =值，不是参数时返回空字符串
+func flagName(arg string) (string, bool) {
+	if !strings.HasPrefix(arg, "-") {
+		return "", false
+	}
+	name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+	return name, hasValue
+}
+
+// hasFlag 判断命令行参数中是否指定了 name
+func hasFlag(args []string, name string) bool {
+	for _, arg := range args {
+		if n, _ := flagName(arg); n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutFlag 去掉命令行参数中的 name 及其值（-name value 或 -name=value，布尔参数没有单独的值）
+func withoutFlag(args []string, name string) []string {
+	isBool := false
+	if f := flag.Lookup(name); f != nil {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		isBool = ok && b.IsBoolFlag()
+	}
+	var out []string
+	for i := 0; i < len(args); i++ {
+		n, hasValue := flagName(args[i])
+		if n != name {
+			out = append(out, args[i])
+			continue
+		}
+		if !hasValue && !isBool {
+			i++
+		}
+	}
+	return out
+}
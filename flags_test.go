@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"slices"
+	"testing"
+)
+
+func TestByteSize(t *testing.T) {
+	for v, want := range map[string]int64{"512": 512, "512K": 512 << 10, "100MB": 100 << 20, "1.5g": 3 << 29, " 2T ": 2 << 40} {
+		var b byteSize
+		if err := b.Set(v); err != nil || int64(b) != want {
+			t.Errorf("Set(%q) = %d, %v, want %d", v, b, err, want)
+		}
+	}
+	for _, v := range []string{"", "K", "-1M", "ten"} {
+		var b byteSize
+		if err := b.Set(v); err == nil {
+			t.Errorf("Set(%q) succeeded", v)
+		}
+	}
+}
+
+func TestWithoutFlag(t *testing.T) {
+	fs := flag.CommandLine
+	if fs.Lookup("test-bool") == nil {
+		fs.Bool("test-bool", false, "")
+	}
+	args := []string{"-root", "D:\\share", "-service", "install", "-rw", "--port=9000"}
+	if !hasFlag(args, "service") || !hasFlag(args, "port") || hasFlag(args, "tls-cert") {
+		t.Error("hasFlag")
+	}
+	if got, want := withoutFlag(args, "service"), []string{"-root", "D:\\share", "-rw", "--port=9000"}; !slices.Equal(got, want) {
+		t.Errorf("withoutFlag(service) = %q, want %q", got, want)
+	}
+	if got, want := withoutFlag(args, "port"), []string{"-root", "D:\\share", "-service", "install", "-rw"}; !slices.Equal(got, want) {
+		t.Errorf("withoutFlag(port) = %q, want %q", got, want)
+	}
+	// 布尔参数没有单独的值，不能连后面的参数一起去掉
+	args = []string{"-test-bool", "-root", "/srv"}
+	if got, want := withoutFlag(args, "test-bool"), []string{"-root", "/srv"}; !slices.Equal(got, want) {
+		t.Errorf("withoutFlag(test-bool) = %q, want %q", got, want)
+	}
+}
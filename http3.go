@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// HTTP/3：-http3 时在同一端口上另外监听 UDP（QUIC），HTTPS 响应中通过 Alt-Svc 告诉浏览器可以改用 HTTP/3，
+// 丢包较多的无线网络下大文件传输快很多。只能和 HTTPS 一起使用
+
+// startHTTP3 在后台启动 HTTP/3 服务，返回给 TCP 服务使用的、会加上 Alt-Svc 的处理函数
+func startHTTP3(srv *http.Server, certFile, keyFile string) http.Handler {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		log.Fatalf("Failed to load TLS certificate: %v", err)
+	}
+	conf := &tls.Config{}
+	if srv.TLSConfig != nil {
+		conf = srv.TLSConfig.Clone()
+	}
+	conf.Certificates = []tls.Certificate{cert}
+
+	h3 := &http3.Server{
+		Addr:           srv.Addr,
+		Handler:        srv.Handler,
+		TLSConfig:      http3.ConfigureTLSConfig(conf),
+		IdleTimeout:    srv.IdleTimeout,
+		MaxHeaderBytes: srv.MaxHeaderBytes,
+	}
+	go func() {
+		log.Printf("Serving HTTP/3 on %s (udp)\n", srv.Addr)
+		log.Fatal(h3.ListenAndServe())
+	}()
+
+	next := srv.Handler
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h3.SetQUICHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net"
+	"os/exec"
+	"runtime"
+
+	"github.com/somnro/Go-Download-Static-Files/fileserver"
+)
+
+// serverURLs 返回可以访问本服务的地址。监听所有网卡时列出每个局域网 IP，第一个总是 localhost，方便在本机打开
+func serverURLs(addrs []listenAddr, base string) []string {
+	var urls []string
+	for _, a := range addrs {
+		if isUnixAddr(a.addr) {
+			continue
+		}
+		host, port, err := net.SplitHostPort(a.addr)
+		if err != nil {
+			continue
+		}
+		scheme := "http"
+		if a.tls {
+			scheme = "https"
+		}
+		hosts := []string{host}
+		if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+			hosts = append([]string{"localhost"}, fileserver.LANIPs()...)
+		}
+		for _, h := range hosts {
+			urls = append(urls, scheme+"://"+net.JoinHostPort(h, port)+base+"/")
+		}
+	}
+	return urls
+}
+
+// openBrowser 用系统默认浏览器打开 url
+func openBrowser(url string) error {
+	switch runtime.GOOS {
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	case "darwin":
+		return exec.Command("open", url).Start()
+	default:
+		return exec.Command("xdg-open", url).Start()
+	}
+}
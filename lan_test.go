@@ -0,0 +1,31 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/somnro/Go-Download-Static-Files/fileserver"
+)
+
+func TestServerURLs(t *testing.T) {
+	got := serverURLs([]listenAddr{
+		{addr: "127.0.0.1:8080"},
+		{addr: "[::1]:8443", tls: true},
+		{addr: "unix:/run/fileserver.sock"},
+	}, "/files")
+	want := []string{"http://127.0.0.1:8080/files/", "https://[::1]:8443/files/"}
+	if !slices.Equal(got, want) {
+		t.Errorf("serverURLs = %q, want %q", got, want)
+	}
+
+	// 监听所有网卡时先列出 localhost，再列出每个局域网 IP
+	want = []string{"http://localhost:8080/"}
+	for _, ip := range fileserver.LANIPs() {
+		want = append(want, "http://"+ip+":8080/")
+	}
+	for _, addr := range []string{":8080", "0.0.0.0:8080"} {
+		if got := serverURLs([]listenAddr{{addr: addr}}, ""); !slices.Equal(got, want) {
+			t.Errorf("%s: serverURLs = %q, want %q", addr, got, want)
+		}
+	}
+}
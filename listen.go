@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 监听地址：-listen 可以是 host:port，也可以是 unix:/run/fileserver.sock，由 nginx 等通过本机 socket 转发。
+// -listen 可以重复，所有地址使用同一套处理逻辑，例如局域网端口加上只监听 127.0.0.1 的管理端口。
+// 地址前加 http:// 或 https:// 可以分别指定协议，不加时指定了 -tls-cert 就是 HTTPS。没有指定时使用 -port
+
+// listenAddr 是一个监听地址
+type listenAddr struct {
+	addr string
+	tls  bool
+}
+
+// parseListen 解析 -listen 的值，defaultTLS 为没有写协议时是否使用 HTTPS
+func parseListen(v string, defaultTLS bool) listenAddr {
+	if a, ok := strings.CutPrefix(v, "https://"); ok {
+		return listenAddr{addr: a, tls: true}
+	}
+	if a, ok := strings.CutPrefix(v, "http://"); ok {
+		return listenAddr{addr: a}
+	}
+	return listenAddr{addr: v, tls: defaultTLS}
+}
+
+// listen 按地址创建监听，unix socket 的权限设为 mode
+func listen(addr string, mode os.FileMode) (net.Listener, error) {
+	sock, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	// 上次异常退出留下的 socket 文件会导致监听失败，确认是 socket 后删除
+	if info, err := os.Lstat(sock); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", sock)
+		}
+		os.Remove(sock)
+	}
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(sock, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// isUnixAddr 判断监听地址是否为 unix socket
+func isUnixAddr(addr string) bool {
+	return strings.HasPrefix(addr, "unix:")
+}
+
+// systemdListeners 返回 systemd socket 激活传入的监听（LISTEN_FDS），没有时返回 nil。
+// systemd 持有端口，程序可以按需启动，也不需要 root 权限就能使用 80、443 端口。
+// .socket 单元中 FileDescriptorName=http 或 https 可以分别指定协议
+func systemdListeners(defaultTLS bool) ([]net.Listener, []listenAddr, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	// 不再传给子进程
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	var listeners []net.Listener
+	var addrs []listenAddr
+	for i := range n {
+		// 传入的文件描述符从 3 开始
+		f := os.NewFile(uintptr(3+i), "systemd-socket")
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("socket %d from systemd: %w", 3+i, err)
+		}
+		a := listenAddr{addr: ln.Addr().String(), tls: defaultTLS}
+		if ln.Addr().Network() == "unix" {
+			a.addr = "unix:" + a.addr
+		}
+		if i < len(names) {
+			switch names[i] {
+			case "http":
+				a.tls = false
+			case "https":
+				a.tls = true
+			}
+		}
+		listeners = append(listeners, ln)
+		addrs = append(addrs, a)
+	}
+	return listeners, addrs, nil
+}
+
+// listenRetry 和 listen 相同，TCP 端口被占用时依次尝试后面的 retry 个端口
+func listenRetry(addr string, mode os.FileMode, retry int) (net.Listener, error) {
+	ln, err := listen(addr, mode)
+	if err == nil || retry <= 0 || isUnixAddr(addr) {
+		return ln, err
+	}
+	host, p, splitErr := net.SplitHostPort(addr)
+	port, atoiErr := strconv.Atoi(p)
+	if splitErr != nil || atoiErr != nil || port == 0 {
+		return nil, err
+	}
+	for i := 1; i <= retry && port+i <= 65535; i++ {
+		next := net.JoinHostPort(host, strconv.Itoa(port+i))
+		if ln, err2 := listen(next, mode); err2 == nil {
+			log.Printf("Port %d is not available (%v), using %d instead", port, err, port+i)
+			return ln, nil
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestUnixListen(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets")
+	}
+	// t.TempDir() 的路径可能超过 unix socket 地址的长度限制
+	dir, err := os.MkdirTemp("", "sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "fs.sock")
+	if !isUnixAddr("unix:"+sock) || isUnixAddr(":8080") {
+		t.Error("isUnixAddr")
+	}
+
+	ln, err := listen("unix:"+sock, 0660)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(sock); err != nil || info.Mode().Perm() != 0660 {
+		t.Errorf("socket mode = %v, %v, want 0660", info.Mode().Perm(), err)
+	}
+	c, err := net.Dial("unix", sock)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	c.Close()
+
+	// 上次留下的 socket 文件不影响再次监听
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	ln, err = listen("unix:"+sock, 0600)
+	if err != nil {
+		t.Fatalf("stale socket: %v", err)
+	}
+	ln.Close()
+
+	// 普通文件不能被删除
+	file := filepath.Join(dir, "data")
+	os.WriteFile(file, []byte("x"), 0644)
+	if _, err := listen("unix:"+file, 0600); err == nil {
+		t.Error("listening over a regular file succeeded")
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("regular file was removed: %v", err)
+	}
+}
+
+func TestParseListen(t *testing.T) {
+	for _, c := range []struct {
+		v          string
+		defaultTLS bool
+		want       listenAddr
+	}{
+		{":8080", false, listenAddr{":8080", false}},
+		{":8443", true, listenAddr{":8443", true}},
+		{"http://127.0.0.1:8080", true, listenAddr{"127.0.0.1:8080", false}},
+		{"https://192.168.1.5:9090", false, listenAddr{"192.168.1.5:9090", true}},
+		{"unix:/run/fileserver.sock", false, listenAddr{"unix:/run/fileserver.sock", false}},
+	} {
+		if got := parseListen(c.v, c.defaultTLS); got != c.want {
+			t.Errorf("parseListen(%q, %v) = %+v, want %+v", c.v, c.defaultTLS, got, c.want)
+		}
+	}
+}
+
+func TestSystemdListeners(t *testing.T) {
+	// 子进程中按 systemd 的约定从文件描述符 3 取得监听
+	if addr := os.Getenv("TEST_SYSTEMD_ADDR"); addr != "" {
+		os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		lns, addrs, err := systemdListeners(false)
+		if err != nil || len(lns) != 1 {
+			t.Fatalf("systemdListeners = %d listeners, %v", len(lns), err)
+		}
+		if want := (listenAddr{addr, true}); addrs[0] != want {
+			t.Errorf("addr = %+v, want %+v", addrs[0], want)
+		}
+		if os.Getenv("LISTEN_FDS") != "" {
+			t.Error("LISTEN_FDS is passed on to child processes")
+		}
+		return
+	}
+
+	if lns, _, err := systemdListeners(false); lns != nil || err != nil {
+		t.Fatalf("without LISTEN_FDS: %v, %v", lns, err)
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("socket activation")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSystemdListeners$")
+	cmd.Env = append(os.Environ(), "TEST_SYSTEMD_ADDR="+ln.Addr().String(), "LISTEN_FDS=1", "LISTEN_FDNAMES=https")
+	cmd.ExtraFiles = []*os.File{f}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("child: %v\n%s", err, out)
+	}
+}
+
+func TestListenRetry(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	addr := busy.Addr().String()
+
+	if _, err := listenRetry(addr, 0, 0); err == nil {
+		t.Fatal("listening on a busy port succeeded")
+	}
+	ln, err := listenRetry(addr, 0, 10)
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	defer ln.Close()
+	_, busyPort, _ := net.SplitHostPort(addr)
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	if port == busyPort {
+		t.Errorf("retry listened on the busy port %s", port)
+	}
+
+	// -port 0 由系统分配空闲端口
+	ln0, err := listenRetry("127.0.0.1:0", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln0.Close()
+	if _, port, _ := net.SplitHostPort(ln0.Addr().String()); port == "0" {
+		t.Error("port 0 was not replaced by a free port")
+	}
+}
@@ -1,321 +1,495 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
-	"html/template"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
-	"path"
 	"path/filepath"
-	"sort"
+	"slices"
+	"strconv"
 	"strings"
-)
-
-type FileInfo struct {
-	Name     string
-	Size     int64
-	IsDir    bool
-	URL      string
-	Original string
-	ModTime  string
-	Parent   string
-}
-
-var tpl = `
-<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>目录列表</title>
-    <style>
-        body {
-            font-family: Arial, sans-serif;
-            line-height: 1.6;
-            margin: 20px;
-        }
-        h1 {
-            color: #2c3e50;
-        }
-        .back-link {
-            font-size: 14px;
-            margin-bottom: 10px;
-            display: inline-block;
-            color: #2980b9;
-            text-decoration: none;
-        }
-        .back-link:hover {
-            text-decoration: underline;
-        }
-        ul {
-            list-style-type: none;
-            padding-left: 0;
-        }
-        li {
-            margin: 8px 0;
-            font-size: 16px;
-        }
-        .size {
-            color: #7f8c8d;
-            font-size: 14px;
-            margin-left: 20px; /* 增加文件大小与链接之间的间距 */
-        }
-        .mod-time {
-            color: #95a5a6;
-            font-size: 14px;
-        }
-        .file, .directory {
-            display: flex;
-            align-items: center;
-        }
-        .file a, .directory a {
-            margin-left: 8px;
-            color: #34495e;
-            text-decoration: none;
-        }
-        .file a:hover, .directory a:hover {
-            text-decoration: underline;
-        }
-    </style>
-</head>
-<body>
-
-<h1>目录列表</h1>
-<!-- 如果有上级目录，显示返回链接 -->
-{{if .Parent}}
-    <p><a href="{{.Parent}}" class="back-link">⬅ 返回上级</a></p>
-{{end}}
+	"time"
 
+	"github.com/somnro/Go-Download-Static-Files/fileserver"
+)
 
-<!-- 文件和目录列表 -->
-<ul>
-    {{range .Files}}
-        <li class="{{if .IsDir}}directory{{else}}file{{end}}">
-            <span class="icon">
-                {{if .IsDir}}📁{{else}}📄{{end}}
-            </span>
-            <a href="{{.Original}}">{{.Name}}</a>
-            
-            <!-- 如果是文件，显示文件大小 -->
-            {{if not .IsDir}}
-                <span class="size" data-bytes="{{.Size}}">{{.Size}} bytes</span>
-                <a href="{{.URL}}">下载</a>
-            {{end}}
-            
-            <!-- 显示最后修改时间 -->
-            <span class="mod-time"> &nbsp; {{.ModTime}}</span>
-        </li>
-    {{end}}
-</ul>
+/*
+编译：
+go build -o FileServer.exe goDemo2/Go-Download-Static-Files/version4
 
-</body>
-<script>
-  function humanSize(n) {
-    const KB = 1024, MB = KB*1024, GB = MB*1024;
-    if (n >= GB) return (n/GB).toFixed(2) + ' GB';
-    if (n >= MB) return (n/MB).toFixed(2) + ' MB';
-    if (n >= KB) return (n/KB).toFixed(2) + ' KB';
-    return n + ' Byte';
-  }
-  document.querySelectorAll('.size').forEach(el => {
-    const bytes = parseInt(el.getAttribute('data-bytes'), 10) || 0;
-    el.textContent = humanSize(bytes);
-  });
-</script>
-</html>
-`
+运行：
+Go-Download-Static-Files
+Go-Download-Static-Files -port=8081
+Go-Download-Static-Files --port=8081
+Go-Download-Static-Files --port=8081 -root="D:\temp\seata"
+Go-Download-Static-Files --port=8081 --root="D:\temp\seata"
 
-type PageData struct {
-	Files  []FileInfo
-	Parent string
+在 main3.go 上优化
+获取指定目录下的文件，运行在指定端口，默认为 8080 端口
+优化显示样式
+访问：
+http://127.0.0.1:8080
+*/
+func main() {
+	// 第一个参数不是选项时是子命令，否则和以前一样直接启动服务
+	if args := os.Args[1:]; len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		runCommand(args[0], args[1:])
+		return
+	}
+	serve(os.Args[1:])
 }
 
-func handler(w http.ResponseWriter, r *http.Request, root string) {
-	//dir := "." + r.URL.Path
-	//if root != "" {
-	//	dir = root
-	//}
+// serve 启动文件服务，是默认的子命令
+func serve(args []string) {
+	// 定义命令行参数，默认值8080
+	port := flag.String("port", "8080", "Server port (0 lets the system pick a free one)")
+	portRetry := flag.Int("port-retry", 0, "If the port is busy, try up to this many following ports")
+	mdns := flag.Bool("mdns", false, "Advertise the server on the LAN via mDNS / Bonjour")
+	mdnsName := flag.String("mdns-name", defaultMDNSName(), "Service name shown to mDNS / Bonjour clients")
+	natMap := flag.Bool("nat", false, "Ask the router for a port mapping via NAT-PMP or UPnP and print the external URL")
+	openURL := flag.Bool("open", false, "Open the server URL in the default browser after starting")
+	daemon := flag.Bool("daemon", false, "Run in the background, detached from the terminal (Unix)")
+	pidFile := flag.String("pidfile", "", "Write the process ID to this file")
+	logFile := flag.String("log-file", "", "Append logs to this file instead of stderr")
+	showVersion := flag.Bool("version", false, "Print version information and exit")
+	service := flag.String("service", "", "Manage the Windows service: install (with the other flags given), start, stop, remove")
+	var listenAddrs stringList
+	flag.Var(&listenAddrs, "listen", "Listen address, host:port or unix:/path/to.sock, optionally prefixed with http:// or https:// (repeatable, overrides -port)")
+	socketMode := flag.String("socket-mode", "0660", "Permissions of the unix socket created by -listen unix:...")
+	rootDir := flag.String("root", ".", "Root directory to serve files from, s3://bucket/prefix for S3-compatible storage, or sftp://user@host/path for a remote machine over SSH (read-only)")
+	tplFile := flag.String("template", "", "Custom HTML template file for directory listing")
+	errorPages := flag.String("error-pages", "", "Directory with custom error page templates (404.html, 403.html, 500.html, error.html)")
+	theme := flag.String("theme", "auto", "Page theme: "+strings.Join(fileserver.Themes(), ", "))
+	shareSecret := flag.String("share-secret", "", "Secret used to sign share links (random if empty, links then stop working after restart)")
+	shareDB := flag.String("share-db", "", "File to persist share link download counts")
+	statsDB := flag.String("stats-db", "", "File to record every download in (path, bytes, client, time, status)")
+	trash := flag.Bool("trash", true, "Move deleted files into a hidden .trash folder where they can be restored from /trash")
+	trashRetention := flag.Duration("trash-retention", 30*24*time.Hour, "How long deleted files stay in the trash")
+	dedupe := flag.Bool("dedupe", false, "Store uploaded files by content hash and hard-link identical uploads instead of keeping copies")
+	clamd := flag.String("clamd", "", "Scan uploads with clamd at this address (host:port or unix socket path) before they are saved")
+	scanCommand := flag.String("scan-command", "", "Scan uploads with this command before they are saved, exit status 1 means infected (e.g. \"clamdscan --no-summary\")")
+	quarantine := flag.Bool("quarantine", false, "Move infected uploads into a hidden .quarantine folder instead of deleting them")
+	followSymlinks := flag.String("follow-symlinks", fileserver.SymlinksWithinRoot, "Which symbolic links to follow: "+strings.Join(fileserver.SymlinkPolicies(), ", "))
+	filenameEncoding := flag.String("filename-encoding", "", "Encoding of file names that aren't UTF-8 (e.g. gbk, big5, shift_jis), converted to UTF-8 for display and links")
+	imageCache := flag.String("image-cache", "", "Directory to keep images resized with ?w= and ?h= in (default: a folder in the user cache directory)")
+	stripEXIF := flag.Bool("strip-exif", false, "Remove EXIF (including GPS), XMP and other metadata from JPEG and PNG files when they are viewed or downloaded")
+	sitemap := flag.Bool("sitemap", false, "Serve /sitemap.xml listing every folder and file visible without logging in, for search engines")
+	var sitemapExclude stringList
+	flag.Var(&sitemapExclude, "sitemap-exclude", "Leave paths matching this pattern out of /sitemap.xml, e.g. '/drafts/**' or '**/*.tmp' (repeatable)")
+	robots := flag.String("robots", "", "Serve /robots.txt: deny (block all crawlers), allow, or the path of a custom robots.txt file")
+	robotsTag := flag.String("robots-tag", "", "X-Robots-Tag header sent with every response, e.g. 'noindex, nofollow'")
+	exifGPS := flag.Bool("exif-gps", true, "Show the GPS location stored in photos on image pages, -exif-gps=false to hide it")
+	versions := flag.Int("versions", 0, "Keep this many previous versions of files overwritten by uploads and edits, browsable at /history/<path>")
+	auditLog := flag.String("audit-log", "", "Append-only file to record uploads, deletes, renames and permission changes in (JSON lines)")
+	statsRetention := flag.Duration("stats-retention", 90*24*time.Hour, "How long download records in -stats-db are kept")
+	sharePath := flag.String("share", "", "Print a share link for this path (relative to root) and exit")
+	shareHours := flag.Float64("share-hours", 24, "Hours before a link created with -share expires, 0 for never")
+	shareDownloads := flag.Int("share-downloads", 0, "Maximum downloads for a link created with -share, 0 for unlimited")
+	var allowIP, denyIP, trustedProxy stringList
+	flag.Var(&allowIP, "allow-ip", "Only allow clients from these CIDR ranges (repeatable, comma separated)")
+	flag.Var(&denyIP, "deny-ip", "Reject clients from these CIDR ranges (repeatable, comma separated)")
+	flag.Var(&trustedProxy, "trusted-proxy", "Trust X-Forwarded-For from these proxy CIDR ranges (repeatable, comma separated)")
+	publicURL := flag.String("public-url", "", "External scheme://host[:port] used in share links, QR codes and copied links; inferred from the request if empty")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file, enables HTTPS together with -tls-key")
+	tlsKey := flag.String("tls-key", "", "TLS private key file")
+	clientCA := flag.String("client-ca", "", "CA certificate file; only clients presenting a certificate signed by it may connect (mTLS)")
+	apiToken := flag.String("api-token", "", "Static bearer token for scripts (authenticates as user \"api\")")
+	configFile := flag.String("config", "", "JSON config file for users and access control rules")
+	usersFile := flag.String("users", "", "JSON user store with roles and per-user root folders, managed with the users command and on /admin")
+	readTimeout := flag.Duration("read-timeout", 0, "Maximum time to read a whole request including the body, 0 for none (large uploads need time)")
+	readHeaderTimeout := flag.Duration("read-header-timeout", 10*time.Second, "Maximum time to read request headers")
+	writeTimeout := flag.Duration("write-timeout", 0, "Maximum time to write a response, 0 for none (large downloads need time)")
+	idleTimeout := flag.Duration("idle-timeout", 2*time.Minute, "How long to keep idle keep-alive connections open")
+	maxHeaderBytes := flag.Int("max-header-bytes", 64<<10, "Maximum size of request headers in bytes")
+	enableHTTP2 := flag.Bool("http2", true, "Enable HTTP/2 when serving HTTPS")
+	enableHTTP3 := flag.Bool("http3", false, "Also serve HTTP/3 (QUIC) on the same UDP port, requires -tls-cert and -tls-key")
+	ftpAddr := flag.String("ftp", "", "Also serve the root over FTP on this address, e.g. :2121 (read-only unless -ftp-rw)")
+	ftpWrite := flag.Bool("ftp-rw", false, "Allow uploads, deletes and renames over FTP (requires -mode rw)")
+	ftpTLS := flag.Bool("ftp-tls", false, "Require FTPS (AUTH TLS) with the -tls-cert certificate before login")
+	ftpPassive := flag.String("ftp-passive-ports", "", "Port range for FTP passive data connections, e.g. 50000-50100 (default: any free port)")
+	ftpPublicIP := flag.String("ftp-public-ip", "", "IP address announced to FTP clients in passive mode, when behind NAT")
+	sftpAddr := flag.String("sftp", "", "Also serve the root over SFTP (SSH) on this address, e.g. :2022 (read-only unless -sftp-rw)")
+	sftpWrite := flag.Bool("sftp-rw", false, "Allow uploads, deletes and renames over SFTP (requires -mode rw)")
+	sftpHostKey := flag.String("sftp-host-key", "", "SSH host private key file, generated if missing (default: ssh_host_ed25519_key in the user config directory)")
+	sftpKeys := flag.String("sftp-authorized-keys", "", "authorized_keys file for SFTP public key login, the comment of each key is the user name")
+	corsOrigins := flag.String("cors-origins", "", "Allow cross-origin requests from these origins (comma separated, * for any)")
+	corsMethods := flag.String("cors-methods", "", "Methods allowed in cross-origin requests (default GET, HEAD, OPTIONS; plus PUT, POST, PATCH, DELETE in rw mode)")
+	corsHeaders := flag.String("cors-headers", "Authorization, Content-Type, Range, Upload-Offset, Upload-Length", "Request headers allowed in cross-origin requests")
+	basePath := flag.String("base-path", "", "URL path prefix when running behind a reverse proxy under a subpath, e.g. /files")
+	spa := flag.Bool("spa", false, "Single-page app mode: serve files at their own paths and fall back to /index.html for everything else")
+	serveIndex := flag.Bool("serve-index", false, "Serve index.html instead of the listing when a directory has one (?list=1 forces the listing)")
+	liveReload := flag.Bool("live-reload", false, "Development mode: reload pages served by -spa or -serve-index in the browser when files under the root change")
+	security := flag.Bool("security-headers", true, "Send X-Content-Type-Options, Referrer-Policy, Content-Security-Policy (pages) and HSTS (HTTPS) headers")
+	index := flag.Bool("index", false, "Index file names and sizes in the background for instant search and directory sizes")
+	indexInterval := flag.Duration("index-interval", time.Hour, "How often to rebuild the whole index; changes to a local root are picked up immediately")
+	dirSizes := flag.Bool("dir-sizes", true, "Show the total size of each folder in listings, computed in the background")
+	noCache := flag.Bool("no-cache", false, "Read directories from disk on every request instead of caching listings in memory")
+	compression := flag.Bool("compress", true, "Compress text responses (listings, JSON, text file views) with brotli or gzip")
+	var mimeTypes stringList
+	flag.Var(&mimeTypes, "mime", "Content-Type for an extension, as .ext=type, e.g. '.apk=application/vnd.android.package-archive' (repeatable)")
+	var cacheRules stringList
+	flag.Var(&cacheRules, "cache-control", "Cache-Control for matching responses, as match=value, e.g. '*.zip=public, max-age=31536000, immutable' or 'listing=no-store' (repeatable)")
+	var protect stringList
+	flag.Var(&protect, "protect", "Password protect a directory, as /path=password (repeatable)")
+	checksum := flag.String("checksum", "", "Show a checksum next to each file in listings: md5, sha1, sha256 or sha512")
+	mode := flag.String("mode", fileserver.ModeReadOnly, "Operation mode: ro (read-only) or rw (allow upload, delete and rename)")
+	var maxUpload, maxBody, quota byteSize
+	flag.Var(&maxUpload, "max-upload", "Maximum size of a single uploaded file, e.g. 2G (0 for unlimited)")
+	flag.Var(&maxBody, "max-body", "Maximum request body size for uploads, e.g. 64M (0 for unlimited; keep at least 8M for chunked uploads)")
+	maxExtract := byteSize(10 << 30)
+	flag.Var(&maxExtract, "max-extract", "Maximum total uncompressed size when extracting an uploaded archive")
+	flag.Var(&quota, "quota", "Maximum total size of all files under root, e.g. 100G (0 for unlimited)")
+	lang := flag.String("lang", "en", "Default UI language when the browser doesn't ask for a supported one: "+strings.Join(fileserver.Languages(), ", "))
 
-	dir := root + r.URL.Path
+	// 解析用户传入的命令行参数。如果用户没有提供该参数，会使用默认值。
+	flag.Usage = serveUsage
+	flag.CommandLine.Parse(args)
 
-	files, err := os.ReadDir(dir)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if *showVersion {
+		runVersion(nil)
 		return
 	}
-
-	var list []FileInfo
-	for _, f := range files {
-		info, _ := f.Info()
-		name := f.Name()
-		modTime := info.ModTime().Format("2006-01-02 15:04:05")
-		var urlStr string
-		var original string
-		if f.IsDir() {
-			urlStr = r.URL.Path + name + "/"
-			original = r.URL.Path + name + "/"
-		} else {
-			encodedName := url.PathEscape(name)
-			if r.URL.Path == "/" {
-				urlStr = "/download/" + encodedName
-				original = "/view/" + encodedName
-			} else {
-				urlStr = "/download" + r.URL.Path + encodedName
-				original = "/view" + r.URL.Path + encodedName
-			}
+	if *service != "" {
+		if err := controlService(*service, withoutFlag(os.Args[1:], "service")); err != nil {
+			log.Fatal(err)
 		}
-		list = append(list, FileInfo{
-			Name:     name,
-			Size:     info.Size(),
-			IsDir:    f.IsDir(),
-			URL:      urlStr,
-			Original: original,
-			ModTime:  modTime,
-		})
+		return
 	}
-
-	// 文件夹排前，名字排序
-	sort.Slice(list, func(i, j int) bool {
-		if list[i].IsDir != list[j].IsDir {
-			return list[i].IsDir
+	if *daemon {
+		if err := daemonize(*logFile); err != nil {
+			log.Fatalf("Failed to start in background: %v", err)
 		}
-		return list[i].Name < list[j].Name
-	})
-
-	// 计算上级目录
-	current := strings.TrimSuffix(r.URL.Path, "/")
-	parent := ""
-	if current != "" && current != "/" {
-		parent = path.Dir(current) // 使用 path 包，永远 / 分隔
-		if parent == "." || parent == "/" {
-			parent = "/"
-		} else {
-			parent += "/" // 保证最后有 /
+		return
+	}
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			log.Fatalf("Failed to open log file: %v", err)
 		}
+		log.SetOutput(f)
 	}
+	startService()
+	// 管理页面显示最近的日志，可能有管理员时才把 log 包的输出同时写入其中
+	var logs *fileserver.LogBuffer
+	if *configFile != "" || *usersFile != "" {
+		logs = &fileserver.LogBuffer{}
+		log.SetOutput(io.MultiWriter(log.Writer(), logs))
+	}
+	log.Printf("%s %s", progName(), buildVersion())
 
-	t := template.Must(template.New("dir").Parse(tpl))
-	t.Execute(w, PageData{Files: list, Parent: parent})
-}
-
-func downloadHandler(w http.ResponseWriter, r *http.Request, root string) {
-	rawPath := r.URL.Path[len("/download"):] // 去掉 /download 前缀
-	decodedPath, err := url.PathUnescape(rawPath)
+	if len(listenAddrs) == 0 {
+		listenAddrs = stringList{":" + *port}
+	}
+	var addrs []listenAddr
+	for _, v := range listenAddrs {
+		addrs = append(addrs, parseListen(v, *tlsCert != ""))
+	}
+	// 由 systemd 启动时使用它传入的 socket，-listen 和 -port 不再生效
+	inherited, inheritedAddrs, err := systemdListeners(*tlsCert != "")
 	if err != nil {
-		http.Error(w, "Invalid file name", http.StatusBadRequest)
-		return
+		log.Fatal(err)
 	}
-
-	dir := root + decodedPath
-
-	// filepath.Clean 函数用于清理路径字符串。它会规范化文件路径，去除路径中的冗余部分，比如多余的 . 和 .. 目录元素.
-	filePath := filepath.Clean(dir)
-	// os.Stat 函数用于获取指定文件或目录的状态信息（FileInfo）
-	info, err := os.Stat(filePath)
-	if err != nil || info.IsDir() {
-		http.Error(w, "File not found", http.StatusNotFound)
-		return
+	if inherited != nil {
+		addrs = inheritedAddrs
+		log.Printf("Using %d socket(s) passed by systemd", len(inherited))
 	}
-
-	log.Println(filePath)
-
-	w.Header().Set("Content-Disposition", `attachment; filename="`+info.Name()+`"`)
-	http.ServeFile(w, r, filePath)
-}
-
-func viewHandler(w http.ResponseWriter, r *http.Request, root string) {
-	rawPath := r.URL.Path[len("/view"):]
-	decodedPath, err := url.PathUnescape(rawPath)
+	sockMode, err := strconv.ParseUint(*socketMode, 8, 32)
 	if err != nil {
-		http.Error(w, "Invalid file name", http.StatusBadRequest)
-		return
+		log.Fatalf("Invalid -socket-mode %q", *socketMode)
 	}
-
-	filePath := filepath.Clean(root + decodedPath)
-	info, err := os.Stat(filePath)
-	if err != nil || info.IsDir() {
-		http.Error(w, "File not found", http.StatusNotFound)
-		return
+	protected := make(map[string]string)
+	for _, p := range protect {
+		dir, pw, ok := strings.Cut(p, "=")
+		if !ok || pw == "" {
+			log.Fatalf("Invalid -protect %q, expected /path=password", p)
+		}
+		protected[dir] = pw
 	}
 
-	// 自动检测 MIME 类型
-	f, err := os.Open(filePath)
+	if *imageCache == "" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			*imageCache = filepath.Join(dir, "Go-Download-Static-Files", "images")
+		}
+	}
+	cfg := fileserver.Config{
+		Root:                   *rootDir,
+		Mode:                   *mode,
+		Theme:                  *theme,
+		Lang:                   *lang,
+		Checksum:               *checksum,
+		BasePath:               *basePath,
+		SPA:                    *spa,
+		ServeIndex:             *serveIndex,
+		LiveReload:             *liveReload,
+		Template:               *tplFile,
+		ErrorPages:             *errorPages,
+		DisableCompression:     !*compression,
+		DisableSecurityHeaders: !*security,
+		DisableListingCache:    *noCache,
+		DisableDirSizes:        !*dirSizes,
+		Index:                  *index,
+		IndexInterval:          *indexInterval,
+		AccessLog:              true,
+		ShareSecret:            *shareSecret,
+		ShareDB:                *shareDB,
+		StatsDB:                *statsDB,
+		AuditLog:               *auditLog,
+		DisableTrash:           !*trash,
+		TrashRetention:         *trashRetention,
+		Versions:               *versions,
+		Dedupe:                 *dedupe,
+		Clamd:                  *clamd,
+		ScanCommand:            *scanCommand,
+		Quarantine:             *quarantine,
+		FollowSymlinks:         *followSymlinks,
+		FilenameEncoding:       *filenameEncoding,
+		HideGPS:                !*exifGPS,
+		ImageCache:             *imageCache,
+		StripEXIF:              *stripEXIF,
+		Sitemap:                *sitemap,
+		SitemapExclude:         sitemapExclude,
+		Robots:                 *robots,
+		RobotsTag:              *robotsTag,
+		StatsRetention:         *statsRetention,
+		ConfigFile:             *configFile,
+		UsersFile:              *usersFile,
+		APIToken:               *apiToken,
+		Logs:                   logs,
+		Protect:                protected,
+		AllowIPs:               allowIP,
+		DenyIPs:                denyIP,
+		TrustedProxies:         trustedProxy,
+		PublicURL:              *publicURL,
+		CORSMethods:            *corsMethods,
+		CORSHeaders:            *corsHeaders,
+		CacheControl:           cacheRules,
+		MimeTypes:              mimeTypes,
+		MaxUpload:              int64(maxUpload),
+		MaxBody:                int64(maxBody),
+		Quota:                  int64(quota),
+		MaxExtract:             int64(maxExtract),
+		Version:                buildVersion(),
+	}
+	if strings.HasPrefix(*rootDir, "s3://") {
+		fsys, err := fileserver.NewS3FS(*rootDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.Root, cfg.FS = "", fsys
+	} else if strings.HasPrefix(*rootDir, "sftp://") {
+		fsys, err := fileserver.NewSFTPFS(*rootDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.Root, cfg.FS = "", fsys
+	}
+	if *corsOrigins != "" {
+		cfg.CORSOrigins = strings.Split(*corsOrigins, ",")
+	}
+	for _, a := range addrs {
+		if isUnixAddr(a.addr) {
+			cfg.TrustUnixSocket = true
+		}
+	}
+	h, err := fileserver.New(cfg)
 	if err != nil {
-		http.Error(w, "Failed to open file", http.StatusInternalServerError)
-		return
+		log.Fatal(err)
+	}
+	defer h.Close()
+	base := h.BasePath()
+	if h.Root() != "" {
+		log.Printf("Serving files from: %s\n", h.Root())
+	} else if u, err := url.Parse(*rootDir); err == nil {
+		// 不在日志中输出 sftp:// 地址里的密码
+		log.Printf("Serving files from: %s\n", u.Redacted())
+	}
+	if *tplFile != "" {
+		log.Printf("Using template: %s\n", *tplFile)
 	}
-	defer f.Close()
-
-	// 读取前 512 字节判断类型
-	buf := make([]byte, 512)
-	n, _ := f.Read(buf)
-	contentType := http.DetectContentType(buf[:n])
-
-	// 重置读取位置
-	f.Seek(0, io.SeekStart)
-
-	// 设置为 inline 显示
-	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Content-Disposition", `inline; filename="`+info.Name()+`"`)
-
-	io.Copy(w, f)
-}
-
-/*
-编译：
-go build -o FileServer.exe goDemo2/Go-Download-Static-Files/version4
-
-运行：
-Go-Download-Static-Files
-Go-Download-Static-Files -port=8081
-Go-Download-Static-Files --port=8081
-Go-Download-Static-Files --port=8081 -root="D:\temp\seata"
-Go-Download-Static-Files --port=8081 --root="D:\temp\seata"
-
-在 main3.go 上优化
-获取指定目录下的文件，运行在指定端口，默认为 8080 端口
-优化显示样式
-访问：
-http://127.0.0.1:8080
-*/
-func main() {
-	// 定义命令行参数，默认值8080
-	port := flag.String("port", "8080", "Server port")
-	rootDir := flag.String("root", ".", "Root directory to serve files from")
 
-	// 解析用户传入的命令行参数。如果用户没有提供该参数，会使用默认值。
-	flag.Parse()
+	// 只生成分享链接，不启动服务。需要与服务端使用相同的 -share-secret
+	if *sharePath != "" {
+		if *shareSecret == "" {
+			log.Fatal("-share requires -share-secret, the same one the server runs with")
+		}
+		token, err := h.Share(*sharePath, time.Duration(*shareHours*float64(time.Hour)), *shareDownloads)
+		if err != nil {
+			log.Fatalf("Failed to share %s: %v", *sharePath, err)
+		}
+		sharePort := *port
+		for _, a := range addrs {
+			if _, lp, err := net.SplitHostPort(a.addr); err == nil && !isUnixAddr(a.addr) && !a.tls {
+				sharePort = lp
+				break
+			}
+		}
+		printShareURLs(token, sharePort, base)
+		return
+	}
+	if *shareSecret == "" {
+		log.Println("No -share-secret given, share links will stop working after restart")
+	}
+	if *mode == fileserver.ModeReadWrite {
+		log.Println("Read-write mode: files can be uploaded, deleted and renamed")
+	}
 
-	addr := ":" + *port
-	// 绝对路径
-	absRoot, err := filepath.Abs(*rootDir)
-	// 绝对路径，测试
-	//absRoot, err = filepath.Abs("C:\\Users")
+	// 大文件下载可能持续很久，默认只限制读取请求头的时间，空闲连接定时回收
+	srv := &http.Server{
+		Addr:              addrs[0].addr,
+		Handler:           h,
+		ReadTimeout:       *readTimeout,
+		ReadHeaderTimeout: *readHeaderTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+		MaxHeaderBytes:    *maxHeaderBytes,
+		Protocols:         new(http.Protocols),
+	}
+	// HTTP/2 只在 HTTPS 下生效，多个下载可以共用一条连接
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetHTTP2(*enableHTTP2)
 
-	absRoot = strings.ReplaceAll(absRoot, string(os.PathSeparator), "/")
-	if err != nil {
-		log.Fatalf("Failed to get absolute path: %v", err)
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatal("-tls-cert and -tls-key must be given together")
+	}
+	if *clientCA != "" {
+		if *tlsCert == "" {
+			log.Fatal("-client-ca requires -tls-cert and -tls-key")
+		}
+		pem, err := os.ReadFile(*clientCA)
+		if err != nil {
+			log.Fatalf("Failed to read client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			log.Fatalf("No certificates found in %s", *clientCA)
+		}
+		// 握手阶段就拒绝没有合法证书的客户端
+		srv.TLSConfig = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
 	}
-	log.Printf("Serving files from: %s\n", absRoot)
 
-	// 文件下载处理
-	http.HandleFunc("/download/", func(w http.ResponseWriter, r *http.Request) {
-		downloadHandler(w, r, absRoot)
-	})
+	for _, a := range addrs {
+		if a.tls && *tlsCert == "" {
+			log.Fatalf("%s: HTTPS requires -tls-cert and -tls-key", a.addr)
+		}
+	}
 
-	// 文件查看处理
-	http.HandleFunc("/view/", func(w http.ResponseWriter, r *http.Request) {
-		viewHandler(w, r, absRoot)
-	})
+	// 先全部监听成功再开始服务，任何一个地址出错都直接退出
+	listeners := inherited
+	if listeners == nil {
+		for i, a := range addrs {
+			ln, err := listenRetry(a.addr, os.FileMode(sockMode), *portRetry)
+			if err != nil {
+				log.Fatalf("Failed to listen on %s: %v", a.addr, err)
+			}
+			// 端口被占用换了端口，或者 -port 0 由系统分配时，后面打印的地址使用实际端口
+			if !isUnixAddr(a.addr) {
+				addrs[i].addr = ln.Addr().String()
+			}
+			listeners = append(listeners, ln)
+		}
+	}
 
-	// 根目录文件处理
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		handler(w, r, absRoot)
-	})
+	if *enableHTTP3 {
+		// HTTP/3 使用第一个 HTTPS 端口对应的 UDP 端口
+		i := slices.IndexFunc(addrs, func(a listenAddr) bool { return a.tls && !isUnixAddr(a.addr) })
+		if i < 0 {
+			log.Fatal("-http3 requires an HTTPS (-tls-cert / -tls-key) TCP listen address")
+		}
+		srv.Addr = addrs[i].addr
+		srv.Handler = startHTTP3(srv, *tlsCert, *tlsKey)
+	}
+	if *pidFile != "" {
+		if err := os.WriteFile(*pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+			log.Fatalf("Failed to write pidfile: %v", err)
+		}
+		defer os.Remove(*pidFile)
+	}
+	errc := make(chan error, len(addrs)+2)
+	for i, a := range addrs {
+		if a.tls {
+			log.Printf("Serving HTTPS on %s\n", a.addr)
+			go func() { errc <- srv.ServeTLS(listeners[i], *tlsCert, *tlsKey) }()
+		} else {
+			log.Printf("Serving on %s\n", a.addr)
+			go func() { errc <- srv.Serve(listeners[i]) }()
+		}
+	}
+	if *ftpAddr != "" {
+		conf := fileserver.FTPConfig{PassivePorts: *ftpPassive, PublicIP: *ftpPublicIP, Writable: *ftpWrite, RequireTLS: *ftpTLS}
+		if *tlsCert != "" {
+			cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+			if err != nil {
+				log.Fatalf("Failed to load TLS certificate: %v", err)
+			}
+			conf.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		} else if *ftpTLS {
+			log.Fatal("-ftp-tls requires -tls-cert and -tls-key")
+		}
+		ln, err := net.Listen("tcp", *ftpAddr)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %v", *ftpAddr, err)
+		}
+		log.Printf("Serving FTP on %s\n", ln.Addr())
+		go func() { errc <- h.ServeFTP(ln, conf) }()
+	}
+	if *sftpAddr != "" {
+		conf := fileserver.SFTPServerConfig{HostKey: *sftpHostKey, AuthorizedKeys: *sftpKeys, Writable: *sftpWrite}
+		if conf.HostKey == "" {
+			dir, err := os.UserConfigDir()
+			if err != nil {
+				log.Fatalf("Failed to locate the SSH host key, use -sftp-host-key: %v", err)
+			}
+			conf.HostKey = filepath.Join(dir, "Go-Download-Static-Files", "ssh_host_ed25519_key")
+		}
+		ln, err := net.Listen("tcp", *sftpAddr)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %v", *sftpAddr, err)
+		}
+		log.Printf("Serving SFTP on %s\n", ln.Addr())
+		go func() { errc <- h.ServeSFTP(ln, conf) }()
+	}
+	if *mdns {
+		m, err := advertise(*mdnsName, addrs, base)
+		if err != nil {
+			log.Printf("Failed to start mDNS: %v", err)
+		} else {
+			log.Printf("Advertising %q via mDNS", *mdnsName)
+			defer m.Shutdown()
+		}
+	}
+	if *natMap {
+		log.Printf("Requesting a port mapping from the router...")
+		u, cleanup, err := mapPort(addrs, base)
+		if err != nil {
+			log.Printf("Failed to map port on the router: %v", err)
+		} else {
+			log.Printf("Reachable from the internet at %s", u)
+			defer cleanup()
+		}
+	}
+	urls := serverURLs(addrs, base)
+	for _, u := range urls {
+		log.Printf("Available at %s", u)
+	}
+	if *openURL && len(urls) > 0 {
+		if err := openBrowser(urls[0]); err != nil {
+			log.Printf("Failed to open browser: %v", err)
+		}
+	}
 
-	log.Printf("Serving on %s\n", addr)
-	log.Fatal(http.ListenAndServe(addr, nil))
+	stop := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}
+	if err := waitServer(errc, stop); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/grandcat/zeroconf"
+)
+
+// mDNS / Bonjour：-mdns 在局域网内广播 _http._tcp 服务，手机、Mac 的文件浏览器和浏览器插件
+// 可以直接发现 "Files on <主机名>"，不用输入 IP 地址
+
+// defaultMDNSName 返回默认的服务实例名
+func defaultMDNSName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	return "Files on " + host
+}
+
+// advertise 广播第一个 TCP 监听地址，返回的服务需要在退出前 Shutdown
+func advertise(name string, addrs []listenAddr, base string) (*zeroconf.Server, error) {
+	for _, a := range addrs {
+		if isUnixAddr(a.addr) {
+			continue
+		}
+		_, p, err := net.SplitHostPort(a.addr)
+		if err != nil {
+			continue
+		}
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			continue
+		}
+		service := "_http._tcp"
+		if a.tls {
+			service = "_https._tcp"
+		}
+		// path 是 DNS-SD 中 http 服务约定的 TXT 字段
+		return zeroconf.Register(name, service, "local.", port, []string{"path=" + base + "/"}, nil)
+	}
+	return nil, fmt.Errorf("no TCP listen address to advertise")
+}
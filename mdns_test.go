@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grandcat/zeroconf"
+)
+
+func TestAdvertise(t *testing.T) {
+	if !strings.HasPrefix(defaultMDNSName(), "Files on ") {
+		t.Errorf("defaultMDNSName() = %q", defaultMDNSName())
+	}
+	if _, err := advertise("x", []listenAddr{{addr: "unix:/run/fileserver.sock"}}, ""); err == nil {
+		t.Error("advertising without a TCP address succeeded")
+	}
+
+	name := "Files test " + time.Now().Format("150405.000")
+	srv, err := advertise(name, []listenAddr{{addr: "unix:/tmp/x.sock"}, {addr: ":8443", tls: true}}, "/files")
+	if err != nil {
+		t.Skipf("mDNS is not available: %v", err)
+	}
+	defer srv.Shutdown()
+
+	resolver, err := zeroconf.NewResolver(nil)
+	if err != nil {
+		t.Skipf("mDNS is not available: %v", err)
+	}
+	entries := make(chan *zeroconf.ServiceEntry)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := resolver.Lookup(ctx, name, "_https._tcp", "local.", entries); err != nil {
+		t.Skipf("mDNS is not available: %v", err)
+	}
+	select {
+	case e := <-entries:
+		if e.Port != 8443 || len(e.Text) != 1 || e.Text[0] != "path=/files/" {
+			t.Errorf("entry port %d, text %q", e.Port, e.Text)
+		}
+	case <-ctx.Done():
+		t.Skip("no mDNS response, multicast is probably blocked")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/huin/goupnp/dcps/internetgateway2"
+	"github.com/jackpal/gateway"
+	natpmp "github.com/jackpal/go-nat-pmp"
+)
+
+// 路由器端口映射（-nat）：通过 NAT-PMP（苹果路由器等）或 UPnP IGD（大多数家用路由器）请求把外网端口转发到本机，
+// 启动时打印外网地址，方便临时把文件分享给局域网以外的人。运行期间定时续期，正常退出时删除映射
+
+const natLease = time.Hour
+
+// portMapper 是一种端口映射协议
+type portMapper interface {
+	name() string
+	externalIP() (string, error)
+	// addMapping 请求映射，返回实际的外网端口
+	addMapping(port int, lease time.Duration) (int, error)
+	deleteMapping(port int) error
+}
+
+type natpmpMapper struct {
+	c *natpmp.Client
+}
+
+func (m natpmpMapper) name() string {
+	return "NAT-PMP"
+}
+
+func (m natpmpMapper) externalIP() (string, error) {
+	res, err := m.c.GetExternalAddress()
+	if err != nil {
+		return "", err
+	}
+	return net.IP(res.ExternalIPAddress[:]).String(), nil
+}
+
+func (m natpmpMapper) addMapping(port int, lease time.Duration) (int, error) {
+	res, err := m.c.AddPortMappingWithDuration("tcp", port, port, lease)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.MappedExternalPort), nil
+}
+
+func (m natpmpMapper) deleteMapping(port int) error {
+	_, err := m.c.AddPortMapping("tcp", port, 0, 0)
+	return err
+}
+
+// igdClient 是 WANIPConnection1/2、WANPPPConnection1 共有的方法
+type igdClient interface {
+	AddPortMapping(remoteHost string, externalPort uint16, protocol string, internalPort uint16, internalClient string, enabled bool, description string, lease uint32) error
+	DeletePortMapping(remoteHost string, externalPort uint16, protocol string) error
+	GetExternalIPAddress() (string, error)
+}
+
+type upnpMapper struct {
+	c       igdClient
+	localIP string
+}
+
+func (m upnpMapper) name() string {
+	return "UPnP"
+}
+
+func (m upnpMapper) externalIP() (string, error) {
+	return m.c.GetExternalIPAddress()
+}
+
+func (m upnpMapper) addMapping(port int, lease time.Duration) (int, error) {
+	err := m.c.AddPortMapping("", uint16(port), "TCP", uint16(port), m.localIP, true, "Go-Download-Static-Files", uint32(lease.Seconds()))
+	return port, err
+}
+
+func (m upnpMapper) deleteMapping(port int) error {
+	return m.c.DeletePortMapping("", uint16(port), "TCP")
+}
+
+// discoverMapper 先尝试 NAT-PMP，再尝试 UPnP
+func discoverMapper() (portMapper, error) {
+	gw, err := gateway.DiscoverGateway()
+	if err == nil {
+		m := natpmpMapper{natpmp.NewClientWithTimeout(gw, 2*time.Second)}
+		if _, err := m.externalIP(); err == nil {
+			return m, nil
+		}
+	}
+	localIP, err := gateway.DiscoverInterface()
+	if err != nil {
+		return nil, fmt.Errorf("no default gateway: %w", err)
+	}
+	if clients, _, err := internetgateway2.NewWANIPConnection2Clients(); err == nil && len(clients) > 0 {
+		return upnpMapper{clients[0], localIP.String()}, nil
+	}
+	if clients, _, err := internetgateway2.NewWANIPConnection1Clients(); err == nil && len(clients) > 0 {
+		return upnpMapper{clients[0], localIP.String()}, nil
+	}
+	if clients, _, err := internetgateway2.NewWANPPPConnection1Clients(); err == nil && len(clients) > 0 {
+		return upnpMapper{clients[0], localIP.String()}, nil
+	}
+	return nil, errors.New("router supports neither NAT-PMP nor UPnP")
+}
+
+// mapPort 映射第一个 TCP 监听端口，返回外网地址和退出时调用的清理函数
+func mapPort(addrs []listenAddr, base string) (string, func(), error) {
+	var a listenAddr
+	port := 0
+	for _, a = range addrs {
+		if isUnixAddr(a.addr) {
+			continue
+		}
+		if _, p, err := net.SplitHostPort(a.addr); err == nil {
+			port, _ = strconv.Atoi(p)
+			break
+		}
+	}
+	if port == 0 {
+		return "", nil, errors.New("no TCP listen address to map")
+	}
+
+	m, err := discoverMapper()
+	if err != nil {
+		return "", nil, err
+	}
+	ip, err := m.externalIP()
+	if err != nil {
+		return "", nil, err
+	}
+	external, err := m.addMapping(port, natLease)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s port mapping failed: %w", m.name(), err)
+	}
+
+	// 租期过半时续期
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(natLease / 2)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if _, err := m.addMapping(port, natLease); err != nil {
+					log.Printf("Failed to renew %s port mapping: %v", m.name(), err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	cleanup := func() {
+		close(done)
+		m.deleteMapping(port)
+	}
+
+	scheme := "http"
+	if a.tls {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(ip, strconv.Itoa(external)) + base + "/", cleanup, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeIGD 记录 upnpMapper 发给路由器的请求
+type fakeIGD struct {
+	mapped map[uint16]string
+	lease  uint32
+}
+
+func (c *fakeIGD) AddPortMapping(remoteHost string, externalPort uint16, protocol string, internalPort uint16, internalClient string, enabled bool, description string, lease uint32) error {
+	c.mapped[externalPort] = internalClient
+	c.lease = lease
+	return nil
+}
+
+func (c *fakeIGD) DeletePortMapping(remoteHost string, externalPort uint16, protocol string) error {
+	delete(c.mapped, externalPort)
+	return nil
+}
+
+func (c *fakeIGD) GetExternalIPAddress() (string, error) {
+	return "203.0.113.7", nil
+}
+
+func TestUPnPMapper(t *testing.T) {
+	igd := &fakeIGD{mapped: make(map[uint16]string)}
+	var m portMapper = upnpMapper{igd, "192.168.1.5"}
+	if ip, err := m.externalIP(); err != nil || ip != "203.0.113.7" {
+		t.Errorf("externalIP = %q, %v", ip, err)
+	}
+	if port, err := m.addMapping(8080, natLease); err != nil || port != 8080 {
+		t.Fatalf("addMapping = %d, %v", port, err)
+	}
+	if igd.mapped[8080] != "192.168.1.5" || igd.lease != uint32(time.Hour.Seconds()) {
+		t.Errorf("mapping %v, lease %d", igd.mapped, igd.lease)
+	}
+	m.deleteMapping(8080)
+	if len(igd.mapped) != 0 {
+		t.Errorf("mapping was not deleted: %v", igd.mapped)
+	}
+}
+
+func TestMapPortNoTCP(t *testing.T) {
+	if _, _, err := mapPort([]listenAddr{{addr: "unix:/run/fileserver.sock"}}, ""); err == nil {
+		t.Error("mapping without a TCP address succeeded")
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Windows 以外的系统请使用 systemd 等管理服务，见 README
+
+func controlService(cmd string, args []string) error {
+	return errors.New("-service is only supported on Windows")
+}
+
+func startService() {}
+
+// waitServer 等待服务结束，收到 SIGINT、SIGTERM 时停止服务并正常返回，pidfile 等随之清理
+func waitServer(errc <-chan error, stop func()) error {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-errc:
+		return err
+	case <-sig:
+		stop()
+		return nil
+	}
+}
@@ -0,0 +1,142 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// Windows 服务：-service install 把当前命令行（去掉 -service）注册为开机自动启动的服务，
+// 之后用 -service start|stop|remove 控制。作为服务运行时日志写入 Windows 事件日志
+
+const serviceName = "Go-Download-Static-Files"
+
+// controlService 处理 -service 子命令，需要管理员权限
+func controlService(cmd string, args []string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager (run as administrator): %w", err)
+	}
+	defer m.Disconnect()
+
+	if cmd == "install" {
+		return installService(m, args)
+	}
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+
+	switch cmd {
+	case "start":
+		return s.Start()
+	case "stop":
+		_, err := s.Control(svc.Stop)
+		return err
+	case "remove":
+		s.Control(svc.Stop)
+		if err := s.Delete(); err != nil {
+			return err
+		}
+		eventlog.Remove(serviceName)
+		return nil
+	}
+	return fmt.Errorf("unknown -service command %q, expected install, start, stop or remove", cmd)
+}
+
+func installService(m *mgr.Mgr, args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", serviceName)
+	}
+	// 服务的工作目录是 System32，没有指定 -root 时使用安装时的当前目录
+	if !hasFlag(args, "root") {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		args = append(args, "-root="+wd)
+	}
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "Go Download Static Files",
+		Description: "Static file server",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		log.Printf("Failed to register event log source: %v", err)
+	}
+	log.Printf("Installed service %s: %s %s", serviceName, filepath.Base(exe), strings.Join(args, " "))
+	return nil
+}
+
+// eventWriter 把 log 的输出写入事件日志
+type eventWriter struct {
+	elog *eventlog.Log
+}
+
+func (w eventWriter) Write(b []byte) (int, error) {
+	return len(b), w.elog.Info(1, strings.TrimSpace(string(b)))
+}
+
+// startService 在作为服务运行时把日志转到事件日志
+func startService() {
+	if isService, _ := svc.IsWindowsService(); !isService {
+		return
+	}
+	if elog, err := eventlog.Open(serviceName); err == nil {
+		log.SetOutput(eventWriter{elog})
+		log.SetFlags(0)
+	}
+}
+
+// winService 实现 svc.Handler，收到停止请求后调用 stop
+type winService struct {
+	errc <-chan error
+	stop func()
+}
+
+func (h *winService) Execute(args []string, r <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case err := <-h.errc:
+			log.Printf("Server stopped: %v", err)
+			return false, 1
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				status <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending, WaitHint: uint32((10 * time.Second).Milliseconds())}
+				h.stop()
+				return false, 0
+			}
+		}
+	}
+}
+
+// waitServer 等待服务结束。作为 Windows 服务运行时由服务管理器控制启停
+func waitServer(errc <-chan error, stop func()) error {
+	if isService, _ := svc.IsWindowsService(); !isService {
+		return <-errc
+	}
+	return svc.Run(serviceName, &winService{errc: errc, stop: stop})
+}
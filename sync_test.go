@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/somnro/Go-Download-Static-Files/fileserver"
+)
+
+func newSyncer(t *testing.T, root string, del bool) *syncer {
+	t.Helper()
+	h, err := fileserver.New(fileserver.Config{Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return &syncer{server: u, delete: del, client: srv.Client()}
+}
+
+func TestSync(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	remote, local := t.TempDir(), t.TempDir()
+	os.MkdirAll(filepath.Join(remote, "sub dir"), 0755)
+	os.WriteFile(filepath.Join(remote, "a.txt"), []byte("hello"), 0644)
+	os.WriteFile(filepath.Join(remote, "sub dir", "b#1.txt"), []byte("world"), 0644)
+
+	s := newSyncer(t, remote, true)
+	if err := s.syncDir("/", local); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(local, "sub dir", "b#1.txt")); string(b) != "world" {
+		t.Errorf("synced b#1.txt = %q", b)
+	}
+	if s.downloaded != 2 {
+		t.Errorf("downloaded = %d, want 2", s.downloaded)
+	}
+
+	// 第二次同步：没变的跳过，同样内容只是修改时间不同的按校验和跳过，改过的重新下载，远程删除的本地也删除
+	os.Chtimes(filepath.Join(local, "a.txt"), time.Time{}, time.Now().Add(-time.Hour))
+	os.WriteFile(filepath.Join(remote, "sub dir", "b#1.txt"), []byte("WORLD"), 0644)
+	os.Chtimes(filepath.Join(remote, "sub dir", "b#1.txt"), time.Time{}, time.Now().Add(time.Minute))
+	os.WriteFile(filepath.Join(local, "stale.txt"), []byte("old"), 0644)
+	s = newSyncer(t, remote, true)
+	if err := s.syncDir("/", local); err != nil {
+		t.Fatal(err)
+	}
+	if s.downloaded != 1 || s.unchanged != 1 || s.deleted != 1 {
+		t.Errorf("downloaded, unchanged, deleted = %d, %d, %d, want 1, 1, 1", s.downloaded, s.unchanged, s.deleted)
+	}
+	if b, _ := os.ReadFile(filepath.Join(local, "sub dir", "b#1.txt")); string(b) != "WORLD" {
+		t.Errorf("updated b#1.txt = %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(local, "stale.txt")); err == nil {
+		t.Error("stale.txt was not deleted")
+	}
+	remoteInfo, _ := os.Stat(filepath.Join(remote, "a.txt"))
+	if info, _ := os.Stat(filepath.Join(local, "a.txt")); !info.ModTime().Truncate(time.Second).Equal(remoteInfo.ModTime().Truncate(time.Second)) {
+		t.Error("modification time of a.txt was not restored")
+	}
+
+	// 只同步子目录
+	sub := t.TempDir()
+	s = newSyncer(t, remote, false)
+	if err := s.syncDir("/sub dir", sub); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(sub, "b#1.txt")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for name, want := range map[string]bool{"a.txt": true, "中文.txt": true, "": false, ".": false, "..": false, "a/b": false, `..\x`: false} {
+		if got := validName(name); got != want {
+			t.Errorf("validName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/somnro/Go-Download-Static-Files/fileserver"
+)
+
+// usersStdin 是没有 -password 时读取密码的地方，测试中替换
+var usersStdin io.Reader = os.Stdin
+
+// runUsers 管理 -users 用户库：users [flags] <list|add|set|remove> [name]，选项也可以写在操作后面。
+// 服务正在运行时修改会在一秒内生效
+func runUsers(args []string) error {
+	flags := newFlagSet("users", "<list|add|set|remove> [name]")
+	file := flags.String("file", "users.json", "User store file, the server's -users")
+	role := flags.String("role", fileserver.RoleViewer, "Role: "+strings.Join(fileserver.Roles, ", "))
+	root := flags.String("root", "", "Folder the user is limited to, e.g. /alice (default: the whole server)")
+	password := flags.String("password", "", "Password (default: read from standard input)")
+	flags.Parse(args)
+	action := flags.Arg(0)
+	if flags.NArg() > 0 {
+		flags.Parse(flags.Args()[1:])
+	}
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	name := flags.Arg(0)
+	if action == "" || (action != "list" && name == "") || flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	users, err := fileserver.ReadUsersFile(*file)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(users, func(u fileserver.User) bool { return u.Name == name })
+
+	switch action {
+	case "list":
+		for _, u := range users {
+			r := u.Root
+			if r == "" {
+				r = "/"
+			}
+			fmt.Printf("%-16s %-9s %s\n", u.Name, u.Role, r)
+		}
+		return nil
+	case "add":
+		if i >= 0 {
+			return fmt.Errorf("user %s already exists, use set to change it", name)
+		}
+		users = append(users, fileserver.User{Name: name, Role: *role, Root: *root})
+		i = len(users) - 1
+		set["password"] = true
+	case "set":
+		if i < 0 {
+			return fmt.Errorf("no such user: %s", name)
+		}
+		if set["role"] {
+			users[i].Role = *role
+		}
+		if set["root"] {
+			users[i].Root = *root
+		}
+	case "remove":
+		if i < 0 {
+			return fmt.Errorf("no such user: %s", name)
+		}
+		users = slices.Delete(users, i, i+1)
+	default:
+		return fmt.Errorf("unknown action %q, use list, add, set or remove", action)
+	}
+
+	if action != "remove" && set["password"] {
+		pw := *password
+		if pw == "" {
+			if pw, err = readPassword(name); err != nil {
+				return err
+			}
+		}
+		if users[i].Password, err = fileserver.HashPassword(pw); err != nil {
+			return err
+		}
+	}
+	if err := fileserver.WriteUsersFile(*file, users); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Saved %s\n", *file)
+	return nil
+}
+
+// readPassword 从标准输入读取一行密码
+func readPassword(name string) (string, error) {
+	fmt.Fprintf(os.Stderr, "Password for %s: ", name)
+	line, err := bufio.NewReader(usersStdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	pw := strings.TrimRight(line, "\r\n")
+	if pw == "" {
+		return "", errors.New("empty password")
+	}
+	return pw, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/somnro/Go-Download-Static-Files/fileserver"
+)
+
+func TestRunUsers(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "users.json")
+	run := func(args ...string) error {
+		return runUsers(append([]string{"-file", file}, args...))
+	}
+	if err := run("add", "-role", "uploader", "-root", "/alice", "-password", "pw", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	// 没有 -password 时从标准输入读取，选项也可以写在操作前面
+	usersStdin = strings.NewReader("secret\n")
+	t.Cleanup(func() { usersStdin = os.Stdin })
+	if err := run("add", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := run("add", "-password", "x", "bob"); err == nil {
+		t.Error("adding an existing user succeeded")
+	}
+	if err := run("set", "-role", "admin", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := run("set", "-role", "owner", "bob"); err == nil {
+		t.Error("unknown role accepted")
+	}
+
+	out := captureStdout(t, func() error { return run("list") })
+	if !strings.Contains(out, "alice") || !strings.Contains(out, "/alice") || !strings.Contains(out, "admin") {
+		t.Errorf("list = %q", out)
+	}
+	users, err := fileserver.ReadUsersFile(file)
+	if err != nil || len(users) != 2 {
+		t.Fatalf("users = %+v, %v", users, err)
+	}
+	if users[1].Name != "bob" || users[1].Role != fileserver.RoleAdmin || strings.Contains(users[1].Password, "secret") {
+		t.Errorf("bob = %+v", users[1])
+	}
+
+	// 服务端用同一个文件登录
+	h, err := fileserver.New(fileserver.Config{Root: t.TempDir(), UsersFile: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.SetBasicAuth("bob", "secret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("bob login: status = %d", w.Code)
+	}
+
+	if err := run("remove", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if users, _ := fileserver.ReadUsersFile(file); len(users) != 1 {
+		t.Errorf("after remove: %+v", users)
+	}
+}
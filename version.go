@@ -0,0 +1,13 @@
+package main
+
+import "github.com/somnro/Go-Download-Static-Files/fileserver"
+
+// 版本信息在编译时用 -ldflags 写入，没有写入时使用 Go 记录的构建信息：
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse --short HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var version, commit, date string
+
+// buildVersion 返回本程序的版本信息，-version、version 子命令和 /api/version 都使用它
+func buildVersion() fileserver.VersionInfo {
+	return fileserver.VersionInfo{Version: version, Commit: commit, Date: date}.WithBuildInfo()
+}